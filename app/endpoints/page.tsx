@@ -67,7 +67,7 @@ import {
 import AddEndpointModal from "./components/add-endpoint-modal";
 import RenameEndpointModal from "./components/rename-endpoint-modal";
 import EditApiKeyModal from "./components/edit-apikey-modal";
-import { buildApiUrl } from '@/lib/utils';
+import { buildApiUrl, ifMatchHeader } from '@/lib/utils';
 import { copyToClipboard } from '@/lib/utils/clipboard';
 import ManualCopyModal from '@/components/ui/manual-copy-modal';
 import { useGlobalVisibility } from '@/lib/hooks/use-global-visibility';
@@ -101,6 +101,7 @@ interface FormattedEndpoint extends EndpointWithRelations {
   lastCheck: Date;
   lastResponse: string | null;
   ver?: string; // 添加版本字段
+  revision?: number; // 配置修订号，修改时通过 If-Match 携带
 }
 
 interface EndpointFormData {
@@ -674,6 +675,7 @@ export default function EndpointsPage() {
         method: 'PUT',
         headers: {
           'Content-Type': 'application/json',
+          ...ifMatchHeader(selectedEndpoint.revision),
         },
         body: JSON.stringify({
           name: newName,
@@ -682,6 +684,8 @@ export default function EndpointsPage() {
       });
 
       if (!response.ok) {
+        // 主控已被其他人修改时刷新列表，以便基于最新配置重试
+        if (response.status === 412) fetchEndpoints();
         const errorData = await response.json();
         throw new Error(errorData.error || '重命名失败');
       }
@@ -706,15 +710,18 @@ export default function EndpointsPage() {
   // 处理编辑主控
   const handleEdit = async (endpointId: string, data: EndpointFormData) => {
     try {
+      const revision = endpoints.find(ep => String(ep.id) === String(endpointId))?.revision;
       const response = await fetch(buildApiUrl(`/api/endpoints/${endpointId}`), {
         method: 'PUT',
         headers: {
-          'Content-Type': 'application/json'
+          'Content-Type': 'application/json',
+          ...ifMatchHeader(revision),
         },
         body: JSON.stringify(data)
       });
 
       if (!response.ok) {
+        if (response.status === 412) fetchEndpoints();
         const error = await response.json();
         throw new Error(error.message || '更新失败');
       }
@@ -750,6 +757,7 @@ export default function EndpointsPage() {
         method: 'PUT',
         headers: {
           'Content-Type': 'application/json',
+          ...ifMatchHeader(selectedEndpoint.revision),
         },
         body: JSON.stringify({
           apiKey: newApiKey,
@@ -758,6 +766,7 @@ export default function EndpointsPage() {
       });
 
       if (!response.ok) {
+        if (response.status === 412) fetchEndpoints();
         const errorData = await response.json();
         throw new Error(errorData.error || '修改密钥失败');
       }
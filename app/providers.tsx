@@ -29,7 +29,8 @@ declare module "@react-types/shared" {
 export function Providers({ children, themeProps }: ProvidersProps) {
   const router = useRouter();
 
-  // 全局 fetch 补丁：默认添加 credentials:'include'，确保跨端口请求携带 Cookie
+  // 全局 fetch 补丁：默认添加 credentials:'include'，确保跨端口请求携带 Cookie；
+  // 修改类请求附带 X-CSRF-Token（取自后端下发的 csrf_token cookie）
   useEffect(() => {
     if (typeof window === 'undefined') return;
 
@@ -39,6 +40,15 @@ export function Providers({ children, themeProps }: ProvidersProps) {
         credentials: 'include',
         ...init,
       };
+      const method = (newInit.method || (input instanceof Request ? input.method : 'GET')).toUpperCase();
+      if (!['GET', 'HEAD', 'OPTIONS'].includes(method)) {
+        const match = document.cookie.match(/(?:^|;\s*)csrf_token=([^;]+)/);
+        if (match) {
+          const headers = new Headers(newInit.headers || (input instanceof Request ? input.headers : undefined));
+          headers.set('X-CSRF-Token', decodeURIComponent(match[1]));
+          newInit.headers = headers;
+        }
+      }
       return originalFetch(input, newInit);
     };
 
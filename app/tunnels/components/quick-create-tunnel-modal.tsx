@@ -15,7 +15,7 @@ import { useEffect, useState } from "react";
 import { FontAwesomeIcon } from "@fortawesome/react-fontawesome";
 import { faBolt, faEye, faEyeSlash } from "@fortawesome/free-solid-svg-icons";
 import { addToast } from "@heroui/toast";
-import { buildApiUrl } from "@/lib/utils";
+import { buildApiUrl, ifMatchHeader } from "@/lib/utils";
 
 interface EndpointSimple {
   id: string;
@@ -171,7 +171,11 @@ export default function QuickCreateTunnelModal({ isOpen, onOpenChange, onSaved,
       const method = modalMode==='edit' ? 'PUT' : 'POST';
       const res = await fetch(url, {
         method: method,
-        headers: { "Content-Type": "application/json" },
+        headers: {
+          "Content-Type": "application/json",
+          // 编辑时携带配置修订号，实例已被其他人修改时服务端返回 412
+          ...(modalMode==='edit' ? ifMatchHeader(editData?.revision) : {}),
+        },
         body: JSON.stringify({
           endpointId: Number(apiEndpoint),
           name: tunnelName.trim(),
@@ -191,6 +195,7 @@ export default function QuickCreateTunnelModal({ isOpen, onOpenChange, onSaved,
         })
       });
       const data = await res.json();
+      if (res.status === 412) throw new Error('实例已被其他人修改，请关闭后刷新再编辑');
       if (!res.ok || !data.success) throw new Error(data.error || (modalMode==='edit'? '更新失败':'创建失败'));
       addToast({ title: modalMode==='edit' ? '更新成功':'创建成功', description: data.message || '', color: "success" });
       onOpenChange(false);
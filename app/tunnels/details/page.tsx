@@ -36,6 +36,7 @@ import { FontAwesomeIcon } from "@fortawesome/react-fontawesome";
 import { faArrowLeft, faPlay, faPause, faRotateRight, faTrash, faRefresh,faStop, faQuestionCircle, faEye, faEyeSlash, faArrowDown, faDownload, faPen, faRecycle } from "@fortawesome/free-solid-svg-icons";
 import { useRouter } from "next/navigation";
 import { useTunnelActions } from "@/lib/hooks/use-tunnel-actions";
+import { ifMatchHeader, revisionFromResponse } from "@/lib/utils";
 import { addToast } from "@heroui/toast";
 import CellValue from "./cell-value";
 import { FlowTrafficChart } from "@/components/ui/flow-traffic-chart";
@@ -56,6 +57,7 @@ interface TunnelInfo {
   endpoint: string;
   endpointId: string;
   endpointVersion?: string;
+  revision?: number; // 配置修订号，修改时通过 If-Match 携带
   password?: string;
   config: {
     listenPort: number;
@@ -768,16 +770,23 @@ export default function TunnelDetailPage({ params }: { params: Promise<PageParam
       // 调用新的重启策略专用接口
       const response = await fetch(`/api/tunnels/${tunnelInfo.id}/restart`, {
         method: 'PATCH',
-        headers: { 'Content-Type': 'application/json' },
+        headers: { 'Content-Type': 'application/json', ...ifMatchHeader(tunnelInfo.revision) },
         body: JSON.stringify({ restart: newRestartValue }),
       });
 
       const data = await response.json();
       
+      if (response.status === 412) {
+        // 实例已被其他人修改，刷新后由用户重新确认
+        fetchTunnelDetails();
+        throw new Error('实例配置已被其他人修改，已刷新为最新配置');
+      }
       if (response.ok && data.success) {
         // 更新本地状态
+        const revision = revisionFromResponse(response);
         setTunnelInfo(prev => prev ? {
           ...prev,
+          revision,
           config: {
             ...prev.config,
             restart: newRestartValue
@@ -1917,7 +1926,8 @@ export default function TunnelDetailPage({ params }: { params: Promise<PageParam
           min: tunnelInfo.config.min,
           max: tunnelInfo.config.max,
           certPath: tunnelInfo.config.certPath,
-          keyPath: tunnelInfo.config.keyPath
+          keyPath: tunnelInfo.config.keyPath,
+          revision: tunnelInfo.revision
         }}
         onSaved={() => {
           setEditModalOpen(false);
@@ -60,7 +60,7 @@ import { Box, Flex } from "@/components";
 import { TunnelToolBox } from "./components/toolbox";
 import { useTunnelActions } from "@/lib/hooks/use-tunnel-actions";
 import { addToast } from "@heroui/toast";
-import { buildApiUrl } from '@/lib/utils';
+import { buildApiUrl, ifMatchHeader, revisionFromResponse } from '@/lib/utils';
 import { copyToClipboard } from '@/lib/utils/clipboard';
 import ManualCopyModal from '@/components/ui/manual-copy-modal';
 import QuickCreateTunnelModal from "./components/quick-create-tunnel-modal";
@@ -93,6 +93,8 @@ interface Tunnel {
     text: string;
   };
   avatar: string;
+  // 配置修订号，修改时通过 If-Match 携带
+  revision?: number;
   // 客户端模式的连接池配置
   min?: number;
   max?: number;
@@ -930,6 +932,7 @@ export default function TunnelsPage() {
         method: 'PATCH',
         headers: {
           'Content-Type': 'application/json',
+          ...ifMatchHeader(editModalTunnel.revision),
         },
         body: JSON.stringify({
           action: 'rename',
@@ -937,12 +940,25 @@ export default function TunnelsPage() {
         }),
       });
 
+      if (response.status === 412) {
+        // 实例已被其他人修改，使用服务端返回的当前状态
+        const data = await response.json();
+        if (data.tunnel) {
+          setTunnels(prev => prev.map(tunnel =>
+            tunnel.id === editModalTunnel.id
+              ? { ...tunnel, name: data.tunnel.name, revision: data.tunnel.revision }
+              : tunnel
+          ));
+        }
+        throw new Error('实例已被其他人修改，请确认后重试');
+      }
       if (!response.ok) throw new Error('修改名称失败');
 
       // 更新本地状态
+      const revision = revisionFromResponse(response);
       setTunnels(prev => prev.map(tunnel => 
         tunnel.id === editModalTunnel.id 
-          ? { ...tunnel, name: newTunnelName.trim() }
+          ? { ...tunnel, name: newTunnelName.trim(), revision }
           : tunnel
       ));
 
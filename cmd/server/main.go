@@ -4,10 +4,13 @@ import (
 	"NodePassDash/internal/api"
 	"NodePassDash/internal/auth"
 	"NodePassDash/internal/dashboard"
+	appdb "NodePassDash/internal/db"
 	"NodePassDash/internal/endpoint"
 	log "NodePassDash/internal/log"
+	"NodePassDash/internal/secret"
 	"NodePassDash/internal/sse"
 	"NodePassDash/internal/tunnel"
+	"NodePassDash/internal/webhook"
 	"archive/zip"
 	"context"
 	"database/sql"
@@ -133,6 +136,7 @@ func unzip(src, dest string) error {
 func main() {
 	// 命令行参数处理
 	resetPwdCmd := flag.Bool("resetpwd", false, "重置管理员密码")
+	reset2FACmd := flag.String("reset-2fa", "", "关闭指定用户的两步验证（用于丢失认证器时恢复登录）")
 	portFlag := flag.String("port", "", "HTTP 服务端口 (优先级高于环境变量 PORT)，默认 3000")
 	versionFlag := flag.Bool("version", false, "显示版本信息")
 	vFlag := flag.Bool("v", false, "显示版本信息")
@@ -141,7 +145,36 @@ func main() {
 	tlsCertFlag := flag.String("cert", "", "TLS 证书文件路径")
 	tlsKeyFlag := flag.String("key", "", "TLS 私钥文件路径")
 	// 禁用用户名密码登录参数
-	disableLoginFlag := flag.Bool("disable-login", false, "禁用用户名密码登录，仅允许 OAuth2 登录")
+	disableLoginFlag := flag.Bool("disable-login", false, "禁用用户名密码登录，仅允许 OAuth2 或反向代理登录")
+	// 受信任的反向代理，只有来自这些地址的 X-Forwarded-For 才会被采信
+	trustedProxiesFlag := flag.String("trusted-proxies", "", "受信任的反向代理 IP/CIDR，多个以逗号分隔")
+	// 反向代理认证参数，可与 --disable-login 组合使用，由前置 SSO 代理负责登录
+	proxyAuthFlag := flag.Bool("proxy-auth", false, "启用反向代理认证，信任代理传递的用户名 / 邮箱请求头")
+	proxyAuthCIDRsFlag := flag.String("proxy-auth-cidrs", "", "允许传递身份请求头的代理 IP/CIDR，多个以逗号分隔（启用反向代理认证时必填）")
+	proxyAuthUserHeaderFlag := flag.String("proxy-auth-user-header", "", "用户名请求头，默认 X-Forwarded-User")
+	proxyAuthEmailHeaderFlag := flag.String("proxy-auth-email-header", "", "邮箱请求头，默认 X-Forwarded-Email")
+	proxyAuthRoleFlag := flag.String("proxy-auth-default-role", "", "自动创建的反向代理用户的角色 (admin, operator, viewer)，默认 viewer")
+	// LDAP / Active Directory 登录参数
+	ldapURLFlag := flag.String("ldap-url", "", "LDAP 服务器地址，如 ldap://ldap.example.com:389 或 ldaps://ldap.example.com:636，设置后启用 LDAP 登录")
+	ldapBindDNFlag := flag.String("ldap-bind-dn", "", "查找用户使用的服务账户 DN，为空时匿名查找")
+	ldapBindPasswordFlag := flag.String("ldap-bind-password", "", "服务账户密码（建议使用环境变量 LDAP_BIND_PASSWORD）")
+	ldapBaseDNFlag := flag.String("ldap-base-dn", "", "查找用户的 Base DN，如 ou=people,dc=example,dc=org")
+	ldapUserFilterFlag := flag.String("ldap-user-filter", "", "用户过滤器，%s 替换为用户名，默认 (uid=%s)；AD 可使用 (sAMAccountName=%s)")
+	ldapStartTLSFlag := flag.Bool("ldap-starttls", false, "在 ldap:// 连接上启用 StartTLS")
+	ldapInsecureFlag := flag.Bool("ldap-insecure-skip-verify", false, "跳过 LDAP 服务器证书校验（仅用于测试）")
+	ldapCAFileFlag := flag.String("ldap-ca-file", "", "校验 LDAP 服务器证书的 CA 文件（PEM）")
+	ldapGroupAttrFlag := flag.String("ldap-group-attribute", "", "用户所属分组的属性，默认 memberOf")
+	ldapGroupRolesFlag := flag.String("ldap-group-roles", "", "分组到角色的映射，格式为 角色=分组DN，多个以 ; 分隔")
+	ldapDefaultRoleFlag := flag.String("ldap-default-role", "", "未命中分组映射时的角色 (admin, operator, viewer)；配置了分组映射时为空表示拒绝登录，否则默认 viewer")
+	// 跨域与 cookie 安全相关参数
+	allowedOriginsFlag := flag.String("allowed-origins", "", "允许跨域访问的来源，多个以逗号分隔，如 https://dash.example.com；默认仅允许同源")
+	cookieSameSiteFlag := flag.String("cookie-samesite", "", "会话 cookie 的 SameSite 属性 (lax, strict, none)，默认 lax")
+	cookieSecureFlag := flag.Bool("cookie-secure", false, "强制为 cookie 设置 Secure（经 HTTPS 反向代理访问时使用）")
+	// 敏感数据加密相关参数
+	masterKeyFileFlag := flag.String("master-key-file", "", "主密钥文件路径，第一行为当前密钥，其余行为轮换前的旧密钥")
+	genMasterKeyCmd := flag.Bool("gen-master-key", false, "生成一个随机主密钥后退出")
+	decryptSecretsCmd := flag.Bool("decrypt-secrets", false, "将数据库中已加密的敏感数据解密为明文后退出（停用加密前使用）")
+	checkOpenAPICmd := flag.Bool("check-openapi", false, "检查 OpenAPI 文档是否覆盖所有已注册的路由，不一致时以非零状态退出")
 	flag.Parse()
 
 	// 设置日志级别
@@ -164,6 +197,28 @@ func main() {
 		return
 	}
 
+	// 如果指定了 --gen-master-key，则生成主密钥后退出
+	if *genMasterKeyCmd {
+		key, err := secret.GenerateKey()
+		if err != nil {
+			log.Errorf("生成主密钥失败: %v", err)
+			return
+		}
+		fmt.Println(key)
+		return
+	}
+
+	// 加载主密钥
+	// 优先级：命令行参数 > 环境变量 NODEPASS_MASTER_KEY_FILE > 环境变量 NODEPASS_MASTER_KEY
+	masterKeyFile := *masterKeyFileFlag
+	if masterKeyFile == "" {
+		masterKeyFile = os.Getenv("NODEPASS_MASTER_KEY_FILE")
+	}
+	if err := secret.LoadKeys(masterKeyFile); err != nil {
+		log.Errorf("加载主密钥失败: %v", err)
+		return
+	}
+
 	// 解压 dist 目录（如果需要）
 	if err := extractDistIfNeeded(); err != nil {
 		log.Errorf("解压 dist 失败: %v", err)
@@ -185,6 +240,12 @@ func main() {
 		}
 		defer db.Close()
 
+		// 旧版数据库可能尚无用户角色等字段
+		if err := appdb.InitSchema(db); err != nil {
+			log.Errorf("初始化数据库失败: %v", err)
+			return
+		}
+
 		authService := auth.NewService(db)
 		if _, _, err := authService.ResetAdminPassword(); err != nil {
 			log.Errorf("重置密码失败: %v", err)
@@ -192,6 +253,51 @@ func main() {
 		return
 	}
 
+	// 如果指定了 --reset-2fa，则关闭该用户的两步验证后退出
+	if *reset2FACmd != "" {
+		db, err := sql.Open("sqlite3", "file:public/sqlite.db?_journal_mode=WAL&_busy_timeout=5000&_fk=1")
+		if err != nil {
+			log.Errorf("连接数据库失败: %v", err)
+		}
+		defer db.Close()
+
+		// 旧版数据库可能尚无两步验证相关字段
+		if err := appdb.InitSchema(db); err != nil {
+			log.Errorf("初始化数据库失败: %v", err)
+			return
+		}
+
+		authService := auth.NewService(db)
+		if err := authService.ResetTOTP(*reset2FACmd); err != nil {
+			log.Errorf("重置两步验证失败: %v", err)
+			return
+		}
+		fmt.Println("================================")
+		fmt.Println("🔐 两步验证已关闭")
+		fmt.Println("用户名:", *reset2FACmd)
+		fmt.Println("================================")
+		return
+	}
+
+	// 如果指定了 --decrypt-secrets，则将敏感数据解密为明文后退出
+	if *decryptSecretsCmd {
+		db, err := sql.Open("sqlite3", "file:public/sqlite.db?_journal_mode=WAL&_busy_timeout=5000&_fk=1")
+		if err != nil {
+			log.Errorf("连接数据库失败: %v", err)
+		}
+		defer db.Close()
+
+		if err := secret.DecryptAll(db); err != nil {
+			log.Errorf("解密敏感数据失败: %v", err)
+			return
+		}
+		fmt.Println("================================")
+		fmt.Println("🔓 敏感数据已解密为明文")
+		fmt.Println("请在移除主密钥配置后再启动服务，否则会重新加密")
+		fmt.Println("================================")
+		return
+	}
+
 	// 打开数据库连接
 	db, err := sql.Open("sqlite3", "file:public/sqlite.db?_journal_mode=WAL&_busy_timeout=10000&_fk=1&_sync=NORMAL&_cache_size=1000000")
 	if err != nil {
@@ -206,10 +312,20 @@ func main() {
 	db.SetConnMaxIdleTime(5 * time.Minute) // 空闲连接5分钟后关闭
 
 	// 初始化数据库表结构
-	if err := initDatabase(db); err != nil {
+	if err := appdb.InitSchema(db); err != nil {
 		log.Errorf("初始化数据库失败: %v", err)
 	}
 
+	// 加密存量敏感数据，并将旧主密钥加密的数据迁移到当前主密钥
+	if secret.Enabled() {
+		log.Infof("敏感数据加密已启用，当前主密钥 ID: %s", secret.CurrentKeyID())
+	} else {
+		log.Warnf("未配置主密钥（NODEPASS_MASTER_KEY / --master-key-file），主控 API Key 与隧道密码将以明文存储")
+	}
+	if err := secret.Migrate(db); err != nil {
+		log.Errorf("迁移敏感数据失败: %v", err)
+	}
+
 	// 初始化服务
 	authService := auth.NewService(db)
 	endpointService := endpoint.NewService(db)
@@ -223,6 +339,13 @@ func main() {
 	// 设置Manager引用到Service（避免循环依赖）
 	sseService.SetManager(sseManager)
 
+	// 创建Webhook服务，主控事件经SSE服务转发给订阅方
+	webhookService := webhook.NewService(db)
+	if err := webhookService.Start(); err != nil {
+		log.Errorf("启动Webhook服务失败: %v", err)
+	}
+	sseService.SetWebhooks(webhookService)
+
 	// 适当减少 worker 数量，避免过多并发写入
 	workerCount := runtime.NumCPU()
 	if workerCount > 4 {
@@ -243,7 +366,18 @@ func main() {
 	api.SetVersion(Version)
 
 	// 创建API路由器 (仅处理 /api/*)
-	apiRouter := api.NewRouter(db, sseService, sseManager)
+	apiRouter := api.NewRouter(db, sseService, sseManager, webhookService)
+
+	// 如果指定了 --check-openapi，则检查 OpenAPI 文档后退出
+	if *checkOpenAPICmd {
+		if err := apiRouter.CheckOpenAPI(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Println("OpenAPI 文档已覆盖所有路由")
+		// 后台任务已启动，直接退出以免其在数据库关闭后报错
+		os.Exit(0)
+	}
 
 	// 顶层路由器，用于同时处理 API 和静态资源
 	rootRouter := mux.NewRouter()
@@ -252,6 +386,9 @@ func main() {
 	// 注册 API 路由
 	rootRouter.PathPrefix("/api/").Handler(apiRouter)
 
+	// Prometheus 指标，认证方式与 API 相同
+	rootRouter.Handle("/metrics", apiRouter)
+
 	// 静态文件服务 - 使用解压后的 dist 目录
 	fs := http.FileServer(http.Dir("dist"))
 	rootRouter.PathPrefix("/").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -303,6 +440,93 @@ func main() {
 		log.Errorf("系统初始化失败: %v", err)
 	}
 
+	// 将旧版单管理员账户迁移到用户表
+	if err := authService.EnsureAdminUser(); err != nil {
+		log.Errorf("迁移管理员账户失败: %v", err)
+	}
+
+	// 设置受信任的反向代理
+	// 优先级：命令行参数 > 环境变量
+	trustedProxies := *trustedProxiesFlag
+	if trustedProxies == "" {
+		trustedProxies = os.Getenv("TRUSTED_PROXIES")
+	}
+	if err := auth.SetTrustedProxies(strings.Split(trustedProxies, ",")); err != nil {
+		log.Errorf("设置受信任代理失败: %v", err)
+	} else if trustedProxies != "" {
+		log.Infof("受信任的反向代理: %s", trustedProxies)
+	}
+
+	// 设置跨域来源及 cookie 属性
+	// 优先级：命令行参数 > 环境变量
+	allowedOrigins := *allowedOriginsFlag
+	if allowedOrigins == "" {
+		allowedOrigins = os.Getenv("ALLOWED_ORIGINS")
+	}
+	api.SetAllowedOrigins(strings.Split(allowedOrigins, ","))
+	if allowedOrigins != "" {
+		log.Infof("允许跨域访问的来源: %s", allowedOrigins)
+	}
+	cookieSameSite := *cookieSameSiteFlag
+	if cookieSameSite == "" {
+		cookieSameSite = os.Getenv("COOKIE_SAMESITE")
+	}
+	cookieSecure := *cookieSecureFlag
+	if !cookieSecure {
+		if env := os.Getenv("COOKIE_SECURE"); env == "true" || env == "1" {
+			cookieSecure = true
+		}
+	}
+	if err := api.SetCookieOptions(cookieSameSite, cookieSecure); err != nil {
+		log.Errorf("设置 cookie 属性失败: %v", err)
+	}
+
+	// 设置反向代理认证
+	// 优先级：命令行参数 > 环境变量
+	proxyAuthCfg := auth.ProxyAuthConfig{
+		Enabled:     *proxyAuthFlag,
+		CIDRs:       strings.Split(flagOrEnv(*proxyAuthCIDRsFlag, "PROXY_AUTH_CIDRS"), ","),
+		UserHeader:  flagOrEnv(*proxyAuthUserHeaderFlag, "PROXY_AUTH_USER_HEADER"),
+		EmailHeader: flagOrEnv(*proxyAuthEmailHeaderFlag, "PROXY_AUTH_EMAIL_HEADER"),
+		DefaultRole: auth.Role(flagOrEnv(*proxyAuthRoleFlag, "PROXY_AUTH_DEFAULT_ROLE")),
+	}
+	if !proxyAuthCfg.Enabled {
+		if env := os.Getenv("PROXY_AUTH"); env == "true" || env == "1" {
+			proxyAuthCfg.Enabled = true
+		}
+	}
+	if err := auth.SetProxyAuth(proxyAuthCfg); err != nil {
+		log.Errorf("设置反向代理认证失败，已停用: %v", err)
+	} else if proxyAuthCfg.Enabled {
+		log.Infof("已启用反向代理认证，受信任的代理: %s", strings.Join(proxyAuthCfg.CIDRs, ","))
+	}
+
+	// 设置 LDAP 登录
+	// 优先级：命令行参数 > 环境变量
+	ldapCfg := auth.LDAPConfig{
+		URL:                flagOrEnv(*ldapURLFlag, "LDAP_URL"),
+		BindDN:             flagOrEnv(*ldapBindDNFlag, "LDAP_BIND_DN"),
+		BindPassword:       flagOrEnv(*ldapBindPasswordFlag, "LDAP_BIND_PASSWORD"),
+		BaseDN:             flagOrEnv(*ldapBaseDNFlag, "LDAP_BASE_DN"),
+		UserFilter:         flagOrEnv(*ldapUserFilterFlag, "LDAP_USER_FILTER"),
+		StartTLS:           flagOrEnvBool(*ldapStartTLSFlag, "LDAP_STARTTLS"),
+		InsecureSkipVerify: flagOrEnvBool(*ldapInsecureFlag, "LDAP_INSECURE_SKIP_VERIFY"),
+		CAFile:             flagOrEnv(*ldapCAFileFlag, "LDAP_CA_FILE"),
+		GroupAttribute:     flagOrEnv(*ldapGroupAttrFlag, "LDAP_GROUP_ATTRIBUTE"),
+		DefaultRole:        auth.Role(flagOrEnv(*ldapDefaultRoleFlag, "LDAP_DEFAULT_ROLE")),
+	}
+	ldapCfg.Enabled = ldapCfg.URL != ""
+	groupRoles, err := auth.ParseLDAPGroupRoles(flagOrEnv(*ldapGroupRolesFlag, "LDAP_GROUP_ROLES"))
+	if err == nil {
+		ldapCfg.GroupRoles = groupRoles
+		err = auth.SetLDAP(ldapCfg)
+	}
+	if err != nil {
+		log.Errorf("设置 LDAP 登录失败，已停用: %v", err)
+	} else if ldapCfg.Enabled {
+		log.Infof("已启用 LDAP 登录: %s (Base DN: %s)", ldapCfg.URL, ldapCfg.BaseDN)
+	}
+
 	// 设置 disable-login 配置
 	// 优先级：命令行参数 > 环境变量
 	shouldDisableLogin := *disableLoginFlag
@@ -317,7 +541,7 @@ func main() {
 		if err := authService.SetSystemConfig("disable_login", "true", "禁用用户名密码登录"); err != nil {
 			log.Errorf("设置 disable-login 配置失败: %v", err)
 		} else {
-			log.Infof("已启用 disable-login 模式，仅允许 OAuth2 登录")
+			log.Infof("已启用 disable-login 模式，仅允许 OAuth2 或反向代理登录")
 		}
 	} else {
 		// 如果没有启用 disable-login，确保数据库中的值为 false
@@ -371,6 +595,7 @@ func main() {
 	// 关闭SSE系统
 	sseManager.Close()
 	sseService.Close()
+	webhookService.Close()
 
 	// 优雅关闭HTTP服务器
 	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -383,316 +608,21 @@ func main() {
 	log.Infof("服务器已关闭")
 }
 
-// initDatabase 创建必须的表结构（如不存在）
-func initDatabase(db *sql.DB) error {
-	createEndpointsTable := `
-	CREATE TABLE IF NOT EXISTS "Endpoint" (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		name TEXT NOT NULL UNIQUE,
-		url TEXT NOT NULL UNIQUE,
-		apiPath TEXT NOT NULL,
-		apiKey TEXT NOT NULL,
-		status TEXT NOT NULL DEFAULT 'OFFLINE',
-		color TEXT DEFAULT 'default',
-		lastCheck DATETIME DEFAULT CURRENT_TIMESTAMP,
-		createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
-		updatedAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
-		tunnelCount INTEGER DEFAULT 0,
-		os TEXT DEFAULT '',
-		arch TEXT DEFAULT '',
-		ver TEXT DEFAULT '',
-		log TEXT DEFAULT '',
-		tls TEXT DEFAULT '',
-		crt TEXT DEFAULT '',
-		key_path TEXT DEFAULT '',
-		uptime INTEGER DEFAULT NULL
-	);`
-
-	createTunnelTable := `
-	CREATE TABLE IF NOT EXISTS "Tunnel" (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		name TEXT NOT NULL,
-		endpointId INTEGER NOT NULL,
-		mode TEXT NOT NULL,
-		status TEXT NOT NULL DEFAULT 'stopped',
-		tunnelAddress TEXT NOT NULL,
-		tunnelPort TEXT NOT NULL,
-		targetAddress TEXT NOT NULL,
-		targetPort TEXT NOT NULL,
-		tlsMode TEXT NOT NULL,
-		certPath TEXT,
-		keyPath TEXT,
-		logLevel TEXT NOT NULL DEFAULT 'info',
-		commandLine TEXT NOT NULL,
-		instanceId TEXT,
-		password TEXT DEFAULT '',
-		tcpRx INTEGER DEFAULT 0,
-		tcpTx INTEGER DEFAULT 0,
-		udpRx INTEGER DEFAULT 0,
-		udpTx INTEGER DEFAULT 0,
-		min INTEGER,
-		max INTEGER,
-		restart BOOLEAN DEFAULT FALSE,
-		createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
-		updatedAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
-		lastEventTime DATETIME
-	);`
-
-	createTunnelRecycleTable := `
-	CREATE TABLE IF NOT EXISTS "TunnelRecycle" (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		name TEXT NOT NULL,
-		endpointId INTEGER NOT NULL,
-		mode TEXT NOT NULL,
-		tunnelAddress TEXT NOT NULL,
-		tunnelPort TEXT NOT NULL,
-		targetAddress TEXT NOT NULL,
-		targetPort TEXT NOT NULL,
-		tlsMode TEXT NOT NULL,
-		certPath TEXT,
-		keyPath TEXT,
-		logLevel TEXT NOT NULL DEFAULT 'info',
-		commandLine TEXT NOT NULL,
-		instanceId TEXT,
-		password TEXT DEFAULT '',
-		tcpRx INTEGER DEFAULT 0,
-		tcpTx INTEGER DEFAULT 0,
-		udpRx INTEGER DEFAULT 0,
-		udpTx INTEGER DEFAULT 0,
-		min INTEGER,
-		max INTEGER
-	);`
-
-	createEndpointSSE := `
-	CREATE TABLE IF NOT EXISTS "EndpointSSE" (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		eventType TEXT NOT NULL,
-		pushType TEXT NOT NULL,
-		eventTime DATETIME NOT NULL,
-		endpointId INTEGER NOT NULL,
-		instanceId TEXT NOT NULL,
-		instanceType TEXT,
-		status TEXT,
-		url TEXT,
-		tcpRx INTEGER DEFAULT 0,
-		tcpTx INTEGER DEFAULT 0,
-		udpRx INTEGER DEFAULT 0,
-		udpTx INTEGER DEFAULT 0,
-		logs TEXT,
-		createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
-	);`
-
-	createTunnelLog := `
-	CREATE TABLE IF NOT EXISTS "TunnelOperationLog" (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		tunnelId INTEGER,
-		tunnelName TEXT NOT NULL,
-		action TEXT NOT NULL,
-		status TEXT NOT NULL,
-		message TEXT,
-		createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
-	);`
-
-	createSystemConfig := `
-	CREATE TABLE IF NOT EXISTS "SystemConfig" (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		KEY TEXT NOT NULL UNIQUE,
-		value TEXT NOT NULL,
-		description TEXT,
-		createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
-		updatedAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
-	);`
-
-	createUserSession := `
-	CREATE TABLE IF NOT EXISTS "UserSession" (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		sessionId TEXT NOT NULL UNIQUE,
-		username TEXT NOT NULL,
-		createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
-		expiresAt DATETIME NOT NULL,
-		isActive BOOLEAN NOT NULL DEFAULT 1
-	);`
-
-	// 创建隧道分组表
-	// createTunnelGroups := `
-	// CREATE TABLE IF NOT EXISTS tunnel_groups (
-	// 	id INTEGER PRIMARY KEY AUTOINCREMENT,
-	// 	name TEXT NOT NULL UNIQUE,
-	// 	description TEXT,
-	// 	type TEXT NOT NULL DEFAULT 'custom',
-	// 	color TEXT DEFAULT '#3B82F6',
-	// 	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-	// 	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
-	// );`
-
-	// 创建隧道分组成员表
-	// createTunnelGroupMembers := `
-	// CREATE TABLE IF NOT EXISTS tunnel_group_members (
-	// 	id INTEGER PRIMARY KEY AUTOINCREMENT,
-	// 	group_id INTEGER NOT NULL,
-	// 	tunnel_id TEXT NOT NULL,
-	// 	role TEXT DEFAULT 'member',
-	// 	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-	// 	FOREIGN KEY (group_id) REFERENCES tunnel_groups(id) ON DELETE CASCADE,
-	// 	UNIQUE(group_id, tunnel_id)
-	// );`
-
-	// 创建标签表
-	createTagsTable := `
-	CREATE TABLE IF NOT EXISTS Tags (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		name TEXT NOT NULL UNIQUE,
-		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
-		updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
-	);`
-
-	// 创建隧道标签关联表
-	createTunnelTagsTable := `
-	CREATE TABLE IF NOT EXISTS TunnelTags (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		tunnel_id INTEGER NOT NULL,
-		tag_id INTEGER NOT NULL,
-		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
-		FOREIGN KEY (tunnel_id) REFERENCES "Tunnel"(id) ON DELETE CASCADE,
-		FOREIGN KEY (tag_id) REFERENCES Tags(id) ON DELETE CASCADE,
-		UNIQUE(tunnel_id, tag_id)
-	);`
-
-	// 依次执行创建表 SQL
-	if _, err := db.Exec(createEndpointsTable); err != nil {
-		return err
-	}
-	if _, err := db.Exec(createTunnelTable); err != nil {
-		return err
-	}
-	if _, err := db.Exec(createTunnelRecycleTable); err != nil {
-		return err
-	}
-	if _, err := db.Exec(createEndpointSSE); err != nil {
-		return err
-	}
-	if _, err := db.Exec(createTunnelLog); err != nil {
-		return err
-	}
-	if _, err := db.Exec(createSystemConfig); err != nil {
-		return err
-	}
-	if _, err := db.Exec(createUserSession); err != nil {
-		return err
-	}
-	// if _, err := db.Exec(createTunnelGroups); err != nil {
-	// 	return err
-	// }
-	// if _, err := db.Exec(createTunnelGroupMembers); err != nil {
-	// 	return err
-	// }
-	if _, err := db.Exec(createTagsTable); err != nil {
-		return err
-	}
-	if _, err := db.Exec(createTunnelTagsTable); err != nil {
-		return err
-	}
-
-	// ---- 旧库兼容：为 Tunnel 表添加 min / max 列 ----
-	if err := ensureColumn(db, "Tunnel", "min", "INTEGER"); err != nil {
-		return err
-	}
-	if err := ensureColumn(db, "Tunnel", "max", "INTEGER"); err != nil {
-		return err
-	}
-
-	// ---- 为 Tunnel 表添加密码字段 ----
-	if err := ensureColumn(db, "Tunnel", "password", "TEXT DEFAULT ''"); err != nil {
-		return err
-	}
-
-	// ---- 为 TunnelRecycle 表添加密码字段 ----
-	if err := ensureColumn(db, "TunnelRecycle", "password", "TEXT DEFAULT ''"); err != nil {
-		return err
-	}
-
-	// ---- 为 Endpoint 表添加系统信息字段 ----
-	if err := ensureColumn(db, "Endpoint", "os", "TEXT DEFAULT ''"); err != nil {
-		return err
-	}
-	if err := ensureColumn(db, "Endpoint", "arch", "TEXT DEFAULT ''"); err != nil {
-		return err
-	}
-	if err := ensureColumn(db, "Endpoint", "ver", "TEXT DEFAULT ''"); err != nil {
-		return err
-	}
-	if err := ensureColumn(db, "Endpoint", "log", "TEXT DEFAULT ''"); err != nil {
-		return err
-	}
-	if err := ensureColumn(db, "Endpoint", "tls", "TEXT DEFAULT ''"); err != nil {
-		return err
-	}
-	if err := ensureColumn(db, "Endpoint", "crt", "TEXT DEFAULT ''"); err != nil {
-		return err
-	}
-	if err := ensureColumn(db, "Endpoint", "key_path", "TEXT DEFAULT ''"); err != nil {
-		return err
-	}
-	if err := ensureColumn(db, "Endpoint", "uptime", "INTEGER DEFAULT NULL"); err != nil {
-		return err
-	}
-
-	// ---- 为 Tunnel 表添加 restart 字段 ----
-	if err := ensureColumn(db, "Tunnel", "restart", "BOOLEAN DEFAULT FALSE"); err != nil {
-		return err
-	}
-
-	// ---- 为 TunnelRecycle 表添加 restart 字段 ----
-	if err := ensureColumn(db, "TunnelRecycle", "restart", "BOOLEAN DEFAULT FALSE"); err != nil {
-		return err
-	}
-
-	// ---- 为 EndpointSSE 表添加 alias 和 restart 字段 ----
-	if err := ensureColumn(db, "EndpointSSE", "alias", "TEXT"); err != nil {
-		return err
-	}
-	if err := ensureColumn(db, "EndpointSSE", "restart", "BOOLEAN"); err != nil {
-		return err
-	}
-
-	// ---- 为 Tunnel 表添加 pool 和 ping 字段 ----
-	if err := ensureColumn(db, "Tunnel", "pool", "INTEGER DEFAULT 0"); err != nil {
-		return err
-	}
-	if err := ensureColumn(db, "Tunnel", "ping", "INTEGER DEFAULT 0"); err != nil {
-		return err
-	}
-
-	// ---- 为 EndpointSSE 表添加 pool 和 ping 字段 ----
-	if err := ensureColumn(db, "EndpointSSE", "pool", "INTEGER DEFAULT 0"); err != nil {
-		return err
-	}
-	if err := ensureColumn(db, "EndpointSSE", "ping", "INTEGER DEFAULT 0"); err != nil {
-		return err
+// flagOrEnvBool 命令行开关未开启时读取环境变量（true / 1 表示开启）
+func flagOrEnvBool(flagValue bool, env string) bool {
+	if flagValue {
+		return true
 	}
+	v := os.Getenv(env)
+	return v == "true" || v == "1"
+}
 
-	// ---- 创建分组表索引 ----
-	groupIndexes := []string{
-		// `CREATE INDEX IF NOT EXISTS idx_tunnel_groups_name ON tunnel_groups(name)`,
-		// `CREATE INDEX IF NOT EXISTS idx_tunnel_groups_type ON tunnel_groups(type)`,
-		// `CREATE INDEX IF NOT EXISTS idx_tunnel_groups_created_at ON tunnel_groups(created_at)`,
-		// `CREATE INDEX IF NOT EXISTS idx_tunnel_group_members_group_id ON tunnel_group_members(group_id)`,
-		// `CREATE INDEX IF NOT EXISTS idx_tunnel_group_members_tunnel_id ON tunnel_group_members(tunnel_id)`,
-		// `CREATE INDEX IF NOT EXISTS idx_tunnel_group_members_role ON tunnel_group_members(role)`,
-		`CREATE INDEX IF NOT EXISTS idx_tags_name ON Tags(name)`,
-		`CREATE INDEX IF NOT EXISTS idx_tags_created_at ON Tags(created_at)`,
-		`CREATE INDEX IF NOT EXISTS idx_tunnel_tags_tunnel_id ON TunnelTags(tunnel_id)`,
-		`CREATE INDEX IF NOT EXISTS idx_tunnel_tags_tag_id ON TunnelTags(tag_id)`,
-	}
-
-	for _, indexSQL := range groupIndexes {
-		if _, err := db.Exec(indexSQL); err != nil {
-			log.Errorf("创建分组表索引失败: %v", err)
-			// 索引创建失败不影响程序运行，只记录日志
-		}
+// flagOrEnv 返回命令行参数值，未设置时读取环境变量
+func flagOrEnv(flagValue, env string) string {
+	if flagValue != "" {
+		return flagValue
 	}
-
-	return nil
+	return os.Getenv(env)
 }
 
 // ensureDir 确保目录存在，如果不存在则创建
@@ -703,32 +633,3 @@ func ensureDir(dir string) error {
 	}
 	return nil
 }
-
-// ensureColumn 若列不存在则 ALTER TABLE 添加，幂等安全
-func ensureColumn(db *sql.DB, table, column, typ string) error {
-	rows, err := db.Query(`PRAGMA table_info(` + table + `)`)
-	if err != nil {
-		return err
-	}
-	defer rows.Close()
-
-	var exists bool
-	for rows.Next() {
-		var cid int
-		var name, ctype string
-		var notnull int
-		var dfltValue interface{}
-		var pk int
-		_ = rows.Scan(&cid, &name, &ctype, &notnull, &dfltValue, &pk)
-		if name == column {
-			exists = true
-			break
-		}
-	}
-
-	if !exists {
-		_, err := db.Exec(`ALTER TABLE "` + table + `" ADD COLUMN ` + column + ` ` + typ)
-		return err
-	}
-	return nil
-}
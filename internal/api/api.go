@@ -22,6 +22,6 @@ func SetupRoutes(parent *mux.Router) {
 	}
 
 	// 创建 API Router 并挂载到父级路由器（此处不共享 SSE 实例，传入 nil 即由内部创建）
-	apiRouter := NewRouter(db, nil, nil)
+	apiRouter := NewRouter(db, nil, nil, nil)
 	parent.PathPrefix("/").Handler(apiRouter)
 }
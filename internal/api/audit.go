@@ -0,0 +1,122 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"NodePassDash/internal/audit"
+	log "NodePassDash/internal/log"
+)
+
+// AuditHandler 审计日志查询相关的处理器（仅管理员可访问）
+type AuditHandler struct {
+	auditService *audit.Service
+}
+
+// NewAuditHandler 创建审计日志处理器实例
+func NewAuditHandler(auditService *audit.Service) *AuditHandler {
+	return &AuditHandler{
+		auditService: auditService,
+	}
+}
+
+// HandleAuditLogs 分页查询审计日志
+// GET /api/audit?actor=&action=&targetType=&targetId=&ip=&success=&from=&to=&page=&pageSize=
+// from / to 支持 RFC3339 或 YYYY-MM-DD，action 按前缀匹配
+func (h *AuditHandler) HandleAuditLogs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	q, err := parseAuditQuery(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": err.Error()})
+		return
+	}
+
+	page, err := h.auditService.List(q)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "查询审计日志失败: " + err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"entries":  page.Entries,
+		"total":    page.Total,
+		"page":     page.Page,
+		"pageSize": page.PageSize,
+	})
+}
+
+// HandleExportAuditLogs 以 CSV 格式导出审计日志，过滤条件与 HandleAuditLogs 相同
+// GET /api/audit/export
+func (h *AuditHandler) HandleExportAuditLogs(w http.ResponseWriter, r *http.Request) {
+	q, err := parseAuditQuery(r)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": err.Error()})
+		return
+	}
+
+	filename := "audit-" + time.Now().Format("20060102-150405") + ".csv"
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	// 写入 UTF-8 BOM，便于 Excel 正确识别中文
+	w.Write([]byte("\xEF\xBB\xBF"))
+	if err := h.auditService.ExportCSV(w, q); err != nil {
+		log.Errorf("[审计] 导出审计日志失败: %v", err)
+	}
+}
+
+// parseAuditQuery 从查询参数解析审计日志过滤条件
+func parseAuditQuery(r *http.Request) (audit.Query, error) {
+	v := r.URL.Query()
+	q := audit.Query{
+		Actor:      v.Get("actor"),
+		Action:     v.Get("action"),
+		TargetType: v.Get("targetType"),
+		TargetID:   v.Get("targetId"),
+		IP:         v.Get("ip"),
+	}
+	q.Page, _ = strconv.Atoi(v.Get("page"))
+	q.PageSize, _ = strconv.Atoi(v.Get("pageSize"))
+
+	if s := v.Get("success"); s != "" {
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return q, errors.New("success 参数无效")
+		}
+		q.Success = &b
+	}
+
+	var err error
+	if q.From, err = parseAuditTime(v.Get("from"), false); err != nil {
+		return q, errors.New("from 参数无效")
+	}
+	if q.To, err = parseAuditTime(v.Get("to"), true); err != nil {
+		return q, errors.New("to 参数无效")
+	}
+	return q, nil
+}
+
+// parseAuditTime 解析时间参数；仅给出日期的结束时间包含当天
+func parseAuditTime(s string, end bool) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", s, time.Local)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
@@ -5,12 +5,18 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"math"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
+	"NodePassDash/internal/audit"
 	"NodePassDash/internal/auth"
+	log "NodePassDash/internal/log"
+
+	"github.com/gorilla/mux"
 )
 
 // AuthHandler 认证相关的处理器
@@ -56,11 +62,14 @@ func (h *AuthHandler) HandleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	audit.Action(r, "auth.login", "user", nil)
+
 	var req auth.LoginRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
+	audit.Actor(r, req.Username)
 
 	// 验证用户名和密码不为空
 	if req.Username == "" || req.Password == "" {
@@ -71,8 +80,17 @@ func (h *AuthHandler) HandleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 验证用户身份
+	// 退避或锁定期间直接拒绝，不再校验密码
+	ip := auth.ClientIP(r)
+	attempt, err := h.authService.ReserveLoginAttempt(ip, req.Username)
+	if err != nil {
+		writeLoginThrottled(w, err)
+		return
+	}
+
+	// 验证用户身份，失败时预占的计数即为本次失败记录
 	if !h.authService.AuthenticateUser(req.Username, req.Password) {
+		log.Warnf("[API] 登录失败: username=%s ip=%s", req.Username, ip)
 		w.WriteHeader(http.StatusUnauthorized)
 		json.NewEncoder(w).Encode(auth.LoginResponse{
 			Success: false,
@@ -81,8 +99,66 @@ func (h *AuthHandler) HandleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	attempt.Release()
+
+	// 启用了两步验证的用户需再提交动态码或恢复码
+	if h.authService.IsTOTPEnabled(req.Username) {
+		json.NewEncoder(w).Encode(auth.LoginResponse{
+			Success:           false,
+			Message:           "请输入两步验证码",
+			TwoFactorRequired: true,
+			Challenge:         h.authService.CreateLoginChallenge(req.Username),
+		})
+		return
+	}
+
+	h.completeLogin(w, r, req.Username, req.RememberMe)
+}
+
+// HandleLoginTwoFactor 两步验证登录第二步 (POST /api/auth/login/2fa Body: {challenge, code, rememberMe})
+func (h *AuthHandler) HandleLoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	audit.Action(r, "auth.login_2fa", "user", nil)
+
+	var req auth.TwoFactorLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// 动态码同样计入 IP 失败次数，防止通过大量挑战穷举
+	ip := auth.ClientIP(r)
+	attempt, err := h.authService.ReserveLoginAttempt(ip, "")
+	if err != nil {
+		writeLoginThrottled(w, err)
+		return
+	}
+
+	username, err := h.authService.CompleteLoginChallenge(req.Challenge, req.Code)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(auth.LoginResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+	attempt.Release()
+
+	h.completeLogin(w, r, username, req.RememberMe)
+}
+
+// completeLogin 创建会话并写入 cookie，返回登录成功响应
+func (h *AuthHandler) completeLogin(w http.ResponseWriter, r *http.Request, username string, rememberMe bool) {
+	h.authService.RecordLoginSuccess(username)
+	audit.Actor(r, username)
+
 	// 创建用户会话
-	sessionID, err := h.authService.CreateUserSession(req.Username)
+	session, err := h.authService.CreateUserSession(username, sessionMeta(r, rememberMe))
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(auth.LoginResponse{
@@ -93,14 +169,7 @@ func (h *AuthHandler) HandleLogin(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 设置会话 cookie
-	http.SetCookie(w, &http.Cookie{
-		Name:     "session",
-		Value:    sessionID,
-		Path:     "/",
-		HttpOnly: true,
-		MaxAge:   24 * 60 * 60, // 24小时
-		SameSite: http.SameSiteLaxMode,
-	})
+	setSessionCookie(w, r, session)
 
 	// 返回成功响应
 	json.NewEncoder(w).Encode(auth.LoginResponse{
@@ -109,6 +178,65 @@ func (h *AuthHandler) HandleLogin(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// sessionMeta 收集创建会话时记录的客户端信息
+func sessionMeta(r *http.Request, rememberMe bool) auth.SessionMeta {
+	ua := r.UserAgent()
+	if len(ua) > 512 {
+		ua = ua[:512]
+	}
+	return auth.SessionMeta{IP: auth.ClientIP(r), UserAgent: ua, RememberMe: rememberMe}
+}
+
+// setSessionCookie 写入会话 cookie，有效期与服务端会话的绝对过期时间一致；
+// 同时轮换 CSRF 令牌，避免登录前被植入的令牌继续有效
+func setSessionCookie(w http.ResponseWriter, r *http.Request, session *auth.Session) {
+	http.SetCookie(w, newCookie(r, "session", session.SessionID, int(time.Until(session.ExpiresAt).Seconds()), true))
+	setCSRFCookie(w, r, newCSRFToken())
+}
+
+// writeLoginThrottled 返回 429 并通过 Retry-After 告知客户端需要等待的秒数
+func writeLoginThrottled(w http.ResponseWriter, err error) {
+	if te, ok := err.(*auth.LoginThrottleError); ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(te.RetryAfter.Seconds()))))
+	}
+	w.WriteHeader(http.StatusTooManyRequests)
+	json.NewEncoder(w).Encode(auth.LoginResponse{
+		Success: false,
+		Error:   err.Error(),
+	})
+}
+
+// HandleLoginLockouts 查看登录失败计数与锁定状态 (GET /api/auth/lockouts)
+func (h *AuthHandler) HandleLoginLockouts(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "lockouts": h.authService.ListLoginLockouts()})
+}
+
+// HandleUnlockLogin 手动解除登录锁定 (POST /api/auth/lockouts/unlock Body: {ip, username})
+func (h *AuthHandler) HandleUnlockLogin(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req struct {
+		IP       string `json:"ip"`
+		Username string `json:"username"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || (req.IP == "" && req.Username == "") {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "请指定要解锁的 IP 或用户名"})
+		return
+	}
+
+	audit.Action(r, "auth.unlock", "user", req.Username)
+	audit.After(r, req)
+
+	if !h.authService.UnlockLogin(req.IP, req.Username) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "没有对应的失败记录"})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "message": "已解除锁定"})
+}
+
 // HandleLogout 处理登出请求
 func (h *AuthHandler) HandleLogout(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -116,21 +244,20 @@ func (h *AuthHandler) HandleLogout(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	audit.Action(r, "auth.logout", "user", nil)
+
 	// 获取会话 cookie
 	cookie, err := r.Cookie("session")
 	if err == nil {
+		if sess, ok := h.authService.GetSession(cookie.Value); ok {
+			audit.Actor(r, sess.Username)
+		}
 		// 销毁会话
 		h.authService.DestroySession(cookie.Value)
 	}
 
 	// 清除 cookie
-	http.SetCookie(w, &http.Cookie{
-		Name:     "session",
-		Value:    "",
-		Path:     "/",
-		HttpOnly: true,
-		MaxAge:   -1,
-	})
+	http.SetCookie(w, newCookie(r, "session", "", -1, true))
 
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"success": true,
@@ -169,6 +296,8 @@ func (h *AuthHandler) HandleInitSystem(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	audit.Action(r, "system.init", "system", nil)
+
 	// 检查系统是否已初始化
 	if h.authService.IsSystemInitialized() {
 		w.WriteHeader(http.StatusBadRequest)
@@ -220,8 +349,14 @@ func (h *AuthHandler) HandleGetMe(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	role := auth.RoleViewer
+	if principal, ok := auth.PrincipalFromContext(r.Context()); ok {
+		role = principal.Role
+	}
+
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"username":  session.Username,
+		"role":      role,
 		"expiresAt": session.ExpiresAt,
 	})
 }
@@ -265,6 +400,8 @@ func (h *AuthHandler) HandleChangePassword(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	audit.Action(r, "user.change_password", "user", sess.Username)
+
 	var req PasswordChangeRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		w.WriteHeader(http.StatusBadRequest)
@@ -315,6 +452,9 @@ func (h *AuthHandler) HandleChangeUsername(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	audit.Action(r, "user.change_username", "user", sess.Username)
+	audit.Before(r, map[string]interface{}{"username": sess.Username})
+
 	var req UsernameChangeRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		w.WriteHeader(http.StatusBadRequest)
@@ -328,6 +468,7 @@ func (h *AuthHandler) HandleChangeUsername(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	audit.After(r, map[string]interface{}{"username": req.NewUsername})
 	ok2, msg := h.authService.ChangeUsername(sess.Username, req.NewUsername)
 	if !ok2 {
 		w.WriteHeader(http.StatusBadRequest)
@@ -352,8 +493,13 @@ func (h *AuthHandler) HandleOAuth2Callback(w http.ResponseWriter, r *http.Reques
 	code := r.URL.Query().Get("code")
 	state := r.URL.Query().Get("state")
 
+	// 回调为 GET 请求，需显式要求记录登录结果
+	audit.Force(r)
+	audit.Action(r, "auth.oauth_login", "oauth_provider", provider)
+
 	// state 校验，防止 CSRF
-	if !h.authService.ValidateOAuthState(state) {
+	stateData, ok := h.authService.ConsumeOAuthState(state)
+	if !ok {
 		http.Error(w, "invalid state", http.StatusBadRequest)
 		return
 	}
@@ -375,6 +521,8 @@ func (h *AuthHandler) HandleOAuth2Callback(w http.ResponseWriter, r *http.Reques
 		h.handleGitHubOAuth(w, r, code)
 	case "cloudflare":
 		h.handleCloudflareOAuth(w, r, code)
+	case "oidc":
+		h.handleOIDCCallback(w, r, code, stateData)
 	default:
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"success": false,
@@ -489,40 +637,34 @@ func (h *AuthHandler) handleGitHubOAuth(w http.ResponseWriter, r *http.Request,
 	if err := h.authService.SaveOAuthUser("github", providerID, username, string(dataJSON)); err != nil {
 		fmt.Printf("❌ 保存 GitHub 用户失败: %v\n", err)
 		// 重定向到错误页面而不是返回 HTTP 错误
-		// 使用与配置中相同的 host 进行跳转
-		baseURL := ""
-		if cfg.RedirectURI != "" {
-			baseURL = strings.Replace(cfg.RedirectURI, "/api/oauth2/callback", "", 1)
-		} else {
-			// 回退到基于请求 Host 的拼接
-			scheme := "http"
-			if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
-				scheme = "https"
-			}
-			baseURL = fmt.Sprintf("%s://%s", scheme, r.Host)
-		}
-		errorURL := fmt.Sprintf("%s/oauth-error?error=%s&provider=github",
-			baseURL, url.QueryEscape(err.Error()))
-		http.Redirect(w, r, errorURL, http.StatusFound)
+		redirectOAuthError(w, r, cfg.RedirectURI, "github", err)
+		return
+	}
+
+	// 白名单校验需在自动创建本地用户之前完成
+	profile := h.githubProfile(proxyClient, cfg.UserInfoURL, tokenRes.AccessToken, login, userData)
+	if err := h.authService.AuthorizeOAuthLogin("github", providerID, profile); err != nil {
+		redirectOAuthError(w, r, cfg.RedirectURI, "github", err)
+		return
+	}
+
+	// 映射到本地用户（未映射时按默认角色自动创建并映射，同名本地账户需管理员手动映射）
+	localUser, err := h.authService.ResolveOAuthLogin("github", providerID, username)
+	if err != nil {
+		redirectOAuthError(w, r, cfg.RedirectURI, "github", err)
 		return
 	}
 
 	// 创建会话
-	sessionID, err := h.authService.CreateUserSession(username)
+	audit.Actor(r, localUser)
+	session, err := h.authService.CreateUserSession(localUser, sessionMeta(r, false))
 	if err != nil {
 		http.Error(w, "创建会话失败", http.StatusInternalServerError)
 		return
 	}
 
 	// 设置 cookie
-	http.SetCookie(w, &http.Cookie{
-		Name:     "session",
-		Value:    sessionID,
-		Path:     "/",
-		HttpOnly: true,
-		MaxAge:   24 * 60 * 60,
-		SameSite: http.SameSiteLaxMode,
-	})
+	setSessionCookie(w, r, session)
 
 	// 如果请求携带 redirect 参数或 Accept text/html，则执行页面跳转；否则返回 JSON
 	redirectURL := r.URL.Query().Get("redirect")
@@ -545,6 +687,78 @@ func (h *AuthHandler) handleGitHubOAuth(w http.ResponseWriter, r *http.Request,
 	})
 }
 
+// githubProfile 收集白名单校验需要的 GitHub 账户信息，
+// 仅在白名单包含对应规则时才请求邮箱（需 user:email）与组织 / 团队（需 read:org）接口
+func (h *AuthHandler) githubProfile(client *http.Client, userInfoURL, accessToken, login string, userData map[string]interface{}) auth.OAuthProfile {
+	profile := auth.OAuthProfile{Login: login}
+	if email, ok := userData["email"].(string); ok && email != "" {
+		profile.Emails = append(profile.Emails, email)
+	}
+
+	allowlist, _ := h.authService.GetOAuthAllowlist()
+	apiBase := strings.TrimSuffix(strings.TrimSuffix(userInfoURL, "/"), "/user")
+
+	if allowlist.NeedsEmails() {
+		var emails []struct {
+			Email    string `json:"email"`
+			Verified bool   `json:"verified"`
+		}
+		if err := githubGet(client, apiBase+"/user/emails", accessToken, &emails); err != nil {
+			log.Warnf("[OAuth2] 获取 GitHub 邮箱失败: %v", err)
+		}
+		for _, e := range emails {
+			if e.Verified {
+				profile.Emails = append(profile.Emails, e.Email)
+			}
+		}
+	}
+
+	if allowlist.NeedsGitHubMembership() {
+		var orgs []struct {
+			Login string `json:"login"`
+		}
+		if err := githubGet(client, apiBase+"/user/orgs", accessToken, &orgs); err != nil {
+			log.Warnf("[OAuth2] 获取 GitHub 组织失败: %v", err)
+		}
+		for _, o := range orgs {
+			profile.Orgs = append(profile.Orgs, o.Login)
+		}
+
+		var teams []struct {
+			Slug         string `json:"slug"`
+			Organization struct {
+				Login string `json:"login"`
+			} `json:"organization"`
+		}
+		if err := githubGet(client, apiBase+"/user/teams", accessToken, &teams); err != nil {
+			log.Warnf("[OAuth2] 获取 GitHub 团队失败: %v", err)
+		}
+		for _, t := range teams {
+			profile.Teams = append(profile.Teams, t.Organization.Login+"/"+t.Slug)
+		}
+	}
+	return profile
+}
+
+// githubGet 携带 access token 请求 GitHub API 并解析 JSON
+func githubGet(client *http.Client, url, accessToken string, out interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "token "+accessToken)
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s 返回 %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
 // handleCloudflareOAuth 处理 Cloudflare OAuth2 回调
 func (h *AuthHandler) handleCloudflareOAuth(w http.ResponseWriter, r *http.Request, code string) {
 	// 读取配置
@@ -687,40 +901,36 @@ func (h *AuthHandler) handleCloudflareOAuth(w http.ResponseWriter, r *http.Reque
 	if err := h.authService.SaveOAuthUser("cloudflare", providerID, username, string(dataJSON)); err != nil {
 		fmt.Printf("❌ 保存 Cloudflare 用户失败: %v\n", err)
 		// 重定向到错误页面而不是返回 HTTP 错误
-		// 使用与配置中相同的 host 进行跳转
-		baseURL := ""
-		if cfg.RedirectURI != "" {
-			baseURL = strings.Replace(cfg.RedirectURI, "/api/oauth2/callback", "", 1)
-		} else {
-			// 回退到基于请求 Host 的拼接
-			scheme := "http"
-			if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
-				scheme = "https"
-			}
-			baseURL = fmt.Sprintf("%s://%s", scheme, r.Host)
-		}
-		errorURL := fmt.Sprintf("%s/oauth-error?error=%s&provider=cloudflare",
-			baseURL, url.QueryEscape(err.Error()))
-		http.Redirect(w, r, errorURL, http.StatusFound)
+		redirectOAuthError(w, r, cfg.RedirectURI, "cloudflare", err)
+		return
+	}
+
+	// 映射到本地用户（未映射时按默认角色自动创建并映射，同名本地账户需管理员手动映射）
+	profile := auth.OAuthProfile{Login: login}
+	if email, ok := userData["email"].(string); ok && email != "" {
+		profile.Emails = []string{email}
+	}
+	if err := h.authService.AuthorizeOAuthLogin("cloudflare", providerID, profile); err != nil {
+		redirectOAuthError(w, r, cfg.RedirectURI, "cloudflare", err)
+		return
+	}
+
+	localUser, err := h.authService.ResolveOAuthLogin("cloudflare", providerID, username)
+	if err != nil {
+		redirectOAuthError(w, r, cfg.RedirectURI, "cloudflare", err)
 		return
 	}
 
 	// 创建会话
-	sessionID, err := h.authService.CreateUserSession(username)
+	audit.Actor(r, localUser)
+	session, err := h.authService.CreateUserSession(localUser, sessionMeta(r, false))
 	if err != nil {
 		http.Error(w, "创建会话失败", http.StatusInternalServerError)
 		return
 	}
 
 	// 设置 cookie
-	http.SetCookie(w, &http.Cookie{
-		Name:     "session",
-		Value:    sessionID,
-		Path:     "/",
-		HttpOnly: true,
-		MaxAge:   24 * 60 * 60,
-		SameSite: http.SameSiteLaxMode,
-	})
+	setSessionCookie(w, r, session)
 
 	// 如果请求携带 redirect 参数或 Accept text/html，则执行页面跳转；否则返回 JSON
 	redirectURL := r.URL.Query().Get("redirect")
@@ -749,8 +959,27 @@ type OAuth2ConfigRequest struct {
 	Config   map[string]interface{} `json:"config"`
 }
 
+// redirectOAuthError 重定向到前端 OAuth 错误页面，使用与配置中相同的 host 进行跳转
+func redirectOAuthError(w http.ResponseWriter, r *http.Request, redirectURI, provider string, err error) {
+	audit.Fail(r, err.Error())
+	baseURL := ""
+	if redirectURI != "" {
+		baseURL = strings.Replace(redirectURI, "/api/oauth2/callback", "", 1)
+	} else {
+		// 回退到基于请求 Host 的拼接
+		scheme := "http"
+		if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+			scheme = "https"
+		}
+		baseURL = fmt.Sprintf("%s://%s", scheme, r.Host)
+	}
+	errorURL := fmt.Sprintf("%s/oauth-error?error=%s&provider=%s",
+		baseURL, url.QueryEscape(err.Error()), provider)
+	http.Redirect(w, r, errorURL, http.StatusFound)
+}
+
 // HandleOAuth2Config 读取或保存 OAuth2 配置
-// GET  参数: ?provider=github|cloudflare
+// GET  参数: ?provider=github|cloudflare|oidc
 // POST Body: {provider, config}
 func (h *AuthHandler) HandleOAuth2Config(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
@@ -790,11 +1019,15 @@ func (h *AuthHandler) HandleOAuth2Config(w http.ResponseWriter, r *http.Request)
 		json.NewEncoder(w).Encode(resp)
 
 	case http.MethodPost:
+		audit.Action(r, "oauth_config.update", "config", "oauth2_config")
+		audit.Before(r, h.oauthConfigSnapshot())
+
 		var req OAuth2ConfigRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			http.Error(w, "invalid body", http.StatusBadRequest)
 			return
 		}
+		audit.After(r, map[string]interface{}{"provider": req.Provider, "config": req.Config})
 		if req.Provider == "" {
 			http.Error(w, "missing provider", http.StatusBadRequest)
 			return
@@ -810,6 +1043,9 @@ func (h *AuthHandler) HandleOAuth2Config(w http.ResponseWriter, r *http.Request)
 		json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
 
 	case http.MethodDelete:
+		audit.Action(r, "oauth_config.delete", "config", "oauth2_config")
+		audit.Before(r, h.oauthConfigSnapshot())
+
 		// 解绑：统一清空配置和用户信息
 		_ = h.authService.SetSystemConfig("oauth2_config", "", "清空 OAuth2 配置")
 		_ = h.authService.SetSystemConfig("oauth2_provider", "", "解绑 OAuth2")
@@ -825,6 +1061,17 @@ func (h *AuthHandler) HandleOAuth2Config(w http.ResponseWriter, r *http.Request)
 	}
 }
 
+// oauthConfigSnapshot 读取当前 OAuth2 配置，用于审计日志记录修改前的状态
+func (h *AuthHandler) oauthConfigSnapshot() map[string]interface{} {
+	provider, _ := h.authService.GetSystemConfig("oauth2_provider")
+	cfgStr, _ := h.authService.GetSystemConfig("oauth2_config")
+	var cfg map[string]interface{}
+	if cfgStr != "" {
+		_ = json.Unmarshal([]byte(cfgStr), &cfg)
+	}
+	return map[string]interface{}{"provider": provider, "config": cfg}
+}
+
 // HandleOAuth2Login 生成 state 并重定向到第三方授权页
 func (h *AuthHandler) HandleOAuth2Login(w http.ResponseWriter, r *http.Request) {
 	provider := r.URL.Query().Get("provider")
@@ -837,6 +1084,12 @@ func (h *AuthHandler) HandleOAuth2Login(w http.ResponseWriter, r *http.Request)
 		}
 	}
 
+	// OIDC 通过发现文档获取授权地址，并使用 PKCE
+	if provider == "oidc" {
+		h.handleOIDCLogin(w, r)
+		return
+	}
+
 	// 统一配置存储在 oauth2_config
 	cfgStr, err := h.authService.GetSystemConfig("oauth2_config")
 	if err != nil || cfgStr == "" {
@@ -909,5 +1162,181 @@ func (h *AuthHandler) HandleOAuth2Provider(w http.ResponseWriter, r *http.Reques
 		"success":      true,
 		"provider":     provider,
 		"disableLogin": disableLogin == "true",
+		"proxyAuth":    auth.ProxyAuthEnabled(),
+		"ldap":         auth.LDAPEnabled(),
 	})
 }
+
+// HandleAPITokens 列出或创建 API 令牌
+// GET  /api/auth/tokens
+// POST /api/auth/tokens Body: {name, scopes, expiresAt}
+func (h *AuthHandler) HandleAPITokens(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case http.MethodGet:
+		tokens, err := h.authService.ListAPITokens()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "获取令牌列表失败: " + err.Error()})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "tokens": tokens})
+
+	case http.MethodPost:
+		principal, _ := auth.PrincipalFromContext(r.Context())
+
+		var req auth.CreateAPITokenRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "无效请求体"})
+			return
+		}
+
+		audit.Action(r, "api_token.create", "api_token", nil)
+		raw, token, err := h.authService.CreateAPIToken(principal.Username, req)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": err.Error()})
+			return
+		}
+		audit.Target(r, token.ID)
+		audit.After(r, token)
+
+		// 明文令牌仅在创建时返回一次
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"token":   raw,
+			"info":    token,
+		})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleRevokeAPIToken 吊销 API 令牌 (DELETE /api/auth/tokens/{id})
+func (h *AuthHandler) HandleRevokeAPIToken(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "无效的令牌ID"})
+		return
+	}
+
+	audit.Action(r, "api_token.revoke", "api_token", id)
+	audit.BeforeRow(r, "ApiToken", id)
+
+	if err := h.authService.RevokeAPIToken(id); err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": err.Error()})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "message": "令牌已吊销"})
+}
+
+// HandleTOTPStatus 获取当前用户的两步验证状态 (GET /api/auth/2fa)
+func (h *AuthHandler) HandleTOTPStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	principal, _ := auth.PrincipalFromContext(r.Context())
+
+	status, err := h.authService.GetTOTPStatus(principal.Username)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "status": status})
+}
+
+// HandleTOTPSetup 生成两步验证密钥与扫码地址 (POST /api/auth/2fa/setup)
+func (h *AuthHandler) HandleTOTPSetup(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	principal, _ := auth.PrincipalFromContext(r.Context())
+
+	audit.Action(r, "user.totp_setup", "user", principal.Username)
+	setup, err := h.authService.SetupTOTP(principal.Username)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "setup": setup})
+}
+
+// HandleTOTPEnable 校验动态码并启用两步验证，返回恢复码 (POST /api/auth/2fa/enable Body: {code})
+func (h *AuthHandler) HandleTOTPEnable(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	principal, _ := auth.PrincipalFromContext(r.Context())
+
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "无效请求体"})
+		return
+	}
+
+	audit.Action(r, "user.totp_enable", "user", principal.Username)
+	codes, err := h.authService.EnableTOTP(principal.Username, req.Code)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": err.Error()})
+		return
+	}
+
+	// 恢复码仅在生成时返回一次
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "recoveryCodes": codes})
+}
+
+// HandleTOTPDisable 关闭两步验证 (POST /api/auth/2fa/disable Body: {password, code})
+func (h *AuthHandler) HandleTOTPDisable(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	principal, _ := auth.PrincipalFromContext(r.Context())
+
+	var req struct {
+		Password string `json:"password"`
+		Code     string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "无效请求体"})
+		return
+	}
+
+	audit.Action(r, "user.totp_disable", "user", principal.Username)
+	if err := h.authService.DisableTOTP(principal.Username, req.Password, req.Code); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "message": "两步验证已关闭"})
+}
+
+// HandleRecoveryCodes 重新生成恢复码 (POST /api/auth/2fa/recovery-codes Body: {code})
+func (h *AuthHandler) HandleRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	principal, _ := auth.PrincipalFromContext(r.Context())
+
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "无效请求体"})
+		return
+	}
+
+	audit.Action(r, "user.recovery_codes", "user", principal.Username)
+	codes, err := h.authService.RegenerateRecoveryCodes(principal.Username, req.Code)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "recoveryCodes": codes})
+}
@@ -6,6 +6,7 @@ import (
 	"strconv"
 
 	"NodePassDash/internal/dashboard"
+	"NodePassDash/internal/workspace"
 )
 
 // DashboardHandler 仪表盘相关的处理器
@@ -54,7 +55,7 @@ func (h *DashboardHandler) HandleGetStats(w http.ResponseWriter, r *http.Request
 	}
 
 	// 获取统计数据
-	stats, err := h.dashboardService.GetStats(dashboard.TimeRange(timeRange))
+	stats, err := h.dashboardService.GetStats(dashboard.TimeRange(timeRange), workspace.ScopeFromContext(r.Context()))
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(map[string]interface{}{
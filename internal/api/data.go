@@ -6,7 +6,9 @@ import (
 	"net/http"
 	"time"
 
+	"NodePassDash/internal/audit"
 	log "NodePassDash/internal/log"
+	"NodePassDash/internal/secret"
 	"NodePassDash/internal/sse"
 )
 
@@ -65,7 +67,12 @@ func (h *DataHandler) HandleExport(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 查询端点（仅导出基本配置信息，不包括状态和隧道信息）
+	// 导出内容包含主控 API Key，读取操作同样记录审计日志
+	audit.Force(r)
+	audit.Action(r, "data.export", "system", nil)
+
+	// 查询端点（仅导出基本配置信息，不包括状态和隧道信息）；
+	// 启用加密时 API Key 按数据库中的密文导出，只能导入到使用相同主密钥的实例
 	rows, err := h.db.Query(`SELECT name, url, apiPath, apiKey, COALESCE(color, '') as color FROM "Endpoint" ORDER BY id`)
 	if err != nil {
 		log.Errorf("export query endpoints: %v", err)
@@ -109,10 +116,12 @@ func (h *DataHandler) HandleImport(w http.ResponseWriter, r *http.Request) {
 		Timestamp string      `json:"timestamp"`
 		Data      interface{} `json:"data"`
 	}
+	audit.Action(r, "data.import", "system", nil)
 	if err := json.NewDecoder(r.Body).Decode(&baseImportData); err != nil {
 		http.Error(w, "invalid json", http.StatusBadRequest)
 		return
 	}
+	audit.After(r, map[string]interface{}{"version": baseImportData.Version, "timestamp": baseImportData.Timestamp})
 
 	// 根据版本选择不同的处理逻辑
 	if baseImportData.Version == "1.0" {
@@ -174,8 +183,15 @@ func (h *DataHandler) handleImportV1(w http.ResponseWriter, r *http.Request, bas
 					status = "OFFLINE"
 				}
 
+				apiKey, storedKey, err := importAPIKey(ep.APIKey)
+				if err != nil {
+					log.Errorf("import endpoint %s: %v", ep.URL, err)
+					continue
+				}
+				ep.APIKey = apiKey
+
 				result, err := tx.Exec(`INSERT INTO "Endpoint" (name, url, apiPath, apiKey, status, tunnelCount, createdAt, updatedAt) VALUES (?, ?, ?, ?, ?, 0, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`,
-					ep.Name, ep.URL, ep.APIPath, ep.APIKey, status)
+					ep.Name, ep.URL, ep.APIPath, storedKey, status)
 				if err != nil {
 					log.Errorf("insert endpoint failed: %v", err)
 					continue
@@ -230,7 +246,7 @@ func (h *DataHandler) handleImportV1(w http.ResponseWriter, r *http.Request, bas
 				tlsMode, logLevel, commandLine, instanceId, createdAt, updatedAt
 			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`,
 				tunnel.Name, endpointID, tunnel.Mode, tunnel.TunnelAddress, tunnel.TunnelPort,
-				tunnel.TargetAddress, tunnel.TargetPort, tunnel.TLSMode, tunnel.LogLevel, tunnel.CommandLine, tunnel.InstanceID)
+				tunnel.TargetAddress, tunnel.TargetPort, tunnel.TLSMode, tunnel.LogLevel, secret.MaskURL(tunnel.CommandLine), tunnel.InstanceID)
 
 			if err != nil {
 				log.Errorf("insert tunnel failed: %v", err)
@@ -317,9 +333,16 @@ func (h *DataHandler) handleImportV2(w http.ResponseWriter, r *http.Request, bas
 			continue
 		}
 
+		apiKey, storedKey, err := importAPIKey(ep.APIKey)
+		if err != nil {
+			log.Errorf("import endpoint %s: %v", ep.URL, err)
+			continue
+		}
+		ep.APIKey = apiKey
+
 		// 插入端点，设置默认状态为 OFFLINE
 		result, err := tx.Exec(`INSERT INTO "Endpoint" (name, url, apiPath, apiKey, status, color, tunnelCount, createdAt, updatedAt) VALUES (?, ?, ?, ?, 'OFFLINE', ?, 0, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`,
-			ep.Name, ep.URL, ep.APIPath, ep.APIKey, ep.Color)
+			ep.Name, ep.URL, ep.APIPath, storedKey, ep.Color)
 		if err != nil {
 			log.Errorf("insert endpoint failed: %v", err)
 			continue
@@ -372,3 +395,17 @@ func (h *DataHandler) handleImportV2(w http.ResponseWriter, r *http.Request, bas
 		"skippedEndpoints":  skippedEndpoints,
 	})
 }
+
+// importAPIKey 处理导入文件中的 API Key：可能是明文，也可能是本实例主密钥加密的密文；
+// 返回明文（用于建立 SSE 连接）及入库值
+func importAPIKey(v string) (string, string, error) {
+	plain, err := secret.Decrypt(v)
+	if err != nil {
+		return "", "", err
+	}
+	stored, err := secret.Encrypt(plain)
+	if err != nil {
+		return "", "", err
+	}
+	return plain, stored, nil
+}
@@ -17,9 +17,12 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/mattn/go-ieproxy"
 
+	"NodePassDash/internal/audit"
 	"NodePassDash/internal/endpoint"
 	"NodePassDash/internal/nodepass"
+	"NodePassDash/internal/secret"
 	"NodePassDash/internal/sse"
+	"NodePassDash/internal/workspace"
 	"strings"
 )
 
@@ -44,7 +47,7 @@ func (h *EndpointHandler) HandleGetEndpoints(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	endpoints, err := h.endpointService.GetEndpoints()
+	endpoints, err := h.endpointService.GetEndpoints(workspace.ScopeFromContext(r.Context()))
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(endpoint.EndpointResponse{
@@ -67,6 +70,8 @@ func (h *EndpointHandler) HandleCreateEndpoint(w http.ResponseWriter, r *http.Re
 		return
 	}
 
+	audit.Action(r, "endpoint.create", "endpoint", nil)
+
 	var req endpoint.CreateEndpointRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		w.WriteHeader(http.StatusBadRequest)
@@ -104,6 +109,9 @@ func (h *EndpointHandler) HandleCreateEndpoint(w http.ResponseWriter, r *http.Re
 		return
 	}
 
+	audit.Target(r, newEndpoint.ID)
+	audit.AfterRow(r, "Endpoint", newEndpoint.ID)
+
 	// 创建成功后，异步启动 SSE 监听
 	if h.sseManager != nil && newEndpoint != nil {
 		go func(ep *endpoint.Endpoint) {
@@ -139,6 +147,13 @@ func (h *EndpointHandler) HandleUpdateEndpoint(w http.ResponseWriter, r *http.Re
 		})
 		return
 	}
+	if !h.endpointService.EndpointVisible(id, workspace.ScopeFromContext(r.Context())) {
+		writeNotFound(w, "端点不存在")
+		return
+	}
+
+	audit.Action(r, "endpoint.update", "endpoint", id)
+	audit.BeforeRow(r, "Endpoint", id)
 
 	var body struct {
 		Name    string `json:"name"`
@@ -179,6 +194,7 @@ func (h *EndpointHandler) HandleUpdateEndpoint(w http.ResponseWriter, r *http.Re
 		})
 		return
 	}
+	audit.AfterRow(r, "Endpoint", id)
 
 	json.NewEncoder(w).Encode(endpoint.EndpointResponse{
 		Success:  true,
@@ -205,6 +221,13 @@ func (h *EndpointHandler) HandleDeleteEndpoint(w http.ResponseWriter, r *http.Re
 		})
 		return
 	}
+	if !h.endpointService.EndpointVisible(id, workspace.ScopeFromContext(r.Context())) {
+		writeNotFound(w, "端点不存在")
+		return
+	}
+
+	audit.Action(r, "endpoint.delete", "endpoint", id)
+	audit.BeforeRow(r, "Endpoint", id)
 
 	// 先获取端点下所有实例ID用于清理文件日志
 	var instanceIDs []string
@@ -318,7 +341,14 @@ func (h *EndpointHandler) HandlePatchEndpoint(w http.ResponseWriter, r *http.Req
 		}
 	}
 
+	if !h.endpointService.EndpointVisible(id, workspace.ScopeFromContext(r.Context())) {
+		writeNotFound(w, "端点不存在")
+		return
+	}
+
 	action, _ := body["action"].(string)
+	audit.Action(r, "endpoint."+action, "endpoint", id)
+
 	switch action {
 	case "rename":
 		name, _ := body["name"].(string)
@@ -328,11 +358,13 @@ func (h *EndpointHandler) HandlePatchEndpoint(w http.ResponseWriter, r *http.Req
 			Action: "rename",
 			Name:   name,
 		}
+		audit.BeforeRow(r, "Endpoint", id)
 		if _, err := h.endpointService.UpdateEndpoint(req); err != nil {
 			w.WriteHeader(http.StatusBadRequest)
 			json.NewEncoder(w).Encode(endpoint.EndpointResponse{Success: false, Error: err.Error()})
 			return
 		}
+		audit.AfterRow(r, "Endpoint", id)
 		json.NewEncoder(w).Encode(endpoint.EndpointResponse{
 			Success: true,
 			Message: "端点名称已更新",
@@ -402,7 +434,7 @@ func (h *EndpointHandler) HandleGetSimpleEndpoints(w http.ResponseWriter, r *htt
 	}
 
 	excludeFailed := r.URL.Query().Get("excludeFailed") == "true"
-	endpoints, err := h.endpointService.GetSimpleEndpoints(excludeFailed)
+	endpoints, err := h.endpointService.GetSimpleEndpoints(excludeFailed, workspace.ScopeFromContext(r.Context()))
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(endpoint.EndpointResponse{Success: false, Error: err.Error()})
@@ -498,12 +530,12 @@ func (h *EndpointHandler) HandleEndpointStatus(w http.ResponseWriter, r *http.Re
 	w.Header().Set("Connection", "keep-alive")
 
 	send := func() {
-		endpoints, err := h.endpointService.GetEndpoints()
+		endpoints, err := h.endpointService.GetEndpoints(workspace.ScopeFromContext(r.Context()))
 		if err != nil {
 			return
 		}
 		data, _ := json.Marshal(endpoints)
-		fmt.Fprintf(w, "data: %s\n\n", data)
+		fmt.Fprintf(w, "data: %s\n\n", secret.RedactJSON(data))
 		flusher.Flush()
 	}
 
@@ -544,6 +576,10 @@ func (h *EndpointHandler) HandleEndpointLogs(w http.ResponseWriter, r *http.Requ
 		json.NewEncoder(w).Encode(map[string]interface{}{"error": "无效的端点ID"})
 		return
 	}
+	if !h.endpointService.EndpointVisible(endpointID, workspace.ScopeFromContext(r.Context())) {
+		writeNotFound(w, "端点不存在")
+		return
+	}
 
 	// 解析 limit 参数，默认 1000
 	limit := 1000
@@ -611,6 +647,10 @@ func (h *EndpointHandler) HandleSearchEndpointLogs(w http.ResponseWriter, r *htt
 		json.NewEncoder(w).Encode(map[string]interface{}{"error": "无效的端点ID"})
 		return
 	}
+	if !h.endpointService.EndpointVisible(endpointID, workspace.ScopeFromContext(r.Context())) {
+		writeNotFound(w, "端点不存在")
+		return
+	}
 
 	q := r.URL.Query()
 	level := strings.ToLower(q.Get("level"))
@@ -759,6 +799,10 @@ func (h *EndpointHandler) HandleRecycleList(w http.ResponseWriter, r *http.Reque
 		json.NewEncoder(w).Encode(map[string]interface{}{"error": "无效的端点ID"})
 		return
 	}
+	if !h.endpointService.EndpointVisible(endpointID, workspace.ScopeFromContext(r.Context())) {
+		writeNotFound(w, "端点不存在")
+		return
+	}
 
 	db := h.endpointService.DB()
 
@@ -803,6 +847,13 @@ func (h *EndpointHandler) HandleRecycleList(w http.ResponseWriter, r *http.Reque
 			&item.ID, &item.Name, &item.Mode, &item.TunnelAddress, &item.TunnelPort, &item.TargetAddress, &item.TargetPort, &item.TLSMode,
 			&item.CertPath, &item.KeyPath, &item.LogLevel, &item.CommandLine, &item.InstanceID, &item.Password, &item.TCPRx, &item.TCPTx, &item.UDPRx, &item.UDPTx, &item.Min, &item.Max,
 		); err == nil {
+			password, err := secret.Reveal(item.Password)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(map[string]interface{}{"error": err.Error()})
+				return
+			}
+			item.Password = password
 			list = append(list, item)
 		}
 	}
@@ -824,6 +875,10 @@ func (h *EndpointHandler) HandleRecycleCount(w http.ResponseWriter, r *http.Requ
 		json.NewEncoder(w).Encode(map[string]interface{}{"error": "无效的端点ID"})
 		return
 	}
+	if !h.endpointService.EndpointVisible(endpointID, workspace.ScopeFromContext(r.Context())) {
+		writeNotFound(w, "端点不存在")
+		return
+	}
 
 	db := h.endpointService.DB()
 	var count int
@@ -854,6 +909,10 @@ func (h *EndpointHandler) HandleRecycleDelete(w http.ResponseWriter, r *http.Req
 		json.NewEncoder(w).Encode(map[string]interface{}{"error": "无效的ID"})
 		return
 	}
+	if !h.endpointService.EndpointVisible(endpointID, workspace.ScopeFromContext(r.Context())) {
+		writeNotFound(w, "端点不存在")
+		return
+	}
 
 	db := h.endpointService.DB()
 
@@ -922,13 +981,15 @@ func (h *EndpointHandler) HandleRecycleListAll(w http.ResponseWriter, r *http.Re
 	}
 
 	db := h.endpointService.DB()
+	cond, args := workspace.ScopeFromContext(r.Context()).Where("ep.workspaceId")
 
 	rows, err := db.Query(`SELECT tr.id, tr.name, tr.mode, tr.tunnelAddress, tr.tunnelPort, tr.targetAddress, tr.targetPort, tr.tlsMode,
 		tr.certPath, tr.keyPath, tr.logLevel, tr.commandLine, tr.instanceId, tr.password, tr.tcpRx, tr.tcpTx, tr.udpRx, tr.udpTx, tr.min, tr.max,
 		tr.endpointId, ep.name as endpointName
 		FROM "TunnelRecycle" tr
 		JOIN "Endpoint" ep ON tr.endpointId = ep.id
-		ORDER BY tr.id DESC`)
+		WHERE `+cond+`
+		ORDER BY tr.id DESC`, args...)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(map[string]interface{}{"error": err.Error()})
@@ -969,6 +1030,13 @@ func (h *EndpointHandler) HandleRecycleListAll(w http.ResponseWriter, r *http.Re
 			&item.CertPath, &item.KeyPath, &item.LogLevel, &item.CommandLine, &item.InstanceID, &item.Password, &item.TCPRx, &item.TCPTx, &item.UDPRx, &item.UDPTx, &item.Min, &item.Max,
 			&item.EndpointID, &item.EndpointName,
 		); err == nil {
+			password, err := secret.Reveal(item.Password)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(map[string]interface{}{"error": err.Error()})
+				return
+			}
+			item.Password = password
 			list = append(list, item)
 		}
 	}
@@ -984,6 +1052,8 @@ func (h *EndpointHandler) HandleRecycleClearAll(w http.ResponseWriter, r *http.R
 	}
 
 	db := h.endpointService.DB()
+	// 仅清空可见工作区内主控的回收站
+	cond, args := workspace.ScopeFromContext(r.Context()).EndpointWhere("endpointId")
 
 	// 先获取所有回收站记录用于清理文件日志
 	var recycleItems []struct {
@@ -991,7 +1061,7 @@ func (h *EndpointHandler) HandleRecycleClearAll(w http.ResponseWriter, r *http.R
 		InstanceID sql.NullString
 	}
 
-	rows, err := db.Query(`SELECT endpointId, instanceId FROM "TunnelRecycle" WHERE instanceId IS NOT NULL`)
+	rows, err := db.Query(`SELECT endpointId, instanceId FROM "TunnelRecycle" WHERE instanceId IS NOT NULL AND `+cond, args...)
 	if err == nil {
 		defer rows.Close()
 		for rows.Next() {
@@ -1013,7 +1083,7 @@ func (h *EndpointHandler) HandleRecycleClearAll(w http.ResponseWriter, r *http.R
 	}
 
 	// 删除 EndpointSSE 记录中对应实例
-	if _, err := tx.Exec(`DELETE FROM "EndpointSSE" WHERE instanceId IN (SELECT instanceId FROM "TunnelRecycle" WHERE instanceId IS NOT NULL)`); err != nil {
+	if _, err := tx.Exec(`DELETE FROM "EndpointSSE" WHERE instanceId IN (SELECT instanceId FROM "TunnelRecycle" WHERE instanceId IS NOT NULL AND `+cond+`)`, args...); err != nil {
 		tx.Rollback()
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(map[string]interface{}{"error": err.Error()})
@@ -1021,7 +1091,7 @@ func (h *EndpointHandler) HandleRecycleClearAll(w http.ResponseWriter, r *http.R
 	}
 
 	// 删除所有回收站记录
-	if _, err := tx.Exec(`DELETE FROM "TunnelRecycle"`); err != nil {
+	if _, err := tx.Exec(`DELETE FROM "TunnelRecycle" WHERE `+cond, args...); err != nil {
 		tx.Rollback()
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(map[string]interface{}{"error": err.Error()})
@@ -1098,13 +1168,22 @@ func (h *EndpointHandler) refreshTunnels(endpointID int64) error {
 
 		// 检查隧道是否存在
 		var tunnelID int64
-		err := tx.QueryRow(`SELECT id FROM "Tunnel" WHERE instanceId = ?`, inst.ID).Scan(&tunnelID)
+		var curPassword sql.NullString
+		err := tx.QueryRow(`SELECT id, password FROM "Tunnel" WHERE instanceId = ?`, inst.ID).Scan(&tunnelID, &curPassword)
 		if err != nil && err != sql.ErrNoRows {
 			tx.Rollback()
 			return err
 		}
+		exists := err == nil
 
-		if err == sql.ErrNoRows {
+		// 密码未变时沿用已有密文，避免每次同步都递增修订号
+		password, err := secret.Reprotect(curPassword.String, parsed.Password)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		if !exists {
 			// 插入新隧道 - 如果有 alias 则使用 alias，否则使用自动生成的名称
 			name := fmt.Sprintf("auto-%s", inst.ID)
 			if inst.Alias != "" {
@@ -1119,7 +1198,7 @@ func (h *EndpointHandler) refreshTunnels(endpointID int64) error {
 				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`,
 				inst.ID, name, endpointID, inst.Type,
 				parsed.TunnelAddress, convPort(parsed.TunnelPort), parsed.TargetAddress, convPort(parsed.TargetPort),
-				parsed.TLSMode, parsed.CertPath, parsed.KeyPath, parsed.LogLevel, inst.URL, parsed.Password, inst.Status,
+				parsed.TLSMode, parsed.CertPath, parsed.KeyPath, parsed.LogLevel, secret.MaskURL(inst.URL), password, inst.Status,
 				convInt(parsed.Min), convInt(parsed.Max),
 				inst.TCPRx, inst.TCPTx, inst.UDPRx, inst.UDPTx, inst.Restart)
 			if err != nil {
@@ -1148,7 +1227,7 @@ func (h *EndpointHandler) refreshTunnels(endpointID int64) error {
 					min = ?, max = ?, tcpRx = ?, tcpTx = ?, udpRx = ?, udpTx = ?, restart = ?, updatedAt = CURRENT_TIMESTAMP
 					WHERE id = ?`,
 					nameParam, inst.Type, parsed.TunnelAddress, convPort(parsed.TunnelPort), parsed.TargetAddress, convPort(parsed.TargetPort),
-					parsed.TLSMode, parsed.CertPath, parsed.KeyPath, parsed.LogLevel, inst.URL, parsed.Password, inst.Status,
+					parsed.TLSMode, parsed.CertPath, parsed.KeyPath, parsed.LogLevel, secret.MaskURL(inst.URL), password, inst.Status,
 					convInt(parsed.Min), convInt(parsed.Max), inst.TCPRx, inst.TCPTx, inst.UDPRx, inst.UDPTx, inst.Restart, tunnelID)
 			} else {
 				_, err = tx.Exec(`UPDATE "Tunnel" SET 
@@ -1157,7 +1236,7 @@ func (h *EndpointHandler) refreshTunnels(endpointID int64) error {
 					min = ?, max = ?, tcpRx = ?, tcpTx = ?, udpRx = ?, udpTx = ?, restart = ?, updatedAt = CURRENT_TIMESTAMP
 					WHERE id = ?`,
 					inst.Type, parsed.TunnelAddress, convPort(parsed.TunnelPort), parsed.TargetAddress, convPort(parsed.TargetPort),
-					parsed.TLSMode, parsed.CertPath, parsed.KeyPath, parsed.LogLevel, inst.URL, parsed.Password, inst.Status,
+					parsed.TLSMode, parsed.CertPath, parsed.KeyPath, parsed.LogLevel, secret.MaskURL(inst.URL), password, inst.Status,
 					convInt(parsed.Min), convInt(parsed.Max), inst.TCPRx, inst.TCPTx, inst.UDPRx, inst.UDPTx, inst.Restart, tunnelID)
 			}
 
@@ -1427,6 +1506,10 @@ func (h *EndpointHandler) HandleGetEndpointInfo(w http.ResponseWriter, r *http.R
 		})
 		return
 	}
+	if !h.endpointService.EndpointVisible(id, workspace.ScopeFromContext(r.Context())) {
+		writeNotFound(w, "端点不存在")
+		return
+	}
 
 	// 获取端点信息
 	ep, err := h.endpointService.GetEndpointByID(id)
@@ -1514,6 +1597,48 @@ func (h *EndpointHandler) HandleGetEndpointInfo(w http.ResponseWriter, r *http.R
 	}
 }
 
+// HandleRevealEndpointSecret 查看主控 API Key 原文 (GET /api/endpoints/{id}/secret)，仅限管理员，每次查看均记录审计
+func (h *EndpointHandler) HandleRevealEndpointSecret(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "无效的端点ID",
+		})
+		return
+	}
+	if !h.endpointService.EndpointVisible(id, workspace.ScopeFromContext(r.Context())) {
+		writeNotFound(w, "端点不存在")
+		return
+	}
+	audit.Force(r)
+	audit.Action(r, "endpoint.reveal_secret", "endpoint", id)
+
+	ep, err := h.endpointService.GetEndpointByID(id)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"apiKey":  ep.APIKey,
+	})
+}
+
 // HandleGetEndpointDetail 获取端点详细信息
 func (h *EndpointHandler) HandleGetEndpointDetail(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -1532,6 +1657,10 @@ func (h *EndpointHandler) HandleGetEndpointDetail(w http.ResponseWriter, r *http
 		})
 		return
 	}
+	if !h.endpointService.EndpointVisible(id, workspace.ScopeFromContext(r.Context())) {
+		writeNotFound(w, "端点不存在")
+		return
+	}
 
 	// 先获取端点基本信息（用于连接NodePass API）
 	ep, err := h.endpointService.GetEndpointByID(id)
@@ -1619,6 +1748,10 @@ func (h *EndpointHandler) HandleEndpointFileLogs(w http.ResponseWriter, r *http.
 		http.Error(w, "Invalid endpoint ID", http.StatusBadRequest)
 		return
 	}
+	if !h.endpointService.EndpointVisible(endpointID, workspace.ScopeFromContext(r.Context())) {
+		writeNotFound(w, "端点不存在")
+		return
+	}
 
 	// 获取查询参数
 	instanceID := r.URL.Query().Get("instanceId")
@@ -1668,6 +1801,10 @@ func (h *EndpointHandler) HandleClearEndpointFileLogs(w http.ResponseWriter, r *
 		http.Error(w, "Invalid endpoint ID", http.StatusBadRequest)
 		return
 	}
+	if !h.endpointService.EndpointVisible(endpointID, workspace.ScopeFromContext(r.Context())) {
+		writeNotFound(w, "端点不存在")
+		return
+	}
 
 	// 获取查询参数
 	instanceID := r.URL.Query().Get("instanceId")
@@ -1707,6 +1844,10 @@ func (h *EndpointHandler) HandleEndpointStats(w http.ResponseWriter, r *http.Req
 		http.Error(w, "Invalid endpoint ID", http.StatusBadRequest)
 		return
 	}
+	if !h.endpointService.EndpointVisible(endpointID, workspace.ScopeFromContext(r.Context())) {
+		writeNotFound(w, "端点不存在")
+		return
+	}
 
 	// 获取隧道数量和流量统计
 	tunnelCount, totalTcpIn, totalTcpOut, totalUdpIn, totalUdpOut, err := h.getTunnelStats(endpointID)
@@ -0,0 +1,233 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ErrorCode /api/v2 返回的机器可读错误码，发布后保持稳定，只增不改
+type ErrorCode string
+
+const (
+	ErrBadRequest         ErrorCode = "BAD_REQUEST"
+	ErrInvalidArgument    ErrorCode = "INVALID_ARGUMENT"
+	ErrOperationFailed    ErrorCode = "OPERATION_FAILED"
+	ErrUnauthenticated    ErrorCode = "UNAUTHENTICATED"
+	ErrInvalidCredentials ErrorCode = "INVALID_CREDENTIALS"
+	ErrTwoFactorRequired  ErrorCode = "TWO_FACTOR_REQUIRED"
+	ErrLoginDisabled      ErrorCode = "LOGIN_DISABLED"
+	ErrPermissionDenied   ErrorCode = "PERMISSION_DENIED"
+	ErrCSRFFailed         ErrorCode = "CSRF_FAILED"
+	ErrNotFound           ErrorCode = "NOT_FOUND"
+	ErrTunnelNotFound     ErrorCode = "TUNNEL_NOT_FOUND"
+	ErrEndpointNotFound   ErrorCode = "ENDPOINT_NOT_FOUND"
+	ErrMethodNotAllowed   ErrorCode = "METHOD_NOT_ALLOWED"
+	ErrAlreadyExists      ErrorCode = "ALREADY_EXISTS"
+	ErrConflict           ErrorCode = "CONFLICT"
+	ErrPreconditionFailed ErrorCode = "PRECONDITION_FAILED"
+	// ErrPreconditionRequired 修改配置时未通过 If-Match 携带 ETag
+	ErrPreconditionRequired ErrorCode = "PRECONDITION_REQUIRED"
+	// ErrIdempotencyMismatch Idempotency-Key 已用于内容不同的请求
+	ErrIdempotencyMismatch ErrorCode = "IDEMPOTENCY_KEY_MISMATCH"
+	// ErrIdempotencyInProgress 使用相同 Idempotency-Key 的请求仍在处理中
+	ErrIdempotencyInProgress ErrorCode = "IDEMPOTENCY_KEY_IN_USE"
+	ErrPayloadTooLarge       ErrorCode = "PAYLOAD_TOO_LARGE"
+	ErrRateLimited           ErrorCode = "RATE_LIMITED"
+	ErrInternal              ErrorCode = "INTERNAL"
+	ErrUpstream              ErrorCode = "UPSTREAM_ERROR"
+	ErrUnavailable           ErrorCode = "SERVICE_UNAVAILABLE"
+)
+
+// errorInfo 错误码对应的 HTTP 状态码及各语言的默认提示
+type errorInfo struct {
+	Status   int
+	Messages map[string]string
+}
+
+// errorCatalog 错误码目录，可通过 GET /api/error-codes 获取
+var errorCatalog = map[ErrorCode]errorInfo{
+	ErrBadRequest:            {http.StatusBadRequest, map[string]string{"zh": "请求无效", "en": "Bad request"}},
+	ErrInvalidArgument:       {http.StatusBadRequest, map[string]string{"zh": "请求参数无效", "en": "Invalid request parameters"}},
+	ErrOperationFailed:       {http.StatusBadRequest, map[string]string{"zh": "操作失败", "en": "The operation failed"}},
+	ErrUnauthenticated:       {http.StatusUnauthorized, map[string]string{"zh": "未登录或会话已过期", "en": "Not signed in or session expired"}},
+	ErrInvalidCredentials:    {http.StatusUnauthorized, map[string]string{"zh": "用户名或密码错误", "en": "Invalid username or password"}},
+	ErrTwoFactorRequired:     {http.StatusUnauthorized, map[string]string{"zh": "请输入两步验证码", "en": "Two-factor authentication code required"}},
+	ErrLoginDisabled:         {http.StatusForbidden, map[string]string{"zh": "用户名密码登录已禁用", "en": "Password login is disabled"}},
+	ErrPermissionDenied:      {http.StatusForbidden, map[string]string{"zh": "权限不足", "en": "Permission denied"}},
+	ErrCSRFFailed:            {http.StatusForbidden, map[string]string{"zh": "CSRF 校验失败，请刷新页面后重试", "en": "CSRF validation failed, please reload the page"}},
+	ErrNotFound:              {http.StatusNotFound, map[string]string{"zh": "资源不存在", "en": "Resource not found"}},
+	ErrTunnelNotFound:        {http.StatusNotFound, map[string]string{"zh": "隧道不存在", "en": "Tunnel not found"}},
+	ErrEndpointNotFound:      {http.StatusNotFound, map[string]string{"zh": "主控不存在", "en": "Endpoint not found"}},
+	ErrMethodNotAllowed:      {http.StatusMethodNotAllowed, map[string]string{"zh": "不支持的请求方法", "en": "Method not allowed"}},
+	ErrAlreadyExists:         {http.StatusConflict, map[string]string{"zh": "资源已存在", "en": "Resource already exists"}},
+	ErrConflict:              {http.StatusConflict, map[string]string{"zh": "资源状态冲突", "en": "Resource state conflict"}},
+	ErrPreconditionFailed:    {http.StatusPreconditionFailed, map[string]string{"zh": "资源已被修改，请刷新后重试", "en": "Resource has been modified, please reload and retry"}},
+	ErrPreconditionRequired:  {http.StatusPreconditionRequired, map[string]string{"zh": "修改前须通过 If-Match 携带资源的 ETag", "en": "If-Match with the resource ETag is required"}},
+	ErrIdempotencyMismatch:   {http.StatusUnprocessableEntity, map[string]string{"zh": "Idempotency-Key 已用于内容不同的请求", "en": "Idempotency-Key was already used for a different request"}},
+	ErrIdempotencyInProgress: {http.StatusConflict, map[string]string{"zh": "相同 Idempotency-Key 的请求正在处理中", "en": "A request with the same Idempotency-Key is still in progress"}},
+	ErrPayloadTooLarge:       {http.StatusRequestEntityTooLarge, map[string]string{"zh": "请求体过大", "en": "Request body too large"}},
+	ErrRateLimited:           {http.StatusTooManyRequests, map[string]string{"zh": "请求过于频繁，请稍后重试", "en": "Too many requests, please retry later"}},
+	ErrInternal:              {http.StatusInternalServerError, map[string]string{"zh": "服务器内部错误", "en": "Internal server error"}},
+	ErrUpstream:              {http.StatusBadGateway, map[string]string{"zh": "NodePass 主控请求失败", "en": "Request to NodePass endpoint failed"}},
+	ErrUnavailable:           {http.StatusServiceUnavailable, map[string]string{"zh": "服务暂不可用", "en": "Service unavailable"}},
+}
+
+// supportedLangs 支持的提示语言，第一个为默认语言
+var supportedLangs = []string{"zh", "en"}
+
+// errorPatterns 根据 v1 接口的错误提示细化错误码，按顺序匹配（小写子串）
+var errorPatterns = []struct {
+	code     ErrorCode
+	keywords []string
+}{
+	{ErrCSRFFailed, []string{"csrf"}},
+	{ErrInvalidCredentials, []string{"用户名或密码错误", "密码错误"}},
+	{ErrLoginDisabled, []string{"登录已禁用"}},
+	{ErrTunnelNotFound, []string{"隧道不存在", "tunnel not found"}},
+	{ErrEndpointNotFound, []string{"端点不存在", "主控不存在", "endpoint not found"}},
+	{ErrNotFound, []string{"不存在", "not found"}},
+	{ErrAlreadyExists, []string{"已存在", "already exists"}},
+	{ErrMethodNotAllowed, []string{"method not allowed"}},
+	{ErrPayloadTooLarge, []string{"too large", "过大"}},
+	{ErrInvalidArgument, []string{"无效", "invalid", "不能为空", "参数", "missing", "请提供", "请指定", "不支持", "格式错误"}},
+}
+
+// statusErrorCodes 无法从提示细化时按 HTTP 状态码归类
+var statusErrorCodes = map[int]ErrorCode{
+	http.StatusBadRequest:            ErrBadRequest,
+	http.StatusUnauthorized:          ErrUnauthenticated,
+	http.StatusForbidden:             ErrPermissionDenied,
+	http.StatusNotFound:              ErrNotFound,
+	http.StatusMethodNotAllowed:      ErrMethodNotAllowed,
+	http.StatusConflict:              ErrConflict,
+	http.StatusPreconditionFailed:    ErrPreconditionFailed,
+	http.StatusRequestEntityTooLarge: ErrPayloadTooLarge,
+	http.StatusTooManyRequests:       ErrRateLimited,
+	http.StatusBadGateway:            ErrUpstream,
+	http.StatusServiceUnavailable:    ErrUnavailable,
+	http.StatusGatewayTimeout:        ErrUpstream,
+}
+
+// classifyError 为 v1 接口的错误响应确定错误码：优先使用响应中声明的错误码，
+// 其次按提示关键字匹配，最后按 HTTP 状态码归类
+func classifyError(status int, declared, message string) ErrorCode {
+	if _, ok := errorCatalog[ErrorCode(declared)]; ok {
+		return ErrorCode(declared)
+	}
+
+	// 5xx 的提示多为内部细节，不参与关键字匹配；401、403 等明确的状态码只细化为同状态码的错误码
+	if status < 500 {
+		lower := strings.ToLower(message)
+		for _, p := range errorPatterns {
+			if status > http.StatusBadRequest && errorStatus(p.code) != status {
+				continue
+			}
+			for _, k := range p.keywords {
+				if strings.Contains(lower, k) {
+					return p.code
+				}
+			}
+		}
+	}
+
+	if code, ok := statusErrorCodes[status]; ok {
+		return code
+	}
+	switch {
+	case status >= 500:
+		return ErrInternal
+	case status >= 400:
+		return ErrBadRequest
+	}
+	// v1 部分接口以 200 + success:false 表示失败
+	return ErrOperationFailed
+}
+
+// errorStatus 返回错误码对应的 HTTP 状态码
+func errorStatus(code ErrorCode) int {
+	if info, ok := errorCatalog[code]; ok {
+		return info.Status
+	}
+	return http.StatusInternalServerError
+}
+
+// errorMessage 返回错误码在指定语言下的提示；中文环境下优先使用接口返回的具体中文提示
+func errorMessage(code ErrorCode, lang, original string) string {
+	if lang == "zh" && hasHan(original) {
+		return original
+	}
+	info, ok := errorCatalog[code]
+	if !ok {
+		info = errorCatalog[ErrInternal]
+	}
+	return info.Messages[lang]
+}
+
+// hasHan 判断字符串是否包含汉字
+func hasHan(s string) bool {
+	for _, r := range s {
+		if unicode.Is(unicode.Han, r) {
+			return true
+		}
+	}
+	return false
+}
+
+// preferredLang 按 Accept-Language 的权重选择提示语言，不支持时使用中文
+func preferredLang(r *http.Request) string {
+	best, bestQ := supportedLangs[0], -1.0
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		tag := strings.ToLower(strings.TrimSpace(fields[0]))
+		if tag == "" {
+			continue
+		}
+		q := 1.0
+		for _, f := range fields[1:] {
+			if v, ok := strings.CutPrefix(strings.TrimSpace(f), "q="); ok {
+				if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		primary, _, _ := strings.Cut(tag, "-")
+		for _, lang := range supportedLangs {
+			if primary == lang && q > bestQ {
+				best, bestQ = lang, q
+			}
+		}
+	}
+	return best
+}
+
+// HandleErrorCodes 返回错误码目录 (GET /api/error-codes)，提示语言按 Accept-Language 选择
+func HandleErrorCodes(w http.ResponseWriter, r *http.Request) {
+	lang := preferredLang(r)
+	codes := make([]string, 0, len(errorCatalog))
+	for code := range errorCatalog {
+		codes = append(codes, string(code))
+	}
+	sort.Strings(codes)
+
+	items := make([]map[string]interface{}, 0, len(codes))
+	for _, code := range codes {
+		info := errorCatalog[ErrorCode(code)]
+		items = append(items, map[string]interface{}{
+			"code":     code,
+			"status":   info.Status,
+			"message":  info.Messages[lang],
+			"messages": info.Messages,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Language", lang)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"codes":   items,
+	})
+}
@@ -7,7 +7,9 @@ import (
 	"strconv"
 	"time"
 
+	"NodePassDash/internal/audit"
 	"NodePassDash/internal/models"
+	"NodePassDash/internal/workspace"
 
 	"github.com/gorilla/mux"
 )
@@ -40,6 +42,7 @@ func (h *GroupHandler) HandleGetGroups(w http.ResponseWriter, r *http.Request) {
 	// 初始化为空数组而不是 nil 切片，确保 JSON 序列化时返回 [] 而不是 null
 	groups := make([]models.TunnelGroupWithMembers, 0)
 
+	scope := workspace.ScopeFromContext(r.Context())
 	for rows.Next() {
 		var group models.TunnelGroup
 		err := rows.Scan(&group.ID, &group.Name, &group.Description, &group.Type,
@@ -48,6 +51,9 @@ func (h *GroupHandler) HandleGetGroups(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, `{"error": "扫描分组数据失败"}`, http.StatusInternalServerError)
 			return
 		}
+		if !h.groupVisible(scope, group.ID) {
+			continue
+		}
 
 		// 查询分组成员
 		members, err := h.getTunnelGroupMembers(group.ID)
@@ -69,17 +75,24 @@ func (h *GroupHandler) HandleGetGroups(w http.ResponseWriter, r *http.Request) {
 
 // HandleCreateGroup 创建新分组
 func (h *GroupHandler) HandleCreateGroup(w http.ResponseWriter, r *http.Request) {
+	audit.Action(r, "group.create", "group", nil)
+
 	var req models.CreateTunnelGroupRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, `{"error": "请求参数错误: `+err.Error()+`"}`, http.StatusBadRequest)
 		return
 	}
+	audit.After(r, req)
 
 	// 验证分组类型
 	if req.Type != "single" && req.Type != "double" && req.Type != "intranet" && req.Type != "custom" {
 		http.Error(w, `{"error": "无效的分组类型"}`, http.StatusBadRequest)
 		return
 	}
+	if !h.tunnelsVisible(workspace.ScopeFromContext(r.Context()), intIDs(req.TunnelIDs)) {
+		http.Error(w, `{"error": "隧道不存在"}`, http.StatusNotFound)
+		return
+	}
 
 	// 开始事务
 	tx, err := h.db.Begin()
@@ -128,6 +141,8 @@ func (h *GroupHandler) HandleCreateGroup(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	audit.Target(r, groupID)
+
 	response := map[string]interface{}{
 		"success": true,
 		"id":      groupID,
@@ -146,12 +161,25 @@ func (h *GroupHandler) HandleUpdateGroup(w http.ResponseWriter, r *http.Request)
 		http.Error(w, `{"error": "无效的分组ID"}`, http.StatusBadRequest)
 		return
 	}
+	scope := workspace.ScopeFromContext(r.Context())
+	if !h.groupVisible(scope, groupID) {
+		http.Error(w, `{"error": "分组不存在"}`, http.StatusNotFound)
+		return
+	}
+
+	audit.Action(r, "group.update", "group", groupID)
+	audit.BeforeRow(r, "tunnel_groups", groupID)
 
 	var req models.UpdateTunnelGroupRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, `{"error": "请求参数错误: `+err.Error()+`"}`, http.StatusBadRequest)
 		return
 	}
+	audit.After(r, req)
+	if !h.tunnelsVisible(scope, intIDs(req.TunnelIDs)) {
+		http.Error(w, `{"error": "隧道不存在"}`, http.StatusNotFound)
+		return
+	}
 
 	// 开始事务
 	tx, err := h.db.Begin()
@@ -223,6 +251,13 @@ func (h *GroupHandler) HandleDeleteGroup(w http.ResponseWriter, r *http.Request)
 		http.Error(w, `{"error": "无效的分组ID"}`, http.StatusBadRequest)
 		return
 	}
+	if !h.groupVisible(workspace.ScopeFromContext(r.Context()), groupID) {
+		http.Error(w, `{"error": "分组不存在"}`, http.StatusNotFound)
+		return
+	}
+
+	audit.Action(r, "group.delete", "group", groupID)
+	audit.BeforeRow(r, "tunnel_groups", groupID)
 
 	// 删除分组（CASCADE 会自动删除成员关系）
 	deleteQuery := "DELETE FROM tunnel_groups WHERE id = ?"
@@ -251,6 +286,50 @@ func (h *GroupHandler) HandleDeleteGroup(w http.ResponseWriter, r *http.Request)
 	json.NewEncoder(w).Encode(response)
 }
 
+// groupVisible 分组本身不归属工作区：受限的可见范围内，仅当分组有成员且所有成员隧道均可见时分组可见
+func (h *GroupHandler) groupVisible(scope workspace.Scope, groupID int) bool {
+	if scope.All {
+		return true
+	}
+	cond, args := scope.EndpointWhere("t.endpointId")
+	var total, visible int
+	err := h.db.QueryRow(`
+		SELECT COUNT(*), COUNT(t.id)
+		FROM tunnel_group_members m
+		LEFT JOIN "Tunnel" t ON t.id = CAST(m.tunnel_id AS INTEGER) AND `+cond+`
+		WHERE m.group_id = ?`, append(args, groupID)...).Scan(&total, &visible)
+	return err == nil && total > 0 && total == visible
+}
+
+// tunnelsVisible 判断待加入分组的隧道是否均属于可见工作区
+func (h *GroupHandler) tunnelsVisible(scope workspace.Scope, tunnelIDs []string) bool {
+	if scope.All {
+		return true
+	}
+	cond, args := scope.EndpointWhere("endpointId")
+	for _, idStr := range tunnelIDs {
+		id, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			return false
+		}
+		var exists bool
+		if err := h.db.QueryRow(`SELECT EXISTS(SELECT 1 FROM "Tunnel" WHERE id = ? AND `+cond+`)`,
+			append([]interface{}{id}, args...)...).Scan(&exists); err != nil || !exists {
+			return false
+		}
+	}
+	return true
+}
+
+// intIDs 将数字隧道 ID 转为分组成员表中的字符串形式
+func intIDs(ids []int) []string {
+	out := make([]string, len(ids))
+	for i, id := range ids {
+		out[i] = strconv.Itoa(id)
+	}
+	return out
+}
+
 // getTunnelGroupMembers 获取分组成员
 func (h *GroupHandler) getTunnelGroupMembers(groupID int) ([]models.TunnelGroupMember, error) {
 	query := `
@@ -292,6 +371,12 @@ func (h *GroupHandler) HandleCreateGroupFromTemplate(w http.ResponseWriter, r *h
 		http.Error(w, `{"error": "请求参数错误: `+err.Error()+`"}`, http.StatusBadRequest)
 		return
 	}
+	audit.Action(r, "group.create_from_template", "group", nil)
+	audit.After(r, req)
+	if !h.tunnelsVisible(workspace.ScopeFromContext(r.Context()), req.TunnelIDs) {
+		http.Error(w, `{"error": "隧道不存在"}`, http.StatusNotFound)
+		return
+	}
 
 	// 根据模式确定分组类型和名称
 	var groupType, groupName, description string
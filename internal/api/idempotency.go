@@ -0,0 +1,187 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"NodePassDash/internal/auth"
+	"NodePassDash/internal/idempotency"
+	log "NodePassDash/internal/log"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// idempotencyKeyHeader 客户端为创建类请求生成的唯一键，超时重试时携带相同的值
+	idempotencyKeyHeader = "Idempotency-Key"
+	// idempotentReplayedHeader 标记响应为首次请求结果的重放
+	idempotentReplayedHeader = "Idempotent-Replayed"
+)
+
+// idempotentRoutes 支持 Idempotency-Key 的路由（方法 + 路由模板）：
+// 这些请求会在 NodePass 主控上创建实例，网络超时后重试可能重复创建
+var idempotentRoutes = map[string]bool{
+	"POST /api/tunnels":             true,
+	"POST /api/tunnels/batch":       true,
+	"POST /api/tunnels/batch-new":   true,
+	"POST /api/tunnels/template":    true,
+	"POST /api/tunnels/quick":       true,
+	"POST /api/tunnels/quick-batch": true,
+}
+
+// idempotencyKeepKey 请求上下文中“保存失败响应”标记的键
+type idempotencyKeepKey struct{}
+
+// keepIdempotentResponse 标记请求已产生无法回滚的副作用（如批量创建中已有实例创建成功），
+// 即使最终失败也保存响应，使用同一个键重试时重放该响应而不是重复创建
+func keepIdempotentResponse(r *http.Request) {
+	if keep, ok := r.Context().Value(idempotencyKeepKey{}).(*bool); ok {
+		*keep = true
+	}
+}
+
+// idempotencyMiddleware 对携带 Idempotency-Key 的创建类请求保存请求摘要及响应 24 小时：
+// 相同请求重试时直接返回首次的响应，请求内容不同则拒绝；
+// 失败的请求（包括 success:false）未创建实例，不保存响应，可使用同一个键重试，
+// 处理器调用 keepIdempotentResponse 标记的请求除外
+func idempotencyMiddleware(svc *idempotency.Service) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := strings.TrimSpace(r.Header.Get(idempotencyKeyHeader))
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			route := mux.CurrentRoute(r)
+			if route == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			tpl, err := route.GetPathTemplate()
+			if err != nil || !idempotentRoutes[r.Method+" "+tpl] {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if len(key) > idempotency.MaxKeyLength {
+				writeIdempotencyError(w, http.StatusBadRequest, ErrInvalidArgument, "Idempotency-Key 过长")
+				return
+			}
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				writeIdempotencyError(w, http.StatusBadRequest, ErrBadRequest, "读取请求体失败")
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			var actor string
+			if p, ok := auth.PrincipalFromContext(r.Context()); ok {
+				actor = p.Username
+			}
+
+			rec, err := svc.Begin(actor, key, idempotency.RequestHash(r.Method, r.URL.Path, body))
+			switch {
+			case errors.Is(err, idempotency.ErrMismatch):
+				writeIdempotencyError(w, http.StatusUnprocessableEntity, ErrIdempotencyMismatch, err.Error())
+				return
+			case errors.Is(err, idempotency.ErrInProgress):
+				writeIdempotencyError(w, http.StatusConflict, ErrIdempotencyInProgress, err.Error())
+				return
+			case err != nil:
+				log.Errorf("[幂等] 登记 Idempotency-Key 失败: %v", err)
+				writeIdempotencyError(w, http.StatusInternalServerError, ErrInternal, "处理 Idempotency-Key 失败")
+				return
+			case rec != nil:
+				if rec.ContentType != "" {
+					w.Header().Set("Content-Type", rec.ContentType)
+				}
+				w.Header().Set(idempotentReplayedHeader, "true")
+				w.WriteHeader(rec.Status)
+				w.Write(rec.Body)
+				return
+			}
+
+			rw := &idempotencyResponseWriter{ResponseWriter: w}
+			keep := false
+			r = r.WithContext(context.WithValue(r.Context(), idempotencyKeepKey{}, &keep))
+			completed := false
+			defer func() {
+				// 请求失败或处理器 panic 时释放幂等键，允许客户端重试
+				if !completed {
+					if err := svc.Abort(actor, key); err != nil {
+						log.Errorf("[幂等] 释放 Idempotency-Key 失败: %v", err)
+					}
+				}
+			}()
+			next.ServeHTTP(rw, r)
+
+			status := rw.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			if !rw.succeeded() && !keep {
+				return
+			}
+			if err := svc.Complete(actor, key, status, w.Header().Get("Content-Type"), rw.body.Bytes()); err != nil {
+				log.Errorf("[幂等] 保存请求响应失败: %v", err)
+				return
+			}
+			completed = true
+		})
+	}
+}
+
+// writeIdempotencyError 写出幂等键相关的错误，code 供 /api/v2 使用
+func writeIdempotencyError(w http.ResponseWriter, status int, code ErrorCode, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": false,
+		"error":   message,
+		"code":    code,
+	})
+}
+
+// idempotencyResponseWriter 在写出响应的同时保留一份副本
+type idempotencyResponseWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *idempotencyResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *idempotencyResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+// succeeded 根据状态码及响应体中的 success 字段判断请求是否成功
+func (w *idempotencyResponseWriter) succeeded() bool {
+	if w.status >= http.StatusBadRequest {
+		return false
+	}
+	var body struct {
+		Success *bool `json:"success"`
+	}
+	_ = json.Unmarshal(w.body.Bytes(), &body)
+	return body.Success == nil || *body.Success
+}
+
+// Unwrap 供 http.ResponseController 获取原始 ResponseWriter
+func (w *idempotencyResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
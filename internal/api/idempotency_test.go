@@ -0,0 +1,184 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"NodePassDash/internal/db/dbtest"
+	"NodePassDash/internal/idempotency"
+
+	"github.com/gorilla/mux"
+)
+
+// idempotencyTestRouter 挂载幂等中间件的测试路由，handler 处理批量创建及（不支持幂等键的）重启路由，
+// 返回的计数器记录 handler 实际执行的次数
+func idempotencyTestRouter(t *testing.T, handler http.HandlerFunc) (*mux.Router, *int32) {
+	t.Helper()
+	var calls int32
+	r := mux.NewRouter()
+	r.Use(idempotencyMiddleware(idempotency.NewService(dbtest.Open(t))))
+	r.HandleFunc("/api/tunnels/batch", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		handler(w, r)
+	}).Methods("POST")
+	r.HandleFunc("/api/tunnels/{id}/restart", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		handler(w, r)
+	}).Methods("POST")
+	return r, &calls
+}
+
+func idempotentPost(router http.Handler, path, key, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	if key != "" {
+		r.Header.Set(idempotencyKeyHeader, key)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	return w
+}
+
+func TestIdempotencyReplay(t *testing.T) {
+	router, calls := idempotencyTestRouter(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "tunnelIds": []int{1}})
+	})
+
+	first := idempotentPost(router, "/api/tunnels/batch", "k1", `{"items":[1]}`)
+	second := idempotentPost(router, "/api/tunnels/batch", "k1", `{"items":[1]}`)
+	if *calls != 1 {
+		t.Fatalf("handler ran %d times, want 1", *calls)
+	}
+	if second.Code != first.Code || second.Body.String() != first.Body.String() ||
+		second.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("replay = %d %q, want %d %q", second.Code, second.Body.String(), first.Code, first.Body.String())
+	}
+	if first.Header().Get(idempotentReplayedHeader) != "" || second.Header().Get(idempotentReplayedHeader) != "true" {
+		t.Fatal("only the replayed response should carry Idempotent-Replayed")
+	}
+
+	// 不同的键、未携带键及不支持幂等键的路由均正常执行
+	idempotentPost(router, "/api/tunnels/batch", "k2", `{"items":[1]}`)
+	idempotentPost(router, "/api/tunnels/batch", "", `{"items":[1]}`)
+	idempotentPost(router, "/api/tunnels/1/restart", "k1", `{}`)
+	idempotentPost(router, "/api/tunnels/1/restart", "k1", `{}`)
+	if *calls != 5 {
+		t.Fatalf("handler ran %d times, want 5", *calls)
+	}
+}
+
+func TestIdempotencyHashMismatch(t *testing.T) {
+	router, calls := idempotencyTestRouter(t, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+	})
+
+	idempotentPost(router, "/api/tunnels/batch", "k1", `{"items":[1]}`)
+	w := idempotentPost(router, "/api/tunnels/batch", "k1", `{"items":[2]}`)
+	var body struct {
+		Code ErrorCode `json:"code"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if w.Code != http.StatusUnprocessableEntity || body.Code != ErrIdempotencyMismatch || *calls != 1 {
+		t.Fatalf("status = %d, code = %s, calls = %d", w.Code, body.Code, *calls)
+	}
+}
+
+func TestIdempotencyConcurrentInFlight(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	router, calls := idempotencyTestRouter(t, func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+	})
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- idempotentPost(router, "/api/tunnels/batch", "k1", `{}`) }()
+	<-started
+
+	w := idempotentPost(router, "/api/tunnels/batch", "k1", `{}`)
+	var body struct {
+		Code ErrorCode `json:"code"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if w.Code != http.StatusConflict || body.Code != ErrIdempotencyInProgress {
+		t.Fatalf("in-flight retry: status = %d, code = %s", w.Code, body.Code)
+	}
+
+	close(release)
+	if first := <-done; first.Code != http.StatusOK {
+		t.Fatalf("first request status = %d", first.Code)
+	}
+	if w := idempotentPost(router, "/api/tunnels/batch", "k1", `{}`); w.Header().Get(idempotentReplayedHeader) != "true" || *calls != 1 {
+		t.Fatalf("retry after completion should replay, calls = %d", *calls)
+	}
+}
+
+func TestIdempotencyFailedResponses(t *testing.T) {
+	cases := []struct {
+		name       string
+		handler    http.HandlerFunc
+		wantStatus int
+		wantReplay bool
+	}{
+		{"400 is retryable", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "主控不可达"})
+		}, http.StatusBadRequest, false},
+		{"200 with success false is retryable", func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": false})
+		}, http.StatusOK, false},
+		{"partial success is replayed", func(w http.ResponseWriter, r *http.Request) {
+			keepIdempotentResponse(r)
+			w.WriteHeader(http.StatusPartialContent)
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "successCount": 1, "failCount": 1})
+		}, http.StatusPartialContent, true},
+		{"failure after side effects is replayed", func(w http.ResponseWriter, r *http.Request) {
+			keepIdempotentResponse(r)
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "server端隧道回滚失败"})
+		}, http.StatusBadRequest, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			router, calls := idempotencyTestRouter(t, c.handler)
+			idempotentPost(router, "/api/tunnels/batch", "k1", `{}`)
+			w := idempotentPost(router, "/api/tunnels/batch", "k1", `{}`)
+			replayed := w.Header().Get(idempotentReplayedHeader) == "true"
+			if w.Code != c.wantStatus || replayed != c.wantReplay {
+				t.Fatalf("retry: status = %d, replayed = %v", w.Code, replayed)
+			}
+			wantCalls := int32(2)
+			if c.wantReplay {
+				wantCalls = 1
+			}
+			if *calls != wantCalls {
+				t.Fatalf("handler ran %d times, want %d", *calls, wantCalls)
+			}
+		})
+	}
+}
+
+func TestIdempotencyPanicReleasesKey(t *testing.T) {
+	panicking := true
+	router, calls := idempotencyTestRouter(t, func(w http.ResponseWriter, r *http.Request) {
+		if panicking {
+			panic("boom")
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+	})
+
+	func() {
+		defer func() { recover() }()
+		idempotentPost(router, "/api/tunnels/batch", "k1", `{}`)
+	}()
+	panicking = false
+	if w := idempotentPost(router, "/api/tunnels/batch", "k1", `{}`); w.Code != http.StatusOK || *calls != 2 {
+		t.Fatalf("retry after panic: status = %d, calls = %d", w.Code, *calls)
+	}
+}
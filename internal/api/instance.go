@@ -6,7 +6,12 @@ import (
 	"net/http"
 	"strings"
 
+	"NodePassDash/internal/audit"
 	"NodePassDash/internal/instance"
+	"NodePassDash/internal/secret"
+	"NodePassDash/internal/workspace"
+
+	"github.com/gorilla/mux"
 )
 
 // InstanceHandler 实例相关的处理器
@@ -48,15 +53,20 @@ func (h *InstanceHandler) HandleGetInstances(w http.ResponseWriter, r *http.Requ
 
 	// 获取端点信息
 	var endpoint struct {
-		URL     string
-		APIPath string
-		APIKey  string
+		URL         string
+		APIPath     string
+		APIKey      string
+		WorkspaceID int64
 	}
 	err := h.db.QueryRow(`
-		SELECT url, apiPath, apiKey
+		SELECT url, apiPath, apiKey, workspaceId
 		FROM "Endpoint"
 		WHERE id = ?
-	`, endpointID).Scan(&endpoint.URL, &endpoint.APIPath, &endpoint.APIKey)
+	`, endpointID).Scan(&endpoint.URL, &endpoint.APIPath, &endpoint.APIKey, &endpoint.WorkspaceID)
+	// 不属于调用方可见工作区的主控同样视为不存在
+	if err == nil && !workspace.ScopeFromContext(r.Context()).Allows(endpoint.WorkspaceID) {
+		err = sql.ErrNoRows
+	}
 	if err != nil {
 		if err == sql.ErrNoRows {
 			http.Error(w, "Endpoint not found", http.StatusNotFound)
@@ -65,6 +75,10 @@ func (h *InstanceHandler) HandleGetInstances(w http.ResponseWriter, r *http.Requ
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
+	if endpoint.APIKey, err = secret.Reveal(endpoint.APIKey); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
 
 	// 获取实例列表
 	instances, err := h.instanceService.GetInstances(endpoint.URL, endpoint.APIPath, endpoint.APIKey)
@@ -96,15 +110,20 @@ func (h *InstanceHandler) HandleGetInstance(w http.ResponseWriter, r *http.Reque
 
 	// 获取端点信息
 	var endpoint struct {
-		URL     string
-		APIPath string
-		APIKey  string
+		URL         string
+		APIPath     string
+		APIKey      string
+		WorkspaceID int64
 	}
 	err := h.db.QueryRow(`
-		SELECT url, apiPath, apiKey
+		SELECT url, apiPath, apiKey, workspaceId
 		FROM "Endpoint"
 		WHERE id = ?
-	`, endpointID).Scan(&endpoint.URL, &endpoint.APIPath, &endpoint.APIKey)
+	`, endpointID).Scan(&endpoint.URL, &endpoint.APIPath, &endpoint.APIKey, &endpoint.WorkspaceID)
+	// 不属于调用方可见工作区的主控同样视为不存在
+	if err == nil && !workspace.ScopeFromContext(r.Context()).Allows(endpoint.WorkspaceID) {
+		err = sql.ErrNoRows
+	}
 	if err != nil {
 		if err == sql.ErrNoRows {
 			http.Error(w, "Endpoint not found", http.StatusNotFound)
@@ -113,6 +132,10 @@ func (h *InstanceHandler) HandleGetInstance(w http.ResponseWriter, r *http.Reque
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
+	if endpoint.APIKey, err = secret.Reveal(endpoint.APIKey); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
 
 	// 获取实例信息
 	instance, err := h.instanceService.GetInstance(endpoint.URL, endpoint.APIPath, endpoint.APIKey, instanceID)
@@ -151,6 +174,8 @@ func (h *InstanceHandler) HandleControlInstance(w http.ResponseWriter, r *http.R
 		return
 	}
 
+	audit.Action(r, "instance."+req.Action, "instance", mux.Vars(r)["instanceId"])
+
 	// 验证action
 	if req.Action != "start" && req.Action != "stop" && req.Action != "restart" {
 		http.Error(w, "Invalid action", http.StatusBadRequest)
@@ -159,15 +184,20 @@ func (h *InstanceHandler) HandleControlInstance(w http.ResponseWriter, r *http.R
 
 	// 获取端点信息
 	var endpoint struct {
-		URL     string
-		APIPath string
-		APIKey  string
+		URL         string
+		APIPath     string
+		APIKey      string
+		WorkspaceID int64
 	}
 	err := h.db.QueryRow(`
-		SELECT url, apiPath, apiKey
+		SELECT url, apiPath, apiKey, workspaceId
 		FROM "Endpoint"
 		WHERE id = ?
-	`, endpointID).Scan(&endpoint.URL, &endpoint.APIPath, &endpoint.APIKey)
+	`, endpointID).Scan(&endpoint.URL, &endpoint.APIPath, &endpoint.APIKey, &endpoint.WorkspaceID)
+	// 不属于调用方可见工作区的主控同样视为不存在
+	if err == nil && !workspace.ScopeFromContext(r.Context()).Allows(endpoint.WorkspaceID) {
+		err = sql.ErrNoRows
+	}
 	if err != nil {
 		if err == sql.ErrNoRows {
 			http.Error(w, "Endpoint not found", http.StatusNotFound)
@@ -176,6 +206,10 @@ func (h *InstanceHandler) HandleControlInstance(w http.ResponseWriter, r *http.R
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
+	if endpoint.APIKey, err = secret.Reveal(endpoint.APIKey); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
 
 	// 控制实例状态
 	err = h.instanceService.ControlInstance(endpoint.URL, endpoint.APIPath, endpoint.APIKey, instanceID, req.Action)
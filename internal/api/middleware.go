@@ -0,0 +1,542 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+
+	"NodePassDash/internal/audit"
+	"NodePassDash/internal/auth"
+	log "NodePassDash/internal/log"
+	"NodePassDash/internal/secret"
+	"NodePassDash/internal/workspace"
+
+	"github.com/gorilla/mux"
+)
+
+// publicRoutes 无需登录即可访问的路由白名单
+// 登录页需要 /api/auth/oauth2 与 /api/auth/validate 判断登录方式和会话状态
+var publicRoutes = map[string]bool{
+	"/api/auth/login":      true,
+	"/api/auth/login/2fa":  true,
+	"/api/auth/init":       true,
+	"/api/auth/oauth2":     true,
+	"/api/auth/validate":   true,
+	"/api/auth/csrf":       true,
+	"/api/oauth2/callback": true,
+	"/api/oauth2/login":    true,
+	"/api/health":          true,
+	"/api/error-codes":     true,
+	"/api/openapi.json":    true,
+}
+
+// isPublicRoute 判断请求路径是否在白名单中
+func isPublicRoute(path string) bool {
+	return publicRoutes[path]
+}
+
+// requiredScope 返回 API Token 访问该路由所需的权限范围，
+// 返回空字符串表示该路由仅允许会话登录访问
+func requiredScope(method, path string) string {
+	read := method == http.MethodGet || method == http.MethodHead
+	switch {
+	case strings.HasPrefix(path, "/api/tunnels"),
+		strings.HasPrefix(path, "/api/tags"),
+		strings.HasPrefix(path, "/api/groups"),
+		strings.HasPrefix(path, "/api/dashboard"),
+		strings.HasPrefix(path, "/api/sse/tunnel/"),
+		path == "/api/ws":
+		// WebSocket 的主控日志订阅另需 endpoints:read，在订阅时校验
+		if read {
+			return auth.ScopeTunnelsRead
+		}
+		return auth.ScopeTunnelsWrite
+	case strings.HasPrefix(path, "/api/endpoints"),
+		strings.HasPrefix(path, "/api/recycle"),
+		strings.HasPrefix(path, "/api/sse"),
+		strings.HasPrefix(path, "/api/data"):
+		// 查看 API Key 原文及代理任意主控地址需要管理权限
+		if read && !strings.HasSuffix(path, "/secret") && path != "/api/sse/nodepass-proxy" {
+			return auth.ScopeEndpointsRead
+		}
+		return auth.ScopeEndpointsAdmin
+	case path == "/metrics":
+		return auth.ScopeMetricsRead
+	}
+	return ""
+}
+
+// requiredRole 返回访问该路由所需的最低角色：
+// 管理员负责用户、令牌、系统配置和主控（含 API Key）管理，
+// 操作员可以管理隧道、标签、分组并控制实例，查看者只能读取
+func requiredRole(method, path string) auth.Role {
+	read := method == http.MethodGet || method == http.MethodHead
+	switch {
+	case path == "/api/auth/sessions/settings":
+		if read {
+			return auth.RoleViewer
+		}
+		return auth.RoleAdmin
+	case strings.HasPrefix(path, "/api/workspaces"):
+		if read {
+			return auth.RoleViewer
+		}
+		return auth.RoleAdmin
+	case strings.HasPrefix(path, "/api/users"),
+		strings.HasPrefix(path, "/api/auth/tokens"),
+		strings.HasPrefix(path, "/api/auth/lockouts"),
+		strings.HasPrefix(path, "/api/audit"),
+		strings.HasPrefix(path, "/api/webhooks"),
+		strings.HasPrefix(path, "/api/oauth2/"),
+		strings.HasPrefix(path, "/api/data/"),
+		strings.HasPrefix(path, "/api/sse/log-cleanup"),
+		path == "/api/sse/endpoint-clear",
+		path == "/api/sse/test",
+		path == "/api/sse/nodepass-proxy",
+		path == "/api/version/auto-update",
+		path == "/metrics":
+		return auth.RoleAdmin
+	case strings.HasPrefix(path, "/api/endpoints"):
+		// 主控列表与详情包含主控配置，查看 API Key 原文同样仅限管理员
+		if path == "/api/endpoints" || strings.HasSuffix(path, "/detail") || strings.HasSuffix(path, "/secret") {
+			return auth.RoleAdmin
+		}
+		if read {
+			return auth.RoleViewer
+		}
+		if strings.Contains(path, "/instances/") && strings.HasSuffix(path, "/control") {
+			return auth.RoleOperator
+		}
+		return auth.RoleAdmin
+	case strings.HasPrefix(path, "/api/recycle"):
+		if read {
+			return auth.RoleViewer
+		}
+		return auth.RoleAdmin
+	case strings.HasPrefix(path, "/api/tunnels"),
+		strings.HasPrefix(path, "/api/tags"),
+		strings.HasPrefix(path, "/api/groups"),
+		strings.HasPrefix(path, "/api/dashboard"):
+		if read {
+			return auth.RoleViewer
+		}
+		return auth.RoleOperator
+	}
+	return auth.RoleViewer
+}
+
+// bearerToken 从 Authorization 头中提取 Bearer 令牌
+func bearerToken(r *http.Request) string {
+	h := r.Header.Get("Authorization")
+	if len(h) > 7 && strings.EqualFold(h[:7], "Bearer ") {
+		return strings.TrimSpace(h[7:])
+	}
+	return ""
+}
+
+// authMiddleware 校验 Bearer 令牌或 session cookie，未通过时统一返回 401 JSON，
+// 通过后将调用方信息及其可见的工作区范围写入请求上下文
+func authMiddleware(authService *auth.Service, workspaceService *workspace.Service) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodOptions {
+				next.ServeHTTP(w, r)
+				return
+			}
+			// 反向代理认证先于白名单处理，使登录页的会话校验同样能识别代理传递的身份
+			if err := ensureProxySession(authService, w, r); err != nil {
+				writeForbidden(w, "反向代理认证失败: "+err.Error())
+				return
+			}
+			if isPublicRoute(r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			var principal *auth.Principal
+			if token := bearerToken(r); token != "" {
+				p, ok := authService.AuthenticateToken(token)
+				if !ok {
+					writeUnauthorized(w, "API 令牌无效、已过期或已吊销")
+					return
+				}
+				scope := requiredScope(r.Method, r.URL.Path)
+				if scope == "" || !p.HasScope(scope) {
+					writeForbidden(w, "API 令牌权限不足")
+					return
+				}
+				principal = p
+			} else {
+				cookie, err := r.Cookie("session")
+				if err != nil || cookie.Value == "" {
+					writeUnauthorized(w, "未登录")
+					return
+				}
+
+				p, ok := authService.AuthenticateSession(cookie.Value)
+				if !ok {
+					writeUnauthorized(w, "会话无效或已过期")
+					return
+				}
+				principal = p
+			}
+
+			if !principal.Role.Allows(requiredRole(r.Method, r.URL.Path)) {
+				writeForbidden(w, "当前角色无权执行此操作")
+				return
+			}
+
+			scope, err := workspaceService.ScopeFor(principal.UserID, principal.Role == auth.RoleAdmin)
+			if err != nil {
+				log.Errorf("[API] 获取用户 %s 的工作区失败: %v", principal.Username, err)
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "获取工作区失败"})
+				return
+			}
+
+			log.Debugf("[API] %s %s user=%s role=%s via=%s", r.Method, r.URL.Path, principal.Username, principal.Role, principal.AuthType)
+			ctx := auth.WithPrincipal(r.Context(), principal)
+			ctx = workspace.WithScope(ctx, scope)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// ensureProxySession 处理经受信任反向代理认证的请求：当前会话不属于代理传递的用户时，
+// 为该用户（必要时自动创建）建立新会话并替换本次请求的 session cookie，
+// 之后的鉴权与普通会话登录一致；两步验证由前置的 SSO 代理负责
+func ensureProxySession(authService *auth.Service, w http.ResponseWriter, r *http.Request) error {
+	id, ok := auth.ProxyIdentityFromRequest(r)
+	if !ok || bearerToken(r) != "" {
+		return nil
+	}
+	if c, err := r.Cookie("session"); err == nil {
+		if sess, ok := authService.GetSession(c.Value); ok && sess.Username == id.Username {
+			return nil
+		}
+	}
+
+	user, err := authService.ResolveProxyLogin(id)
+	if err != nil {
+		log.Warnf("[API] 反向代理用户 %s 登录失败: %v", id.Username, err)
+		return err
+	}
+	session, err := authService.CreateUserSession(user.Username, sessionMeta(r, false))
+	if err != nil {
+		log.Errorf("[API] 为反向代理用户 %s 创建会话失败: %v", user.Username, err)
+		return errors.New("创建会话失败")
+	}
+	setSessionCookie(w, r, session)
+	replaceRequestCookie(r, "session", session.SessionID)
+	log.Infof("[API] 反向代理用户 %s 已登录 (email=%s, ip=%s)", user.Username, id.Email, auth.ClientIP(r))
+	return nil
+}
+
+// replaceRequestCookie 替换请求中的指定 cookie，供后续处理器读取新值
+func replaceRequestCookie(r *http.Request, name, value string) {
+	cookies := r.Cookies()
+	r.Header.Del("Cookie")
+	for _, c := range cookies {
+		if c.Name != name {
+			r.AddCookie(c)
+		}
+	}
+	r.AddCookie(&http.Cookie{Name: name, Value: value})
+}
+
+// writeUnauthorized 返回统一格式的 401 响应
+func writeUnauthorized(w http.ResponseWriter, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnauthorized)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": false,
+		"error":   msg,
+	})
+}
+
+// writeForbidden 返回统一格式的 403 响应
+func writeForbidden(w http.ResponseWriter, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": false,
+		"error":   msg,
+	})
+}
+
+// writeNotFound 返回统一格式的 404 响应；资源不属于调用方可见的工作区时同样使用，不暴露其是否存在
+func writeNotFound(w http.ResponseWriter, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNotFound)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": false,
+		"error":   msg,
+	})
+}
+
+// auditResponseWriter 记录响应状态码及响应体开头，用于判断操作是否成功
+type auditResponseWriter struct {
+	http.ResponseWriter
+	status int
+	head   []byte
+}
+
+// auditHeadLimit 为解析 success / error 字段保留的响应体长度
+const auditHeadLimit = 4096
+
+func (w *auditResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *auditResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if remain := auditHeadLimit - len(w.head); remain > 0 {
+		if len(b) < remain {
+			remain = len(b)
+		}
+		w.head = append(w.head, b[:remain]...)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush 透传 http.Flusher，保证 SSE 等流式响应正常工作
+func (w *auditResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap 供 http.ResponseController 获取原始 ResponseWriter
+func (w *auditResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Hijack 透传 http.Hijacker，供 WebSocket 升级连接
+func (w *auditResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.status = http.StatusSwitchingProtocols
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
+
+// outcome 根据状态码及响应体中的 success / error 字段判断操作结果
+func (w *auditResponseWriter) outcome() (bool, string) {
+	status := w.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	var body struct {
+		Success *bool  `json:"success"`
+		Error   string `json:"error"`
+		Message string `json:"message"`
+	}
+	_ = json.Unmarshal(w.head, &body)
+
+	success := status < http.StatusBadRequest && (body.Success == nil || *body.Success)
+	if success {
+		return true, ""
+	}
+	msg := body.Error
+	if msg == "" {
+		msg = body.Message
+	}
+	if msg == "" {
+		msg = strings.TrimSpace(string(w.head))
+		if len(msg) > 200 {
+			msg = msg[:200]
+		}
+	}
+	return false, msg
+}
+
+// auditMiddleware 为每个请求准备审计信息，修改类请求（及处理器显式要求记录的请求）
+// 在处理完成后写入审计日志；处理器可通过 audit.Action / audit.Before / audit.After 补充目标及变更内容
+func auditMiddleware(auditService *audit.Service) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodOptions {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx, rec := audit.WithRecord(r.Context(), auditService)
+			aw := &auditResponseWriter{ResponseWriter: w}
+			next.ServeHTTP(aw, r.WithContext(ctx))
+
+			mutating := r.Method != http.MethodGet && r.Method != http.MethodHead
+			entry, before, after, ok := rec.Entry(mutating)
+			if !ok {
+				return
+			}
+
+			entry.IP = auth.ClientIP(r)
+			entry.UserAgent = r.UserAgent()
+			entry.Method = r.Method
+			entry.Path = r.URL.Path
+			entry.Status = aw.status
+			if entry.Status == 0 {
+				entry.Status = http.StatusOK
+			}
+			if entry.Error == "" {
+				entry.Success, entry.Error = aw.outcome()
+			}
+			if p, ok := auth.PrincipalFromContext(r.Context()); ok {
+				entry.AuthType = string(p.AuthType)
+				if entry.Actor == "" {
+					entry.Actor = p.Username
+				}
+			}
+			if entry.Action == "" {
+				// 未显式命名的操作使用路由模板，如 POST /api/tunnels/{id}/action
+				tpl := r.URL.Path
+				if route := mux.CurrentRoute(r); route != nil {
+					if t, err := route.GetPathTemplate(); err == nil {
+						tpl = t
+					}
+				}
+				entry.Action = r.Method + " " + tpl
+			}
+
+			if err := auditService.Log(entry, before, after); err != nil {
+				log.Errorf("[审计] 写入审计日志失败: %v", err)
+			}
+		})
+	}
+}
+
+// unmaskedRoute 响应需保留敏感字段原文的路由：系统初始化一次性返回管理员初始密码，
+// 数据导出用于备份恢复（启用加密时为密文），主控密钥查看接口仅限管理员且记录审计；
+// OpenAPI 文档中的 password 等为字段定义而非数据
+func unmaskedRoute(path string) bool {
+	switch {
+	case path == "/api/auth/init",
+		path == "/api/data/export",
+		path == "/api/openapi.json",
+		strings.HasPrefix(path, "/api/endpoints/") && strings.HasSuffix(path, "/secret"):
+		return true
+	}
+	return false
+}
+
+// redactResponseWriter 缓存 JSON 响应，在写出前对 API Key、密码等敏感字段脱敏；
+// SSE、文件下载等非 JSON 响应直接透传
+type redactResponseWriter struct {
+	http.ResponseWriter
+	status  int
+	decided bool
+	buffer  bool
+	body    bytes.Buffer
+}
+
+// decide 根据 Content-Type（未设置时根据响应体首字符）决定是否缓存响应
+func (w *redactResponseWriter) decide(b []byte) {
+	if w.decided {
+		return
+	}
+	ct := w.Header().Get("Content-Type")
+	if ct == "" && b == nil {
+		return
+	}
+	w.decided = true
+	if ct != "" {
+		w.buffer = strings.HasPrefix(ct, "application/json")
+	} else {
+		trimmed := bytes.TrimSpace(b)
+		w.buffer = len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[')
+	}
+	if !w.buffer && w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+}
+
+func (w *redactResponseWriter) WriteHeader(status int) {
+	if w.status != 0 {
+		return
+	}
+	w.status = status
+	if w.decided {
+		if !w.buffer {
+			w.ResponseWriter.WriteHeader(status)
+		}
+		return
+	}
+	// decide 确定透传时会写出状态码
+	w.decide(nil)
+}
+
+func (w *redactResponseWriter) Write(b []byte) (int, error) {
+	w.decide(b)
+	if w.buffer {
+		return w.body.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush 透传 http.Flusher，缓存中的 JSON 响应在请求结束时统一写出
+func (w *redactResponseWriter) Flush() {
+	if w.buffer {
+		return
+	}
+	if !w.decided {
+		w.decided = true
+		if w.status != 0 {
+			w.ResponseWriter.WriteHeader(w.status)
+		}
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap 供 http.ResponseController 获取原始 ResponseWriter
+func (w *redactResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Hijack 透传 http.Hijacker，升级后的连接不再经过脱敏
+func (w *redactResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.decided = true
+	w.buffer = false
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
+
+// finish 写出缓存的响应
+func (w *redactResponseWriter) finish() {
+	if !w.decided {
+		// 处理器只设置了状态码、没有写响应体
+		if w.status != 0 {
+			w.ResponseWriter.WriteHeader(w.status)
+		}
+		return
+	}
+	if !w.buffer {
+		return
+	}
+	body := secret.RedactJSON(w.body.Bytes())
+	w.Header().Del("Content-Length")
+	if w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+	w.ResponseWriter.Write(body)
+}
+
+// redactMiddleware 默认对所有 JSON 响应中的敏感字段脱敏，需要原文时使用专门的查看接口
+func redactMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions || unmaskedRoute(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		rw := &redactResponseWriter{ResponseWriter: w}
+		next.ServeHTTP(rw, r)
+		rw.finish()
+	})
+}
@@ -0,0 +1,156 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"NodePassDash/internal/auth"
+)
+
+func TestRequiredRole(t *testing.T) {
+	cases := []struct {
+		method, path string
+		want         auth.Role
+	}{
+		// 只读接口
+		{http.MethodGet, "/api/tunnels", auth.RoleViewer},
+		{http.MethodGet, "/api/tunnels/1/details", auth.RoleViewer},
+		{http.MethodGet, "/api/tags", auth.RoleViewer},
+		{http.MethodGet, "/api/dashboard/overall-stats", auth.RoleViewer},
+		{http.MethodGet, "/api/recycle", auth.RoleViewer},
+		{http.MethodGet, "/api/workspaces", auth.RoleViewer},
+		{http.MethodGet, "/api/auth/sessions/settings", auth.RoleViewer},
+		{http.MethodGet, "/api/endpoints/simple", auth.RoleViewer},
+		{http.MethodGet, "/api/endpoints/1/logs", auth.RoleViewer},
+		{http.MethodHead, "/api/tunnels", auth.RoleViewer},
+		{http.MethodGet, "/api/auth/me", auth.RoleViewer},
+		{http.MethodPost, "/api/auth/sessions/revoke-others", auth.RoleViewer},
+
+		// 隧道、标签、分组及实例操作
+		{http.MethodPost, "/api/tunnels", auth.RoleOperator},
+		{http.MethodPatch, "/api/tunnels/1", auth.RoleOperator},
+		{http.MethodDelete, "/api/tunnels/1", auth.RoleOperator},
+		{http.MethodPut, "/api/tunnels/1/tag", auth.RoleOperator},
+		{http.MethodPost, "/api/tags", auth.RoleOperator},
+		{http.MethodPost, "/api/groups", auth.RoleOperator},
+		{http.MethodPost, "/api/dashboard/logs/clear", auth.RoleOperator},
+		{http.MethodPost, "/api/endpoints/1/instances/abc/control", auth.RoleOperator},
+
+		// 主控配置、回收站清理及系统管理
+		{http.MethodGet, "/api/endpoints", auth.RoleAdmin},
+		{http.MethodGet, "/api/endpoints/1/detail", auth.RoleAdmin},
+		{http.MethodGet, "/api/endpoints/1/secret", auth.RoleAdmin},
+		{http.MethodPost, "/api/endpoints", auth.RoleAdmin},
+		{http.MethodPut, "/api/endpoints/1", auth.RoleAdmin},
+		{http.MethodPost, "/api/endpoints/1/instances", auth.RoleAdmin},
+		{http.MethodDelete, "/api/recycle", auth.RoleAdmin},
+		{http.MethodPost, "/api/workspaces", auth.RoleAdmin},
+		{http.MethodPut, "/api/auth/sessions/settings", auth.RoleAdmin},
+		{http.MethodGet, "/api/users", auth.RoleAdmin},
+		{http.MethodGet, "/api/auth/tokens", auth.RoleAdmin},
+		{http.MethodGet, "/api/auth/lockouts", auth.RoleAdmin},
+		{http.MethodGet, "/api/audit", auth.RoleAdmin},
+		{http.MethodGet, "/api/webhooks", auth.RoleAdmin},
+		{http.MethodGet, "/api/oauth2/config", auth.RoleAdmin},
+		{http.MethodGet, "/api/data/export", auth.RoleAdmin},
+		{http.MethodGet, "/api/sse/log-cleanup/config", auth.RoleAdmin},
+		{http.MethodPost, "/api/sse/endpoint-clear", auth.RoleAdmin},
+		{http.MethodPost, "/api/sse/test", auth.RoleAdmin},
+		{http.MethodGet, "/api/sse/nodepass-proxy", auth.RoleAdmin},
+		{http.MethodPost, "/api/version/auto-update", auth.RoleAdmin},
+		{http.MethodGet, "/metrics", auth.RoleAdmin},
+	}
+	for _, c := range cases {
+		if got := requiredRole(c.method, c.path); got != c.want {
+			t.Errorf("requiredRole(%s %s) = %q, want %q", c.method, c.path, got, c.want)
+		}
+	}
+}
+
+func TestRequiredScope(t *testing.T) {
+	cases := []struct {
+		method, path string
+		want         string
+	}{
+		{http.MethodGet, "/api/tunnels", auth.ScopeTunnelsRead},
+		{http.MethodPost, "/api/tunnels", auth.ScopeTunnelsWrite},
+		{http.MethodGet, "/api/sse/tunnel/abc", auth.ScopeTunnelsRead},
+		{http.MethodGet, "/api/endpoints/1/stats", auth.ScopeEndpointsRead},
+		{http.MethodGet, "/api/endpoints/1/secret", auth.ScopeEndpointsAdmin},
+		{http.MethodGet, "/api/sse/global", auth.ScopeEndpointsRead},
+		{http.MethodGet, "/api/sse/nodepass-proxy", auth.ScopeEndpointsAdmin},
+		{http.MethodGet, "/metrics", auth.ScopeMetricsRead},
+		{http.MethodGet, "/api/auth/me", ""},
+	}
+	for _, c := range cases {
+		if got := requiredScope(c.method, c.path); got != c.want {
+			t.Errorf("requiredScope(%s %s) = %q, want %q", c.method, c.path, got, c.want)
+		}
+	}
+}
+
+func TestRoleAllows(t *testing.T) {
+	roles := []auth.Role{auth.RoleViewer, auth.RoleOperator, auth.RoleAdmin}
+	for i, have := range roles {
+		for j, need := range roles {
+			if got, want := have.Allows(need), i >= j; got != want {
+				t.Errorf("%s.Allows(%s) = %v, want %v", have, need, got, want)
+			}
+		}
+	}
+}
+
+func TestUnmaskedRoute(t *testing.T) {
+	cases := []struct {
+		path string
+		want bool
+	}{
+		{"/api/auth/init", true},
+		{"/api/data/export", true},
+		{"/api/openapi.json", true},
+		{"/api/endpoints/1/secret", true},
+		{"/api/endpoints/1/detail", false},
+		{"/api/endpoints", false},
+		{"/api/data/import", false},
+		{"/api/tunnels/1/secret", false},
+	}
+	for _, c := range cases {
+		if got := unmaskedRoute(c.path); got != c.want {
+			t.Errorf("unmaskedRoute(%s) = %v, want %v", c.path, got, c.want)
+		}
+	}
+}
+
+func TestRedactMiddleware(t *testing.T) {
+	const body = `{"apiKey":"k","url":"server://pass@:1001/127.0.0.1:80"}`
+	handler := redactMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/sse/global" {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte("data: " + body + "\n\n"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(body))
+	}))
+
+	cases := []struct {
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{"/api/endpoints/1/detail", http.StatusCreated, `{"apiKey":"******","url":"server://******@:1001/127.0.0.1:80"}`},
+		{"/api/endpoints/1/secret", http.StatusCreated, body},
+		{"/api/data/export", http.StatusCreated, body},
+		// 非 JSON 响应直接透传
+		{"/api/sse/global", http.StatusOK, "data: " + body + "\n\n"},
+	}
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, c.path, nil))
+		if w.Code != c.wantStatus || w.Body.String() != c.wantBody {
+			t.Errorf("%s: status = %d, body = %s; want %d, %s", c.path, w.Code, w.Body.String(), c.wantStatus, c.wantBody)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"NodePassDash/internal/audit"
+	"NodePassDash/internal/auth"
+	log "NodePassDash/internal/log"
+	"NodePassDash/internal/oidc"
+)
+
+// loadOIDCConfig 读取 oauth2_config 中的 OIDC 配置，未配置 redirectUri 时按请求 Host 拼接
+func (h *AuthHandler) loadOIDCConfig(r *http.Request) (oidc.Config, error) {
+	var cfg oidc.Config
+	cfgStr, err := h.authService.GetSystemConfig("oauth2_config")
+	if err != nil || cfgStr == "" {
+		return cfg, errors.New("OIDC 未配置")
+	}
+	if err := json.Unmarshal([]byte(cfgStr), &cfg); err != nil {
+		return cfg, fmt.Errorf("OIDC 配置解析失败: %v", err)
+	}
+	if cfg.RedirectURI == "" {
+		scheme := "http"
+		if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+			scheme = "https"
+		}
+		cfg.RedirectURI = fmt.Sprintf("%s://%s/api/oauth2/callback", scheme, r.Host)
+	}
+	return cfg, nil
+}
+
+// handleOIDCLogin 读取发现文档，生成 state / nonce / PKCE 后跳转到授权地址
+func (h *AuthHandler) handleOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	cfg, err := h.loadOIDCConfig(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	provider, err := oidc.NewProvider(r.Context(), cfg, h.createProxyClient())
+	if err != nil {
+		log.Errorf("[OIDC] 初始化提供者失败: %v", err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	verifier, challenge, err := oidc.NewPKCE()
+	if err != nil {
+		http.Error(w, "生成 PKCE 失败", http.StatusInternalServerError)
+		return
+	}
+	nonce, err := oidc.NewNonce()
+	if err != nil {
+		http.Error(w, "生成 nonce 失败", http.StatusInternalServerError)
+		return
+	}
+
+	state := h.authService.GenerateOAuthStateWithData(auth.OAuthStateData{
+		CodeVerifier: verifier,
+		Nonce:        nonce,
+	})
+	http.Redirect(w, r, provider.AuthCodeURL(state, nonce, challenge), http.StatusFound)
+}
+
+// handleOIDCCallback 使用授权码换取并校验 ID Token，按分组映射角色后创建会话
+func (h *AuthHandler) handleOIDCCallback(w http.ResponseWriter, r *http.Request, code string, stateData auth.OAuthStateData) {
+	cfg, err := h.loadOIDCConfig(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if stateData.CodeVerifier == "" || stateData.Nonce == "" {
+		redirectOAuthError(w, r, cfg.RedirectURI, "oidc", errors.New("登录请求缺少 PKCE 参数，请重新登录"))
+		return
+	}
+
+	provider, err := oidc.NewProvider(r.Context(), cfg, h.createProxyClient())
+	if err != nil {
+		log.Errorf("[OIDC] 初始化提供者失败: %v", err)
+		redirectOAuthError(w, r, cfg.RedirectURI, "oidc", err)
+		return
+	}
+
+	claims, err := provider.Exchange(r.Context(), code, stateData.CodeVerifier, stateData.Nonce)
+	if err != nil {
+		log.Warnf("[OIDC] ID Token 校验失败: %v", err)
+		redirectOAuthError(w, r, cfg.RedirectURI, "oidc", err)
+		return
+	}
+
+	name, err := claims.Username(cfg)
+	if err != nil {
+		redirectOAuthError(w, r, cfg.RedirectURI, "oidc", err)
+		return
+	}
+	username := "oidc:" + name
+
+	// 配置了分组映射时，按分组决定角色；未命中且无默认角色则拒绝登录
+	role, err := oidcRole(cfg, claims.Groups(cfg))
+	if err != nil {
+		redirectOAuthError(w, r, cfg.RedirectURI, "oidc", err)
+		return
+	}
+
+	dataJSON, _ := json.Marshal(claims)
+	if err := h.authService.SaveOAuthUser("oidc", claims.Subject(), username, string(dataJSON)); err != nil {
+		redirectOAuthError(w, r, cfg.RedirectURI, "oidc", err)
+		return
+	}
+
+	profile := auth.OAuthProfile{Login: name}
+	if email, ok := claims["email"].(string); ok && email != "" && claims["email_verified"] != false {
+		profile.Emails = []string{email}
+	}
+	if err := h.authService.AuthorizeOAuthLogin("oidc", claims.Subject(), profile); err != nil {
+		redirectOAuthError(w, r, cfg.RedirectURI, "oidc", err)
+		return
+	}
+
+	localUser, err := h.authService.ResolveOAuthLogin("oidc", claims.Subject(), username)
+	if err != nil {
+		redirectOAuthError(w, r, cfg.RedirectURI, "oidc", err)
+		return
+	}
+	if role != "" {
+		if err := h.authService.SetUserRole(localUser, role); err != nil {
+			log.Warnf("[OIDC] 同步用户 %s 的角色失败: %v", localUser, err)
+		}
+	}
+
+	audit.Actor(r, localUser)
+	session, err := h.authService.CreateUserSession(localUser, sessionMeta(r, false))
+	if err != nil {
+		http.Error(w, "创建会话失败", http.StatusInternalServerError)
+		return
+	}
+
+	setSessionCookie(w, r, session)
+
+	log.Infof("[OIDC] 用户 %s 登录成功", localUser)
+	http.Redirect(w, r, strings.Replace(cfg.RedirectURI, "/api/oauth2/callback", "/dashboard", 1), http.StatusFound)
+}
+
+// oidcRole 根据分组映射计算角色，取命中分组中权限最高的角色；
+// 未配置映射时返回空字符串，表示沿用本地用户的现有角色
+func oidcRole(cfg oidc.Config, groups []string) (auth.Role, error) {
+	if len(cfg.GroupRoles) == 0 {
+		return "", nil
+	}
+
+	var role auth.Role
+	for _, g := range groups {
+		mapped := auth.Role(cfg.GroupRoles[g])
+		if mapped.Valid() && (role == "" || !role.Allows(mapped)) {
+			role = mapped
+		}
+	}
+	if role != "" {
+		return role, nil
+	}
+	if def := auth.Role(cfg.DefaultRole); def.Valid() {
+		return def, nil
+	}
+	return "", errors.New("当前账户不属于任何授权分组")
+}
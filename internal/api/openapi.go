@@ -0,0 +1,612 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"NodePassDash/internal/audit"
+	"NodePassDash/internal/auth"
+	"NodePassDash/internal/dashboard"
+	"NodePassDash/internal/endpoint"
+	"NodePassDash/internal/idempotency"
+	"NodePassDash/internal/instance"
+	"NodePassDash/internal/models"
+	"NodePassDash/internal/tag"
+	"NodePassDash/internal/tunnel"
+	"NodePassDash/internal/webhook"
+	"NodePassDash/internal/workspace"
+
+	"github.com/gorilla/mux"
+)
+
+// apiOperation OpenAPI 中的单个接口描述，Request / Response 为对应 Go 类型的零值，
+// 文档中的 schema 由其反射生成
+type apiOperation struct {
+	Method  string
+	Path    string // 与 registerRoutes 中的路由模板一致
+	Tag     string
+	Summary string
+	// Request 请求体类型，nil 表示无请求体
+	Request interface{}
+	// Response 成功响应类型，nil 表示通用的 {success, message} 结构
+	Response interface{}
+	// Field 响应类型在响应体中的字段名，为空表示响应体即该类型
+	Field string
+	// Query 查询参数
+	Query []string
+	// Produces 非 JSON 响应的内容类型，如 text/event-stream
+	Produces string
+}
+
+// apiOperations 所有已注册路由的接口描述；新增路由时需同步补充，
+// 否则 TestOpenAPICoversAllRoutes 及 --check-openapi 检查会失败
+var apiOperations = []apiOperation{
+	// 认证
+	{Method: "POST", Path: "/api/auth/login", Tag: "auth", Summary: "用户名密码登录", Request: auth.LoginRequest{}, Response: auth.LoginResponse{}},
+	{Method: "POST", Path: "/api/auth/login/2fa", Tag: "auth", Summary: "两步验证登录第二步", Request: auth.TwoFactorLoginRequest{}, Response: auth.LoginResponse{}},
+	{Method: "POST", Path: "/api/auth/logout", Tag: "auth", Summary: "退出登录"},
+	{Method: "GET", Path: "/api/auth/validate", Tag: "auth", Summary: "校验当前会话"},
+	{Method: "GET", Path: "/api/auth/csrf", Tag: "auth", Summary: "获取 CSRF 令牌"},
+	{Method: "GET", Path: "/api/auth/me", Tag: "auth", Summary: "当前登录用户"},
+	{Method: "POST", Path: "/api/auth/init", Tag: "auth", Summary: "初始化系统并生成管理员账户"},
+	{Method: "POST", Path: "/api/auth/change-password", Tag: "auth", Summary: "修改密码", Request: PasswordChangeRequest{}},
+	{Method: "POST", Path: "/api/auth/change-username", Tag: "auth", Summary: "修改用户名", Request: UsernameChangeRequest{}},
+	{Method: "GET", Path: "/api/auth/oauth2", Tag: "auth", Summary: "当前可用的登录方式"},
+	{Method: "GET", Path: "/api/auth/tokens", Tag: "auth", Summary: "API 令牌列表", Response: []auth.APIToken{}, Field: "tokens"},
+	{Method: "POST", Path: "/api/auth/tokens", Tag: "auth", Summary: "创建 API 令牌", Request: auth.CreateAPITokenRequest{}},
+	{Method: "DELETE", Path: "/api/auth/tokens/{id}", Tag: "auth", Summary: "吊销 API 令牌"},
+	{Method: "GET", Path: "/api/auth/sessions", Tag: "auth", Summary: "当前用户的会话列表", Response: []auth.SessionInfo{}, Field: "sessions"},
+	{Method: "DELETE", Path: "/api/auth/sessions", Tag: "auth", Summary: "注销当前会话以外的全部会话"},
+	{Method: "GET", Path: "/api/auth/sessions/settings", Tag: "auth", Summary: "会话有效期设置", Response: auth.SessionSettings{}, Field: "settings"},
+	{Method: "PUT", Path: "/api/auth/sessions/settings", Tag: "auth", Summary: "修改会话有效期设置", Request: auth.SessionSettings{}, Response: auth.SessionSettings{}, Field: "settings"},
+	{Method: "DELETE", Path: "/api/auth/sessions/{id:[0-9]+}", Tag: "auth", Summary: "注销指定会话"},
+	{Method: "GET", Path: "/api/auth/lockouts", Tag: "auth", Summary: "登录失败计数与锁定状态", Response: []auth.LoginLockout{}, Field: "lockouts"},
+	{Method: "POST", Path: "/api/auth/lockouts/unlock", Tag: "auth", Summary: "解除登录锁定"},
+	{Method: "GET", Path: "/api/auth/2fa", Tag: "auth", Summary: "两步验证状态", Response: auth.TOTPStatus{}, Field: "status"},
+	{Method: "POST", Path: "/api/auth/2fa/setup", Tag: "auth", Summary: "生成两步验证密钥", Response: auth.TOTPSetup{}, Field: "setup"},
+	{Method: "POST", Path: "/api/auth/2fa/enable", Tag: "auth", Summary: "启用两步验证", Response: []string{}, Field: "recoveryCodes"},
+	{Method: "POST", Path: "/api/auth/2fa/disable", Tag: "auth", Summary: "关闭两步验证"},
+	{Method: "POST", Path: "/api/auth/2fa/recovery-codes", Tag: "auth", Summary: "重新生成恢复码", Response: []string{}, Field: "recoveryCodes"},
+
+	// OAuth2 / OIDC
+	{Method: "GET", Path: "/api/oauth2/callback", Tag: "oauth2", Summary: "OAuth2 回调", Query: []string{"code", "state"}, Produces: "text/html"},
+	{Method: "GET", Path: "/api/oauth2/login", Tag: "oauth2", Summary: "跳转到 OAuth2 登录页", Produces: "text/html"},
+	{Method: "GET", Path: "/api/oauth2/config", Tag: "oauth2", Summary: "OAuth2 配置"},
+	{Method: "POST", Path: "/api/oauth2/config", Tag: "oauth2", Summary: "保存 OAuth2 配置", Request: OAuth2ConfigRequest{}},
+	{Method: "DELETE", Path: "/api/oauth2/config", Tag: "oauth2", Summary: "删除 OAuth2 配置"},
+	{Method: "GET", Path: "/api/oauth2/identities", Tag: "oauth2", Summary: "第三方登录身份列表", Response: []auth.OAuthIdentity{}, Field: "identities"},
+	{Method: "PUT", Path: "/api/oauth2/identities/{id}", Tag: "oauth2", Summary: "映射第三方身份到本地用户"},
+	{Method: "POST", Path: "/api/oauth2/identities/{id}/{action}", Tag: "oauth2", Summary: "第三方身份操作"},
+	{Method: "GET", Path: "/api/oauth2/allowlist", Tag: "oauth2", Summary: "第三方登录白名单", Response: auth.OAuthAllowlist{}, Field: "allowlist"},
+	{Method: "PUT", Path: "/api/oauth2/allowlist", Tag: "oauth2", Summary: "保存第三方登录白名单", Request: auth.OAuthAllowlist{}},
+
+	// 审计日志
+	{Method: "GET", Path: "/api/audit", Tag: "audit", Summary: "分页查询审计日志", Response: audit.Page{}, Query: []string{"actor", "action", "targetType", "targetId", "ip", "success", "from", "to", "page", "pageSize"}},
+	{Method: "GET", Path: "/api/audit/export", Tag: "audit", Summary: "以 CSV 导出审计日志", Query: []string{"actor", "action", "targetType", "targetId", "ip", "success", "from", "to"}, Produces: "text/csv"},
+
+	// 出站 Webhook
+	{Method: "GET", Path: "/api/webhooks", Tag: "webhooks", Summary: "Webhook 列表", Response: []webhook.Webhook{}, Field: "webhooks"},
+	{Method: "POST", Path: "/api/webhooks", Tag: "webhooks", Summary: "创建 Webhook（签名密钥仅返回一次）", Request: webhook.CreateWebhookRequest{}, Response: webhook.Webhook{}, Field: "webhook"},
+	{Method: "GET", Path: "/api/webhooks/{id:[0-9]+}", Tag: "webhooks", Summary: "Webhook 详情", Response: webhook.Webhook{}, Field: "webhook"},
+	{Method: "PUT", Path: "/api/webhooks/{id:[0-9]+}", Tag: "webhooks", Summary: "更新 Webhook", Request: webhook.UpdateWebhookRequest{}, Response: webhook.Webhook{}, Field: "webhook"},
+	{Method: "DELETE", Path: "/api/webhooks/{id:[0-9]+}", Tag: "webhooks", Summary: "删除 Webhook 及其投递记录"},
+	{Method: "POST", Path: "/api/webhooks/{id:[0-9]+}/test", Tag: "webhooks", Summary: "发送测试事件", Response: webhook.Delivery{}, Field: "delivery"},
+	{Method: "GET", Path: "/api/webhooks/{id:[0-9]+}/deliveries", Tag: "webhooks", Summary: "分页查询投递记录", Response: webhook.DeliveryPage{}, Query: []string{"status", "page", "pageSize"}},
+	{Method: "POST", Path: "/api/webhooks/{id:[0-9]+}/deliveries/{deliveryId:[0-9]+}/retry", Tag: "webhooks", Summary: "重新投递", Response: webhook.Delivery{}, Field: "delivery"},
+
+	// 用户与工作区
+	{Method: "GET", Path: "/api/users", Tag: "users", Summary: "用户列表", Response: []auth.User{}, Field: "users"},
+	{Method: "POST", Path: "/api/users", Tag: "users", Summary: "创建用户", Request: auth.CreateUserRequest{}, Response: auth.User{}, Field: "user"},
+	{Method: "PUT", Path: "/api/users/{id}", Tag: "users", Summary: "更新用户", Request: auth.UpdateUserRequest{}, Response: auth.User{}, Field: "user"},
+	{Method: "DELETE", Path: "/api/users/{id}", Tag: "users", Summary: "删除用户"},
+	{Method: "GET", Path: "/api/workspaces", Tag: "workspaces", Summary: "工作区列表", Response: []workspace.Workspace{}, Field: "workspaces"},
+	{Method: "POST", Path: "/api/workspaces", Tag: "workspaces", Summary: "创建工作区", Request: workspace.CreateWorkspaceRequest{}, Response: workspace.Workspace{}, Field: "workspace"},
+	{Method: "PUT", Path: "/api/workspaces/{id}", Tag: "workspaces", Summary: "更新工作区", Request: workspace.UpdateWorkspaceRequest{}, Response: workspace.Workspace{}, Field: "workspace"},
+	{Method: "DELETE", Path: "/api/workspaces/{id}", Tag: "workspaces", Summary: "删除工作区"},
+	{Method: "PUT", Path: "/api/workspaces/{id}/members", Tag: "workspaces", Summary: "设置工作区成员"},
+	{Method: "PUT", Path: "/api/workspaces/{id}/endpoints", Tag: "workspaces", Summary: "将主控迁移到工作区"},
+
+	// 主控
+	{Method: "GET", Path: "/api/endpoints", Tag: "endpoints", Summary: "主控列表", Response: []endpoint.EndpointWithStats{}},
+	{Method: "POST", Path: "/api/endpoints", Tag: "endpoints", Summary: "添加主控", Request: endpoint.CreateEndpointRequest{}, Response: endpoint.EndpointResponse{}},
+	{Method: "PUT", Path: "/api/endpoints/{id}", Tag: "endpoints", Summary: "更新主控", Request: endpoint.UpdateEndpointRequest{}, Response: endpoint.EndpointResponse{}},
+	{Method: "DELETE", Path: "/api/endpoints/{id}", Tag: "endpoints", Summary: "删除主控", Response: endpoint.EndpointResponse{}},
+	{Method: "PATCH", Path: "/api/endpoints/{id}", Tag: "endpoints", Summary: "主控操作（重命名、重连、断开等）", Request: map[string]interface{}{}, Response: endpoint.EndpointResponse{}},
+	{Method: "PATCH", Path: "/api/endpoints", Tag: "endpoints", Summary: "主控操作（请求体中指定 id）", Request: map[string]interface{}{}, Response: endpoint.EndpointResponse{}},
+	{Method: "GET", Path: "/api/endpoints/simple", Tag: "endpoints", Summary: "主控简要列表", Response: []endpoint.SimpleEndpoint{}, Query: []string{"excludeFailed"}},
+	{Method: "POST", Path: "/api/endpoints/test", Tag: "endpoints", Summary: "测试主控连接", Request: TestConnectionRequest{}},
+	{Method: "GET", Path: "/api/endpoints/status", Tag: "endpoints", Summary: "主控状态推送", Produces: "text/event-stream"},
+	{Method: "GET", Path: "/api/endpoints/{id}/detail", Tag: "endpoints", Summary: "主控详情", Response: endpoint.EndpointResponse{}},
+	{Method: "GET", Path: "/api/endpoints/{id}/secret", Tag: "endpoints", Summary: "查看主控 API Key 原文（管理员，记录审计日志）"},
+	{Method: "GET", Path: "/api/endpoints/{id}/info", Tag: "endpoints", Summary: "刷新并返回主控系统信息", Response: endpoint.EndpointResponse{}},
+	{Method: "GET", Path: "/api/endpoints/{id}/logs", Tag: "endpoints", Summary: "主控事件日志", Query: []string{"limit"}},
+	{Method: "GET", Path: "/api/endpoints/{id}/logs/search", Tag: "endpoints", Summary: "搜索主控事件日志", Query: []string{"start", "end", "level", "instanceId", "page", "size"}},
+	{Method: "GET", Path: "/api/endpoints/{id}/file-logs", Tag: "endpoints", Summary: "主控文件日志", Query: []string{"instanceId", "date", "days"}},
+	{Method: "DELETE", Path: "/api/endpoints/{id}/file-logs/clear", Tag: "endpoints", Summary: "清空主控文件日志", Query: []string{"instanceId"}},
+	{Method: "GET", Path: "/api/endpoints/{id}/stats", Tag: "endpoints", Summary: "主控统计信息"},
+	{Method: "GET", Path: "/api/endpoints/{id}/recycle", Tag: "recycle", Summary: "主控回收站列表"},
+	{Method: "GET", Path: "/api/endpoints/{id}/recycle/count", Tag: "recycle", Summary: "主控回收站数量"},
+	{Method: "DELETE", Path: "/api/endpoints/{endpointId}/recycle/{recycleId}", Tag: "recycle", Summary: "删除回收站记录"},
+	{Method: "GET", Path: "/api/recycle", Tag: "recycle", Summary: "全局回收站列表"},
+	{Method: "DELETE", Path: "/api/recycle", Tag: "recycle", Summary: "清空全局回收站"},
+
+	// 实例
+	{Method: "GET", Path: "/api/endpoints/{endpointId}/instances", Tag: "instances", Summary: "主控上的实例列表", Response: []instance.Instance{}},
+	{Method: "GET", Path: "/api/endpoints/{endpointId}/instances/{instanceId}", Tag: "instances", Summary: "实例详情", Response: instance.Instance{}},
+	{Method: "POST", Path: "/api/endpoints/{endpointId}/instances/{instanceId}/control", Tag: "instances", Summary: "控制实例（start / stop / restart）"},
+
+	// SSE
+	{Method: "GET", Path: "/api/sse/global", Tag: "sse", Summary: "全局事件流（支持 Last-Event-ID 断线续传及按主控、标签、分组、事件类型过滤）", Query: []string{"lastEventId", "endpointIds", "tagIds", "groupIds", "eventTypes", "statusOnly"}, Produces: "text/event-stream"},
+	{Method: "GET", Path: "/api/sse/tunnel/{tunnelId}", Tag: "sse", Summary: "单个隧道的事件流（支持 Last-Event-ID 断线续传）", Query: []string{"lastEventId"}, Produces: "text/event-stream"},
+	{Method: "GET", Path: "/api/sse/nodepass-proxy", Tag: "sse", Summary: "代理主控的事件流", Query: []string{"endpointId"}, Produces: "text/event-stream"},
+	{Method: "POST", Path: "/api/sse/test", Tag: "sse", Summary: "测试主控 SSE 连接"},
+	{Method: "GET", Path: "/api/sse/status", Tag: "sse", Summary: "SSE 连接状态"},
+	{Method: "GET", Path: "/api/ws", Tag: "sse", Summary: "WebSocket 推送（在一个连接上订阅全局、隧道及主控日志事件）"},
+	{Method: "GET", Path: "/api/sse/log-cleanup/stats", Tag: "sse", Summary: "日志清理统计"},
+	{Method: "GET", Path: "/api/sse/log-cleanup/config", Tag: "sse", Summary: "日志清理配置"},
+	{Method: "POST", Path: "/api/sse/log-cleanup/config", Tag: "sse", Summary: "修改日志清理配置"},
+	{Method: "POST", Path: "/api/sse/log-cleanup/trigger", Tag: "sse", Summary: "立即执行日志清理"},
+	{Method: "GET", Path: "/api/sse/log-cleanup/history", Tag: "sse", Summary: "日志清理历史"},
+	{Method: "GET", Path: "/api/sse/endpoint-stats", Tag: "sse", Summary: "主控事件记录统计"},
+	{Method: "DELETE", Path: "/api/sse/endpoint-clear", Tag: "sse", Summary: "清空主控事件记录", Query: []string{"endpointId"}},
+
+	// 标签
+	{Method: "GET", Path: "/api/tags", Tag: "tags", Summary: "标签列表", Response: tag.TagResponse{}},
+	{Method: "POST", Path: "/api/tags", Tag: "tags", Summary: "创建标签", Request: tag.CreateTagRequest{}, Response: tag.TagResponse{}},
+	{Method: "PUT", Path: "/api/tags/{id}", Tag: "tags", Summary: "更新标签", Request: tag.UpdateTagRequest{}, Response: tag.TagResponse{}},
+	{Method: "DELETE", Path: "/api/tags/{id}", Tag: "tags", Summary: "删除标签", Response: tag.TagResponse{}},
+	{Method: "GET", Path: "/api/tunnels/{tunnelId}/tag", Tag: "tags", Summary: "隧道的标签", Response: tag.TagResponse{}},
+	{Method: "POST", Path: "/api/tunnels/{tunnelId}/tag", Tag: "tags", Summary: "为隧道设置标签", Request: tag.AssignTagRequest{}, Response: tag.TagResponse{}},
+
+	// 隧道
+	{Method: "GET", Path: "/api/tunnels", Tag: "tunnels", Summary: "分页查询隧道列表（不带任何查询参数时返回全部隧道的数组）", Response: tunnel.ListPage{},
+		Query: []string{"page", "pageSize", "cursor", "sort", "order", "endpointId", "status", "mode", "tagId", "groupId", "name", "portFrom", "portTo"}},
+	{Method: "POST", Path: "/api/tunnels", Tag: "tunnels", Summary: "创建隧道", Request: tunnel.CreateTunnelRequest{}, Response: tunnel.TunnelResponse{}},
+	{Method: "POST", Path: "/api/tunnels/batch", Tag: "tunnels", Summary: "批量创建隧道", Request: tunnel.BatchCreateTunnelRequest{}, Response: tunnel.BatchCreateTunnelResponse{}},
+	{Method: "POST", Path: "/api/tunnels/batch-new", Tag: "tunnels", Summary: "批量创建隧道（标准 / 配置模式）", Request: tunnel.NewBatchCreateRequest{}, Response: tunnel.NewBatchCreateResponse{}},
+	{Method: "DELETE", Path: "/api/tunnels/batch", Tag: "tunnels", Summary: "批量删除隧道"},
+	{Method: "POST", Path: "/api/tunnels/batch/action", Tag: "tunnels", Summary: "批量启动 / 停止 / 重启隧道"},
+	{Method: "POST", Path: "/api/tunnels/quick", Tag: "tunnels", Summary: "通过 URL 快速创建隧道", Response: tunnel.TunnelResponse{}},
+	{Method: "POST", Path: "/api/tunnels/quick-batch", Tag: "tunnels", Summary: "通过多条 URL 批量快速创建隧道", Response: tunnel.TunnelResponse{}},
+	{Method: "POST", Path: "/api/tunnels/template", Tag: "tunnels", Summary: "按模板创建隧道", Response: tunnel.TunnelResponse{}},
+	{Method: "PATCH", Path: "/api/tunnels", Tag: "tunnels", Summary: "隧道操作（请求体中指定 id）", Request: tunnel.TunnelActionRequest{}, Response: tunnel.TunnelResponse{}},
+	{Method: "PATCH", Path: "/api/tunnels/{id}", Tag: "tunnels", Summary: "隧道操作或重命名", Request: tunnel.TunnelActionRequest{}, Response: tunnel.TunnelResponse{}},
+	{Method: "PATCH", Path: "/api/tunnels/{id}/attributes", Tag: "tunnels", Summary: "修改隧道属性", Request: map[string]interface{}{}, Response: tunnel.TunnelResponse{}},
+	{Method: "PATCH", Path: "/api/tunnels/{id}/restart", Tag: "tunnels", Summary: "设置隧道自动重启", Response: tunnel.TunnelResponse{}},
+	{Method: "GET", Path: "/api/tunnels/{id}", Tag: "tunnels", Summary: "隧道信息", Response: []tunnel.TunnelWithStats{}},
+	{Method: "PUT", Path: "/api/tunnels/{id}", Tag: "tunnels", Summary: "更新隧道配置", Request: tunnel.CreateTunnelRequest{}, Response: tunnel.TunnelResponse{}},
+	{Method: "DELETE", Path: "/api/tunnels/{id}", Tag: "tunnels", Summary: "删除隧道", Response: tunnel.TunnelResponse{}},
+	{Method: "PATCH", Path: "/api/tunnels/{id}/status", Tag: "tunnels", Summary: "控制隧道", Request: tunnel.TunnelActionRequest{}, Response: tunnel.TunnelResponse{}},
+	{Method: "POST", Path: "/api/tunnels/{id}/action", Tag: "tunnels", Summary: "控制隧道", Request: tunnel.TunnelActionRequest{}, Response: tunnel.TunnelResponse{}},
+	{Method: "GET", Path: "/api/tunnels/{id}/details", Tag: "tunnels", Summary: "隧道详情"},
+	{Method: "GET", Path: "/api/tunnels/{id}/logs", Tag: "tunnels", Summary: "隧道事件日志"},
+	{Method: "GET", Path: "/api/tunnels/{id}/traffic-trend", Tag: "tunnels", Summary: "隧道流量趋势"},
+	{Method: "GET", Path: "/api/tunnels/{id}/ping-trend", Tag: "tunnels", Summary: "隧道延迟趋势"},
+	{Method: "GET", Path: "/api/tunnels/{id}/pool-trend", Tag: "tunnels", Summary: "隧道连接池趋势"},
+	{Method: "GET", Path: "/api/tunnels/{id}/export-logs", Tag: "tunnels", Summary: "导出隧道日志", Produces: "application/zip"},
+	{Method: "GET", Path: "/api/dashboard/logs", Tag: "tunnels", Summary: "隧道操作日志", Query: []string{"limit"}},
+	{Method: "DELETE", Path: "/api/dashboard/logs", Tag: "tunnels", Summary: "清空隧道操作日志"},
+
+	// 仪表盘与系统
+	{Method: "GET", Path: "/api/health", Tag: "system", Summary: "健康检查"},
+	{Method: "GET", Path: "/api/error-codes", Tag: "system", Summary: "/api/v2 错误码目录"},
+	{Method: "GET", Path: "/api/openapi.json", Tag: "system", Summary: "OpenAPI 文档"},
+	{Method: "GET", Path: "/metrics", Tag: "system", Summary: "Prometheus 指标（管理员，API 令牌需 metrics:read）", Produces: "text/plain"},
+	{Method: "GET", Path: "/api/dashboard/traffic-trend", Tag: "dashboard", Summary: "流量趋势", Response: []dashboard.TrafficTrendItem{}, Field: "data", Query: []string{"hours"}},
+	{Method: "GET", Path: "/api/dashboard/stats", Tag: "dashboard", Summary: "仪表盘统计数据", Response: dashboard.DashboardStats{}, Query: []string{"range"}},
+	{Method: "GET", Path: "/api/data/export", Tag: "data", Summary: "导出主控与隧道数据", Produces: "application/json"},
+	{Method: "POST", Path: "/api/data/import", Tag: "data", Summary: "导入主控与隧道数据"},
+
+	// 版本
+	{Method: "GET", Path: "/api/version/current", Tag: "version", Summary: "当前版本", Response: VersionInfo{}, Field: "data"},
+	{Method: "GET", Path: "/api/version/check-update", Tag: "version", Summary: "检查更新", Response: UpdateInfo{}, Field: "data"},
+	{Method: "GET", Path: "/api/version/update-info", Tag: "version", Summary: "最新版本信息", Response: UpdateInfo{}, Field: "data"},
+	{Method: "GET", Path: "/api/version/history", Tag: "version", Summary: "版本发布历史", Response: []GitHubRelease{}, Field: "data"},
+	{Method: "GET", Path: "/api/version/deployment-info", Tag: "version", Summary: "部署方式信息", Response: DeploymentInfo{}, Field: "data"},
+	{Method: "POST", Path: "/api/version/auto-update", Tag: "version", Summary: "自动更新", Response: UpdateResult{}, Field: "data"},
+
+	// 分组
+	{Method: "GET", Path: "/api/groups", Tag: "groups", Summary: "分组列表", Response: []models.TunnelGroupWithMembers{}},
+	{Method: "POST", Path: "/api/groups", Tag: "groups", Summary: "创建分组", Request: models.CreateTunnelGroupRequest{}},
+	{Method: "PUT", Path: "/api/groups/{id}", Tag: "groups", Summary: "更新分组", Request: models.UpdateTunnelGroupRequest{}},
+	{Method: "DELETE", Path: "/api/groups/{id}", Tag: "groups", Summary: "删除分组"},
+	{Method: "POST", Path: "/api/groups/from-template", Tag: "groups", Summary: "按模板创建分组"},
+}
+
+// pathParamPattern mux 路由模板中的路径参数，如 {id} 或 {id:[0-9]+}
+var pathParamPattern = regexp.MustCompile(`\{(\w+)(?::([^}]+))?\}`)
+
+var (
+	openAPIOnce sync.Once
+	openAPIDoc  []byte
+)
+
+// HandleOpenAPI 返回 OpenAPI 3 文档 (GET /api/openapi.json)
+func HandleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	openAPIOnce.Do(func() {
+		openAPIDoc, _ = json.MarshalIndent(buildOpenAPISpec(), "", "  ")
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPIDoc)
+}
+
+// operationKey 路由在文档中的唯一标识
+func operationKey(method, path string) string {
+	return strings.ToUpper(method) + " " + path
+}
+
+// CheckOpenAPI 检查已注册的路由与 OpenAPI 文档是否一致，不一致时返回列出差异的错误
+func (r *Router) CheckOpenAPI() error {
+	undocumented, stale := r.openAPIMismatch()
+	if len(undocumented) == 0 && len(stale) == 0 {
+		return nil
+	}
+	var b strings.Builder
+	if len(undocumented) > 0 {
+		fmt.Fprintf(&b, "以下路由未登记到 OpenAPI 文档 (internal/api/openapi.go):\n  %s", strings.Join(undocumented, "\n  "))
+	}
+	if len(stale) > 0 {
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "以下 OpenAPI 文档中的接口未注册路由:\n  %s", strings.Join(stale, "\n  "))
+	}
+	return errors.New(b.String())
+}
+
+// openAPIMismatch 返回未登记到文档的路由及文档中已不存在的路由
+func (r *Router) openAPIMismatch() (undocumented, stale []string) {
+	documented := make(map[string]bool, len(apiOperations))
+	for _, op := range apiOperations {
+		documented[operationKey(op.Method, op.Path)] = true
+	}
+
+	registered := map[string]bool{}
+	r.router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			methods = []string{"GET"}
+		}
+		for _, m := range methods {
+			key := operationKey(m, path)
+			registered[key] = true
+			if !documented[key] {
+				undocumented = append(undocumented, key)
+			}
+		}
+		return nil
+	})
+	for key := range documented {
+		if !registered[key] {
+			stale = append(stale, key)
+		}
+	}
+	sort.Strings(undocumented)
+	sort.Strings(stale)
+	return undocumented, stale
+}
+
+// buildOpenAPISpec 根据 apiOperations 生成 OpenAPI 3 文档
+func buildOpenAPISpec() map[string]interface{} {
+	g := &schemaGenerator{schemas: map[string]interface{}{}}
+
+	g.schemas["SuccessResponse"] = map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"success": map[string]interface{}{"type": "boolean"},
+			"message": map[string]interface{}{"type": "string"},
+		},
+		"additionalProperties": true,
+	}
+	g.schemas["ErrorResponse"] = map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"success": map[string]interface{}{"type": "boolean"},
+			"error":   map[string]interface{}{"type": "string"},
+		},
+		"additionalProperties": true,
+	}
+	g.schemaFor(reflect.TypeOf(Envelope{}))
+
+	paths := map[string]interface{}{}
+	for _, op := range apiOperations {
+		path, params := openAPIPath(op.Path)
+		item, _ := paths[path].(map[string]interface{})
+		if item == nil {
+			item = map[string]interface{}{}
+			paths[path] = item
+		}
+
+		if idempotentRoutes[operationKey(op.Method, op.Path)] {
+			params = append(params, map[string]interface{}{
+				"name": idempotencyKeyHeader, "in": "header", "required": false,
+				"description": "重试时携带相同的值，24 小时内重放首次请求的响应",
+				"schema":      map[string]interface{}{"type": "string", "maxLength": idempotency.MaxKeyLength},
+			})
+		}
+		if rr, ok := revisionRoutes[operationKey(op.Method, op.Path)]; ok && rr.precondition != preconditionNone {
+			description := "资源的 ETag，未携带返回 428，与当前修订号不一致返回 412 及资源的当前状态"
+			if rr.precondition == preconditionRename {
+				description = "action 为 rename 时必填：" + description
+			}
+			params = append(params, map[string]interface{}{
+				"name": ifMatchHeader, "in": "header", "required": rr.precondition == preconditionAlways,
+				"description": description,
+				"schema":      map[string]interface{}{"type": "string"},
+			})
+		}
+		for _, q := range op.Query {
+			params = append(params, map[string]interface{}{
+				"name": q, "in": "query", "required": false,
+				"schema": map[string]interface{}{"type": "string"},
+			})
+		}
+
+		operation := map[string]interface{}{
+			"tags":        []string{op.Tag},
+			"summary":     op.Summary,
+			"operationId": operationID(op),
+			"responses": map[string]interface{}{
+				"200": map[string]interface{}{
+					"description": "成功",
+					"content":     g.responseContent(op),
+				},
+				"default": map[string]interface{}{
+					"description": "失败",
+					"content": map[string]interface{}{
+						"application/json": map[string]interface{}{"schema": schemaRef("ErrorResponse")},
+					},
+				},
+			},
+		}
+		if len(params) > 0 {
+			operation["parameters"] = params
+		}
+		if op.Request != nil {
+			operation["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": g.schemaFor(reflect.TypeOf(op.Request))},
+				},
+			}
+		}
+		if isPublicRoute(op.Path) {
+			operation["security"] = []interface{}{}
+		}
+		item[strings.ToLower(op.Method)] = operation
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "NodePassDash API",
+			"version": Version,
+			"description": "NodePassDash 管理接口。/api/v2/... 与 /api/... 使用相同的路由与参数，" +
+				"响应统一为 Envelope 结构，错误码见 GET /api/error-codes。" +
+				"修改类请求需携带与 csrf_token cookie 一致的 X-CSRF-Token 请求头（使用 Bearer 令牌时除外）。",
+		},
+		"tags":  openAPITags(),
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": g.schemas,
+			"securitySchemes": map[string]interface{}{
+				"session": map[string]interface{}{"type": "apiKey", "in": "cookie", "name": "session"},
+				"bearer":  map[string]interface{}{"type": "http", "scheme": "bearer", "description": "API 令牌"},
+			},
+		},
+		"security": []interface{}{
+			map[string]interface{}{"session": []string{}},
+			map[string]interface{}{"bearer": []string{}},
+		},
+	}
+}
+
+// openAPITags 按首次出现的顺序列出接口分类
+func openAPITags() []interface{} {
+	seen := map[string]bool{}
+	tags := []interface{}{}
+	for _, op := range apiOperations {
+		if !seen[op.Tag] {
+			seen[op.Tag] = true
+			tags = append(tags, map[string]interface{}{"name": op.Tag})
+		}
+	}
+	return tags
+}
+
+// openAPIPath 将 mux 路由模板转换为 OpenAPI 路径，并生成路径参数
+func openAPIPath(template string) (string, []interface{}) {
+	var params []interface{}
+	for _, m := range pathParamPattern.FindAllStringSubmatch(template, -1) {
+		schema := map[string]interface{}{"type": "string"}
+		if m[2] != "" {
+			schema["pattern"] = "^" + m[2] + "$"
+		}
+		params = append(params, map[string]interface{}{
+			"name": m[1], "in": "path", "required": true, "schema": schema,
+		})
+	}
+	return pathParamPattern.ReplaceAllString(template, "{$1}"), params
+}
+
+// operationID 由方法和路径生成唯一的 operationId，如 GET /api/tunnels/{id} → getTunnelsById
+func operationID(op apiOperation) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(op.Method))
+	path, _ := openAPIPath(op.Path)
+	for _, seg := range strings.Split(strings.TrimPrefix(path, "/api/"), "/") {
+		if strings.HasPrefix(seg, "{") {
+			seg = "by-" + strings.Trim(seg, "{}")
+		}
+		for _, word := range strings.FieldsFunc(seg, func(r rune) bool { return r == '-' || r == '_' || r == '.' }) {
+			b.WriteString(strings.ToUpper(word[:1]) + word[1:])
+		}
+	}
+	return b.String()
+}
+
+// responseContent 成功响应的内容描述
+func (g *schemaGenerator) responseContent(op apiOperation) map[string]interface{} {
+	if op.Produces != "" && op.Produces != "application/json" {
+		return map[string]interface{}{op.Produces: map[string]interface{}{"schema": map[string]interface{}{"type": "string"}}}
+	}
+
+	var schema map[string]interface{}
+	switch {
+	case op.Response == nil:
+		schema = schemaRef("SuccessResponse")
+	case op.Field == "":
+		schema = g.schemaFor(reflect.TypeOf(op.Response))
+	default:
+		schema = map[string]interface{}{
+			"allOf": []interface{}{
+				schemaRef("SuccessResponse"),
+				map[string]interface{}{
+					"type":       "object",
+					"properties": map[string]interface{}{op.Field: g.schemaFor(reflect.TypeOf(op.Response))},
+				},
+			},
+		}
+	}
+	return map[string]interface{}{"application/json": map[string]interface{}{"schema": schema}}
+}
+
+// schemaGenerator 通过反射将 Go 类型转换为 JSON Schema，命名结构体登记到 components.schemas
+type schemaGenerator struct {
+	schemas map[string]interface{}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func schemaRef(name string) map[string]interface{} {
+	return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+}
+
+// schemaName 命名结构体在文档中的名称：包名.类型名，api 包内的类型省略包名
+func schemaName(t reflect.Type) string {
+	pkg := t.PkgPath()
+	if i := strings.LastIndex(pkg, "/"); i >= 0 {
+		pkg = pkg[i+1:]
+	}
+	if pkg == "api" || pkg == "" {
+		return t.Name()
+	}
+	return pkg + "." + t.Name()
+}
+
+// schemaFor 返回类型对应的 schema
+func (g *schemaGenerator) schemaFor(t reflect.Type) map[string]interface{} {
+	nullable := false
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+		nullable = true
+	}
+
+	var schema map[string]interface{}
+	switch {
+	case t == timeType:
+		schema = map[string]interface{}{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.Struct && t.Name() != "":
+		name := schemaName(t)
+		if _, ok := g.schemas[name]; !ok {
+			// 先占位，避免自引用的类型无限递归
+			g.schemas[name] = map[string]interface{}{}
+			g.schemas[name] = g.structSchema(t)
+		}
+		if nullable {
+			return map[string]interface{}{"allOf": []interface{}{schemaRef(name)}, "nullable": true}
+		}
+		return schemaRef(name)
+	case t.Kind() == reflect.Struct:
+		schema = g.structSchema(t)
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8:
+		schema = map[string]interface{}{"type": "string", "format": "byte"}
+	case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+		schema = map[string]interface{}{"type": "array", "items": g.schemaFor(t.Elem())}
+	case t.Kind() == reflect.Map:
+		schema = map[string]interface{}{"type": "object", "additionalProperties": g.schemaFor(t.Elem())}
+	case t.Kind() == reflect.Interface:
+		schema = map[string]interface{}{}
+	case t.Kind() == reflect.Bool:
+		schema = map[string]interface{}{"type": "boolean"}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		format := "int32"
+		if t.Kind() == reflect.Int64 || t.Kind() == reflect.Uint64 || t.Kind() == reflect.Int || t.Kind() == reflect.Uint {
+			format = "int64"
+		}
+		schema = map[string]interface{}{"type": "integer", "format": format}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		schema = map[string]interface{}{"type": "number"}
+	case t.Kind() == reflect.String:
+		schema = map[string]interface{}{"type": "string"}
+	default:
+		schema = map[string]interface{}{}
+	}
+	if nullable {
+		schema["nullable"] = true
+	}
+	return schema
+}
+
+// structSchema 按 json 标签生成结构体的 schema，匿名嵌入的结构体字段展开到外层；
+// validate 标签含 required 的字段标记为必填
+func (g *schemaGenerator) structSchema(t reflect.Type) map[string]interface{} {
+	props := map[string]interface{}{}
+	var required []string
+	g.collectFields(t, props, &required)
+
+	schema := map[string]interface{}{"type": "object", "properties": props}
+	if len(required) > 0 {
+		sort.Strings(required)
+		schema["required"] = required
+	}
+	return schema
+}
+
+func (g *schemaGenerator) collectFields(t reflect.Type, props map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tagValue := f.Tag.Get("json")
+		if tagValue == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tagValue, ",")
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				g.collectFields(ft, props, required)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		schema := g.schemaFor(f.Type)
+		if strings.Contains(opts, "string") {
+			schema = map[string]interface{}{"type": "string"}
+		}
+		props[name] = schema
+		if strings.Contains(f.Tag.Get("validate"), "required") {
+			*required = append(*required, name)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"NodePassDash/internal/db/dbtest"
+	"NodePassDash/internal/endpoint"
+	"NodePassDash/internal/sse"
+	"NodePassDash/internal/webhook"
+)
+
+// newTestRouter 以临时数据库创建完整的路由器；SSE 文件日志写入临时目录
+func newTestRouter(t *testing.T) *Router {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	db := dbtest.Open(t)
+	sseService := sse.NewService(db, endpoint.NewService(db))
+	t.Cleanup(sseService.Close)
+	sseManager := sse.NewManager(db, sseService)
+	webhookService := webhook.NewService(db)
+	return NewRouter(db, sseService, sseManager, webhookService)
+}
+
+func TestOpenAPICoversAllRoutes(t *testing.T) {
+	r := newTestRouter(t)
+
+	undocumented, stale := r.openAPIMismatch()
+	if len(undocumented) > 0 {
+		t.Errorf("routes missing from the OpenAPI spec (internal/api/openapi.go):\n  %s", strings.Join(undocumented, "\n  "))
+	}
+	if len(stale) > 0 {
+		t.Errorf("OpenAPI operations without a registered route:\n  %s", strings.Join(stale, "\n  "))
+	}
+}
+
+func TestOpenAPIOperationIDsUnique(t *testing.T) {
+	seen := map[string]string{}
+	for _, op := range apiOperations {
+		id := operationID(op)
+		key := operationKey(op.Method, op.Path)
+		if prev, ok := seen[id]; ok {
+			t.Errorf("operationId %q used by both %s and %s", id, prev, key)
+		}
+		seen[id] = key
+	}
+}
@@ -0,0 +1,294 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"NodePassDash/internal/endpoint"
+	log "NodePassDash/internal/log"
+	"NodePassDash/internal/tunnel"
+	"NodePassDash/internal/workspace"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	ifMatchHeader = "If-Match"
+	etagHeader    = "ETag"
+)
+
+// revisionResource 带配置修订号的资源
+type revisionResource struct {
+	table    string // 数据表
+	field    string // 412 / 428 响应中当前状态的字段名
+	notFound string // 资源不存在或不可见时的错误信息
+}
+
+var (
+	tunnelRevision   = revisionResource{table: "Tunnel", field: "tunnel", notFound: "隧道不存在"}
+	endpointRevision = revisionResource{table: "Endpoint", field: "endpoint", notFound: "主控不存在"}
+)
+
+// precondition 何时要求 If-Match
+type precondition int
+
+const (
+	// preconditionNone 只返回 ETag
+	preconditionNone precondition = iota
+	// preconditionAlways 修改配置的请求，须携带 If-Match
+	preconditionAlways
+	// preconditionRename 仅 action 为 rename 时须携带 If-Match，启停等生命周期操作不受限制
+	preconditionRename
+)
+
+// revisionRoute 路由对应的资源及条件请求要求
+type revisionRoute struct {
+	resource     revisionResource
+	precondition precondition
+}
+
+// revisionRoutes 支持 ETag 的路由（方法 + 路由模板）
+var revisionRoutes = map[string]revisionRoute{
+	"GET /api/tunnels/{id}":              {tunnelRevision, preconditionNone},
+	"GET /api/tunnels/{id}/details":      {tunnelRevision, preconditionNone},
+	"GET /api/endpoints/{id}/detail":     {endpointRevision, preconditionNone},
+	"PUT /api/tunnels/{id}":              {tunnelRevision, preconditionAlways},
+	"PATCH /api/tunnels/{id}/attributes": {tunnelRevision, preconditionAlways},
+	"PATCH /api/tunnels/{id}/restart":    {tunnelRevision, preconditionAlways},
+	"PATCH /api/tunnels/{id}":            {tunnelRevision, preconditionRename},
+	"PATCH /api/tunnels":                 {tunnelRevision, preconditionRename},
+	"PUT /api/endpoints/{id}":            {endpointRevision, preconditionAlways},
+	"PATCH /api/endpoints/{id}":          {endpointRevision, preconditionRename},
+	"PATCH /api/endpoints":               {endpointRevision, preconditionRename},
+}
+
+// revisionLocks 按资源串行化条件请求，保证校验修订号与写入之间不会插入其他修改
+type revisionLocks struct {
+	mu    sync.Mutex
+	locks map[string]*revisionLock
+}
+
+type revisionLock struct {
+	sync.Mutex
+	refs int
+}
+
+// lock 锁定资源，返回解锁函数
+func (l *revisionLocks) lock(key string) func() {
+	l.mu.Lock()
+	lk, ok := l.locks[key]
+	if !ok {
+		lk = &revisionLock{}
+		l.locks[key] = lk
+	}
+	lk.refs++
+	l.mu.Unlock()
+
+	lk.Lock()
+	return func() {
+		lk.Unlock()
+		l.mu.Lock()
+		lk.refs--
+		if lk.refs == 0 {
+			delete(l.locks, key)
+		}
+		l.mu.Unlock()
+	}
+}
+
+// preconditionMiddleware 为隧道与主控返回基于修订号的 ETag，修改配置时要求 If-Match：
+// 未携带返回 428，与当前修订号不一致返回 412 及资源的当前状态
+func preconditionMiddleware(db *sql.DB, tunnelService *tunnel.Service, endpointService *endpoint.Service) mux.MiddlewareFunc {
+	locks := &revisionLocks{locks: map[string]*revisionLock{}}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route := mux.CurrentRoute(r)
+			if route == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			tpl, err := route.GetPathTemplate()
+			if err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			rr, ok := revisionRoutes[r.Method+" "+tpl]
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			id, _ := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+			required := rr.precondition == preconditionAlways
+			if rr.precondition == preconditionRename {
+				body, err := io.ReadAll(r.Body)
+				if err != nil {
+					writePreconditionError(w, http.StatusBadRequest, ErrBadRequest, "读取请求体失败", "", nil)
+					return
+				}
+				r.Body = io.NopCloser(bytes.NewReader(body))
+				var req struct {
+					ID     int64  `json:"id"`
+					Action string `json:"action"`
+				}
+				_ = json.Unmarshal(body, &req)
+				if id == 0 {
+					id = req.ID
+				}
+				required = req.Action == "rename"
+			}
+			if id <= 0 {
+				// 无需校验的请求缺少 ID 时交由处理器返回错误，须校验的修改直接拒绝
+				if r.Method == http.MethodGet || !required {
+					next.ServeHTTP(w, r)
+					return
+				}
+				writePreconditionError(w, http.StatusBadRequest, ErrBadRequest, "缺少资源 ID", "", nil)
+				return
+			}
+
+			scope := workspace.ScopeFromContext(r.Context())
+			if r.Method == http.MethodGet || !required {
+				// 先读取修订号再生成响应，响应期间发生的修改只会导致后续请求 412，不会被覆盖
+				if rev, found, err := resourceRevision(db, rr.resource, id, scope); err == nil && found {
+					w.Header().Set(etagHeader, formatETag(rev))
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			unlock := locks.lock(rr.resource.table + ":" + strconv.FormatInt(id, 10))
+			defer unlock()
+
+			rev, found, err := resourceRevision(db, rr.resource, id, scope)
+			if err != nil {
+				log.Errorf("[API] 读取%s修订号失败: %v", rr.resource.table, err)
+				writePreconditionError(w, http.StatusInternalServerError, ErrInternal, "读取资源修订号失败", "", nil)
+				return
+			}
+			// 资源不存在或不在可见工作区内时一律返回 404，不放行未经校验的修改
+			if !found {
+				writeNotFound(w, rr.resource.notFound)
+				return
+			}
+
+			ifMatch := r.Header.Get(ifMatchHeader)
+			if ifMatch == "" || !etagMatches(ifMatch, rev) {
+				status, code, message := http.StatusPreconditionFailed, ErrPreconditionFailed, "资源已被修改，请刷新后重试"
+				if ifMatch == "" {
+					status, code, message = http.StatusPreconditionRequired, ErrPreconditionRequired, "修改前须通过 If-Match 请求头携带资源的 ETag"
+				}
+				var current interface{}
+				switch rr.resource {
+				case tunnelRevision:
+					current, err = tunnelService.GetTunnelWithStats(id)
+				case endpointRevision:
+					current, err = endpointService.GetEndpointByID(id)
+				}
+				if err != nil {
+					log.Warnf("[API] 读取%s当前状态失败: %v", rr.resource.table, err)
+					current = nil
+				}
+				w.Header().Set(etagHeader, formatETag(rev))
+				writePreconditionError(w, status, code, message, rr.resource.field, current)
+				return
+			}
+
+			next.ServeHTTP(&etagResponseWriter{ResponseWriter: w, onSuccess: func() {
+				if rev, found, err := resourceRevision(db, rr.resource, id, scope); err == nil && found {
+					w.Header().Set(etagHeader, formatETag(rev))
+				}
+			}}, r)
+		})
+	}
+}
+
+// resourceRevision 读取资源的修订号；资源不存在或不在可见工作区内时 found 为 false
+func resourceRevision(db *sql.DB, res revisionResource, id int64, scope workspace.Scope) (rev int64, found bool, err error) {
+	var workspaceID sql.NullInt64
+	switch res {
+	case tunnelRevision:
+		err = db.QueryRow(`SELECT t.revision, e.workspaceId FROM "Tunnel" t LEFT JOIN "Endpoint" e ON t.endpointId = e.id WHERE t.id = ?`, id).
+			Scan(&rev, &workspaceID)
+	case endpointRevision:
+		err = db.QueryRow(`SELECT revision, workspaceId FROM "Endpoint" WHERE id = ?`, id).Scan(&rev, &workspaceID)
+	}
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	if !scope.Allows(workspaceID.Int64) {
+		return 0, false, nil
+	}
+	return rev, true, nil
+}
+
+// formatETag 修订号对应的强 ETag
+func formatETag(rev int64) string {
+	return `"` + strconv.FormatInt(rev, 10) + `"`
+}
+
+// etagMatches 判断 If-Match 是否包含当前修订号；反向代理压缩响应时可能将 ETag 改为弱 ETag，
+// 因此忽略 W/ 前缀，* 匹配任意修订号
+func etagMatches(ifMatch string, rev int64) bool {
+	current := formatETag(rev)
+	for _, tag := range strings.Split(ifMatch, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == current {
+			return true
+		}
+	}
+	return false
+}
+
+// writePreconditionError 写出条件请求相关的错误，field 非空时附带资源的当前状态
+func writePreconditionError(w http.ResponseWriter, status int, code ErrorCode, message, field string, current interface{}) {
+	body := map[string]interface{}{
+		"success": false,
+		"error":   message,
+		"code":    code,
+	}
+	if field != "" && current != nil {
+		body[field] = current
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// etagResponseWriter 在写出成功响应的状态码前设置新的 ETag
+type etagResponseWriter struct {
+	http.ResponseWriter
+	onSuccess   func()
+	wroteHeader bool
+}
+
+func (w *etagResponseWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if status < http.StatusBadRequest {
+			w.onSuccess()
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *etagResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap 供 http.ResponseController 获取原始 ResponseWriter
+func (w *etagResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
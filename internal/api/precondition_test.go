@@ -0,0 +1,151 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"NodePassDash/internal/endpoint"
+	"NodePassDash/internal/tunnel"
+	"NodePassDash/internal/workspace"
+
+	"github.com/gorilla/mux"
+)
+
+// newPreconditionRouter 注册经 preconditionMiddleware 的隧道路由；修改类处理器会更新隧道名称以递增修订号，
+// 返回的计数记录处理器被调用的次数
+func newPreconditionRouter(t *testing.T, db *sql.DB) (*mux.Router, *int) {
+	t.Helper()
+	calls := 0
+	ok := func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusOK)
+	}
+	rename := func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if _, err := db.Exec(`UPDATE "Tunnel" SET name = name || '-x' WHERE id = ?`, mux.Vars(r)["id"]); err != nil {
+			t.Error(err)
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	router := mux.NewRouter()
+	router.HandleFunc("/api/tunnels/{id}", ok).Methods("GET")
+	router.HandleFunc("/api/tunnels/{id}", rename).Methods("PUT")
+	router.HandleFunc("/api/tunnels/{id}", ok).Methods("PATCH")
+	router.HandleFunc("/api/tunnels", ok).Methods("PATCH")
+	router.Use(preconditionMiddleware(db, tunnel.NewService(db), endpoint.NewService(db)))
+	return router, &calls
+}
+
+// preconditionRequest 以默认工作区的可见范围发送请求，ifMatch 为空表示不携带
+func preconditionRequest(router http.Handler, method, target, body, ifMatch string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	r = r.WithContext(workspace.WithScope(r.Context(), workspace.Scope{IDs: []int64{1}}))
+	if ifMatch != "" {
+		r.Header.Set(ifMatchHeader, ifMatch)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	return w
+}
+
+func TestPreconditionETagOnRead(t *testing.T) {
+	router, _ := newPreconditionRouter(t, newScopeTestDB(t))
+
+	w := preconditionRequest(router, http.MethodGet, "/api/tunnels/1", "", "")
+	if w.Code != http.StatusOK || w.Header().Get(etagHeader) != `"1"` {
+		t.Fatalf("status = %d, ETag = %q; want 200 with \"1\"", w.Code, w.Header().Get(etagHeader))
+	}
+	// 其他工作区的隧道不返回 ETag
+	if w := preconditionRequest(router, http.MethodGet, "/api/tunnels/2", "", ""); w.Header().Get(etagHeader) != "" {
+		t.Fatalf("ETag leaked for hidden tunnel: %q", w.Header().Get(etagHeader))
+	}
+}
+
+func TestPreconditionRequiredWithoutIfMatch(t *testing.T) {
+	router, calls := newPreconditionRouter(t, newScopeTestDB(t))
+
+	for _, c := range []struct{ name, method, target, body string }{
+		{"update", http.MethodPut, "/api/tunnels/1", `{}`},
+		{"rename", http.MethodPatch, "/api/tunnels/1", `{"action":"rename","name":"x"}`},
+		{"rename by body id", http.MethodPatch, "/api/tunnels", `{"id":1,"action":"rename","name":"x"}`},
+	} {
+		w := preconditionRequest(router, c.method, c.target, c.body, "")
+		if w.Code != http.StatusPreconditionRequired {
+			t.Errorf("%s: status = %d, want 428; body: %s", c.name, w.Code, w.Body.String())
+			continue
+		}
+		var resp map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		if resp["code"] != string(ErrPreconditionRequired) || w.Header().Get(etagHeader) != `"1"` {
+			t.Errorf("%s: code = %v, ETag = %q", c.name, resp["code"], w.Header().Get(etagHeader))
+		}
+	}
+	if *calls != 0 {
+		t.Fatalf("handler called %d times without If-Match", *calls)
+	}
+
+	// 启停等生命周期操作无需 If-Match
+	if w := preconditionRequest(router, http.MethodPatch, "/api/tunnels/1", `{"action":"stop"}`, ""); w.Code != http.StatusOK || *calls != 1 {
+		t.Fatalf("lifecycle action: status = %d, calls = %d", w.Code, *calls)
+	}
+}
+
+func TestPreconditionFailedOnStaleETag(t *testing.T) {
+	router, calls := newPreconditionRouter(t, newScopeTestDB(t))
+
+	w := preconditionRequest(router, http.MethodPut, "/api/tunnels/1", `{}`, `"1"`)
+	if w.Code != http.StatusOK || w.Header().Get(etagHeader) != `"2"` {
+		t.Fatalf("status = %d, ETag = %q; want 200 with the new revision", w.Code, w.Header().Get(etagHeader))
+	}
+
+	// 以旧的 ETag 再次修改返回 412 及当前状态
+	w = preconditionRequest(router, http.MethodPut, "/api/tunnels/1", `{}`, `"1"`)
+	if w.Code != http.StatusPreconditionFailed {
+		t.Fatalf("status = %d, want 412; body: %s", w.Code, w.Body.String())
+	}
+	var resp map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp["code"] != string(ErrPreconditionFailed) || resp["tunnel"] == nil || w.Header().Get(etagHeader) != `"2"` {
+		t.Fatalf("body = %v, ETag = %q", resp, w.Header().Get(etagHeader))
+	}
+	if *calls != 1 {
+		t.Fatalf("handler called %d times, want 1", *calls)
+	}
+
+	// 弱 ETag 与 * 同样匹配
+	for _, ifMatch := range []string{`W/"2"`, `"0", "3"`, `*`} {
+		w := preconditionRequest(router, http.MethodPut, "/api/tunnels/1", `{}`, ifMatch)
+		if w.Code != http.StatusOK {
+			t.Fatalf("If-Match %s: status = %d", ifMatch, w.Code)
+		}
+	}
+}
+
+func TestPreconditionHidesOtherWorkspaces(t *testing.T) {
+	router, calls := newPreconditionRouter(t, newScopeTestDB(t))
+
+	cases := []struct {
+		name, method, target, body string
+		want                       int
+	}{
+		{"other workspace", http.MethodPut, "/api/tunnels/2", `{}`, http.StatusNotFound},
+		{"other workspace rename", http.MethodPatch, "/api/tunnels", `{"id":2,"action":"rename","name":"x"}`, http.StatusNotFound},
+		{"missing tunnel", http.MethodPut, "/api/tunnels/99", `{}`, http.StatusNotFound},
+		{"rename without id", http.MethodPatch, "/api/tunnels", `{"action":"rename","name":"x"}`, http.StatusBadRequest},
+	}
+	for _, c := range cases {
+		// 携带 * 也不能绕过可见范围校验
+		if w := preconditionRequest(router, c.method, c.target, c.body, "*"); w.Code != c.want {
+			t.Errorf("%s: status = %d, want %d; body: %s", c.name, w.Code, c.want, w.Body.String())
+		}
+	}
+	if *calls != 0 {
+		t.Fatalf("unverified writes reached the handler %d times", *calls)
+	}
+}
@@ -3,15 +3,19 @@ package api
 import (
 	"database/sql"
 	"net/http"
-	"strings"
 
+	"NodePassDash/internal/audit"
 	"NodePassDash/internal/auth"
 	"NodePassDash/internal/dashboard"
 	"NodePassDash/internal/endpoint"
+	"NodePassDash/internal/idempotency"
 	"NodePassDash/internal/instance"
+	"NodePassDash/internal/metrics"
 	"NodePassDash/internal/sse"
 	"NodePassDash/internal/tag"
 	"NodePassDash/internal/tunnel"
+	"NodePassDash/internal/webhook"
+	"NodePassDash/internal/workspace"
 
 	"github.com/gorilla/mux"
 )
@@ -29,11 +33,17 @@ type Router struct {
 	dataHandler      *DataHandler
 	versionHandler   *VersionHandler
 	groupHandler     *GroupHandler
+	userHandler      *UserHandler
+	workspaceHandler *WorkspaceHandler
+	auditHandler     *AuditHandler
+	webhookHandler   *WebhookHandler
+	metricsService   *metrics.Service
 }
 
 // NewRouter 创建路由器实例
-// 如果外部已创建 sseService / sseManager，则传入以复用，避免出现多个实例导致推流失效
-func NewRouter(db *sql.DB, sseService *sse.Service, sseManager *sse.Manager) *Router {
+// 如果外部已创建 sseService / sseManager，则传入以复用，避免出现多个实例导致推流失效；
+// webhookService 需与 sseService 共用同一实例，事件才会投递给订阅方
+func NewRouter(db *sql.DB, sseService *sse.Service, sseManager *sse.Manager, webhookService *webhook.Service) *Router {
 	// 创建路由器（忽略末尾斜杠差异）
 	router := mux.NewRouter()
 	router.StrictSlash(true)
@@ -44,6 +54,8 @@ func NewRouter(db *sql.DB, sseService *sse.Service, sseManager *sse.Manager) *Ro
 	instanceService := instance.NewService(db)
 	tunnelService := tunnel.NewService(db)
 	tagService := tag.NewService(db)
+	workspaceService := workspace.NewService(db)
+	auditService := audit.NewService(db)
 
 	if sseService == nil {
 		panic("sseService is nil")
@@ -51,6 +63,9 @@ func NewRouter(db *sql.DB, sseService *sse.Service, sseManager *sse.Manager) *Ro
 	if sseManager == nil {
 		panic("sseManager is nil")
 	}
+	if webhookService == nil {
+		panic("webhookService is nil")
+	}
 	dashboardService := dashboard.NewService(db)
 
 	// 创建处理器实例
@@ -58,12 +73,16 @@ func NewRouter(db *sql.DB, sseService *sse.Service, sseManager *sse.Manager) *Ro
 	endpointHandler := NewEndpointHandler(endpointService, sseManager)
 	instanceHandler := NewInstanceHandler(db, instanceService)
 	tunnelHandler := NewTunnelHandler(tunnelService, sseManager)
-	tagHandler := NewTagHandler(tagService)
+	tagHandler := NewTagHandler(tagService, tunnelService)
 	sseHandler := NewSSEHandler(sseService, sseManager)
 	dataHandler := NewDataHandler(db, sseManager)
 	dashboardHandler := NewDashboardHandler(dashboardService)
 	versionHandler := NewVersionHandler()
 	groupHandler := NewGroupHandler(db)
+	userHandler := NewUserHandler(authService)
+	workspaceHandler := NewWorkspaceHandler(workspaceService)
+	auditHandler := NewAuditHandler(auditService)
+	webhookHandler := NewWebhookHandler(webhookService)
 
 	r := &Router{
 		router:           router,
@@ -77,39 +96,102 @@ func NewRouter(db *sql.DB, sseService *sse.Service, sseManager *sse.Manager) *Ro
 		dataHandler:      dataHandler,
 		versionHandler:   versionHandler,
 		groupHandler:     groupHandler,
+		userHandler:      userHandler,
+		workspaceHandler: workspaceHandler,
+		auditHandler:     auditHandler,
+		webhookHandler:   webhookHandler,
+		metricsService:   metrics.NewService(db, sseService, sseManager),
 	}
 
 	// 注册路由
 	r.registerRoutes()
 
-	// 为所有路由添加 CORS 处理
-	r.router.Use(corsMiddleware)
+	// 记录请求耗时（在最外层，包含认证失败等被拒绝的请求）
+	r.router.Use(r.metricsService.Middleware)
+
+	// 修改类请求需通过双重提交 CSRF 校验
+	r.router.Use(csrfMiddleware)
+
+	// JSON 响应中的 API Key、密码等敏感字段默认脱敏
+	r.router.Use(redactMiddleware)
+
+	// 除白名单外的所有路由均需登录
+	r.router.Use(authMiddleware(authService, workspaceService))
+
+	// 修改类请求写入审计日志（在认证之后，以便记录操作人）
+	r.router.Use(auditMiddleware(auditService))
+
+	// 创建类请求支持 Idempotency-Key，超时重试时重放首次的响应
+	r.router.Use(idempotencyMiddleware(idempotency.NewService(db)))
+
+	// 隧道与主控返回 ETag，修改配置时须携带 If-Match，防止并发编辑互相覆盖
+	r.router.Use(preconditionMiddleware(db, tunnelService, endpointService))
 
 	return r
 }
 
-// ServeHTTP 实现 http.Handler 接口
+// ServeHTTP 实现 http.Handler 接口；CORS 在路由匹配之前处理，以便响应未注册 OPTIONS 方法的预检请求；
+// /api/v2 请求在进入路由前转为对应的 v1 路径，响应统一为 Envelope 格式
 func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	r.router.ServeHTTP(w, req)
+	corsMiddleware(v2Middleware(r.router)).ServeHTTP(w, req)
 }
 
 // registerRoutes 注册所有 API 路由
 func (r *Router) registerRoutes() {
 	// 认证相关路由
 	r.router.HandleFunc("/api/auth/login", r.authHandler.HandleLogin).Methods("POST")
+	r.router.HandleFunc("/api/auth/login/2fa", r.authHandler.HandleLoginTwoFactor).Methods("POST")
 	r.router.HandleFunc("/api/auth/logout", r.authHandler.HandleLogout).Methods("POST")
 	r.router.HandleFunc("/api/auth/validate", r.authHandler.HandleValidateSession).Methods("GET")
+	r.router.HandleFunc("/api/auth/csrf", r.authHandler.HandleCSRFToken).Methods("GET")
 	r.router.HandleFunc("/api/auth/me", r.authHandler.HandleGetMe).Methods("GET")
 	r.router.HandleFunc("/api/auth/init", r.authHandler.HandleInitSystem).Methods("POST")
 	r.router.HandleFunc("/api/auth/change-password", r.authHandler.HandleChangePassword).Methods("POST")
 	r.router.HandleFunc("/api/auth/change-username", r.authHandler.HandleChangeUsername).Methods("POST")
 	r.router.HandleFunc("/api/auth/oauth2", r.authHandler.HandleOAuth2Provider).Methods("GET")
+	r.router.HandleFunc("/api/auth/tokens", r.authHandler.HandleAPITokens).Methods("GET", "POST")
+	r.router.HandleFunc("/api/auth/tokens/{id}", r.authHandler.HandleRevokeAPIToken).Methods("DELETE")
+	r.router.HandleFunc("/api/auth/sessions", r.authHandler.HandleSessions).Methods("GET", "DELETE")
+	r.router.HandleFunc("/api/auth/sessions/settings", r.authHandler.HandleSessionSettings).Methods("GET", "PUT")
+	r.router.HandleFunc("/api/auth/sessions/{id:[0-9]+}", r.authHandler.HandleRevokeSession).Methods("DELETE")
+	r.router.HandleFunc("/api/auth/lockouts", r.authHandler.HandleLoginLockouts).Methods("GET")
+	r.router.HandleFunc("/api/auth/lockouts/unlock", r.authHandler.HandleUnlockLogin).Methods("POST")
+	r.router.HandleFunc("/api/auth/2fa", r.authHandler.HandleTOTPStatus).Methods("GET")
+	r.router.HandleFunc("/api/auth/2fa/setup", r.authHandler.HandleTOTPSetup).Methods("POST")
+	r.router.HandleFunc("/api/auth/2fa/enable", r.authHandler.HandleTOTPEnable).Methods("POST")
+	r.router.HandleFunc("/api/auth/2fa/disable", r.authHandler.HandleTOTPDisable).Methods("POST")
+	r.router.HandleFunc("/api/auth/2fa/recovery-codes", r.authHandler.HandleRecoveryCodes).Methods("POST")
 
 	// OAuth2 回调
 	r.router.HandleFunc("/api/oauth2/callback", r.authHandler.HandleOAuth2Callback).Methods("GET")
 	r.router.HandleFunc("/api/oauth2/login", r.authHandler.HandleOAuth2Login).Methods("GET")
 	// OAuth2 配置读写
 	r.router.HandleFunc("/api/oauth2/config", r.authHandler.HandleOAuth2Config).Methods("GET", "POST", "DELETE")
+	r.router.HandleFunc("/api/oauth2/identities", r.userHandler.HandleOAuthIdentities).Methods("GET")
+	r.router.HandleFunc("/api/oauth2/identities/{id}", r.userHandler.HandleMapOAuthIdentity).Methods("PUT")
+	r.router.HandleFunc("/api/oauth2/identities/{id}/{action}", r.userHandler.HandleOAuthIdentityAction).Methods("POST")
+	r.router.HandleFunc("/api/oauth2/allowlist", r.userHandler.HandleOAuthAllowlist).Methods("GET", "PUT")
+
+	// 审计日志
+	r.router.HandleFunc("/api/audit", r.auditHandler.HandleAuditLogs).Methods("GET")
+	r.router.HandleFunc("/api/audit/export", r.auditHandler.HandleExportAuditLogs).Methods("GET")
+
+	// 出站 Webhook 路由（仅管理员）
+	r.router.HandleFunc("/api/webhooks", r.webhookHandler.HandleWebhooks).Methods("GET", "POST")
+	r.router.HandleFunc("/api/webhooks/{id:[0-9]+}", r.webhookHandler.HandleWebhook).Methods("GET", "PUT", "DELETE")
+	r.router.HandleFunc("/api/webhooks/{id:[0-9]+}/test", r.webhookHandler.HandleWebhookTest).Methods("POST")
+	r.router.HandleFunc("/api/webhooks/{id:[0-9]+}/deliveries", r.webhookHandler.HandleWebhookDeliveries).Methods("GET")
+	r.router.HandleFunc("/api/webhooks/{id:[0-9]+}/deliveries/{deliveryId:[0-9]+}/retry", r.webhookHandler.HandleWebhookRedeliver).Methods("POST")
+
+	// 用户管理路由
+	r.router.HandleFunc("/api/users", r.userHandler.HandleUsers).Methods("GET", "POST")
+	r.router.HandleFunc("/api/users/{id}", r.userHandler.HandleUser).Methods("PUT", "DELETE")
+
+	// 工作区路由
+	r.router.HandleFunc("/api/workspaces", r.workspaceHandler.HandleWorkspaces).Methods("GET", "POST")
+	r.router.HandleFunc("/api/workspaces/{id}", r.workspaceHandler.HandleWorkspace).Methods("PUT", "DELETE")
+	r.router.HandleFunc("/api/workspaces/{id}/members", r.workspaceHandler.HandleSetMembers).Methods("PUT")
+	r.router.HandleFunc("/api/workspaces/{id}/endpoints", r.workspaceHandler.HandleAssignEndpoints).Methods("PUT")
 
 	// 端点相关路由
 	r.router.HandleFunc("/api/endpoints", r.endpointHandler.HandleGetEndpoints).Methods("GET")
@@ -122,6 +204,7 @@ func (r *Router) registerRoutes() {
 	r.router.HandleFunc("/api/endpoints/test", r.endpointHandler.HandleTestEndpoint).Methods("POST")
 	r.router.HandleFunc("/api/endpoints/status", r.endpointHandler.HandleEndpointStatus).Methods("GET")
 	r.router.HandleFunc("/api/endpoints/{id}/detail", r.endpointHandler.HandleGetEndpointDetail).Methods("GET")
+	r.router.HandleFunc("/api/endpoints/{id}/secret", r.endpointHandler.HandleRevealEndpointSecret).Methods("GET")
 	r.router.HandleFunc("/api/endpoints/{id}/info", r.endpointHandler.HandleGetEndpointInfo).Methods("GET")
 	r.router.HandleFunc("/api/endpoints/{id}/logs", r.endpointHandler.HandleEndpointLogs).Methods("GET")
 	r.router.HandleFunc("/api/endpoints/{id}/logs/search", r.endpointHandler.HandleSearchEndpointLogs).Methods("GET")
@@ -147,6 +230,7 @@ func (r *Router) registerRoutes() {
 	r.router.HandleFunc("/api/sse/nodepass-proxy", r.sseHandler.HandleNodePassSSEProxy).Methods("GET")
 	r.router.HandleFunc("/api/sse/test", r.sseHandler.HandleTestSSEEndpoint).Methods("POST")
 	r.router.HandleFunc("/api/sse/status", r.sseHandler.HandleSSEStatus).Methods("GET")
+	r.router.HandleFunc("/api/ws", r.sseHandler.HandleWebSocket).Methods("GET")
 
 	// 日志清理相关路由
 	r.router.HandleFunc("/api/sse/log-cleanup/stats", r.sseHandler.HandleLogCleanupStats).Methods("GET")
@@ -202,6 +286,15 @@ func (r *Router) registerRoutes() {
 		w.Write([]byte(`{"status": "ok"}`))
 	}).Methods("GET")
 
+	// 错误码目录（/api/v2 响应中的 error.code）
+	r.router.HandleFunc("/api/error-codes", HandleErrorCodes).Methods("GET")
+
+	// OpenAPI 文档，新增路由时需在 openapi.go 中登记
+	r.router.HandleFunc("/api/openapi.json", HandleOpenAPI).Methods("GET")
+
+	// Prometheus 指标（顶层路由器将 /metrics 转交给本路由器，以复用认证）
+	r.router.Handle("/metrics", r.metricsService.Handler()).Methods("GET")
+
 	// 仪表盘流量趋势
 	r.router.HandleFunc("/api/dashboard/traffic-trend", r.dashboardHandler.HandleTrafficTrend).Methods("GET")
 
@@ -228,47 +321,6 @@ func (r *Router) registerRoutes() {
 	r.router.HandleFunc("/api/version/auto-update", r.versionHandler.HandleAutoUpdate).Methods("POST")
 }
 
-// corsMiddleware 允许跨域请求（开发阶段 8080 → 3000）
-func corsMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		origin := r.Header.Get("Origin")
-
-		// 如果带 Origin 头，则回显；否则允许所有
-		if origin != "" {
-			w.Header().Set("Access-Control-Allow-Origin", origin)
-			w.Header().Set("Vary", "Origin")
-		} else {
-			w.Header().Set("Access-Control-Allow-Origin", "*")
-		}
-
-		w.Header().Set("Access-Control-Allow-Credentials", "true")
-		// 回显浏览器预检要求的 Headers，如果没有则给常用默认值
-		reqHeaders := r.Header.Get("Access-Control-Request-Headers")
-		if reqHeaders == "" {
-			reqHeaders = "Content-Type, Authorization"
-		}
-		w.Header().Set("Access-Control-Allow-Headers", reqHeaders)
-
-		// 同理回显预检方法，或允许常见方法
-		reqMethod := r.Header.Get("Access-Control-Request-Method")
-		if reqMethod == "" {
-			reqMethod = "GET, POST, PUT, PATCH, DELETE"
-		}
-		w.Header().Set("Access-Control-Allow-Methods", reqMethod)
-
-		// 预检结果缓存 12 小时，减少重复 OPTIONS
-		w.Header().Set("Access-Control-Max-Age", "43200")
-
-		// 预检请求直接返回
-		if strings.ToUpper(r.Method) == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
-
-		next.ServeHTTP(w, r)
-	})
-}
-
 // 以下是各个处理函数的实现
 func handleLogin(w http.ResponseWriter, r *http.Request) {
 	// TODO: 实现登录逻辑
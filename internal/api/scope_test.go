@@ -0,0 +1,147 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"NodePassDash/internal/db/dbtest"
+	"NodePassDash/internal/endpoint"
+	"NodePassDash/internal/instance"
+	"NodePassDash/internal/tag"
+	"NodePassDash/internal/tunnel"
+	"NodePassDash/internal/workspace"
+
+	"github.com/gorilla/mux"
+)
+
+// newScopeTestDB 创建两个工作区，各有一个主控、一条隧道、一条回收站记录及一条操作日志
+func newScopeTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db := dbtest.Open(t)
+	stmts := []string{
+		`INSERT INTO "Workspace" (id, name) VALUES (2, 'other')`,
+		`INSERT INTO "Endpoint" (id, name, url, apiPath, apiKey, workspaceId) VALUES (1, 'ep1', 'http://127.0.0.1:1', '/api', 'k1', 1)`,
+		`INSERT INTO "Endpoint" (id, name, url, apiPath, apiKey, workspaceId) VALUES (2, 'ep2', 'http://127.0.0.1:2', '/api', 'k2', 2)`,
+		`INSERT INTO "Tunnel" (id, name, endpointId, mode, tunnelAddress, tunnelPort, targetAddress, targetPort, tlsMode, commandLine, instanceId)
+			VALUES (1, 't1', 1, 'server', '', '1001', '127.0.0.1', '80', 'inherit', 'server://:1001/127.0.0.1:80', 'i1')`,
+		`INSERT INTO "Tunnel" (id, name, endpointId, mode, tunnelAddress, tunnelPort, targetAddress, targetPort, tlsMode, commandLine, instanceId)
+			VALUES (2, 't2', 2, 'server', '', '1002', '127.0.0.1', '80', 'inherit', 'server://:1002/127.0.0.1:80', 'i2')`,
+		`INSERT INTO "TunnelRecycle" (name, endpointId, mode, tunnelAddress, tunnelPort, targetAddress, targetPort, tlsMode, commandLine, instanceId)
+			VALUES ('r1', 1, 'server', '', '2001', '127.0.0.1', '80', 'inherit', '', 'ri1')`,
+		`INSERT INTO "TunnelRecycle" (name, endpointId, mode, tunnelAddress, tunnelPort, targetAddress, targetPort, tlsMode, commandLine, instanceId)
+			VALUES ('r2', 2, 'server', '', '2002', '127.0.0.1', '80', 'inherit', '', 'ri2')`,
+		`INSERT INTO "TunnelOperationLog" (tunnelId, tunnelName, action, status) VALUES (1, 't1', 'create', 'success')`,
+		`INSERT INTO "TunnelOperationLog" (tunnelId, tunnelName, action, status) VALUES (2, 't2', 'create', 'success')`,
+	}
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	return db
+}
+
+// scopedRequest 构造仅可见默认工作区的请求
+func scopedRequest(method, target, body string, vars map[string]string) *http.Request {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	r = r.WithContext(workspace.WithScope(r.Context(), workspace.Scope{IDs: []int64{1}}))
+	return mux.SetURLVars(r, vars)
+}
+
+func TestPerIDRoutesHideOtherWorkspaces(t *testing.T) {
+	db := newScopeTestDB(t)
+	tunnelService := tunnel.NewService(db)
+	tunnelHandler := NewTunnelHandler(tunnelService, nil)
+	tagHandler := NewTagHandler(tag.NewService(db), tunnelService)
+	endpointHandler := NewEndpointHandler(endpoint.NewService(db), nil)
+	instanceHandler := NewInstanceHandler(db, instance.NewService(db))
+
+	cases := []struct {
+		name    string
+		handler http.HandlerFunc
+		method  string
+		target  string
+		body    string
+		vars    map[string]string
+	}{
+		{"tunnel details", tunnelHandler.HandleGetTunnelDetails, http.MethodGet, "/api/tunnels/2/details", "", map[string]string{"id": "2"}},
+		{"tunnel logs", tunnelHandler.HandleTunnelLogs, http.MethodGet, "/api/tunnels/2/logs", "", map[string]string{"id": "2"}},
+		{"tunnel traffic trend", tunnelHandler.HandleGetTunnelTrafficTrend, http.MethodGet, "/api/tunnels/2/traffic-trend", "", map[string]string{"id": "2"}},
+		{"tunnel export logs", tunnelHandler.HandleExportTunnelLogs, http.MethodGet, "/api/tunnels/2/export-logs", "", map[string]string{"id": "2"}},
+		{"tunnel update", tunnelHandler.HandleUpdateTunnelV2, http.MethodPut, "/api/tunnels/2", `{}`, map[string]string{"id": "2"}},
+		{"tunnel restart policy", tunnelHandler.HandleSetTunnelRestart, http.MethodPatch, "/api/tunnels/2/restart", `{"restart":true}`, map[string]string{"id": "2"}},
+		{"tunnel delete by id", tunnelHandler.HandleDeleteTunnel, http.MethodDelete, "/api/tunnels/2", "", map[string]string{"id": "2"}},
+		{"tunnel delete by instance", tunnelHandler.HandleDeleteTunnel, http.MethodDelete, "/api/tunnels/1", `{"instanceId":"i2"}`, map[string]string{"id": "1"}},
+		{"tunnel control", tunnelHandler.HandleControlTunnel, http.MethodPatch, "/api/tunnels/2/status", `{"action":"stop"}`, map[string]string{"id": "2"}},
+		{"tunnel rename", tunnelHandler.HandlePatchTunnels, http.MethodPatch, "/api/tunnels/2", `{"action":"rename","name":"x"}`, map[string]string{"id": "2"}},
+		{"tunnel create", tunnelHandler.HandleCreateTunnel, http.MethodPost, "/api/tunnels", `{"name":"x","endpointId":2,"mode":"server","tunnelPort":1,"targetPort":1}`, nil},
+		{"tunnel tag", tagHandler.GetTunnelTag, http.MethodGet, "/api/tunnels/2/tag", "", map[string]string{"tunnelId": "2"}},
+		{"tunnel assign tag", tagHandler.AssignTagToTunnel, http.MethodPost, "/api/tunnels/2/tag", `{"tagId":0}`, map[string]string{"tunnelId": "2"}},
+		{"endpoint detail", endpointHandler.HandleGetEndpointDetail, http.MethodGet, "/api/endpoints/2/detail", "", map[string]string{"id": "2"}},
+		{"endpoint logs", endpointHandler.HandleEndpointLogs, http.MethodGet, "/api/endpoints/2/logs", "", map[string]string{"id": "2"}},
+		{"endpoint stats", endpointHandler.HandleEndpointStats, http.MethodGet, "/api/endpoints/2/stats", "", map[string]string{"id": "2"}},
+		{"endpoint recycle", endpointHandler.HandleRecycleList, http.MethodGet, "/api/endpoints/2/recycle", "", map[string]string{"id": "2"}},
+		{"instances", instanceHandler.HandleGetInstances, http.MethodGet, "/api/endpoints/2/instances", "", map[string]string{"endpointId": "2"}},
+		{"instance", instanceHandler.HandleGetInstance, http.MethodGet, "/api/endpoints/2/instances/i2", "", map[string]string{"endpointId": "2", "instanceId": "i2"}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c.handler(w, scopedRequest(c.method, c.target, c.body, c.vars))
+			if w.Code != http.StatusNotFound {
+				t.Fatalf("status = %d, want 404; body: %s", w.Code, w.Body.String())
+			}
+		})
+	}
+
+	// 同一工作区内的隧道不受影响
+	w := httptest.NewRecorder()
+	tagHandler.GetTunnelTag(w, scopedRequest(http.MethodGet, "/api/tunnels/1/tag", "", map[string]string{"tunnelId": "1"}))
+	if w.Code != http.StatusOK {
+		t.Fatalf("visible tunnel: status = %d, want 200", w.Code)
+	}
+}
+
+func TestListRoutesFilterByWorkspace(t *testing.T) {
+	db := newScopeTestDB(t)
+	tunnelHandler := NewTunnelHandler(tunnel.NewService(db), nil)
+	endpointHandler := NewEndpointHandler(endpoint.NewService(db), nil)
+
+	w := httptest.NewRecorder()
+	tunnelHandler.HandleGetTunnelLogs(w, scopedRequest(http.MethodGet, "/api/dashboard/logs", "", nil))
+	var logs []map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &logs); err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 1 || logs[0]["instance"] != "t1" {
+		t.Fatalf("dashboard logs = %v, want only t1", logs)
+	}
+
+	w = httptest.NewRecorder()
+	endpointHandler.HandleRecycleListAll(w, scopedRequest(http.MethodGet, "/api/recycle", "", nil))
+	var recycled []map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &recycled); err != nil {
+		t.Fatal(err)
+	}
+	if len(recycled) != 1 || recycled[0]["name"] != "r1" {
+		t.Fatalf("recycle = %v, want only r1", recycled)
+	}
+
+	// 清空操作仅影响可见工作区
+	tunnelHandler.HandleClearTunnelLogs(httptest.NewRecorder(), scopedRequest(http.MethodDelete, "/api/dashboard/logs", "", nil))
+	endpointHandler.HandleRecycleClearAll(httptest.NewRecorder(), scopedRequest(http.MethodDelete, "/api/recycle", "", nil))
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM "TunnelOperationLog" WHERE tunnelId = 2`).Scan(&n); err != nil || n != 1 {
+		t.Fatalf("other workspace logs left = %d, %v; want 1", n, err)
+	}
+	if err := db.QueryRow(`SELECT COUNT(*) FROM "TunnelRecycle" WHERE endpointId = 2`).Scan(&n); err != nil || n != 1 {
+		t.Fatalf("other workspace recycle left = %d, %v; want 1", n, err)
+	}
+	if err := db.QueryRow(`SELECT COUNT(*) FROM "TunnelRecycle"`).Scan(&n); err != nil || n != 1 {
+		t.Fatalf("recycle left = %d, %v; want 1", n, err)
+	}
+}
@@ -0,0 +1,221 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+const (
+	// csrfCookieName 双重提交的 CSRF 令牌 cookie，前端读取后放入 csrfHeaderName 请求头
+	csrfCookieName = "csrf_token"
+	// csrfHeaderName 修改类请求需携带的 CSRF 请求头
+	csrfHeaderName = "X-CSRF-Token"
+)
+
+var (
+	securityMu sync.RWMutex
+	// allowedOrigins 允许跨域携带凭据访问的来源，为空时仅允许同源访问
+	allowedOrigins = map[string]bool{}
+	// allowAnyOrigin 配置为 * 时允许任意来源（不建议在生产环境使用）
+	allowAnyOrigin bool
+	// cookieSameSite 会话及 CSRF cookie 的 SameSite 属性
+	cookieSameSite = http.SameSiteLaxMode
+	// cookieSecure 强制为 cookie 设置 Secure，未设置时仅在 HTTPS 请求中设置
+	cookieSecure bool
+)
+
+// SetAllowedOrigins 设置允许跨域访问的来源，如 https://dash.example.com；* 表示允许任意来源
+func SetAllowedOrigins(origins []string) {
+	set := map[string]bool{}
+	any := false
+	for _, o := range origins {
+		o = normalizeOrigin(o)
+		if o == "" {
+			continue
+		}
+		if o == "*" {
+			any = true
+			continue
+		}
+		set[o] = true
+	}
+
+	securityMu.Lock()
+	allowedOrigins = set
+	allowAnyOrigin = any
+	securityMu.Unlock()
+}
+
+// SetCookieOptions 设置 cookie 的 SameSite（lax / strict / none）及是否强制 Secure；
+// SameSite=None 要求 Secure，此时会自动启用
+func SetCookieOptions(sameSite string, secure bool) error {
+	var mode http.SameSite
+	switch strings.ToLower(strings.TrimSpace(sameSite)) {
+	case "", "lax":
+		mode = http.SameSiteLaxMode
+	case "strict":
+		mode = http.SameSiteStrictMode
+	case "none":
+		mode = http.SameSiteNoneMode
+		secure = true
+	default:
+		return fmt.Errorf("无效的 SameSite 值: %s（可选 lax / strict / none）", sameSite)
+	}
+
+	securityMu.Lock()
+	cookieSameSite = mode
+	cookieSecure = secure
+	securityMu.Unlock()
+	return nil
+}
+
+// normalizeOrigin 统一来源格式：小写、去掉末尾的 /
+func normalizeOrigin(o string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(o)), "/")
+}
+
+// originAllowed 判断跨域来源是否在允许列表中
+func originAllowed(origin string) bool {
+	securityMu.RLock()
+	defer securityMu.RUnlock()
+	return allowAnyOrigin || allowedOrigins[normalizeOrigin(origin)]
+}
+
+// sameOrigin 判断 Origin 是否与请求的 Host 相同（含经反向代理转发的情况）
+func sameOrigin(r *http.Request, origin string) bool {
+	origin = normalizeOrigin(origin)
+	host := strings.ToLower(r.Host)
+	return origin == "http://"+host || origin == "https://"+host
+}
+
+// newCookie 按全局配置创建 cookie
+func newCookie(r *http.Request, name, value string, maxAge int, httpOnly bool) *http.Cookie {
+	securityMu.RLock()
+	defer securityMu.RUnlock()
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		HttpOnly: httpOnly,
+		MaxAge:   maxAge,
+		SameSite: cookieSameSite,
+		Secure:   cookieSecure || r.TLS != nil,
+	}
+}
+
+// corsMiddleware 仅允许配置的来源跨域携带凭据访问，同源请求不受影响
+func corsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+		if origin != "" && !sameOrigin(r, origin) {
+			w.Header().Add("Vary", "Origin")
+			if !originAllowed(origin) {
+				// 不返回 CORS 头，浏览器将拒绝跨域读取；预检请求直接拒绝
+				if preflight {
+					w.WriteHeader(http.StatusForbidden)
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+			w.Header().Set("Access-Control-Expose-Headers", "Retry-After, "+idempotentReplayedHeader+", "+etagHeader)
+		}
+
+		if preflight {
+			// 回显浏览器预检要求的 Headers，如果没有则给常用默认值
+			reqHeaders := r.Header.Get("Access-Control-Request-Headers")
+			if reqHeaders == "" {
+				reqHeaders = "Content-Type, Authorization, " + csrfHeaderName + ", " + idempotencyKeyHeader + ", " + ifMatchHeader
+			}
+			w.Header().Set("Access-Control-Allow-Headers", reqHeaders)
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE")
+			// 预检结果缓存 12 小时，减少重复 OPTIONS
+			w.Header().Set("Access-Control-Max-Age", "43200")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// newCSRFToken 生成随机 CSRF 令牌
+func newCSRFToken() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// setCSRFCookie 写入 CSRF 令牌 cookie，前端需要读取该值，因此不设置 HttpOnly
+func setCSRFCookie(w http.ResponseWriter, r *http.Request, token string) {
+	http.SetCookie(w, newCookie(r, csrfCookieName, token, 0, false))
+}
+
+// csrfMiddleware 双重提交 CSRF 校验：修改类请求的 X-CSRF-Token 请求头必须与 csrf_token cookie 一致；
+// 使用 Bearer 令牌的请求不依赖 cookie，不受 CSRF 影响，无需校验
+func csrfMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := ""
+		if c, err := r.Cookie(csrfCookieName); err == nil {
+			token = c.Value
+		}
+		issued := token == ""
+		if issued {
+			// 首次访问时下发令牌，供后续修改类请求使用
+			token = newCSRFToken()
+			setCSRFCookie(w, r, token)
+			r.AddCookie(&http.Cookie{Name: csrfCookieName, Value: token})
+		}
+
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+		if bearerToken(r) != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		header := r.Header.Get(csrfHeaderName)
+		if issued || header == "" || subtle.ConstantTimeCompare([]byte(token), []byte(header)) != 1 {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": false,
+				"error":   "CSRF 校验失败，请刷新页面后重试",
+			})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// HandleCSRFToken 返回当前的 CSRF 令牌 (GET /api/auth/csrf)，供脚本等无法直接读取 cookie 的客户端使用
+func (h *AuthHandler) HandleCSRFToken(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	// csrfMiddleware 保证此时请求中已有令牌
+	token := ""
+	if c, err := r.Cookie(csrfCookieName); err == nil {
+		token = c.Value
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":   true,
+		"csrfToken": token,
+	})
+}
@@ -0,0 +1,135 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"NodePassDash/internal/auth"
+	"NodePassDash/internal/db/dbtest"
+)
+
+// csrfRequest 经 csrfMiddleware 发送请求，cookie / header 为空表示不携带
+func csrfRequest(method, cookie, header, authorization string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, "/api/tunnels", nil)
+	if cookie != "" {
+		r.AddCookie(&http.Cookie{Name: csrfCookieName, Value: cookie})
+	}
+	if header != "" {
+		r.Header.Set(csrfHeaderName, header)
+	}
+	if authorization != "" {
+		r.Header.Set("Authorization", authorization)
+	}
+	w := httptest.NewRecorder()
+	csrfMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})).ServeHTTP(w, r)
+	return w
+}
+
+func TestCSRFMiddleware(t *testing.T) {
+	cases := []struct {
+		name                          string
+		method                        string
+		cookie, header, authorization string
+		want                          int
+	}{
+		{"safe method without token", http.MethodGet, "", "", "", http.StatusOK},
+		{"post without cookie", http.MethodPost, "", "abc", "", http.StatusForbidden},
+		{"post without header", http.MethodPost, "abc", "", "", http.StatusForbidden},
+		{"post with mismatched header", http.MethodPost, "abc", "abd", "", http.StatusForbidden},
+		{"post with matching header", http.MethodPost, "abc", "abc", "", http.StatusOK},
+		{"delete with matching header", http.MethodDelete, "abc", "abc", "", http.StatusOK},
+		{"bearer token skips check", http.MethodPost, "", "", "Bearer np_token", http.StatusOK},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if w := csrfRequest(c.method, c.cookie, c.header, c.authorization); w.Code != c.want {
+				t.Fatalf("status = %d, want %d; body: %s", w.Code, c.want, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestCSRFTokenIssuedOnFirstVisit(t *testing.T) {
+	w := csrfRequest(http.MethodGet, "", "", "")
+	var issued string
+	for _, c := range w.Result().Cookies() {
+		if c.Name == csrfCookieName {
+			issued = c.Value
+			if c.HttpOnly {
+				t.Error("csrf cookie must be readable by the frontend")
+			}
+		}
+	}
+	if len(issued) != 64 {
+		t.Fatalf("issued token = %q, want 64 hex characters", issued)
+	}
+
+	// 已有令牌时不重新下发
+	if w := csrfRequest(http.MethodGet, issued, "", ""); len(w.Result().Cookies()) != 0 {
+		t.Fatal("existing token should not be replaced")
+	}
+
+	// 下发的令牌可用于之后的修改类请求
+	if w := csrfRequest(http.MethodPost, issued, issued, ""); w.Code != http.StatusOK {
+		t.Fatalf("post with issued token: status = %d", w.Code)
+	}
+}
+
+func TestHandleCSRFTokenReturnsCookieValue(t *testing.T) {
+	h := &AuthHandler{}
+	handler := csrfMiddleware(http.HandlerFunc(h.HandleCSRFToken))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/auth/csrf", nil))
+	var resp struct {
+		CSRFToken string `json:"csrfToken"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || resp.CSRFToken == "" || cookies[0].Value != resp.CSRFToken {
+		t.Fatalf("token = %q, cookies = %v; want the issued cookie value", resp.CSRFToken, cookies)
+	}
+}
+
+func TestEnsureProxySessionOnlyFromConfiguredProxy(t *testing.T) {
+	authService := auth.NewService(dbtest.Open(t))
+	if err := auth.SetProxyAuth(auth.ProxyAuthConfig{Enabled: true, CIDRs: []string{"10.0.0.1"}}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { auth.SetProxyAuth(auth.ProxyAuthConfig{}) })
+
+	cases := []struct {
+		remote      string
+		wantSession bool
+	}{
+		{"203.0.113.9:1234", false},
+		{"10.0.0.1:1234", true},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest(http.MethodGet, "/api/tunnels", nil)
+		r.RemoteAddr = c.remote
+		r.Header.Set("X-Forwarded-User", "alice")
+		w := httptest.NewRecorder()
+		if err := ensureProxySession(authService, w, r); err != nil {
+			t.Fatalf("%s: %v", c.remote, err)
+		}
+		cookie, err := r.Cookie("session")
+		if got := err == nil && cookie.Value != ""; got != c.wantSession {
+			t.Fatalf("%s: session issued = %v, want %v", c.remote, got, c.wantSession)
+		}
+		if c.wantSession {
+			if sess, ok := authService.GetSession(cookie.Value); !ok || sess.Username != "alice" {
+				t.Fatalf("session = %+v, %v; want alice", sess, ok)
+			}
+		}
+	}
+	if _, err := authService.GetUserByUsername("alice"); err != nil {
+		t.Fatalf("proxy user not created: %v", err)
+	}
+}
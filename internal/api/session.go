@@ -0,0 +1,110 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"NodePassDash/internal/audit"
+	"NodePassDash/internal/auth"
+
+	"github.com/gorilla/mux"
+)
+
+// HandleSessions 管理当前用户的登录会话
+// GET    /api/auth/sessions  列出当前用户的有效会话
+// DELETE /api/auth/sessions  注销除当前会话外的所有会话
+func (h *AuthHandler) HandleSessions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok || principal.AuthType != auth.AuthTypeSession {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "仅支持会话登录访问"})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		sessions, err := h.authService.ListUserSessions(principal.Username, principal.SessionID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "获取会话列表失败: " + err.Error()})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "sessions": sessions})
+
+	case http.MethodDelete:
+		audit.Action(r, "session.revoke_others", "user", principal.Username)
+		count, err := h.authService.RevokeOtherSessions(principal.Username, principal.SessionID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "注销会话失败: " + err.Error()})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "revoked": count, "message": "已注销其他会话"})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleRevokeSession 注销当前用户的指定会话 (DELETE /api/auth/sessions/{id})
+func (h *AuthHandler) HandleRevokeSession(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok || principal.AuthType != auth.AuthTypeSession {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "仅支持会话登录访问"})
+		return
+	}
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "无效的会话ID"})
+		return
+	}
+
+	audit.Action(r, "session.revoke", "session", id)
+	if err := h.authService.RevokeUserSession(principal.Username, id); err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "message": "会话已注销"})
+}
+
+// HandleSessionSettings 读取或保存会话有效期设置（分钟）
+// GET /api/auth/sessions/settings
+// PUT /api/auth/sessions/settings Body: {absoluteTimeout, idleTimeout, rememberMeTimeout}
+func (h *AuthHandler) HandleSessionSettings(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case http.MethodGet:
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "settings": h.authService.GetSessionSettings()})
+
+	case http.MethodPut:
+		audit.Action(r, "session_settings.update", "config", auth.ConfigKeySessionSettings)
+		audit.Before(r, h.authService.GetSessionSettings())
+
+		var req auth.SessionSettings
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "无效请求体"})
+			return
+		}
+		if err := h.authService.SetSessionSettings(req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": err.Error()})
+			return
+		}
+		audit.After(r, req)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "settings": req})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
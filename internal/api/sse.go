@@ -2,17 +2,21 @@ package api
 
 import (
 	log "NodePassDash/internal/log"
+	"NodePassDash/internal/models"
+	"NodePassDash/internal/secret"
 	"context"
 	"crypto/tls"
 	"database/sql"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
 
 	"NodePassDash/internal/sse"
+	"NodePassDash/internal/workspace"
 
 	"bufio"
 	"encoding/base64"
@@ -37,7 +41,14 @@ func NewSSEHandler(sseService *sse.Service, sseManager *sse.Manager) *SSEHandler
 }
 
 // HandleGlobalSSE 处理全局SSE连接
+// 可选过滤参数：endpointIds、tagIds、groupIds、eventTypes（逗号分隔），statusOnly=true 仅推送状态变化
 func (h *SSEHandler) HandleGlobalSSE(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseSSEFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// 设置SSE响应头
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
@@ -55,8 +66,9 @@ func (h *SSEHandler) HandleGlobalSSE(w http.ResponseWriter, r *http.Request) {
 
 	// log.Infof("前端建立全局SSE连接,clientID=%s remote=%s", clientID, r.RemoteAddr)
 
-	// 添加客户端
-	h.sseService.AddClient(clientID, w)
+	// 添加客户端，仅推送调用方可见工作区内的事件；重连时补发断线期间错过的事件
+	client := &sse.Client{ID: clientID, Writer: w, Scope: workspace.ScopeFromContext(r.Context()), Filter: filter}
+	h.sseService.ResumeGlobal(client, lastEventID(r))
 	defer h.sseService.RemoveClient(clientID)
 
 	// 保持连接直到客户端断开
@@ -80,6 +92,12 @@ func (h *SSEHandler) HandleTunnelSSE(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	scope := workspace.ScopeFromContext(r.Context())
+	if !h.sseService.InstanceVisible(tunnelID, scope) {
+		http.Error(w, "Tunnel not found", http.StatusNotFound)
+		return
+	}
+
 	// 生成客户端ID
 	clientID := uuid.New().String()
 
@@ -91,13 +109,10 @@ func (h *SSEHandler) HandleTunnelSSE(w http.ResponseWriter, r *http.Request) {
 
 	// log.Infof("前端请求隧道SSE订阅,tunnelID=%s clientID=%s remote=%s", tunnelID, clientID, r.RemoteAddr)
 
-	// 添加客户端并订阅隧道
-	h.sseService.AddClient(clientID, w)
-	h.sseService.SubscribeToTunnel(clientID, tunnelID)
-	defer func() {
-		h.sseService.UnsubscribeFromTunnel(clientID, tunnelID)
-		h.sseService.RemoveClient(clientID)
-	}()
+	// 订阅隧道（不加入全局推送），重连时补发断线期间错过的事件
+	client := &sse.Client{ID: clientID, Writer: w, Scope: scope}
+	h.sseService.ResumeTunnel(client, tunnelID, lastEventID(r))
+	defer h.sseService.RemoveClient(clientID)
 
 	// 保持连接直到客户端断开
 	<-r.Context().Done()
@@ -105,6 +120,89 @@ func (h *SSEHandler) HandleTunnelSSE(w http.ResponseWriter, r *http.Request) {
 	// log.Infof("隧道SSE连接关闭,tunnelID=%s clientID=%s remote=%s", tunnelID, clientID, r.RemoteAddr)
 }
 
+// sseFilterEventTypes 全局事件流可按其过滤的事件类型（initial 不推送，log 仅推送给隧道及日志订阅者）
+var sseFilterEventTypes = map[string]bool{
+	string(models.SSEEventTypeCreate):   true,
+	string(models.SSEEventTypeUpdate):   true,
+	string(models.SSEEventTypeDelete):   true,
+	string(models.SSEEventTypeShutdown): true,
+}
+
+// parseSSEFilter 解析全局事件流的过滤参数，未设置任何条件时返回 nil；
+// 列表参数可以逗号分隔，也可以重复出现
+func parseSSEFilter(q url.Values) (*sse.Filter, error) {
+	f := &sse.Filter{}
+	empty := true
+
+	ids := func(name string) ([]int64, error) {
+		var out []int64
+		for _, v := range splitQueryList(q[name]) {
+			id, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || id <= 0 {
+				return nil, fmt.Errorf("invalid %s: %s", name, v)
+			}
+			out = append(out, id)
+		}
+		if len(out) > 0 {
+			empty = false
+		}
+		return out, nil
+	}
+
+	var err error
+	if f.EndpointIDs, err = ids("endpointIds"); err != nil {
+		return nil, err
+	}
+	if f.TagIDs, err = ids("tagIds"); err != nil {
+		return nil, err
+	}
+	if f.GroupIDs, err = ids("groupIds"); err != nil {
+		return nil, err
+	}
+	for _, v := range splitQueryList(q["eventTypes"]) {
+		if !sseFilterEventTypes[v] {
+			return nil, fmt.Errorf("invalid eventTypes: %s", v)
+		}
+		f.EventTypes = append(f.EventTypes, v)
+		empty = false
+	}
+	if v := q.Get("statusOnly"); v != "" {
+		statusOnly, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid statusOnly: %s", v)
+		}
+		f.StatusOnly = statusOnly
+		empty = empty && !statusOnly
+	}
+
+	if empty {
+		return nil, nil
+	}
+	return f, nil
+}
+
+// splitQueryList 展开逗号分隔的查询参数并去除空白项
+func splitQueryList(values []string) []string {
+	var out []string
+	for _, v := range values {
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				out = append(out, item)
+			}
+		}
+	}
+	return out
+}
+
+// lastEventID 返回客户端最后收到的事件 ID：浏览器 EventSource 重连时自动携带 Last-Event-ID 请求头，
+// 无法设置请求头的客户端可使用 lastEventId 查询参数
+func lastEventID(r *http.Request) string {
+	if id := r.Header.Get("Last-Event-ID"); id != "" {
+		return id
+	}
+	return r.URL.Query().Get("lastEventId")
+}
+
 // HandleTestSSEEndpoint 测试端点SSE连接
 func (h *SSEHandler) HandleTestSSEEndpoint(w http.ResponseWriter, r *http.Request) {
 	// 仅允许 POST
@@ -568,7 +666,10 @@ func (h *SSEHandler) HandleNodePassSSEProxy(w http.ResponseWriter, r *http.Reque
 		default:
 		}
 
-		// 转发SSE数据行
+		// 转发SSE数据行，数据中的实例 URL 可能包含隧道密码
+		if strings.HasPrefix(line, "data: ") {
+			line = "data: " + string(secret.RedactJSON([]byte(line[6:])))
+		}
 		if _, err := fmt.Fprintf(w, "%s\n", line); err != nil {
 			log.Errorf("[NodePass SSE Proxy] 写入响应失败: %v", err)
 			return
@@ -5,24 +5,28 @@ import (
 	"net/http"
 	"strconv"
 
+	"NodePassDash/internal/audit"
 	"NodePassDash/internal/tag"
+	"NodePassDash/internal/tunnel"
+	"NodePassDash/internal/workspace"
 
 	"github.com/gorilla/mux"
 )
 
 // TagHandler 标签处理器
 type TagHandler struct {
-	tagService *tag.Service
+	tagService    *tag.Service
+	tunnelService *tunnel.Service
 }
 
 // NewTagHandler 创建标签处理器
-func NewTagHandler(tagService *tag.Service) *TagHandler {
-	return &TagHandler{tagService: tagService}
+func NewTagHandler(tagService *tag.Service, tunnelService *tunnel.Service) *TagHandler {
+	return &TagHandler{tagService: tagService, tunnelService: tunnelService}
 }
 
 // GetTags 获取所有标签
 func (h *TagHandler) GetTags(w http.ResponseWriter, r *http.Request) {
-	tags, err := h.tagService.GetTags()
+	tags, err := h.tagService.GetTags(workspace.ScopeFromContext(r.Context()))
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -39,17 +43,30 @@ func (h *TagHandler) GetTags(w http.ResponseWriter, r *http.Request) {
 
 // CreateTag 创建标签
 func (h *TagHandler) CreateTag(w http.ResponseWriter, r *http.Request) {
+	audit.Action(r, "tag.create", "tag", nil)
+
 	var req tag.CreateTagRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "无效的请求数据", http.StatusBadRequest)
 		return
 	}
 
+	scope := workspace.ScopeFromContext(r.Context())
+	if req.WorkspaceID == 0 {
+		req.WorkspaceID = scope.Default()
+	}
+	if !scope.Allows(req.WorkspaceID) {
+		http.Error(w, "无权访问该工作区", http.StatusForbidden)
+		return
+	}
+
 	tagObj, err := h.tagService.CreateTag(&req)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	audit.Target(r, tagObj.ID)
+	audit.After(r, tagObj)
 
 	response := tag.TagResponse{
 		Success: true,
@@ -61,6 +78,15 @@ func (h *TagHandler) CreateTag(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
+// tagVisible 判断标签是否属于调用方可见的工作区
+func (h *TagHandler) tagVisible(r *http.Request, id int64) bool {
+	tagObj, err := h.tagService.GetTagByID(id)
+	if err != nil {
+		return false
+	}
+	return workspace.ScopeFromContext(r.Context()).Allows(tagObj.WorkspaceID)
+}
+
 // UpdateTag 更新标签
 func (h *TagHandler) UpdateTag(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -70,6 +96,8 @@ func (h *TagHandler) UpdateTag(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	audit.Action(r, "tag.update", "tag", id)
+
 	var req tag.UpdateTagRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "无效的请求数据", http.StatusBadRequest)
@@ -77,11 +105,18 @@ func (h *TagHandler) UpdateTag(w http.ResponseWriter, r *http.Request) {
 	}
 	req.ID = id
 
+	if !h.tagVisible(r, id) {
+		http.Error(w, "标签不存在", http.StatusNotFound)
+		return
+	}
+
+	audit.BeforeRow(r, "Tags", id)
 	tagObj, err := h.tagService.UpdateTag(&req)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	audit.AfterRow(r, "Tags", id)
 
 	response := tag.TagResponse{
 		Success: true,
@@ -108,6 +143,20 @@ func (h *TagHandler) DeleteTag(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !h.tagVisible(r, id) {
+		response := tag.TagResponse{
+			Success: false,
+			Error:   "标签不存在",
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	audit.Action(r, "tag.delete", "tag", id)
+	audit.BeforeRow(r, "Tags", id)
+
 	err = h.tagService.DeleteTag(id)
 	if err != nil {
 		response := tag.TagResponse{
@@ -142,6 +191,22 @@ func (h *TagHandler) AssignTagToTunnel(w http.ResponseWriter, r *http.Request) {
 		json.NewEncoder(w).Encode(response)
 		return
 	}
+	if req.TunnelId == 0 {
+		req.TunnelId, _ = strconv.ParseInt(mux.Vars(r)["tunnelId"], 10, 64)
+	}
+
+	// 隧道与标签均须属于调用方可见的工作区
+	if !h.tunnelService.TunnelVisible(req.TunnelId, workspace.ScopeFromContext(r.Context())) {
+		writeNotFound(w, "隧道不存在")
+		return
+	}
+	if req.TagID > 0 && !h.tagVisible(r, req.TagID) {
+		writeNotFound(w, "指定的标签不存在")
+		return
+	}
+
+	audit.Action(r, "tunnel.assign_tag", "tunnel", req.TunnelId)
+	audit.After(r, req)
 
 	err := h.tagService.AssignTagToTunnel(&req)
 	if err != nil {
@@ -172,6 +237,10 @@ func (h *TagHandler) GetTunnelTag(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "无效的隧道ID", http.StatusBadRequest)
 		return
 	}
+	if !h.tunnelService.TunnelVisible(tunnelID, workspace.ScopeFromContext(r.Context())) {
+		writeNotFound(w, "隧道不存在")
+		return
+	}
 
 	tagObj, err := h.tagService.GetTunnelTag(tunnelID)
 	if err != nil {
@@ -6,6 +6,7 @@ import (
 	"bytes"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -19,9 +20,12 @@ import (
 
 	"github.com/gorilla/mux"
 
+	"NodePassDash/internal/audit"
 	"NodePassDash/internal/nodepass"
+	"NodePassDash/internal/secret"
 	"NodePassDash/internal/sse"
 	"NodePassDash/internal/tunnel"
+	"NodePassDash/internal/workspace"
 )
 
 // TunnelHandler 隧道相关的处理器
@@ -38,14 +42,28 @@ func NewTunnelHandler(tunnelService *tunnel.Service, sseManager *sse.Manager) *T
 	}
 }
 
-// HandleGetTunnels 获取隧道列表
+// tunnelListParams 隧道列表的分页、过滤与排序参数，带任一参数时返回分页结果
+var tunnelListParams = []string{
+	"page", "pageSize", "cursor", "sort", "order",
+	"endpointId", "status", "mode", "tagId", "groupId", "name", "portFrom", "portTo",
+}
+
+// HandleGetTunnels 获取隧道列表；未指定分页、过滤或排序参数时按原格式返回全部隧道
 func (h *TunnelHandler) HandleGetTunnels(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	tunnels, err := h.tunnelService.GetTunnels()
+	query := r.URL.Query()
+	for _, p := range tunnelListParams {
+		if query.Has(p) {
+			h.handleListTunnels(w, r)
+			return
+		}
+	}
+
+	tunnels, err := h.tunnelService.GetTunnels(workspace.ScopeFromContext(r.Context()))
 	if err != nil {
 		log.Errorf("[API] 获取隧道列表失败: %v", err)
 
@@ -71,6 +89,104 @@ func (h *TunnelHandler) HandleGetTunnels(w http.ResponseWriter, r *http.Request)
 	json.NewEncoder(w).Encode(tunnels)
 }
 
+// handleListTunnels 分页查询隧道列表
+// GET /api/tunnels?page=1&pageSize=50&status=running,error&sort=traffic&order=desc
+func (h *TunnelHandler) handleListTunnels(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	q, err := parseTunnelListQuery(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": err.Error()})
+		return
+	}
+
+	page, err := h.tunnelService.ListTunnels(workspace.ScopeFromContext(r.Context()), q)
+	if err != nil {
+		var queryErr *tunnel.ListQueryError
+		if errors.As(err, &queryErr) {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": err.Error()})
+			return
+		}
+		log.Errorf("[API] 分页查询隧道列表失败: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "获取隧道列表失败: " + err.Error()})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":      true,
+		"tunnels":      page.Tunnels,
+		"total":        page.Total,
+		"statusCounts": page.StatusCounts,
+		"page":         page.Page,
+		"pageSize":     page.PageSize,
+		"nextCursor":   page.NextCursor,
+	})
+}
+
+// parseTunnelListQuery 从查询参数解析隧道列表条件，status 可用逗号分隔多个状态
+func parseTunnelListQuery(r *http.Request) (tunnel.ListQuery, error) {
+	v := r.URL.Query()
+	q := tunnel.ListQuery{
+		Mode:   tunnel.TunnelMode(v.Get("mode")),
+		Name:   strings.TrimSpace(v.Get("name")),
+		Sort:   v.Get("sort"),
+		Order:  strings.ToLower(v.Get("order")),
+		Cursor: v.Get("cursor"),
+	}
+
+	ints := []struct {
+		name string
+		dst  *int
+	}{
+		{"page", &q.Page}, {"pageSize", &q.PageSize}, {"portFrom", &q.PortFrom}, {"portTo", &q.PortTo},
+	}
+	for _, p := range ints {
+		if s := v.Get(p.name); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil {
+				return q, fmt.Errorf("%s 参数无效", p.name)
+			}
+			*p.dst = n
+		}
+	}
+
+	var err error
+	if s := v.Get("endpointId"); s != "" {
+		if q.EndpointID, err = strconv.ParseInt(s, 10, 64); err != nil {
+			return q, errors.New("endpointId 参数无效")
+		}
+	}
+	if s := v.Get("groupId"); s != "" {
+		if q.GroupID, err = strconv.ParseInt(s, 10, 64); err != nil {
+			return q, errors.New("groupId 参数无效")
+		}
+	}
+	if s := v.Get("tagId"); s != "" {
+		tagID, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return q, errors.New("tagId 参数无效")
+		}
+		q.TagID = &tagID
+	}
+
+	if q.Mode != "" && q.Mode != tunnel.ModeServer && q.Mode != tunnel.ModeClient {
+		return q, errors.New("mode 参数无效")
+	}
+	for _, s := range strings.Split(v.Get("status"), ",") {
+		switch status := tunnel.TunnelStatus(strings.TrimSpace(s)); status {
+		case "":
+		case tunnel.StatusRunning, tunnel.StatusStopped, tunnel.StatusError, tunnel.StatusOffline:
+			q.Statuses = append(q.Statuses, status)
+		default:
+			return q, fmt.Errorf("status 参数无效: %s", status)
+		}
+	}
+	return q, nil
+}
+
 // HandleCreateTunnel 创建新隧道
 func (h *TunnelHandler) HandleCreateTunnel(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -78,6 +194,8 @@ func (h *TunnelHandler) HandleCreateTunnel(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	audit.Action(r, "tunnel.create", "tunnel", nil)
+
 	// 兼容前端将端口作为字符串提交的情况
 	var raw struct {
 		Name          string          `json:"name"`
@@ -178,6 +296,11 @@ func (h *TunnelHandler) HandleCreateTunnel(w http.ResponseWriter, r *http.Reques
 		Max:           maxPtr,
 	}
 
+	if !h.tunnelService.EndpointVisible(req.EndpointID, workspace.ScopeFromContext(r.Context())) {
+		writeNotFound(w, "主控不存在")
+		return
+	}
+
 	log.Infof("[Master-%v] 创建隧道请求: %v", req.EndpointID, req.Name)
 
 	// 使用等待模式创建隧道，超时时间为 3 秒
@@ -192,6 +315,8 @@ func (h *TunnelHandler) HandleCreateTunnel(w http.ResponseWriter, r *http.Reques
 	}
 
 	// CreateTunnelAndWait 已经包含了设置别名的逻辑，这里不需要再调用
+	audit.Target(r, newTunnel.ID)
+	audit.AfterRow(r, "Tunnel", newTunnel.ID)
 
 	json.NewEncoder(w).Encode(tunnel.TunnelResponse{
 		Success: true,
@@ -217,6 +342,9 @@ func (h *TunnelHandler) HandleBatchCreateTunnels(w http.ResponseWriter, r *http.
 		return
 	}
 
+	audit.Action(r, "tunnel.batch_create", "tunnel", nil)
+	audit.After(r, req)
+
 	// 验证请求
 	if len(req.Items) == 0 {
 		w.WriteHeader(http.StatusBadRequest)
@@ -248,6 +376,10 @@ func (h *TunnelHandler) HandleBatchCreateTunnels(w http.ResponseWriter, r *http.
 			})
 			return
 		}
+		if !h.tunnelService.EndpointVisible(item.EndpointID, workspace.ScopeFromContext(r.Context())) {
+			writeNotFound(w, fmt.Sprintf("第 %d 项的主控不存在", i+1))
+			return
+		}
 		if item.InboundsPort <= 0 || item.InboundsPort > 65535 {
 			w.WriteHeader(http.StatusBadRequest)
 			json.NewEncoder(w).Encode(tunnel.BatchCreateTunnelResponse{
@@ -287,6 +419,9 @@ func (h *TunnelHandler) HandleBatchCreateTunnels(w http.ResponseWriter, r *http.
 		return
 	}
 
+	// 逐项创建不可整体回滚，部分或全部失败的结果同样保存用于重放，避免重试时重复创建已成功的项
+	keepIdempotentResponse(r)
+
 	// 根据结果设置HTTP状态码
 	if response.Success {
 		if response.FailCount > 0 {
@@ -311,6 +446,8 @@ func (h *TunnelHandler) HandleDeleteTunnel(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	audit.Action(r, "tunnel.delete", "tunnel", mux.Vars(r)["id"])
+
 	var req struct {
 		InstanceID string `json:"instanceId"`
 		Recycle    bool   `json:"recycle"`
@@ -352,6 +489,10 @@ func (h *TunnelHandler) HandleDeleteTunnel(w http.ResponseWriter, r *http.Reques
 		})
 		return
 	}
+	if !h.tunnelService.InstanceVisible(req.InstanceID, workspace.ScopeFromContext(r.Context())) {
+		writeNotFound(w, "隧道不存在")
+		return
+	}
 
 	// 在删除前先获取隧道数据库ID，用于清理分组关系和文件日志
 	var tunnelID int64
@@ -366,6 +507,9 @@ func (h *TunnelHandler) HandleDeleteTunnel(w http.ResponseWriter, r *http.Reques
 			}
 		}
 	} else {
+		audit.Target(r, tunnelID)
+		audit.BeforeRow(r, "Tunnel", tunnelID)
+
 		// 如果不是移入回收站，在删除前先解绑分组关系和清理标签关联
 		if !req.Recycle {
 			if err := h.deleteTunnelFromGroups(tunnelID); err != nil {
@@ -443,6 +587,8 @@ func (h *TunnelHandler) HandleControlTunnel(w http.ResponseWriter, r *http.Reque
 		}
 	}
 
+	audit.Action(r, "tunnel."+req.Action, "tunnel", mux.Vars(r)["id"])
+
 	if req.InstanceID == "" || req.Action == "" {
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(tunnel.TunnelResponse{
@@ -451,6 +597,10 @@ func (h *TunnelHandler) HandleControlTunnel(w http.ResponseWriter, r *http.Reque
 		})
 		return
 	}
+	if !h.tunnelService.InstanceVisible(req.InstanceID, workspace.ScopeFromContext(r.Context())) {
+		writeNotFound(w, "隧道不存在")
+		return
+	}
 
 	if req.Action != "start" && req.Action != "stop" && req.Action != "restart" {
 		w.WriteHeader(http.StatusBadRequest)
@@ -490,6 +640,10 @@ func (h *TunnelHandler) HandleUpdateTunnel(w http.ResponseWriter, r *http.Reques
 		})
 		return
 	}
+	if !h.tunnelService.TunnelVisible(tunnelID, workspace.ScopeFromContext(r.Context())) {
+		writeNotFound(w, "隧道不存在")
+		return
+	}
 
 	// 尝试解析为创建/替换请求体（与创建接口保持一致）
 	var rawCreate struct {
@@ -518,6 +672,14 @@ func (h *TunnelHandler) HandleUpdateTunnel(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	password, err := h.tunnelPassword(tunnelID, rawCreate.Password)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(tunnel.TunnelResponse{Success: false, Error: err.Error()})
+		return
+	}
+	rawCreate.Password = password
+
 	// 如果请求体包含 EndpointID 和 Mode，则认定为"替换"逻辑，否则执行原 Update 逻辑
 	if rawCreate.EndpointID != 0 && rawCreate.Mode != "" {
 		// 1. 获取旧 instanceId
@@ -617,7 +779,7 @@ func (h *TunnelHandler) HandleGetTunnelLogs(w http.ResponseWriter, r *http.Reque
 		}
 	}
 
-	logs, err := h.tunnelService.GetOperationLogs(limit)
+	logs, err := h.tunnelService.GetOperationLogs(limit, workspace.ScopeFromContext(r.Context()))
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(map[string]interface{}{"error": err.Error()})
@@ -657,7 +819,9 @@ func (h *TunnelHandler) HandleClearTunnelLogs(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	deleted, err := h.tunnelService.ClearOperationLogs()
+	audit.Action(r, "tunnel_log.clear", "tunnel_log", nil)
+
+	deleted, err := h.tunnelService.ClearOperationLogs(workspace.ScopeFromContext(r.Context()))
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(map[string]interface{}{
@@ -722,6 +886,17 @@ func (h *TunnelHandler) HandlePatchTunnels(w http.ResponseWriter, r *http.Reques
 		})
 		return
 	}
+	scope := workspace.ScopeFromContext(r.Context())
+	if (raw.InstanceID != "" && !h.tunnelService.InstanceVisible(raw.InstanceID, scope)) ||
+		(raw.ID != 0 && !h.tunnelService.TunnelVisible(raw.ID, scope)) {
+		writeNotFound(w, "隧道不存在")
+		return
+	}
+	if raw.ID != 0 {
+		audit.Action(r, "tunnel."+raw.Action, "tunnel", raw.ID)
+	} else {
+		audit.Action(r, "tunnel."+raw.Action, "tunnel", raw.InstanceID)
+	}
 
 	switch raw.Action {
 	case "start", "stop", "restart":
@@ -786,6 +961,7 @@ func (h *TunnelHandler) HandlePatchTunnels(w http.ResponseWriter, r *http.Reques
 			return
 		}
 
+		audit.Before(r, map[string]interface{}{"name": h.tunnelName(raw.ID)})
 		if err := h.tunnelService.RenameTunnel(raw.ID, raw.Name); err != nil {
 			w.WriteHeader(http.StatusBadRequest)
 			json.NewEncoder(w).Encode(tunnel.TunnelResponse{
@@ -794,6 +970,7 @@ func (h *TunnelHandler) HandlePatchTunnels(w http.ResponseWriter, r *http.Reques
 			})
 			return
 		}
+		audit.After(r, map[string]interface{}{"name": raw.Name})
 
 		json.NewEncoder(w).Encode(tunnel.TunnelResponse{
 			Success: true,
@@ -838,6 +1015,10 @@ func (h *TunnelHandler) HandlePatchTunnelAttributes(w http.ResponseWriter, r *ht
 		})
 		return
 	}
+	if !h.tunnelService.TunnelVisible(tunnelID, workspace.ScopeFromContext(r.Context())) {
+		writeNotFound(w, "隧道不存在")
+		return
+	}
 
 	// 解析请求体
 	var updates map[string]interface{}
@@ -862,6 +1043,9 @@ func (h *TunnelHandler) HandlePatchTunnelAttributes(w http.ResponseWriter, r *ht
 			return
 		}
 
+		audit.Action(r, "tunnel.alias", "tunnel", tunnelID)
+		audit.After(r, map[string]interface{}{"alias": aliasStr})
+
 		filteredUpdates := map[string]interface{}{"alias": aliasStr}
 		if err := h.tunnelService.PatchTunnel(tunnelID, filteredUpdates); err != nil {
 			w.WriteHeader(http.StatusBadRequest)
@@ -913,6 +1097,10 @@ func (h *TunnelHandler) HandleSetTunnelRestart(w http.ResponseWriter, r *http.Re
 		})
 		return
 	}
+	if !h.tunnelService.TunnelVisible(id, workspace.ScopeFromContext(r.Context())) {
+		writeNotFound(w, "隧道不存在")
+		return
+	}
 
 	var requestData struct {
 		Restart bool `json:"restart"`
@@ -926,6 +1114,9 @@ func (h *TunnelHandler) HandleSetTunnelRestart(w http.ResponseWriter, r *http.Re
 		return
 	}
 
+	audit.Action(r, "tunnel.set_restart", "tunnel", id)
+	audit.After(r, map[string]interface{}{"restart": requestData.Restart})
+
 	if err := h.tunnelService.SetTunnelRestart(id, requestData.Restart); err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(tunnel.TunnelResponse{
@@ -961,6 +1152,10 @@ func (h *TunnelHandler) HandleGetTunnelDetails(w http.ResponseWriter, r *http.Re
 		json.NewEncoder(w).Encode(map[string]interface{}{"error": "无效的隧道ID"})
 		return
 	}
+	if !h.tunnelService.TunnelVisible(id, workspace.ScopeFromContext(r.Context())) {
+		writeNotFound(w, "隧道不存在")
+		return
+	}
 
 	db := h.tunnelService.DB()
 
@@ -995,13 +1190,14 @@ func (h *TunnelHandler) HandleGetTunnelDetails(w http.ResponseWriter, r *http.Re
 		Min             sql.NullInt64
 		Max             sql.NullInt64
 		Restart         bool
+		Revision        int64
 	}
 
 	query := `SELECT t.id, t.instanceId, t.name, t.mode, t.status, t.endpointId,
 		   e.name, e.tls, e.log, e.ver, t.tunnelPort, t.targetPort, t.tlsMode, t.logLevel,
 		   t.tunnelAddress, t.targetAddress, t.commandLine, t.password, t.certPath, t.keyPath,
 		   t.tcpRx, t.tcpTx, t.udpRx, t.udpTx, t.pool, t.ping,
-		   t.min, t.max, t.restart
+		   t.min, t.max, t.restart, t.revision
 		   FROM "Tunnel" t
 		   LEFT JOIN "Endpoint" e ON t.endpointId = e.id
 		   WHERE t.id = ?`
@@ -1035,6 +1231,7 @@ func (h *TunnelHandler) HandleGetTunnelDetails(w http.ResponseWriter, r *http.Re
 		&tunnelRecord.Min,
 		&tunnelRecord.Max,
 		&tunnelRecord.Restart,
+		&tunnelRecord.Revision,
 	); err != nil {
 		if err == sql.ErrNoRows {
 			w.WriteHeader(http.StatusNotFound)
@@ -1068,7 +1265,12 @@ func (h *TunnelHandler) HandleGetTunnelDetails(w http.ResponseWriter, r *http.Re
 	}
 	password := ""
 	if tunnelRecord.PasswordNS.Valid {
-		password = tunnelRecord.PasswordNS.String
+		var err error
+		if password, err = secret.Reveal(tunnelRecord.PasswordNS.String); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{"error": err.Error()})
+			return
+		}
 	}
 	certPath := ""
 	if tunnelRecord.CertPathNS.Valid {
@@ -1111,7 +1313,8 @@ func (h *TunnelHandler) HandleGetTunnelDetails(w http.ResponseWriter, r *http.Re
 			"endpoint":        endpointName,
 			"endpointId":      tunnelRecord.EndpointID,
 			"endpointVersion": endpointVersion,
-			"password":        password, // 添加密码字段
+			"revision":        tunnelRecord.Revision, // 配置修订号，修改时通过 If-Match 携带
+			"password":        password,              // 添加密码字段
 			"config": map[string]interface{}{
 				"listenPort":  listenPort,
 				"targetPort":  targetPort,
@@ -1183,6 +1386,10 @@ func (h *TunnelHandler) HandleTunnelLogs(w http.ResponseWriter, r *http.Request)
 		json.NewEncoder(w).Encode(map[string]interface{}{"error": "无效的隧道ID"})
 		return
 	}
+	if !h.tunnelService.TunnelVisible(id, workspace.ScopeFromContext(r.Context())) {
+		writeNotFound(w, "隧道不存在")
+		return
+	}
 
 	db := h.tunnelService.DB()
 
@@ -1333,6 +1540,9 @@ func (h *TunnelHandler) HandleQuickCreateTunnel(w http.ResponseWriter, r *http.R
 		return
 	}
 
+	audit.Action(r, "tunnel.quick_create", "tunnel", nil)
+	audit.After(r, req)
+
 	if req.EndpointID == 0 || req.URL == "" || strings.TrimSpace(req.Name) == "" {
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(tunnel.TunnelResponse{
@@ -1341,6 +1551,10 @@ func (h *TunnelHandler) HandleQuickCreateTunnel(w http.ResponseWriter, r *http.R
 		})
 		return
 	}
+	if !h.tunnelService.EndpointVisible(req.EndpointID, workspace.ScopeFromContext(r.Context())) {
+		writeNotFound(w, "主控不存在")
+		return
+	}
 
 	// 使用等待模式快速创建隧道，超时时间为 3 秒
 	if err := h.tunnelService.QuickCreateTunnelAndWait(req.EndpointID, req.URL, req.Name, 3*time.Second); err != nil {
@@ -1381,6 +1595,9 @@ func (h *TunnelHandler) HandleQuickBatchCreateTunnel(w http.ResponseWriter, r *h
 		return
 	}
 
+	audit.Action(r, "tunnel.quick_batch_create", "tunnel", nil)
+	audit.After(r, req)
+
 	if len(req.Rules) == 0 {
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(tunnel.TunnelResponse{
@@ -1400,8 +1617,15 @@ func (h *TunnelHandler) HandleQuickBatchCreateTunnel(w http.ResponseWriter, r *h
 			})
 			return
 		}
+		if !h.tunnelService.EndpointVisible(rule.EndpointID, workspace.ScopeFromContext(r.Context())) {
+			writeNotFound(w, fmt.Sprintf("第 %d 条规则：主控不存在", i+1))
+			return
+		}
 	}
 
+	// 逐条创建不可整体回滚，此后的结果（包括全部失败）均保存用于重放
+	keepIdempotentResponse(r)
+
 	// 批量创建隧道
 	var successCount, failCount int
 	var errorMessages []string
@@ -1446,6 +1670,23 @@ func (h *TunnelHandler) getTunnelIDByName(tunnelName string) (int64, error) {
 	return tunnelID, err
 }
 
+// rollbackTemplateTunnel 模板创建中 client 端失败时删除已创建的 server 端隧道，避免遗留半套隧道，
+// 客户端可使用同一个 Idempotency-Key 重试；回滚失败时保存本次响应，防止重试再创建一个 server 端实例
+func (h *TunnelHandler) rollbackTemplateTunnel(r *http.Request, tunnelName string) bool {
+	var instanceID sql.NullString
+	err := h.tunnelService.DB().QueryRow(`SELECT instanceId FROM "Tunnel" WHERE name = ?`, tunnelName).Scan(&instanceID)
+	if err == nil {
+		err = h.tunnelService.DeleteTunnelAndWait(instanceID.String, 3*time.Second, false)
+	}
+	if err != nil {
+		log.Errorf("[API] 回滚server端隧道 %s 失败: %v", tunnelName, err)
+		keepIdempotentResponse(r)
+		return false
+	}
+	log.Infof("[API] 已回滚server端隧道 %s", tunnelName)
+	return true
+}
+
 // createTunnelGroup 自动创建隧道分组
 func (h *TunnelHandler) createTunnelGroup(name, groupType, description string, tunnelIDs []int64) error {
 	db := h.tunnelService.DB()
@@ -1497,6 +1738,23 @@ func (h *TunnelHandler) deleteTunnelFromGroups(tunnelID int64) error {
 	return err
 }
 
+// tunnelName 查询隧道名称，用于记录重命名前的值
+func (h *TunnelHandler) tunnelName(id int64) string {
+	var name string
+	_ = h.tunnelService.DB().QueryRow(`SELECT name FROM "Tunnel" WHERE id = ?`, id).Scan(&name)
+	return name
+}
+
+// tunnelPassword 前端回传脱敏占位值时，取回隧道当前保存的密码，以便编辑时保持原密码不变
+func (h *TunnelHandler) tunnelPassword(id int64, password string) (string, error) {
+	if !secret.IsMasked(password) {
+		return password, nil
+	}
+	var stored sql.NullString
+	_ = h.tunnelService.DB().QueryRow(`SELECT password FROM "Tunnel" WHERE id = ?`, id).Scan(&stored)
+	return secret.Reveal(stored.String)
+}
+
 // HandleTemplateCreate 处理模板创建请求
 func (h *TunnelHandler) HandleTemplateCreate(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -1536,6 +1794,17 @@ func (h *TunnelHandler) HandleTemplateCreate(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	audit.Action(r, "tunnel.template_create", "tunnel", nil)
+	audit.After(r, req)
+
+	// 模板涉及的主控须属于可见工作区
+	scope := workspace.ScopeFromContext(r.Context())
+	if (req.Inbounds != nil && !h.tunnelService.EndpointVisible(req.Inbounds.MasterID, scope)) ||
+		(req.Outbounds != nil && !h.tunnelService.EndpointVisible(req.Outbounds.MasterID, scope)) {
+		writeNotFound(w, "指定的主控不存在")
+		return
+	}
+
 	log.Infof("[API] 模板创建请求: mode=%s, listen_host=%s, listen_port=%d", req.Mode, req.ListenHost, req.ListenPort)
 
 	switch req.Mode {
@@ -1572,6 +1841,14 @@ func (h *TunnelHandler) HandleTemplateCreate(w http.ResponseWriter, r *http.Requ
 			})
 			return
 		}
+		if endpointAPIKey, err = secret.Reveal(endpointAPIKey); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(tunnel.TunnelResponse{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
 
 		// 构建单端转发的URL，支持listen_host
 		var listenAddr string
@@ -1673,6 +1950,14 @@ func (h *TunnelHandler) HandleTemplateCreate(w http.ResponseWriter, r *http.Requ
 			})
 			return
 		}
+		if serverEndpoint.APIKey, err = secret.Reveal(serverEndpoint.APIKey); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(tunnel.TunnelResponse{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
 
 		// 获取client endpoint信息
 		err = db.QueryRow(
@@ -1695,6 +1980,14 @@ func (h *TunnelHandler) HandleTemplateCreate(w http.ResponseWriter, r *http.Requ
 			})
 			return
 		}
+		if clientEndpoint.APIKey, err = secret.Reveal(clientEndpoint.APIKey); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(tunnel.TunnelResponse{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
 
 		// 从server端URL中提取IP
 		serverIP := strings.TrimPrefix(serverEndpoint.URL, "http://")
@@ -1755,11 +2048,14 @@ func (h *TunnelHandler) HandleTemplateCreate(w http.ResponseWriter, r *http.Requ
 		log.Infof("[API] 步骤2: 在endpoint %d 创建client隧道 %s", clientConfig.MasterID, clientTunnelName)
 		if err := h.tunnelService.QuickCreateTunnelAndWait(clientConfig.MasterID, clientURL, clientTunnelName, 3*time.Second); err != nil {
 			log.Errorf("[API] 创建client端隧道失败: %v", err)
-			// 如果client端创建失败，可以考虑回滚server端，但这里先简单处理
+			errMsg := "创建client端隧道失败: " + err.Error()
+			if !h.rollbackTemplateTunnel(r, serverTunnelName) {
+				errMsg += "（server端隧道回滚失败，请手动删除）"
+			}
 			w.WriteHeader(http.StatusBadRequest)
 			json.NewEncoder(w).Encode(tunnel.TunnelResponse{
 				Success: false,
-				Error:   "创建client端隧道失败: " + err.Error(),
+				Error:   errMsg,
 			})
 			return
 		}
@@ -1845,6 +2141,14 @@ func (h *TunnelHandler) HandleTemplateCreate(w http.ResponseWriter, r *http.Requ
 			})
 			return
 		}
+		if serverEndpoint.APIKey, err = secret.Reveal(serverEndpoint.APIKey); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(tunnel.TunnelResponse{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
 
 		// 获取client endpoint信息
 		err = db.QueryRow(
@@ -1867,6 +2171,14 @@ func (h *TunnelHandler) HandleTemplateCreate(w http.ResponseWriter, r *http.Requ
 			})
 			return
 		}
+		if clientEndpoint.APIKey, err = secret.Reveal(clientEndpoint.APIKey); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(tunnel.TunnelResponse{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
 
 		// 从server端URL中提取IP
 		serverIP := strings.TrimPrefix(serverEndpoint.URL, "http://")
@@ -1927,11 +2239,14 @@ func (h *TunnelHandler) HandleTemplateCreate(w http.ResponseWriter, r *http.Requ
 		log.Infof("[API] 步骤2: 在endpoint %d 创建client隧道 %s", clientConfig.MasterID, clientTunnelName)
 		if err := h.tunnelService.QuickCreateTunnelAndWait(clientConfig.MasterID, clientURL, clientTunnelName, 3*time.Second); err != nil {
 			log.Errorf("[API] 创建client端隧道失败: %v", err)
-			// 如果client端创建失败，可以考虑回滚server端，但这里先简单处理
+			errMsg := "创建client端隧道失败: " + err.Error()
+			if !h.rollbackTemplateTunnel(r, serverTunnelName) {
+				errMsg += "（server端隧道回滚失败，请手动删除）"
+			}
 			w.WriteHeader(http.StatusBadRequest)
 			json.NewEncoder(w).Encode(tunnel.TunnelResponse{
 				Success: false,
-				Error:   "创建client端隧道失败: " + err.Error(),
+				Error:   errMsg,
 			})
 			return
 		}
@@ -2011,6 +2326,9 @@ func (h *TunnelHandler) HandleBatchDeleteTunnels(w http.ResponseWriter, r *http.
 		return
 	}
 
+	audit.Action(r, "tunnel.batch_delete", "tunnel", nil)
+	audit.Before(r, req)
+
 	// 至少提供一种 ID
 	if len(req.IDs) == 0 && len(req.InstanceIDs) == 0 {
 		w.WriteHeader(http.StatusBadRequest)
@@ -2057,9 +2375,17 @@ func (h *TunnelHandler) HandleBatchDeleteTunnels(w http.ResponseWriter, r *http.
 
 	// 开始删除
 	var resp batchDeleteResponse
+	scope := workspace.ScopeFromContext(r.Context())
 	for _, iid := range req.InstanceIDs {
 		r := itemResult{InstanceID: iid}
 
+		if !h.tunnelService.InstanceVisible(iid, scope) {
+			r.Error = "隧道不存在"
+			resp.FailCount++
+			resp.Results = append(resp.Results, r)
+			continue
+		}
+
 		// 如果不是移入回收站，先解绑分组关系
 		if !req.Recycle {
 			if tunnelID, exists := instanceTunnelMap[iid]; exists {
@@ -2128,6 +2454,9 @@ func (h *TunnelHandler) HandleNewBatchCreateTunnels(w http.ResponseWriter, r *ht
 		return
 	}
 
+	audit.Action(r, "tunnel.batch_create", "tunnel", nil)
+	audit.After(r, req)
+
 	// 添加调试日志，显示接收到的原始请求数据
 	reqBytes, _ := json.MarshalIndent(req, "", "  ")
 	log.Infof("[API] 接收到新的批量创建请求，原始数据: %s", string(reqBytes))
@@ -2175,6 +2504,10 @@ func (h *TunnelHandler) HandleNewBatchCreateTunnels(w http.ResponseWriter, r *ht
 				})
 				return
 			}
+			if !h.tunnelService.EndpointVisible(item.EndpointID, workspace.ScopeFromContext(r.Context())) {
+				writeNotFound(w, fmt.Sprintf("第 %d 项的主控不存在", i+1))
+				return
+			}
 			if item.TunnelPort <= 0 || item.TunnelPort > 65535 {
 				w.WriteHeader(http.StatusBadRequest)
 				json.NewEncoder(w).Encode(tunnel.NewBatchCreateResponse{
@@ -2245,6 +2578,10 @@ func (h *TunnelHandler) HandleNewBatchCreateTunnels(w http.ResponseWriter, r *ht
 				})
 				return
 			}
+			if !h.tunnelService.EndpointVisible(configItem.EndpointID, workspace.ScopeFromContext(r.Context())) {
+				writeNotFound(w, fmt.Sprintf("第 %d 个配置组的主控不存在", i+1))
+				return
+			}
 
 			if len(configItem.Config) == 0 {
 				w.WriteHeader(http.StatusBadRequest)
@@ -2305,6 +2642,9 @@ func (h *TunnelHandler) HandleNewBatchCreateTunnels(w http.ResponseWriter, r *ht
 		return
 	}
 
+	// 逐项创建不可整体回滚，部分或全部失败的结果同样保存用于重放，避免重试时重复创建已成功的项
+	keepIdempotentResponse(r)
+
 	// 根据结果设置HTTP状态码
 	if response.Success {
 		if response.FailCount > 0 {
@@ -2366,6 +2706,9 @@ func (h *TunnelHandler) HandleBatchActionTunnels(w http.ResponseWriter, r *http.
 		return
 	}
 
+	audit.Action(r, "tunnel.batch_action", "tunnel", nil)
+	audit.After(r, req)
+
 	// 验证操作类型
 	if req.Action != "start" && req.Action != "stop" && req.Action != "restart" {
 		w.WriteHeader(http.StatusBadRequest)
@@ -2404,11 +2747,20 @@ func (h *TunnelHandler) HandleBatchActionTunnels(w http.ResponseWriter, r *http.
 	failCount := 0
 
 	// 逐个处理每个隧道
+	scope := workspace.ScopeFromContext(r.Context())
 	for _, tunnelID := range req.IDs {
 		result := actionResult{
 			ID: tunnelID,
 		}
 
+		if !h.tunnelService.TunnelVisible(tunnelID, scope) {
+			result.Success = false
+			result.Error = "隧道不存在"
+			failCount++
+			results = append(results, result)
+			continue
+		}
+
 		// 获取隧道的 instanceID 和名称
 		instanceID, err := h.tunnelService.GetInstanceIDByTunnelID(tunnelID)
 		if err != nil {
@@ -2496,6 +2848,10 @@ func (h *TunnelHandler) HandleGetTunnelTrafficTrend(w http.ResponseWriter, r *ht
 		json.NewEncoder(w).Encode(map[string]interface{}{"error": "无效的隧道ID"})
 		return
 	}
+	if !h.tunnelService.TunnelVisible(id, workspace.ScopeFromContext(r.Context())) {
+		writeNotFound(w, "隧道不存在")
+		return
+	}
 
 	db := h.tunnelService.DB()
 
@@ -2724,6 +3080,10 @@ func (h *TunnelHandler) HandleGetTunnelPingTrend(w http.ResponseWriter, r *http.
 		json.NewEncoder(w).Encode(map[string]interface{}{"error": "无效的隧道ID"})
 		return
 	}
+	if !h.tunnelService.TunnelVisible(id, workspace.ScopeFromContext(r.Context())) {
+		writeNotFound(w, "隧道不存在")
+		return
+	}
 
 	db := h.tunnelService.DB()
 
@@ -2861,6 +3221,10 @@ func (h *TunnelHandler) HandleGetTunnelPoolTrend(w http.ResponseWriter, r *http.
 		json.NewEncoder(w).Encode(map[string]interface{}{"error": "无效的隧道ID"})
 		return
 	}
+	if !h.tunnelService.TunnelVisible(id, workspace.ScopeFromContext(r.Context())) {
+		writeNotFound(w, "隧道不存在")
+		return
+	}
 
 	db := h.tunnelService.DB()
 
@@ -2997,6 +3361,12 @@ func (h *TunnelHandler) HandleUpdateTunnelV2(w http.ResponseWriter, r *http.Requ
 		json.NewEncoder(w).Encode(tunnel.TunnelResponse{Success: false, Error: "无效的隧道ID"})
 		return
 	}
+	if !h.tunnelService.TunnelVisible(tunnelID, workspace.ScopeFromContext(r.Context())) {
+		writeNotFound(w, "隧道不存在")
+		return
+	}
+	audit.Action(r, "tunnel.update", "tunnel", tunnelID)
+	audit.BeforeRow(r, "Tunnel", tunnelID)
 
 	// 解析请求体（与创建接口保持一致）
 	var raw struct {
@@ -3021,6 +3391,13 @@ func (h *TunnelHandler) HandleUpdateTunnelV2(w http.ResponseWriter, r *http.Requ
 		json.NewEncoder(w).Encode(tunnel.TunnelResponse{Success: false, Error: "无效的请求数据"})
 		return
 	}
+	password, err := h.tunnelPassword(tunnelID, raw.Password)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(tunnel.TunnelResponse{Success: false, Error: err.Error()})
+		return
+	}
+	raw.Password = password
 
 	// 工具函数解析 int 字段（复用前面定义的函数逻辑）
 	parseIntV2 := func(j json.RawMessage) (int, bool, error) {
@@ -3112,9 +3489,16 @@ func (h *TunnelHandler) HandleUpdateTunnelV2(w http.ResponseWriter, r *http.Requ
 		json.NewEncoder(w).Encode(tunnel.TunnelResponse{Success: false, Error: "查询端点信息失败"})
 		return
 	}
+	apiKey, err := secret.Reveal(endpoint.APIKey)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(tunnel.TunnelResponse{Success: false, Error: err.Error()})
+		return
+	}
+	endpoint.APIKey = apiKey
 
 	npClient := nodepass.NewClient(endpoint.URL, endpoint.APIPath, endpoint.APIKey, nil)
-	log.Infof("[API] 准备调用 UpdateInstanceV1: instanceID=%s, commandLine=%s", instanceID, commandLine)
+	log.Infof("[API] 准备调用 UpdateInstanceV1: instanceID=%s, commandLine=%s", instanceID, secret.MaskURL(commandLine))
 	if err := npClient.UpdateInstanceV1(instanceID, commandLine); err != nil {
 		log.Errorf("[API] UpdateInstanceV1 调用失败: %v", err)
 		// 若远端返回 405，则回退旧逻辑（删除+重建）
@@ -3159,6 +3543,7 @@ func (h *TunnelHandler) HandleUpdateTunnelV2(w http.ResponseWriter, r *http.Requ
 				json.NewEncoder(w).Encode(tunnel.TunnelResponse{Success: false, Error: "编辑实例失败，创建新实例错误: " + crtErr.Error()})
 				return
 			}
+			audit.AfterRow(r, "Tunnel", newTunnel.ID)
 			json.NewEncoder(w).Encode(tunnel.TunnelResponse{Success: true, Message: "编辑实例成功(回退旧逻辑)", Tunnel: newTunnel})
 			return
 		}
@@ -3174,7 +3559,7 @@ func (h *TunnelHandler) HandleUpdateTunnelV2(w http.ResponseWriter, r *http.Requ
 	for time.Now().Before(deadline) {
 		var dbCmd, dbStatus string
 		if scanErr := h.tunnelService.DB().QueryRow(`SELECT commandLine, status FROM "Tunnel" WHERE instanceId = ?`, instanceID).Scan(&dbCmd, &dbStatus); scanErr == nil {
-			if dbCmd == commandLine && dbStatus == "running" {
+			if dbCmd == secret.MaskURL(commandLine) && dbStatus == "running" {
 				success = true
 				break
 			}
@@ -3193,7 +3578,7 @@ func (h *TunnelHandler) HandleUpdateTunnelV2(w http.ResponseWriter, r *http.Requ
 			maxVal = -1
 		}
 		_, _ = h.tunnelService.DB().Exec(`UPDATE "Tunnel" SET name = ?, mode = ?, tunnelAddress = ?, tunnelPort = ?, targetAddress = ?, targetPort = ?, tlsMode = ?, certPath = ?, keyPath = ?, logLevel = ?, commandLine = ?, min = ?, max = ?, status = ?, updatedAt = ? WHERE id = ?`,
-			raw.Name, raw.Mode, raw.TunnelAddress, tunnelPort, raw.TargetAddress, targetPort, raw.TLSMode, raw.CertPath, raw.KeyPath, raw.LogLevel, commandLine,
+			raw.Name, raw.Mode, raw.TunnelAddress, tunnelPort, raw.TargetAddress, targetPort, raw.TLSMode, raw.CertPath, raw.KeyPath, raw.LogLevel, secret.MaskURL(commandLine),
 			func() interface{} {
 				if minVal >= 0 {
 					return minVal
@@ -3220,6 +3605,7 @@ func (h *TunnelHandler) HandleUpdateTunnelV2(w http.ResponseWriter, r *http.Requ
 		}
 	}
 
+	audit.AfterRow(r, "Tunnel", tunnelID)
 	json.NewEncoder(w).Encode(tunnel.TunnelResponse{Success: true, Message: "编辑实例成功"})
 }
 
@@ -3239,6 +3625,10 @@ func (h *TunnelHandler) HandleExportTunnelLogs(w http.ResponseWriter, r *http.Re
 		http.Error(w, "Invalid tunnel ID", http.StatusBadRequest)
 		return
 	}
+	if !h.tunnelService.TunnelVisible(tunnelID, workspace.ScopeFromContext(r.Context())) {
+		writeNotFound(w, "隧道不存在")
+		return
+	}
 
 	// 获取隧道信息
 	db := h.tunnelService.DB()
@@ -0,0 +1,249 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"NodePassDash/internal/audit"
+	"NodePassDash/internal/auth"
+
+	"github.com/gorilla/mux"
+)
+
+// UserHandler 用户与第三方身份映射管理相关的处理器（仅管理员可访问）
+type UserHandler struct {
+	authService *auth.Service
+}
+
+// NewUserHandler 创建用户处理器实例
+func NewUserHandler(authService *auth.Service) *UserHandler {
+	return &UserHandler{
+		authService: authService,
+	}
+}
+
+// HandleUsers 列出或创建用户
+// GET  /api/users
+// POST /api/users Body: {username, password, role}
+func (h *UserHandler) HandleUsers(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case http.MethodGet:
+		users, err := h.authService.ListUsers()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "获取用户列表失败: " + err.Error()})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "users": users})
+
+	case http.MethodPost:
+		audit.Action(r, "user.create", "user", nil)
+
+		var req auth.CreateUserRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "无效请求体"})
+			return
+		}
+
+		user, err := h.authService.CreateUser(req)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": err.Error()})
+			return
+		}
+		audit.Target(r, user.ID)
+		audit.AfterRow(r, "User", user.ID)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "user": user})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleUser 更新或删除指定用户
+// PUT    /api/users/{id} Body: {password, role, disabled}
+// DELETE /api/users/{id}
+func (h *UserHandler) HandleUser(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "无效的用户ID"})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		audit.Action(r, "user.update", "user", id)
+		audit.BeforeRow(r, "User", id)
+
+		var req auth.UpdateUserRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "无效请求体"})
+			return
+		}
+
+		user, err := h.authService.UpdateUser(id, req)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": err.Error()})
+			return
+		}
+		audit.AfterRow(r, "User", id)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "user": user})
+
+	case http.MethodDelete:
+		audit.Action(r, "user.delete", "user", id)
+		audit.BeforeRow(r, "User", id)
+
+		if principal, ok := auth.PrincipalFromContext(r.Context()); ok {
+			if user, err := h.authService.GetUserByID(id); err == nil && user.Username == principal.Username {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "不能删除当前登录的用户"})
+				return
+			}
+		}
+
+		if err := h.authService.DeleteUser(id); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": err.Error()})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "message": "用户已删除"})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleOAuthIdentities 列出所有第三方登录身份 (GET /api/oauth2/identities)
+func (h *UserHandler) HandleOAuthIdentities(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	identities, err := h.authService.ListOAuthIdentities()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "获取身份列表失败: " + err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "identities": identities})
+}
+
+// HandleMapOAuthIdentity 将第三方身份映射到本地用户
+// PUT /api/oauth2/identities/{id} Body: {userId}，userId 为 null 表示解除映射
+func (h *UserHandler) HandleMapOAuthIdentity(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "无效的身份ID"})
+		return
+	}
+
+	var req struct {
+		UserID *int64 `json:"userId"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "无效请求体"})
+		return
+	}
+
+	audit.Action(r, "oauth_identity.map", "oauth_identity", id)
+	audit.BeforeRow(r, "OAuthUser", id)
+
+	if err := h.authService.MapOAuthIdentity(id, req.UserID); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": err.Error()})
+		return
+	}
+	audit.AfterRow(r, "OAuthUser", id)
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "message": "身份映射已更新"})
+}
+
+// HandleOAuthIdentityAction 批准或撤销第三方身份
+// POST /api/oauth2/identities/{id}/approve
+// POST /api/oauth2/identities/{id}/revoke
+func (h *UserHandler) HandleOAuthIdentityAction(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "无效的身份ID"})
+		return
+	}
+
+	audit.Action(r, "oauth_identity."+vars["action"], "oauth_identity", id)
+	audit.BeforeRow(r, "OAuthUser", id)
+
+	var message string
+	switch vars["action"] {
+	case "approve":
+		err = h.authService.ApproveOAuthIdentity(id)
+		message = "身份已批准"
+	case "revoke":
+		err = h.authService.RevokeOAuthIdentity(id)
+		message = "身份已撤销"
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "不支持的操作"})
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": err.Error()})
+		return
+	}
+	audit.AfterRow(r, "OAuthUser", id)
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "message": message})
+}
+
+// HandleOAuthAllowlist 读取或保存 OAuth2 登录白名单
+// GET /api/oauth2/allowlist
+// PUT /api/oauth2/allowlist Body: {logins, emails, domains, githubOrgs, githubTeams}
+func (h *UserHandler) HandleOAuthAllowlist(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case http.MethodGet:
+		allowlist, err := h.authService.GetOAuthAllowlist()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": err.Error()})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "allowlist": allowlist, "enabled": allowlist.Enabled()})
+
+	case http.MethodPut:
+		audit.Action(r, "oauth_allowlist.update", "config", auth.ConfigKeyOAuthAllowlist)
+		if before, err := h.authService.GetOAuthAllowlist(); err == nil {
+			audit.Before(r, before)
+		}
+
+		var req auth.OAuthAllowlist
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "无效请求体"})
+			return
+		}
+		audit.After(r, req)
+		if err := h.authService.SetOAuthAllowlist(req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": err.Error()})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "message": "白名单已保存"})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
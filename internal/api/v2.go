@@ -0,0 +1,246 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// apiV2Prefix v2 接口前缀：/api/v2/... 与 /api/... 共用同一套处理器，仅响应格式不同
+const apiV2Prefix = "/api/v2"
+
+// Envelope /api/v2 统一响应结构：成功时 error 为 null，失败时 data 为 null
+type Envelope struct {
+	Data  interface{}            `json:"data"`
+	Error *EnvelopeError         `json:"error"`
+	Meta  map[string]interface{} `json:"meta"`
+}
+
+// EnvelopeError v2 错误信息；message 按 Accept-Language 本地化，details 携带 v1 响应中的附加字段
+type EnvelopeError struct {
+	Code    ErrorCode              `json:"code"`
+	Message string                 `json:"message"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// v2Middleware 将 /api/v2/... 请求转交给对应的 v1 路由，并把响应统一转换为 Envelope；
+// 路由、权限及审计等中间件均按 v1 路径处理
+func v2Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rest, ok := strings.CutPrefix(r.URL.Path, apiV2Prefix)
+		if !ok || (rest != "" && !strings.HasPrefix(rest, "/")) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		r2 := new(http.Request)
+		*r2 = *r
+		u := *r.URL
+		u.Path = "/api" + rest
+		if u.RawPath != "" {
+			if rawRest, ok := strings.CutPrefix(u.RawPath, apiV2Prefix); ok {
+				u.RawPath = "/api" + rawRest
+			}
+		}
+		r2.URL = &u
+
+		ew := &envelopeResponseWriter{ResponseWriter: w, lang: preferredLang(r)}
+		next.ServeHTTP(ew, r2)
+		ew.finish()
+	})
+}
+
+// envelopeResponseWriter 缓存 JSON 及错误响应，在请求结束时转换为 Envelope；
+// SSE、文件下载等成功的非 JSON 响应直接透传
+type envelopeResponseWriter struct {
+	http.ResponseWriter
+	lang    string
+	status  int
+	decided bool
+	buffer  bool
+	body    bytes.Buffer
+}
+
+// decide 决定是否缓存响应：错误响应一律缓存，成功响应仅缓存 JSON
+func (w *envelopeResponseWriter) decide(b []byte) {
+	if w.decided {
+		return
+	}
+	h := w.Header()
+	ct := h.Get("Content-Type")
+	if ct == "" && b == nil && w.status < 400 {
+		return
+	}
+	w.decided = true
+	switch {
+	case strings.HasPrefix(ct, "text/event-stream"):
+		w.buffer = false
+	case w.status >= 400:
+		w.buffer = true
+	case w.status >= 300:
+		w.buffer = false
+		if loc := h.Get("Location"); strings.HasPrefix(loc, "/api/") {
+			h.Set("Location", apiV2Prefix+strings.TrimPrefix(loc, "/api"))
+		}
+	case h.Get("Content-Disposition") != "":
+		w.buffer = false
+	case ct != "":
+		w.buffer = strings.HasPrefix(ct, "application/json")
+	default:
+		trimmed := bytes.TrimSpace(b)
+		w.buffer = len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[')
+	}
+	if !w.buffer && w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+}
+
+func (w *envelopeResponseWriter) WriteHeader(status int) {
+	if w.status != 0 {
+		return
+	}
+	w.status = status
+	w.decide(nil)
+}
+
+func (w *envelopeResponseWriter) Write(b []byte) (int, error) {
+	w.decide(b)
+	if w.buffer {
+		return w.body.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush 透传 http.Flusher，缓存的响应在请求结束时统一写出
+func (w *envelopeResponseWriter) Flush() {
+	if w.buffer {
+		return
+	}
+	if !w.decided {
+		w.decided = true
+		if w.status != 0 {
+			w.ResponseWriter.WriteHeader(w.status)
+		}
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap 供 http.ResponseController 获取原始 ResponseWriter
+func (w *envelopeResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// finish 写出转换后的响应
+func (w *envelopeResponseWriter) finish() {
+	if w.decided && !w.buffer {
+		return
+	}
+	status := w.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if status == http.StatusNoContent || status == http.StatusNotModified {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+
+	status, env := toEnvelope(status, w.body.Bytes(), w.lang)
+	h := w.Header()
+	h.Del("Content-Length")
+	h.Set("Content-Type", "application/json")
+	h.Set("Content-Language", w.lang)
+	w.ResponseWriter.WriteHeader(status)
+
+	enc := json.NewEncoder(w.ResponseWriter)
+	enc.SetEscapeHTML(false)
+	enc.Encode(env)
+}
+
+// toEnvelope 将 v1 响应体转换为 Envelope，返回最终的 HTTP 状态码：
+// success:false 或 4xx/5xx 视为失败
+func toEnvelope(status int, body []byte, lang string) (int, Envelope) {
+	env := Envelope{Meta: map[string]interface{}{}}
+
+	var parsed interface{}
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) > 0 {
+		dec := json.NewDecoder(bytes.NewReader(trimmed))
+		dec.UseNumber()
+		if err := dec.Decode(&parsed); err != nil {
+			// http.Error 等写出的纯文本
+			parsed = nil
+		}
+	}
+	obj, isObject := parsed.(map[string]interface{})
+
+	failed := status >= 400
+	if isObject {
+		if ok, exists := obj["success"].(bool); exists && !ok {
+			failed = true
+		}
+	}
+
+	if !failed {
+		if !isObject {
+			env.Data = parsed
+			return status, env
+		}
+		delete(obj, "success")
+		if data, ok := obj["data"]; ok {
+			delete(obj, "data")
+			env.Data = data
+			for k, v := range obj {
+				env.Meta[k] = v
+			}
+			return status, env
+		}
+		if msg, ok := obj["message"].(string); ok {
+			delete(obj, "message")
+			env.Meta["message"] = msg
+		}
+		if len(obj) > 0 {
+			env.Data = obj
+		}
+		return status, env
+	}
+
+	message, declared := "", ""
+	details := map[string]interface{}{}
+	if isObject {
+		message, _ = obj["error"].(string)
+		if message == "" {
+			message, _ = obj["message"].(string)
+		}
+		declared, _ = obj["code"].(string)
+		if required, _ := obj["twoFactorRequired"].(bool); required {
+			declared = string(ErrTwoFactorRequired)
+		}
+		for k, v := range obj {
+			switch k {
+			case "success", "error", "message", "code":
+			default:
+				details[k] = v
+			}
+		}
+	} else if parsed == nil {
+		message = strings.TrimSpace(string(trimmed))
+	}
+
+	// 4xx 及以 200 表示的失败统一使用错误码对应的状态码，5xx 保持原状态码
+	code := classifyError(status, declared, message)
+	if status < 500 {
+		status = errorStatus(code)
+	}
+	localized := errorMessage(code, lang, message)
+	if message != "" && message != localized {
+		details["reason"] = message
+	}
+	if len(details) == 0 {
+		details = nil
+	}
+	env.Error = &EnvelopeError{Code: code, Message: localized, Details: details}
+	return status, env
+}
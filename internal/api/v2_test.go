@@ -0,0 +1,184 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestPreferredLang(t *testing.T) {
+	cases := []struct{ header, want string }{
+		{"", "zh"},
+		{"en", "en"},
+		{"en-US,en;q=0.9", "en"},
+		{"zh-CN,zh;q=0.9,en;q=0.8", "zh"},
+		{"en;q=0.9, zh;q=0.8", "en"},
+		{"zh;q=0.5, EN-GB;q=0.7", "en"},
+		{"fr-FR, de;q=0.9", "zh"},
+		{"fr, en;q=0.1", "en"},
+		{"en;q=bad", "en"},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if c.header != "" {
+			r.Header.Set("Accept-Language", c.header)
+		}
+		if got := preferredLang(r); got != c.want {
+			t.Errorf("preferredLang(%q) = %q, want %q", c.header, got, c.want)
+		}
+	}
+}
+
+func TestClassifyError(t *testing.T) {
+	cases := []struct {
+		status   int
+		declared string
+		message  string
+		want     ErrorCode
+	}{
+		{http.StatusPreconditionFailed, string(ErrPreconditionFailed), "", ErrPreconditionFailed},
+		{http.StatusBadRequest, "UNKNOWN_CODE", "", ErrBadRequest},
+		{http.StatusNotFound, "", "隧道不存在", ErrTunnelNotFound},
+		{http.StatusNotFound, "", "端点不存在", ErrEndpointNotFound},
+		{http.StatusNotFound, "", "用户不存在", ErrNotFound},
+		{http.StatusBadRequest, "", "无效的隧道ID", ErrInvalidArgument},
+		{http.StatusBadRequest, "", "Invalid JSON", ErrInvalidArgument},
+		{http.StatusUnauthorized, "", "用户名或密码错误", ErrInvalidCredentials},
+		{http.StatusForbidden, "", "CSRF token mismatch", ErrCSRFFailed},
+		// 明确的状态码只细化为同状态码的错误码
+		{http.StatusForbidden, "", "参数无效", ErrPermissionDenied},
+		{http.StatusConflict, "", "名称已存在", ErrAlreadyExists},
+		{http.StatusTooManyRequests, "", "", ErrRateLimited},
+		{http.StatusTeapot, "", "", ErrBadRequest},
+		// 5xx 不按提示细化
+		{http.StatusInternalServerError, "", "隧道不存在", ErrInternal},
+		{http.StatusBadGateway, "", "", ErrUpstream},
+		{http.StatusOK, "", "", ErrOperationFailed},
+	}
+	for _, c := range cases {
+		if got := classifyError(c.status, c.declared, c.message); got != c.want {
+			t.Errorf("classifyError(%d, %q, %q) = %s, want %s", c.status, c.declared, c.message, got, c.want)
+		}
+	}
+}
+
+func TestErrorCatalogComplete(t *testing.T) {
+	for code, info := range errorCatalog {
+		if info.Status < 400 {
+			t.Errorf("%s: status %d is not an error", code, info.Status)
+		}
+		for _, lang := range supportedLangs {
+			if info.Messages[lang] == "" {
+				t.Errorf("%s: missing %s message", code, lang)
+			}
+		}
+	}
+}
+
+// v2Request 经 v2Middleware 请求测试路由，返回响应及解析后的 Envelope
+func v2Request(t *testing.T, path, lang string) (*httptest.ResponseRecorder, Envelope) {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/tunnels", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "data": []int{1, 2}, "total": 2})
+	})
+	mux.HandleFunc("/api/tunnels/1", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "message": "已更新", "id": 1})
+	})
+	mux.HandleFunc("/api/tunnels/2", func(w http.ResponseWriter, r *http.Request) {
+		writeNotFound(w, "隧道不存在")
+	})
+	mux.HandleFunc("/api/tunnels/3", func(w http.ResponseWriter, r *http.Request) {
+		// v1 以 200 + success:false 表示失败
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "instance busy", "instanceId": "i3"})
+	})
+	mux.HandleFunc("/api/tunnels/4", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "upstream exploded", http.StatusBadGateway)
+	})
+	mux.HandleFunc("/api/sse/global", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: {}\n\n"))
+	})
+
+	r := httptest.NewRequest(http.MethodGet, path, nil)
+	if lang != "" {
+		r.Header.Set("Accept-Language", lang)
+	}
+	w := httptest.NewRecorder()
+	v2Middleware(mux).ServeHTTP(w, r)
+
+	var env Envelope
+	if w.Header().Get("Content-Type") == "application/json" {
+		if err := json.Unmarshal(w.Body.Bytes(), &env); err != nil {
+			t.Fatalf("%s: invalid envelope %s: %v", path, w.Body.String(), err)
+		}
+	}
+	return w, env
+}
+
+func TestV2EnvelopeSuccess(t *testing.T) {
+	w, env := v2Request(t, "/api/v2/tunnels", "")
+	if w.Code != http.StatusOK || env.Error != nil {
+		t.Fatalf("status = %d, error = %+v", w.Code, env.Error)
+	}
+	if !reflect.DeepEqual(env.Data, []interface{}{float64(1), float64(2)}) || env.Meta["total"] != float64(2) {
+		t.Fatalf("envelope = %+v, want data list with total in meta", env)
+	}
+	if _, ok := env.Meta["success"]; ok {
+		t.Fatal("success flag should not leak into meta")
+	}
+
+	// 没有 data 字段时其余字段作为 data，message 放入 meta
+	_, env = v2Request(t, "/api/v2/tunnels/1", "")
+	if data, _ := env.Data.(map[string]interface{}); data["id"] != float64(1) || env.Meta["message"] != "已更新" {
+		t.Fatalf("envelope = %+v", env)
+	}
+
+	// v1 路径不受影响，SSE 直接透传
+	if w, _ := v2Request(t, "/api/tunnels/1", ""); w.Body.String() != "{\"id\":1,\"message\":\"已更新\",\"success\":true}\n" {
+		t.Fatalf("v1 response changed: %s", w.Body.String())
+	}
+	if w, _ := v2Request(t, "/api/v2/sse/global", ""); w.Body.String() != "data: {}\n\n" {
+		t.Fatalf("sse response wrapped: %s", w.Body.String())
+	}
+}
+
+func TestV2EnvelopeErrors(t *testing.T) {
+	cases := []struct {
+		name, path, lang string
+		wantLang         string
+		wantStatus       int
+		wantCode         ErrorCode
+		wantMessage      string
+		wantDetails      map[string]interface{}
+	}{
+		{"chinese keeps specific message", "/api/v2/tunnels/2", "zh-CN", "zh", http.StatusNotFound, ErrTunnelNotFound, "隧道不存在", nil},
+		{"english localized", "/api/v2/tunnels/2", "en-US,en;q=0.9", "en", http.StatusNotFound, ErrTunnelNotFound, "Tunnel not found",
+			map[string]interface{}{"reason": "隧道不存在"}},
+		{"unsupported language falls back to chinese", "/api/v2/tunnels/2", "fr", "zh", http.StatusNotFound, ErrTunnelNotFound, "隧道不存在", nil},
+		{"200 failure", "/api/v2/tunnels/3", "en", "en", http.StatusBadRequest, ErrOperationFailed, "The operation failed",
+			map[string]interface{}{"reason": "instance busy", "instanceId": "i3"}},
+		{"chinese catalog message for english reason", "/api/v2/tunnels/3", "", "zh", http.StatusBadRequest, ErrOperationFailed, "操作失败",
+			map[string]interface{}{"reason": "instance busy", "instanceId": "i3"}},
+		{"plain text 5xx keeps status", "/api/v2/tunnels/4", "en", "en", http.StatusBadGateway, ErrUpstream, "Request to NodePass endpoint failed",
+			map[string]interface{}{"reason": "upstream exploded"}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			w, env := v2Request(t, c.path, c.lang)
+			if w.Code != c.wantStatus || env.Data != nil || env.Error == nil {
+				t.Fatalf("status = %d, envelope = %+v", w.Code, env)
+			}
+			if env.Error.Code != c.wantCode || env.Error.Message != c.wantMessage || !reflect.DeepEqual(env.Error.Details, c.wantDetails) {
+				t.Fatalf("error = %+v, want %s %q %v", env.Error, c.wantCode, c.wantMessage, c.wantDetails)
+			}
+			if lang := w.Header().Get("Content-Language"); lang != c.wantLang {
+				t.Fatalf("Content-Language = %q, want %q", lang, c.wantLang)
+			}
+		})
+	}
+}
@@ -0,0 +1,240 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"NodePassDash/internal/audit"
+	"NodePassDash/internal/auth"
+	"NodePassDash/internal/webhook"
+
+	"github.com/gorilla/mux"
+)
+
+// WebhookHandler 出站 Webhook 管理相关的处理器（仅管理员可访问）
+type WebhookHandler struct {
+	webhookService *webhook.Service
+}
+
+// NewWebhookHandler 创建 Webhook 处理器实例
+func NewWebhookHandler(webhookService *webhook.Service) *WebhookHandler {
+	return &WebhookHandler{
+		webhookService: webhookService,
+	}
+}
+
+// HandleWebhooks 列出或创建 Webhook
+// GET  /api/webhooks
+// POST /api/webhooks Body: {name, url, secret, eventTypes, endpointIds, tagIds, enabled}
+// 签名密钥仅在创建时返回一次，secret 为空时自动生成
+func (h *WebhookHandler) HandleWebhooks(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case http.MethodGet:
+		hooks, err := h.webhookService.List()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "获取 Webhook 列表失败: " + err.Error()})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "webhooks": hooks})
+
+	case http.MethodPost:
+		audit.Action(r, "webhook.create", "webhook", nil)
+
+		var req webhook.CreateWebhookRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "无效请求体"})
+			return
+		}
+
+		var createdBy string
+		if principal, ok := auth.PrincipalFromContext(r.Context()); ok {
+			createdBy = principal.Username
+		}
+		key, hook, err := h.webhookService.Create(createdBy, req)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": err.Error()})
+			return
+		}
+		audit.Target(r, hook.ID)
+		audit.After(r, hook)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"webhook": hook,
+			"secret":  key, // 明文密钥仅在创建时返回一次
+		})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleWebhook 获取、更新或删除指定 Webhook
+// GET    /api/webhooks/{id}
+// PUT    /api/webhooks/{id} Body: {name, url, eventTypes, endpointIds, tagIds, enabled, rotateSecret}
+// DELETE /api/webhooks/{id}
+func (h *WebhookHandler) HandleWebhook(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, ok := parseWebhookID(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		hook, err := h.webhookService.Get(id)
+		if err != nil {
+			writeWebhookError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "webhook": hook})
+
+	case http.MethodPut:
+		audit.Action(r, "webhook.update", "webhook", id)
+		if before, err := h.webhookService.Get(id); err == nil {
+			audit.Before(r, before)
+		}
+
+		var req webhook.UpdateWebhookRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "无效请求体"})
+			return
+		}
+
+		key, hook, err := h.webhookService.Update(id, req)
+		if err != nil {
+			writeWebhookError(w, err)
+			return
+		}
+		audit.After(r, hook)
+		resp := map[string]interface{}{"success": true, "webhook": hook}
+		if key != "" {
+			// 重新生成的密钥同样仅返回一次
+			resp["secret"] = key
+		}
+		json.NewEncoder(w).Encode(resp)
+
+	case http.MethodDelete:
+		audit.Action(r, "webhook.delete", "webhook", id)
+		if before, err := h.webhookService.Get(id); err == nil {
+			audit.Before(r, before)
+		}
+
+		if err := h.webhookService.Delete(id); err != nil {
+			writeWebhookError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "message": "Webhook 已删除"})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleWebhookTest 立即发送一条 ping 事件并返回投递结果，失败时不重试
+// POST /api/webhooks/{id}/test
+func (h *WebhookHandler) HandleWebhookTest(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, ok := parseWebhookID(w, r)
+	if !ok {
+		return
+	}
+	audit.Action(r, "webhook.test", "webhook", id)
+
+	delivery, err := h.webhookService.SendTest(id)
+	if err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+	// 订阅方返回非 2xx 仍视为请求成功，结果见 delivery.status
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "delivery": delivery})
+}
+
+// HandleWebhookDeliveries 分页查询投递记录
+// GET /api/webhooks/{id}/deliveries?status=&page=&pageSize=
+func (h *WebhookHandler) HandleWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, ok := parseWebhookID(w, r)
+	if !ok {
+		return
+	}
+	if _, err := h.webhookService.Get(id); err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+
+	v := r.URL.Query()
+	q := webhook.DeliveryQuery{WebhookID: id, Status: webhook.DeliveryStatus(v.Get("status"))}
+	q.Page, _ = strconv.Atoi(v.Get("page"))
+	q.PageSize, _ = strconv.Atoi(v.Get("pageSize"))
+
+	page, err := h.webhookService.ListDeliveries(q)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "查询投递记录失败: " + err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    true,
+		"deliveries": page.Deliveries,
+		"total":      page.Total,
+		"page":       page.Page,
+		"pageSize":   page.PageSize,
+	})
+}
+
+// HandleWebhookRedeliver 将投递记录重新放入队列
+// POST /api/webhooks/{id}/deliveries/{deliveryId}/retry
+func (h *WebhookHandler) HandleWebhookRedeliver(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, ok := parseWebhookID(w, r)
+	if !ok {
+		return
+	}
+	deliveryID, err := strconv.ParseInt(mux.Vars(r)["deliveryId"], 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "无效的投递记录ID"})
+		return
+	}
+	audit.Action(r, "webhook.redeliver", "webhook", id)
+
+	delivery, err := h.webhookService.Redeliver(id, deliveryID)
+	if err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "delivery": delivery})
+}
+
+// parseWebhookID 解析路径中的 Webhook ID，无效时写入 400 响应
+func parseWebhookID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "无效的 Webhook ID"})
+		return 0, false
+	}
+	return id, true
+}
+
+// writeWebhookError 不存在时返回 404，其余视为参数错误
+func writeWebhookError(w http.ResponseWriter, err error) {
+	if errors.Is(err, webhook.ErrNotFound) || errors.Is(err, webhook.ErrDeliveryNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+	} else {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": err.Error()})
+}
@@ -0,0 +1,254 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"NodePassDash/internal/auth"
+	log "NodePassDash/internal/log"
+	"NodePassDash/internal/sse"
+	"NodePassDash/internal/workspace"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// wsWriteWait 单条消息的写超时
+	wsWriteWait = 10 * time.Second
+	// wsPongWait 等待客户端响应 ping 的最长时间
+	wsPongWait = 60 * time.Second
+	// wsPingInterval 服务端发送 ping 的间隔，须小于 wsPongWait
+	wsPingInterval = 25 * time.Second
+	// wsSendBuffer 待发送消息缓冲，写满说明客户端消费过慢，将断开连接
+	wsSendBuffer = 256
+	// wsMaxSubscriptions 单个连接的订阅数上限
+	wsMaxSubscriptions = 100
+	// wsMaxMessageSize 客户端消息大小上限
+	wsMaxMessageSize = 4096
+)
+
+var (
+	errWSClosed = errors.New("WebSocket 连接已关闭")
+	errWSSlow   = errors.New("WebSocket 客户端消费过慢")
+)
+
+// wsUpgrader 仅允许同源或已配置的跨域来源建立连接，防止跨站 WebSocket 劫持
+var wsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 4096,
+	CheckOrigin: func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		return origin == "" || sameOrigin(r, origin) || originAllowed(origin)
+	},
+}
+
+// wsRequest 客户端消息
+type wsRequest struct {
+	Type    string `json:"type"`    // subscribe / unsubscribe / ping
+	Channel string `json:"channel"` // global / tunnel / logs
+	ID      string `json:"id"`      // tunnel 为隧道实例 ID，logs 为主控 ID
+}
+
+// wsMessage 服务端消息
+type wsMessage struct {
+	Type    string          `json:"type"` // connected / event / subscribed / unsubscribed / pong / error
+	Channel string          `json:"channel,omitempty"`
+	ID      string          `json:"id,omitempty"`
+	Data    json.RawMessage `json:"data,omitempty"`
+	Message string          `json:"message,omitempty"`
+}
+
+// wsConn 一个 WebSocket 连接，实现 sse.Sink；所有写操作由 writeLoop 串行完成
+type wsConn struct {
+	conn      *websocket.Conn
+	send      chan []byte
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Send 实现 sse.Sink，将推送的事件包装为 event 消息
+func (c *wsConn) Send(stream, key string, payload []byte) error {
+	return c.reply(wsMessage{Type: "event", Channel: stream, ID: key, Data: payload})
+}
+
+// reply 将消息放入发送队列；队列已满时断开连接，客户端重连后需重新订阅
+func (c *wsConn) reply(msg wsMessage) error {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	select {
+	case <-c.done:
+		return errWSClosed
+	default:
+	}
+	select {
+	case c.send <- b:
+		return nil
+	default:
+		c.close()
+		return errWSSlow
+	}
+}
+
+func (c *wsConn) close() {
+	c.closeOnce.Do(func() { close(c.done) })
+}
+
+// writeLoop 发送队列中的消息并定时 ping，连接关闭后退出
+func (c *wsConn) writeLoop() {
+	ticker := time.NewTicker(wsPingInterval)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+
+	for {
+		select {
+		case <-c.done:
+			c.conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(wsWriteWait))
+			return
+		case msg := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := c.conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+				c.close()
+				return
+			}
+		case <-ticker.C:
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait)); err != nil {
+				c.close()
+				return
+			}
+		}
+	}
+}
+
+// HandleWebSocket 在一个 WebSocket 连接上复用全局、隧道及主控日志推送 (GET /api/ws)
+// 客户端发送 {"type":"subscribe","channel":"tunnel","id":"<实例ID>"} 订阅，unsubscribe 取消，
+// 推送的事件为 {"type":"event","channel":"...","id":"...","data":{...}}，data 与对应 SSE 接口的内容一致
+func (h *SSEHandler) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade 已写入错误响应
+		log.Debugf("[WS] 升级连接失败: %v", err)
+		return
+	}
+
+	c := &wsConn{
+		conn: conn,
+		send: make(chan []byte, wsSendBuffer),
+		done: make(chan struct{}),
+	}
+	client := &sse.Client{
+		ID:    uuid.New().String(),
+		Sink:  c,
+		Scope: workspace.ScopeFromContext(r.Context()),
+	}
+	principal, _ := auth.PrincipalFromContext(r.Context())
+
+	go c.writeLoop()
+	defer func() {
+		h.sseService.RemoveClient(client.ID)
+		c.close()
+	}()
+
+	c.reply(wsMessage{Type: "connected", Message: "连接成功"})
+
+	conn.SetReadLimit(wsMaxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	subs := make(map[string]bool)
+	for {
+		var req wsRequest
+		if err := conn.ReadJSON(&req); err != nil {
+			var syntaxErr *json.SyntaxError
+			var typeErr *json.UnmarshalTypeError
+			if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) {
+				c.reply(wsMessage{Type: "error", Message: "无效的消息格式"})
+				continue
+			}
+			return
+		}
+		conn.SetReadDeadline(time.Now().Add(wsPongWait))
+
+		switch req.Type {
+		case "ping":
+			c.reply(wsMessage{Type: "pong"})
+		case "subscribe":
+			if msg := h.wsSubscribe(client, principal, subs, req); msg != "" {
+				c.reply(wsMessage{Type: "error", Channel: req.Channel, ID: req.ID, Message: msg})
+				continue
+			}
+			c.reply(wsMessage{Type: "subscribed", Channel: req.Channel, ID: req.ID})
+		case "unsubscribe":
+			h.wsUnsubscribe(client, subs, req)
+			c.reply(wsMessage{Type: "unsubscribed", Channel: req.Channel, ID: req.ID})
+		default:
+			c.reply(wsMessage{Type: "error", Message: "不支持的消息类型: " + req.Type})
+		}
+	}
+}
+
+// wsSubscribe 校验并登记订阅，失败时返回错误信息
+func (h *SSEHandler) wsSubscribe(client *sse.Client, principal *auth.Principal, subs map[string]bool, req wsRequest) string {
+	key := req.Channel + ":" + req.ID
+	if subs[key] {
+		return ""
+	}
+	if len(subs) >= wsMaxSubscriptions {
+		return "订阅数量已达上限"
+	}
+
+	switch req.Channel {
+	case sse.StreamGlobal:
+		h.sseService.SubscribeGlobal(client)
+	case sse.StreamTunnel:
+		if req.ID == "" || !h.sseService.InstanceVisible(req.ID, client.Scope) {
+			return "隧道不存在"
+		}
+		h.sseService.SubscribeClientToTunnel(client, req.ID)
+	case sse.StreamLogs:
+		// 主控日志与 /api/sse 下的接口一致，API 令牌需具备主控读取权限
+		if principal != nil && !principal.HasScope(auth.ScopeEndpointsRead) {
+			return "API 令牌权限不足"
+		}
+		endpointID, err := strconv.ParseInt(req.ID, 10, 64)
+		if err != nil || !h.sseService.EndpointVisible(endpointID, client.Scope) {
+			return "主控不存在"
+		}
+		h.sseService.SubscribeEndpointLogs(client, endpointID)
+	default:
+		return "不支持的订阅频道: " + req.Channel
+	}
+	subs[key] = true
+	return ""
+}
+
+// wsUnsubscribe 取消订阅，未订阅时忽略
+func (h *SSEHandler) wsUnsubscribe(client *sse.Client, subs map[string]bool, req wsRequest) {
+	key := req.Channel + ":" + req.ID
+	if !subs[key] {
+		return
+	}
+	delete(subs, key)
+
+	switch req.Channel {
+	case sse.StreamGlobal:
+		h.sseService.UnsubscribeGlobal(client.ID)
+	case sse.StreamTunnel:
+		h.sseService.UnsubscribeFromTunnel(client.ID, req.ID)
+	case sse.StreamLogs:
+		if endpointID, err := strconv.ParseInt(req.ID, 10, 64); err == nil {
+			h.sseService.UnsubscribeEndpointLogs(client.ID, endpointID)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"NodePassDash/internal/audit"
+	"NodePassDash/internal/workspace"
+
+	"github.com/gorilla/mux"
+)
+
+// WorkspaceHandler 工作区相关的处理器
+type WorkspaceHandler struct {
+	workspaceService *workspace.Service
+}
+
+// NewWorkspaceHandler 创建工作区处理器实例
+func NewWorkspaceHandler(workspaceService *workspace.Service) *WorkspaceHandler {
+	return &WorkspaceHandler{
+		workspaceService: workspaceService,
+	}
+}
+
+// HandleWorkspaces 列出或创建工作区
+// GET  /api/workspaces          列出调用方可见的工作区
+// POST /api/workspaces Body: {name, description}
+func (h *WorkspaceHandler) HandleWorkspaces(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case http.MethodGet:
+		workspaces, err := h.workspaceService.ListWorkspaces(workspace.ScopeFromContext(r.Context()))
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "获取工作区列表失败: " + err.Error()})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "workspaces": workspaces})
+
+	case http.MethodPost:
+		audit.Action(r, "workspace.create", "workspace", nil)
+
+		var req workspace.CreateWorkspaceRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "无效请求体"})
+			return
+		}
+
+		ws, err := h.workspaceService.CreateWorkspace(req)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": err.Error()})
+			return
+		}
+		audit.Target(r, ws.ID)
+		audit.After(r, ws)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "workspace": ws})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleWorkspace 更新或删除工作区
+// PUT    /api/workspaces/{id} Body: {name, description}
+// DELETE /api/workspaces/{id}
+func (h *WorkspaceHandler) HandleWorkspace(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, ok := parseWorkspaceID(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		audit.Action(r, "workspace.update", "workspace", id)
+		audit.BeforeRow(r, "Workspace", id)
+
+		var req workspace.UpdateWorkspaceRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "无效请求体"})
+			return
+		}
+
+		ws, err := h.workspaceService.UpdateWorkspace(id, req)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": err.Error()})
+			return
+		}
+		audit.AfterRow(r, "Workspace", id)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "workspace": ws})
+
+	case http.MethodDelete:
+		audit.Action(r, "workspace.delete", "workspace", id)
+		audit.BeforeRow(r, "Workspace", id)
+
+		if err := h.workspaceService.DeleteWorkspace(id); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": err.Error()})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "message": "工作区已删除"})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleSetMembers 设置工作区成员 (PUT /api/workspaces/{id}/members Body: {userIds})
+func (h *WorkspaceHandler) HandleSetMembers(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, ok := parseWorkspaceID(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		UserIDs []int64 `json:"userIds"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "无效请求体"})
+		return
+	}
+
+	audit.Action(r, "workspace.set_members", "workspace", id)
+	audit.After(r, req)
+
+	if err := h.workspaceService.SetMembers(id, req.UserIDs); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "message": "工作区成员已更新"})
+}
+
+// HandleAssignEndpoints 将主控迁移到工作区 (PUT /api/workspaces/{id}/endpoints Body: {endpointIds})
+func (h *WorkspaceHandler) HandleAssignEndpoints(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, ok := parseWorkspaceID(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		EndpointIDs []int64 `json:"endpointIds"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "无效请求体"})
+		return
+	}
+
+	audit.Action(r, "workspace.assign_endpoints", "workspace", id)
+	audit.After(r, req)
+
+	if err := h.workspaceService.AssignEndpoints(id, req.EndpointIDs); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "message": "主控已迁移"})
+}
+
+// parseWorkspaceID 解析路径中的工作区 ID，失败时直接写入 400 响应
+func parseWorkspaceID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "无效的工作区ID"})
+		return 0, false
+	}
+	return id, true
+}
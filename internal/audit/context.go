@@ -0,0 +1,136 @@
+package audit
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+// recordKey 上下文中存放当前请求审计信息的键
+type recordKey struct{}
+
+// Record 处理器在请求过程中补充的审计信息，由审计中间件在请求结束后写入
+type Record struct {
+	mu         sync.Mutex
+	service    *Service
+	force      bool
+	actor      string
+	action     string
+	targetType string
+	targetID   string
+	failure    string
+	before     interface{}
+	after      interface{}
+}
+
+// WithRecord 为请求创建审计信息并写入上下文
+func WithRecord(ctx context.Context, service *Service) (context.Context, *Record) {
+	rec := &Record{service: service}
+	return context.WithValue(ctx, recordKey{}, rec), rec
+}
+
+// FromContext 读取当前请求的审计信息，未启用审计时返回 nil
+func FromContext(ctx context.Context) *Record {
+	rec, _ := ctx.Value(recordKey{}).(*Record)
+	return rec
+}
+
+// Action 设置操作名称及目标对象，如 ("tunnel.update", "tunnel", 12)
+func Action(r *http.Request, action, targetType string, targetID interface{}) {
+	if rec := FromContext(r.Context()); rec != nil {
+		rec.mu.Lock()
+		rec.action = action
+		rec.targetType = targetType
+		rec.targetID = idString(targetID)
+		rec.mu.Unlock()
+	}
+}
+
+// Target 仅更新目标 ID，用于创建成功后补充新对象的 ID
+func Target(r *http.Request, targetID interface{}) {
+	if rec := FromContext(r.Context()); rec != nil {
+		rec.mu.Lock()
+		rec.targetID = idString(targetID)
+		rec.mu.Unlock()
+	}
+}
+
+// Actor 设置操作人，用于登录等尚未建立身份的请求
+func Actor(r *http.Request, username string) {
+	if rec := FromContext(r.Context()); rec != nil {
+		rec.mu.Lock()
+		rec.actor = username
+		rec.mu.Unlock()
+	}
+}
+
+// Force 要求记录本次请求，即使它不是修改类请求（如 OAuth2 回调登录）
+func Force(r *http.Request) {
+	if rec := FromContext(r.Context()); rec != nil {
+		rec.mu.Lock()
+		rec.force = true
+		rec.mu.Unlock()
+	}
+}
+
+// Fail 将本次操作标记为失败，用于以重定向等方式返回错误、无法从响应判断结果的请求
+func Fail(r *http.Request, reason string) {
+	if rec := FromContext(r.Context()); rec != nil {
+		rec.mu.Lock()
+		rec.failure = reason
+		rec.mu.Unlock()
+	}
+}
+
+// Before 记录修改前的状态，敏感字段会在写入时脱敏
+func Before(r *http.Request, v interface{}) {
+	if rec := FromContext(r.Context()); rec != nil {
+		rec.mu.Lock()
+		rec.before = v
+		rec.mu.Unlock()
+	}
+}
+
+// After 记录修改后的状态
+func After(r *http.Request, v interface{}) {
+	if rec := FromContext(r.Context()); rec != nil {
+		rec.mu.Lock()
+		rec.after = v
+		rec.mu.Unlock()
+	}
+}
+
+// BeforeRow 读取数据表中的一行作为修改前的状态
+func BeforeRow(r *http.Request, table string, id interface{}) {
+	if rec := FromContext(r.Context()); rec != nil {
+		if row := rec.service.Row(table, id); row != nil {
+			Before(r, row)
+		}
+	}
+}
+
+// AfterRow 读取数据表中的一行作为修改后的状态
+func AfterRow(r *http.Request, table string, id interface{}) {
+	if rec := FromContext(r.Context()); rec != nil {
+		if row := rec.service.Row(table, id); row != nil {
+			After(r, row)
+		}
+	}
+}
+
+// Entry 返回处理器补充的审计信息，record 为 false 且未调用 Force 时不记录；
+// 调用过 Fail 时返回的 Error 非空
+func (rec *Record) Entry(record bool) (Entry, interface{}, interface{}, bool) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if !record && !rec.force {
+		return Entry{}, nil, nil, false
+	}
+	return Entry{
+		Actor:      rec.actor,
+		Action:     rec.action,
+		TargetType: rec.targetType,
+		TargetID:   rec.targetID,
+		Error:      rec.failure,
+	}, rec.before, rec.after, true
+}
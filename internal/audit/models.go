@@ -0,0 +1,55 @@
+package audit
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Entry 一条审计记录
+type Entry struct {
+	ID         int64           `json:"id"`
+	CreatedAt  time.Time       `json:"createdAt"`
+	Actor      string          `json:"actor"`
+	AuthType   string          `json:"authType"` // session | token，匿名请求为空
+	IP         string          `json:"ip"`
+	UserAgent  string          `json:"userAgent"`
+	Method     string          `json:"method"`
+	Path       string          `json:"path"`
+	Action     string          `json:"action"`
+	TargetType string          `json:"targetType"`
+	TargetID   string          `json:"targetId"`
+	Status     int             `json:"status"`
+	Success    bool            `json:"success"`
+	Error      string          `json:"error,omitempty"`
+	Before     json.RawMessage `json:"before,omitempty"`
+	After      json.RawMessage `json:"after,omitempty"`
+	Diff       json.RawMessage `json:"diff,omitempty"`
+}
+
+// Change 单个字段的变更
+type Change struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// Query 审计记录查询条件，零值字段不参与过滤
+type Query struct {
+	Actor      string
+	Action     string // 支持前缀匹配，如 tunnel. 匹配所有隧道操作
+	TargetType string
+	TargetID   string
+	IP         string
+	Success    *bool
+	From       time.Time
+	To         time.Time
+	Page       int
+	PageSize   int
+}
+
+// Page 分页查询结果
+type Page struct {
+	Entries  []Entry `json:"entries"`
+	Total    int     `json:"total"`
+	Page     int     `json:"page"`
+	PageSize int     `json:"pageSize"`
+}
@@ -0,0 +1,365 @@
+package audit
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	log "NodePassDash/internal/log"
+)
+
+// maxExportRows CSV 导出的最大行数
+const maxExportRows = 100000
+
+// redacted 敏感字段脱敏后的占位值
+const redacted = "******"
+
+var (
+	// identPattern 允许快照的表名
+	identPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	// urlCredentialPattern URL 中的凭据部分，如 server://password@host
+	urlCredentialPattern = regexp.MustCompile(`://[^/@\s]+@`)
+)
+
+// Service 审计日志服务
+type Service struct {
+	db *sql.DB
+}
+
+// NewService 创建审计日志服务实例
+func NewService(db *sql.DB) *Service {
+	return &Service{db: db}
+}
+
+// Log 写入一条审计记录，before / after 及其差异中的敏感字段均会脱敏
+func (s *Service) Log(e Entry, before, after interface{}) error {
+	b := toGeneric(before)
+	a := toGeneric(after)
+	// 先基于原始值计算差异，敏感字段只体现“已修改”而不暴露内容
+	if diff := computeDiff(b, a); len(diff) > 0 {
+		e.Diff, _ = json.Marshal(diff)
+	}
+	if b != nil {
+		e.Before, _ = json.Marshal(redact(b))
+	}
+	if a != nil {
+		e.After, _ = json.Marshal(redact(a))
+	}
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now()
+	}
+
+	_, err := s.db.Exec(`
+		INSERT INTO "AuditLog" (createdAt, actor, authType, ip, userAgent, method, path, action,
+			targetType, targetId, status, success, error, before, after, diff)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, e.CreatedAt.UTC(), e.Actor, e.AuthType, e.IP, e.UserAgent, e.Method, e.Path, e.Action,
+		e.TargetType, e.TargetID, e.Status, e.Success, e.Error,
+		nullableJSON(e.Before), nullableJSON(e.After), nullableJSON(e.Diff))
+	return err
+}
+
+// Row 读取数据表中指定 ID 的一行，返回列名到值的映射，读取失败时返回 nil
+func (s *Service) Row(table string, id interface{}) map[string]interface{} {
+	if !identPattern.MatchString(table) {
+		return nil
+	}
+	rows, err := s.db.Query(fmt.Sprintf(`SELECT * FROM "%s" WHERE id = ?`, table), id)
+	if err != nil {
+		log.Warnf("[审计] 读取 %s#%v 快照失败: %v", table, id, err)
+		return nil
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return nil
+	}
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil
+	}
+	values := make([]interface{}, len(cols))
+	ptrs := make([]interface{}, len(cols))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	if err := rows.Scan(ptrs...); err != nil {
+		return nil
+	}
+
+	row := make(map[string]interface{}, len(cols))
+	for i, col := range cols {
+		if b, ok := values[i].([]byte); ok {
+			row[col] = string(b)
+		} else {
+			row[col] = values[i]
+		}
+	}
+	return row
+}
+
+// List 分页查询审计记录，按时间倒序
+func (s *Service) List(q Query) (*Page, error) {
+	if q.Page < 1 {
+		q.Page = 1
+	}
+	if q.PageSize < 1 || q.PageSize > 500 {
+		q.PageSize = 50
+	}
+
+	where, args := q.where()
+	var total int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM "AuditLog" WHERE `+where, args...).Scan(&total); err != nil {
+		return nil, err
+	}
+
+	entries, err := s.query(where+` ORDER BY id DESC LIMIT ? OFFSET ?`,
+		append(args, q.PageSize, (q.Page-1)*q.PageSize)...)
+	if err != nil {
+		return nil, err
+	}
+	return &Page{Entries: entries, Total: total, Page: q.Page, PageSize: q.PageSize}, nil
+}
+
+// ExportCSV 将满足条件的审计记录以 CSV 格式写入 w
+func (s *Service) ExportCSV(w io.Writer, q Query) error {
+	where, args := q.where()
+	entries, err := s.query(where+` ORDER BY id DESC LIMIT ?`, append(args, maxExportRows)...)
+	if err != nil {
+		return err
+	}
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"id", "time", "actor", "authType", "ip", "method", "path", "action",
+		"targetType", "targetId", "status", "success", "error", "diff"})
+	for _, e := range entries {
+		cw.Write([]string{
+			strconv.FormatInt(e.ID, 10),
+			e.CreatedAt.UTC().Format(time.RFC3339),
+			e.Actor, e.AuthType, e.IP, e.Method, e.Path, e.Action,
+			e.TargetType, e.TargetID,
+			strconv.Itoa(e.Status),
+			strconv.FormatBool(e.Success),
+			e.Error,
+			string(e.Diff),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// where 构造查询条件
+func (q Query) where() (string, []interface{}) {
+	conds := []string{"1 = 1"}
+	var args []interface{}
+	if q.Actor != "" {
+		conds = append(conds, "actor = ?")
+		args = append(args, q.Actor)
+	}
+	if q.Action != "" {
+		conds = append(conds, "action LIKE ? ESCAPE '\\'")
+		args = append(args, escapeLike(q.Action)+"%")
+	}
+	if q.TargetType != "" {
+		conds = append(conds, "targetType = ?")
+		args = append(args, q.TargetType)
+	}
+	if q.TargetID != "" {
+		conds = append(conds, "targetId = ?")
+		args = append(args, q.TargetID)
+	}
+	if q.IP != "" {
+		conds = append(conds, "ip = ?")
+		args = append(args, q.IP)
+	}
+	if q.Success != nil {
+		conds = append(conds, "success = ?")
+		args = append(args, *q.Success)
+	}
+	if !q.From.IsZero() {
+		conds = append(conds, "createdAt >= ?")
+		args = append(args, q.From.UTC())
+	}
+	if !q.To.IsZero() {
+		conds = append(conds, "createdAt < ?")
+		args = append(args, q.To.UTC())
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+// query 执行查询并扫描审计记录
+func (s *Service) query(cond string, args ...interface{}) ([]Entry, error) {
+	rows, err := s.db.Query(`
+		SELECT id, createdAt, actor, authType, ip, userAgent, method, path, action,
+			targetType, targetId, status, success, error, before, after, diff
+		FROM "AuditLog" WHERE `+cond, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := make([]Entry, 0)
+	for rows.Next() {
+		var e Entry
+		var before, after, diff sql.NullString
+		if err := rows.Scan(&e.ID, &e.CreatedAt, &e.Actor, &e.AuthType, &e.IP, &e.UserAgent, &e.Method, &e.Path, &e.Action,
+			&e.TargetType, &e.TargetID, &e.Status, &e.Success, &e.Error, &before, &after, &diff); err != nil {
+			return nil, err
+		}
+		if before.Valid {
+			e.Before = json.RawMessage(before.String)
+		}
+		if after.Valid {
+			e.After = json.RawMessage(after.String)
+		}
+		if diff.Valid {
+			e.Diff = json.RawMessage(diff.String)
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// toGeneric 将任意值转换为通用 JSON 结构
+func toGeneric(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var generic interface{}
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return nil
+	}
+	return generic
+}
+
+// redact 递归脱敏：敏感字段替换为占位值，URL 中的凭据同样隐藏
+func redact(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, item := range val {
+			if isSensitiveKey(k) {
+				val[k] = mask(item)
+				continue
+			}
+			val[k] = redact(item)
+		}
+		return val
+	case []interface{}:
+		for i, item := range val {
+			val[i] = redact(item)
+		}
+		return val
+	case string:
+		return urlCredentialPattern.ReplaceAllString(val, "://"+redacted+"@")
+	}
+	return v
+}
+
+// isSensitiveKey 判断字段名是否为密码、密钥等敏感信息
+func isSensitiveKey(key string) bool {
+	k := strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(key))
+	if strings.Contains(k, "password") || strings.Contains(k, "secret") {
+		return true
+	}
+	switch k {
+	case "apikey", "token", "accesstoken", "refreshtoken", "idtoken":
+		return true
+	}
+	return false
+}
+
+// computeDiff 计算两个 JSON 对象顶层字段的差异，任意一侧为空时视为空对象；
+// 返回的差异已脱敏
+func computeDiff(before, after interface{}) map[string]Change {
+	b, _ := before.(map[string]interface{})
+	a, _ := after.(map[string]interface{})
+	if b == nil && a == nil {
+		return nil
+	}
+
+	diff := make(map[string]Change)
+	add := func(k string, bv, av interface{}) {
+		if isSensitiveKey(k) {
+			diff[k] = Change{Before: mask(bv), After: mask(av)}
+			return
+		}
+		diff[k] = Change{Before: redact(deepCopy(bv)), After: redact(deepCopy(av))}
+	}
+	for k, bv := range b {
+		if av, ok := a[k]; !ok || !reflect.DeepEqual(av, bv) {
+			add(k, bv, a[k])
+		}
+	}
+	for k, av := range a {
+		if _, ok := b[k]; !ok {
+			add(k, nil, av)
+		}
+	}
+	return diff
+}
+
+// mask 非空的敏感值替换为占位值
+func mask(v interface{}) interface{} {
+	if v == nil || v == "" {
+		return v
+	}
+	return redacted
+}
+
+// deepCopy 复制通用 JSON 结构，避免脱敏时修改原值
+func deepCopy(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			m[k] = deepCopy(item)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(val))
+		for i, item := range val {
+			l[i] = deepCopy(item)
+		}
+		return l
+	}
+	return v
+}
+
+// escapeLike 转义 LIKE 通配符
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// nullableJSON 空 JSON 写入 NULL
+func nullableJSON(raw json.RawMessage) interface{} {
+	if len(raw) == 0 {
+		return nil
+	}
+	return string(raw)
+}
+
+// idString 将目标 ID 统一转换为字符串
+func idString(id interface{}) string {
+	switch v := id.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case int:
+		return strconv.Itoa(v)
+	}
+	return fmt.Sprint(id)
+}
@@ -0,0 +1,178 @@
+package auth
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// Enabled 白名单中是否配置了任意规则
+func (a OAuthAllowlist) Enabled() bool {
+	return len(a.Logins) > 0 || len(a.Emails) > 0 || len(a.Domains) > 0 ||
+		len(a.GitHubOrgs) > 0 || len(a.GitHubTeams) > 0
+}
+
+// NeedsEmails 是否需要获取账户邮箱
+func (a OAuthAllowlist) NeedsEmails() bool {
+	return len(a.Emails) > 0 || len(a.Domains) > 0
+}
+
+// NeedsGitHubMembership 是否需要查询 GitHub 组织 / 团队成员关系
+func (a OAuthAllowlist) NeedsGitHubMembership() bool {
+	return len(a.GitHubOrgs) > 0 || len(a.GitHubTeams) > 0
+}
+
+// Match 判断账户是否命中任意一条白名单规则（不区分大小写）
+func (a OAuthAllowlist) Match(p OAuthProfile) bool {
+	if p.Login != "" && containsFold(a.Logins, p.Login) {
+		return true
+	}
+	for _, email := range p.Emails {
+		if containsFold(a.Emails, email) {
+			return true
+		}
+		if at := strings.LastIndex(email, "@"); at >= 0 && containsFold(a.Domains, email[at+1:]) {
+			return true
+		}
+	}
+	for _, org := range p.Orgs {
+		if containsFold(a.GitHubOrgs, org) {
+			return true
+		}
+	}
+	for _, team := range p.Teams {
+		if containsFold(a.GitHubTeams, team) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsFold 忽略大小写及首尾空白判断列表是否包含 v
+func containsFold(list []string, v string) bool {
+	v = strings.TrimSpace(v)
+	for _, item := range list {
+		if strings.EqualFold(strings.TrimSpace(item), v) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetOAuthAllowlist 读取 OAuth2 登录白名单，未配置时返回空白名单
+func (s *Service) GetOAuthAllowlist() (OAuthAllowlist, error) {
+	var a OAuthAllowlist
+	v, err := s.GetSystemConfig(ConfigKeyOAuthAllowlist)
+	if err != nil || v == "" {
+		return a, nil
+	}
+	if err := json.Unmarshal([]byte(v), &a); err != nil {
+		return a, errors.New("OAuth2 白名单配置损坏")
+	}
+	return a, nil
+}
+
+// SetOAuthAllowlist 保存 OAuth2 登录白名单
+func (s *Service) SetOAuthAllowlist(a OAuthAllowlist) error {
+	for _, team := range a.GitHubTeams {
+		if parts := strings.Split(team, "/"); len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return errors.New("GitHub 团队格式应为 org/team-slug")
+		}
+	}
+	data, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	return s.SetSystemConfig(ConfigKeyOAuthAllowlist, string(data), "OAuth2 登录白名单")
+}
+
+// AuthorizeOAuthLogin 在创建会话前校验第三方身份是否允许登录，需在 SaveOAuthUser 之后调用：
+// 已撤销的身份始终拒绝，已批准的身份始终放行；其余身份启用白名单时按白名单判断，
+// 未启用白名单时仅第一个身份自动批准（兼容原先只允许绑定一个 OAuth2 账户的行为）。
+// 未通过的身份标记为待审批，管理员可在身份列表中批准
+func (s *Service) AuthorizeOAuthLogin(provider, providerID string, profile OAuthProfile) error {
+	var id int64
+	var status string
+	err := s.db.QueryRow(`SELECT id, status FROM "OAuthUser" WHERE provider = ? AND providerId = ?`, provider, providerID).Scan(&id, &status)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return errors.New("OAuth 身份不存在")
+		}
+		return err
+	}
+
+	switch status {
+	case OAuthStatusRevoked:
+		return errors.New("该账户的登录权限已被管理员撤销")
+	case OAuthStatusApproved:
+		return nil
+	}
+
+	allowlist, err := s.GetOAuthAllowlist()
+	if err != nil {
+		return err
+	}
+
+	next := OAuthStatusPending
+	if allowlist.Enabled() {
+		if allowlist.Match(profile) {
+			next = OAuthStatusAllowed
+		}
+	} else {
+		var others int
+		if err := s.db.QueryRow(`SELECT COUNT(*) FROM "OAuthUser" WHERE id != ? AND status IN (?, ?)`,
+			id, OAuthStatusApproved, OAuthStatusAllowed).Scan(&others); err != nil {
+			return err
+		}
+		if others == 0 {
+			next = OAuthStatusApproved
+		}
+	}
+
+	if next != status {
+		if _, err := s.db.Exec(`UPDATE "OAuthUser" SET status = ?, updatedAt = CURRENT_TIMESTAMP WHERE id = ?`, next, id); err != nil {
+			return err
+		}
+	}
+	if next == OAuthStatusPending {
+		return errors.New("该账户不在登录白名单中，请等待管理员审批")
+	}
+	return nil
+}
+
+// ApproveOAuthIdentity 批准第三方身份登录，不再受白名单限制
+func (s *Service) ApproveOAuthIdentity(identityID int64) error {
+	return s.setOAuthIdentityStatus(identityID, OAuthStatusApproved)
+}
+
+// RevokeOAuthIdentity 撤销第三方身份的登录权限，并注销其对应本地用户的会话
+func (s *Service) RevokeOAuthIdentity(identityID int64) error {
+	if err := s.setOAuthIdentityStatus(identityID, OAuthStatusRevoked); err != nil {
+		return err
+	}
+
+	var localUsername string
+	err := s.db.QueryRow(`
+		SELECT COALESCE(u.username, o.username)
+		FROM "OAuthUser" o
+		LEFT JOIN "User" u ON o.userId = u.id
+		WHERE o.id = ?
+	`, identityID).Scan(&localUsername)
+	if err == nil {
+		s.invalidateUserSessions(localUsername)
+	}
+	return nil
+}
+
+// setOAuthIdentityStatus 更新第三方身份状态
+func (s *Service) setOAuthIdentityStatus(identityID int64, status string) error {
+	res, err := s.db.Exec(`UPDATE "OAuthUser" SET status = ?, updatedAt = CURRENT_TIMESTAMP WHERE id = ?`, status, identityID)
+	if err != nil {
+		return err
+	}
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		return errors.New("OAuth 身份不存在")
+	}
+	return nil
+}
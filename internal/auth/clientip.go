@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+var (
+	// 受信任的反向代理网段，仅来自这些地址的 X-Forwarded-For 才会被采信
+	trustedProxies   []*net.IPNet
+	trustedProxiesMu sync.RWMutex
+)
+
+// SetTrustedProxies 设置受信任的反向代理，支持单个 IP 与 CIDR
+func SetTrustedProxies(entries []string) error {
+	nets, err := parseNets(entries)
+	if err != nil {
+		return err
+	}
+
+	trustedProxiesMu.Lock()
+	trustedProxies = nets
+	trustedProxiesMu.Unlock()
+	return nil
+}
+
+// parseNets 解析 IP / CIDR 列表，单个 IP 视为 /32 或 /128，空项忽略
+func parseNets(entries []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(entries))
+	for _, e := range entries {
+		e = strings.TrimSpace(e)
+		if e == "" {
+			continue
+		}
+		if !strings.Contains(e, "/") {
+			ip := net.ParseIP(e)
+			if ip == nil {
+				return nil, fmt.Errorf("无效的代理地址: %s", e)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(e)
+		if err != nil {
+			return nil, fmt.Errorf("无效的代理网段: %s", e)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// containsIP 判断地址是否属于任一网段
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsTrustedProxy 判断地址是否属于受信任的反向代理
+func IsTrustedProxy(ip net.IP) bool {
+	trustedProxiesMu.RLock()
+	defer trustedProxiesMu.RUnlock()
+	return containsIP(trustedProxies, ip)
+}
+
+// RemoteIP 返回 TCP 连接的对端地址（不解析任何转发头）
+func RemoteIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+// ClientIP 返回请求的真实客户端地址：
+// 仅当直连地址是受信任代理时才解析 X-Forwarded-For，并从右向左跳过受信任代理，
+// 取第一个不受信任的地址，避免客户端伪造转发头绕过限流
+func ClientIP(r *http.Request) string {
+	remote := RemoteIP(r)
+	if remote == nil {
+		return r.RemoteAddr
+	}
+	if !IsTrustedProxy(remote) {
+		return remote.String()
+	}
+
+	var hops []string
+	for _, v := range r.Header.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(v, ",") {
+			if hop = strings.TrimSpace(hop); hop != "" {
+				hops = append(hops, hop)
+			}
+		}
+	}
+
+	client := remote
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(hops[i])
+		if ip == nil {
+			break
+		}
+		client = ip
+		if !IsTrustedProxy(ip) {
+			break
+		}
+	}
+	return client.String()
+}
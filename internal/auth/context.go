@@ -0,0 +1,17 @@
+package auth
+
+import "context"
+
+// principalKey 上下文中存放已认证调用方的键
+type principalKey struct{}
+
+// WithPrincipal 将已认证的调用方写入上下文，供下游处理器与日志使用
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFromContext 从上下文中读取已认证的调用方
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok && p != nil
+}
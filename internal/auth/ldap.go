@@ -0,0 +1,282 @@
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	log "NodePassDash/internal/log"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// ldapTimeout 连接及单次操作的超时时间
+const ldapTimeout = 10 * time.Second
+
+// LDAPConfig LDAP / Active Directory 登录配置：先以服务账户（或匿名）在 BaseDN 下按 UserFilter 查找用户，
+// 再以该用户的 DN 和密码绑定完成认证
+type LDAPConfig struct {
+	Enabled      bool
+	URL          string // ldap://host:389 或 ldaps://host:636
+	BindDN       string // 查找用户使用的服务账户，为空时匿名查找
+	BindPassword string
+	BaseDN       string
+	UserFilter   string // %s 替换为转义后的用户名，默认 (uid=%s)；AD 通常为 (sAMAccountName=%s)
+	StartTLS     bool   // 在 ldap:// 连接上执行 StartTLS
+	// InsecureSkipVerify 跳过服务端证书校验，仅用于测试环境
+	InsecureSkipVerify bool
+	CAFile             string         // 校验服务端证书使用的 CA 文件（PEM），为空时使用系统证书
+	RootCAs            *x509.CertPool // 直接指定 CA，优先于 CAFile
+	GroupAttribute     string         // 用户条目中记录所属分组的属性，默认 memberOf
+	// GroupRoles 分组 DN 到本地角色的映射（不区分大小写），取命中分组中权限最高的角色
+	GroupRoles map[string]Role
+	// DefaultRole 未命中任何分组时的角色；配置了 GroupRoles 时为空表示拒绝登录，否则默认 viewer
+	DefaultRole Role
+}
+
+var (
+	ldapCfg ldapSettings
+	ldapMu  sync.RWMutex
+)
+
+// ldapSettings 校验后的 LDAP 配置
+type ldapSettings struct {
+	LDAPConfig
+	tls *tls.Config
+}
+
+// SetLDAP 设置 LDAP 登录，启用时校验必填项并加载 CA
+func SetLDAP(cfg LDAPConfig) error {
+	settings := ldapSettings{LDAPConfig: cfg}
+	if cfg.Enabled {
+		u, err := url.Parse(cfg.URL)
+		if err != nil || (u.Scheme != "ldap" && u.Scheme != "ldaps") || u.Host == "" {
+			return fmt.Errorf("无效的 LDAP 地址: %s（应为 ldap://host:389 或 ldaps://host:636）", cfg.URL)
+		}
+		if cfg.StartTLS && u.Scheme == "ldaps" {
+			return errors.New("ldaps:// 连接已加密，无需启用 StartTLS")
+		}
+		if cfg.BaseDN == "" {
+			return errors.New("启用 LDAP 登录时必须指定 Base DN")
+		}
+		if cfg.UserFilter == "" {
+			settings.UserFilter = "(uid=%s)"
+		}
+		if strings.Count(settings.UserFilter, "%s") != 1 {
+			return errors.New("LDAP 用户过滤器必须包含且仅包含一个 %s，如 (uid=%s)")
+		}
+		if cfg.GroupAttribute == "" {
+			settings.GroupAttribute = "memberOf"
+		}
+		if cfg.DefaultRole == "" && len(cfg.GroupRoles) == 0 {
+			settings.DefaultRole = RoleViewer
+		}
+		if settings.DefaultRole != "" && !settings.DefaultRole.Valid() {
+			return errors.New("无效的默认角色: " + string(settings.DefaultRole))
+		}
+		settings.GroupRoles = make(map[string]Role, len(cfg.GroupRoles))
+		for group, role := range cfg.GroupRoles {
+			if !role.Valid() {
+				return fmt.Errorf("分组 %s 映射的角色无效: %s", group, role)
+			}
+			settings.GroupRoles[normalizeDN(group)] = role
+		}
+
+		host, _, err := net.SplitHostPort(u.Host)
+		if err != nil {
+			host = u.Host
+		}
+		settings.tls = &tls.Config{
+			ServerName:         host,
+			InsecureSkipVerify: cfg.InsecureSkipVerify,
+			RootCAs:            cfg.RootCAs,
+			MinVersion:         tls.VersionTLS12,
+		}
+		if cfg.RootCAs == nil && cfg.CAFile != "" {
+			pem, err := os.ReadFile(cfg.CAFile)
+			if err != nil {
+				return fmt.Errorf("读取 LDAP CA 文件失败: %v", err)
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				return errors.New("LDAP CA 文件中没有有效的证书")
+			}
+			settings.tls.RootCAs = pool
+		}
+	}
+
+	ldapMu.Lock()
+	ldapCfg = settings
+	ldapMu.Unlock()
+	return nil
+}
+
+// LDAPEnabled 是否启用 LDAP 登录
+func LDAPEnabled() bool {
+	ldapMu.RLock()
+	defer ldapMu.RUnlock()
+	return ldapCfg.Enabled
+}
+
+// ParseLDAPGroupRoles 解析分组映射，格式为 角色=分组DN，多个以 ; 分隔，
+// 如 admin=cn=admins,ou=groups,dc=example,dc=org;operator=cn=ops,ou=groups,dc=example,dc=org
+func ParseLDAPGroupRoles(s string) (map[string]Role, error) {
+	roles := map[string]Role{}
+	for _, item := range strings.Split(s, ";") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[1]) == "" {
+			return nil, fmt.Errorf("无效的分组映射: %s（格式为 角色=分组DN）", item)
+		}
+		role := Role(strings.TrimSpace(parts[0]))
+		if !role.Valid() {
+			return nil, fmt.Errorf("无效的角色: %s", role)
+		}
+		roles[strings.TrimSpace(parts[1])] = role
+	}
+	return roles, nil
+}
+
+// normalizeDN 统一 DN 格式以便比较：小写并去掉 RDN 之间的空格
+func normalizeDN(dn string) string {
+	if parsed, err := ldap.ParseDN(dn); err == nil {
+		rdns := make([]string, 0, len(parsed.RDNs))
+		for _, rdn := range parsed.RDNs {
+			attrs := make([]string, 0, len(rdn.Attributes))
+			for _, a := range rdn.Attributes {
+				attrs = append(attrs, a.Type+"="+a.Value)
+			}
+			rdns = append(rdns, strings.Join(attrs, "+"))
+		}
+		dn = strings.Join(rdns, ",")
+	}
+	return strings.ToLower(strings.TrimSpace(dn))
+}
+
+// authenticateLDAP 在目录中校验用户名和密码，成功时返回按分组映射得到的角色；
+// 返回空角色表示未配置分组映射，沿用本地用户的现有角色
+func authenticateLDAP(username, password string) (Role, error) {
+	ldapMu.RLock()
+	cfg := ldapCfg
+	ldapMu.RUnlock()
+
+	if !cfg.Enabled {
+		return "", errors.New("未启用 LDAP 登录")
+	}
+	// 空密码的简单绑定在多数目录中会被视为匿名绑定而“成功”，必须拒绝
+	if username == "" || password == "" {
+		return "", errors.New("用户名和密码不能为空")
+	}
+
+	conn, err := ldap.DialURL(cfg.URL,
+		ldap.DialWithDialer(&net.Dialer{Timeout: ldapTimeout}),
+		ldap.DialWithTLSConfig(cfg.tls))
+	if err != nil {
+		return "", fmt.Errorf("连接 LDAP 服务器失败: %v", err)
+	}
+	defer conn.Close()
+	conn.SetTimeout(ldapTimeout)
+
+	if cfg.StartTLS {
+		if err := conn.StartTLS(cfg.tls); err != nil {
+			return "", fmt.Errorf("LDAP StartTLS 失败: %v", err)
+		}
+	}
+
+	if cfg.BindDN != "" {
+		err = conn.Bind(cfg.BindDN, cfg.BindPassword)
+	} else {
+		err = conn.UnauthenticatedBind("")
+	}
+	if err != nil {
+		return "", fmt.Errorf("LDAP 服务账户绑定失败: %v", err)
+	}
+
+	result, err := conn.Search(ldap.NewSearchRequest(
+		cfg.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, int(ldapTimeout/time.Second), false,
+		fmt.Sprintf(cfg.UserFilter, ldap.EscapeFilter(username)),
+		[]string{cfg.GroupAttribute}, nil,
+	))
+	if err != nil {
+		return "", fmt.Errorf("查找 LDAP 用户失败: %v", err)
+	}
+	if len(result.Entries) != 1 {
+		return "", fmt.Errorf("LDAP 中匹配到 %d 个用户", len(result.Entries))
+	}
+	entry := result.Entries[0]
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		return "", fmt.Errorf("LDAP 用户密码错误: %v", err)
+	}
+
+	return ldapRole(cfg, entry.GetAttributeValues(cfg.GroupAttribute))
+}
+
+// ldapRole 根据分组映射计算角色，取命中分组中权限最高的角色
+func ldapRole(cfg ldapSettings, groups []string) (Role, error) {
+	var role Role
+	for _, g := range groups {
+		mapped := cfg.GroupRoles[normalizeDN(g)]
+		if mapped.Valid() && (role == "" || !role.Allows(mapped)) {
+			role = mapped
+		}
+	}
+	if role != "" {
+		return role, nil
+	}
+	if len(cfg.GroupRoles) == 0 {
+		return "", nil
+	}
+	if cfg.DefaultRole.Valid() {
+		return cfg.DefaultRole, nil
+	}
+	return "", errors.New("当前账户不属于任何授权分组")
+}
+
+// authenticateLDAPUser 通过 LDAP 校验后返回对应的本地用户，不存在时自动创建（无本地密码），
+// 配置了分组映射时每次登录同步角色
+func (s *Service) authenticateLDAPUser(username, password string) bool {
+	role, err := authenticateLDAP(username, password)
+	if err != nil {
+		log.Warnf("[LDAP] 用户 %s 认证失败: %v", username, err)
+		return false
+	}
+
+	if user, err := s.GetUserByUsername(username); err == nil {
+		if user.Disabled {
+			return false
+		}
+		if role != "" {
+			if err := s.SetUserRole(username, role); err != nil {
+				log.Warnf("[LDAP] 同步用户 %s 的角色失败: %v", username, err)
+			}
+		}
+		return true
+	}
+
+	if role == "" {
+		ldapMu.RLock()
+		role = ldapCfg.DefaultRole
+		ldapMu.RUnlock()
+	}
+	if _, err := s.CreateUser(CreateUserRequest{Username: username, Role: role}); err != nil {
+		// 并发的首次登录可能已创建该用户
+		if existing, getErr := s.GetUserByUsername(username); getErr == nil && !existing.Disabled {
+			return true
+		}
+		log.Warnf("[LDAP] 创建用户 %s 失败: %v", username, err)
+		return false
+	}
+	log.Infof("[LDAP] 已为目录用户 %s 创建本地账户，角色 %s", username, role)
+	return true
+}
@@ -0,0 +1,216 @@
+package auth
+
+import (
+	"testing"
+
+	"NodePassDash/internal/auth/ldaptest"
+)
+
+const (
+	ldapBaseDN    = "dc=example,dc=org"
+	ldapServiceDN = "cn=svc,ou=system,dc=example,dc=org"
+	ldapAdminsDN  = "cn=admins,ou=groups,dc=example,dc=org"
+	ldapOpsDN     = "cn=ops,ou=groups,dc=example,dc=org"
+)
+
+// newLDAPDirectory 启动包含服务账户及三个用户的目录：alice 属于 admins 与 ops，bob 属于 ops，carol 不属于任何分组
+func newLDAPDirectory(t *testing.T, tlsServer bool) *ldaptest.Server {
+	t.Helper()
+	entries := []ldaptest.Entry{
+		{DN: ldapServiceDN, Password: "svc-secret"},
+		{DN: "uid=alice,ou=people,dc=example,dc=org", Password: "alice-pw", Attributes: map[string][]string{
+			"uid": {"alice"}, "memberOf": {ldapOpsDN, ldapAdminsDN},
+		}},
+		{DN: "uid=bob,ou=people,dc=example,dc=org", Password: "bob-pw", Attributes: map[string][]string{
+			"uid": {"bob"}, "memberOf": {ldapOpsDN},
+		}},
+		{DN: "uid=carol,ou=people,dc=example,dc=org", Password: "carol-pw", Attributes: map[string][]string{
+			"uid": {"carol"},
+		}},
+	}
+	var srv *ldaptest.Server
+	if tlsServer {
+		srv = ldaptest.NewTLSServer(entries...)
+	} else {
+		srv = ldaptest.NewServer(entries...)
+	}
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// setTestLDAP 启用 LDAP 登录，测试结束后关闭
+func setTestLDAP(t *testing.T, cfg LDAPConfig) {
+	t.Helper()
+	cfg.Enabled = true
+	if err := SetLDAP(cfg); err != nil {
+		t.Fatalf("SetLDAP: %v", err)
+	}
+	t.Cleanup(func() { SetLDAP(LDAPConfig{}) })
+}
+
+func TestLDAPLoginMapsGroupsToRoles(t *testing.T) {
+	srv := newLDAPDirectory(t, false)
+	s := newTestService(t)
+	setTestLDAP(t, LDAPConfig{
+		URL:          srv.URL,
+		BindDN:       ldapServiceDN,
+		BindPassword: "svc-secret",
+		BaseDN:       ldapBaseDN,
+		// 配置中的 DN 大小写及空格与目录不同，仍应命中
+		GroupRoles: map[string]Role{
+			"CN=Admins, OU=Groups, DC=Example, DC=Org": RoleAdmin,
+			ldapOpsDN: RoleOperator,
+		},
+	})
+
+	cases := []struct {
+		username, password string
+		want               Role
+	}{
+		{"alice", "alice-pw", RoleAdmin}, // 命中多个分组时取权限最高的角色
+		{"bob", "bob-pw", RoleOperator},
+	}
+	for _, c := range cases {
+		if !s.AuthenticateUser(c.username, c.password) {
+			t.Fatalf("%s: login failed", c.username)
+		}
+		user, err := s.GetUserByUsername(c.username)
+		if err != nil {
+			t.Fatalf("%s: local user not created: %v", c.username, err)
+		}
+		if user.Role != c.want {
+			t.Errorf("%s: role = %q, want %q", c.username, user.Role, c.want)
+		}
+	}
+
+	// 先以服务账户查找，再以用户 DN 绑定
+	binds := srv.Binds()
+	if len(binds) < 2 || binds[0] != ldapServiceDN || binds[1] != "uid=alice,ou=people,dc=example,dc=org" {
+		t.Fatalf("binds = %v", binds)
+	}
+
+	// 配置了分组映射且未设置默认角色时，不属于任何授权分组的用户被拒绝
+	if s.AuthenticateUser("carol", "carol-pw") {
+		t.Fatal("user outside mapped groups should be rejected")
+	}
+	if _, err := s.GetUserByUsername("carol"); err == nil {
+		t.Fatal("rejected user should not be created locally")
+	}
+}
+
+func TestLDAPLoginSyncsRoleOfExistingUser(t *testing.T) {
+	srv := newLDAPDirectory(t, false)
+	s := newTestService(t)
+	if _, err := s.CreateUser(CreateUserRequest{Username: "bob", Role: RoleViewer}); err != nil {
+		t.Fatal(err)
+	}
+	setTestLDAP(t, LDAPConfig{
+		URL:        srv.URL,
+		BaseDN:     ldapBaseDN,
+		GroupRoles: map[string]Role{ldapOpsDN: RoleOperator},
+	})
+
+	if !s.AuthenticateUser("bob", "bob-pw") {
+		t.Fatal("login failed")
+	}
+	user, _ := s.GetUserByUsername("bob")
+	if user.Role != RoleOperator {
+		t.Fatalf("role = %q, want %q after sync", user.Role, RoleOperator)
+	}
+	// 未配置服务账户时匿名查找
+	if binds := srv.Binds(); len(binds) == 0 || binds[0] != "" {
+		t.Fatalf("binds = %v, want anonymous search bind first", binds)
+	}
+}
+
+func TestLDAPLoginDefaultRoleWithoutMapping(t *testing.T) {
+	srv := newLDAPDirectory(t, true)
+	s := newTestService(t)
+	setTestLDAP(t, LDAPConfig{
+		URL:     srv.URL,
+		BaseDN:  ldapBaseDN,
+		RootCAs: srv.CertPool(),
+	})
+
+	if !s.AuthenticateUser("carol", "carol-pw") {
+		t.Fatal("ldaps login failed")
+	}
+	user, err := s.GetUserByUsername("carol")
+	if err != nil || user.Role != RoleViewer {
+		t.Fatalf("user = %+v, %v; want viewer", user, err)
+	}
+}
+
+func TestLDAPLoginRejectsBadCredentials(t *testing.T) {
+	srv := newLDAPDirectory(t, false)
+	s := newTestService(t)
+	setTestLDAP(t, LDAPConfig{
+		URL:          srv.URL,
+		BindDN:       ldapServiceDN,
+		BindPassword: "svc-secret",
+		BaseDN:       ldapBaseDN,
+	})
+
+	cases := []struct{ name, username, password string }{
+		{"wrong password", "alice", "wrong"},
+		{"empty password", "alice", ""},
+		{"unknown user", "mallory", "alice-pw"},
+		{"filter injection", "*", "alice-pw"},
+	}
+	for _, c := range cases {
+		if s.AuthenticateUser(c.username, c.password) {
+			t.Errorf("%s: login should fail", c.name)
+		}
+	}
+
+	// 服务账户密码错误时同样拒绝
+	setTestLDAP(t, LDAPConfig{
+		URL:          srv.URL,
+		BindDN:       ldapServiceDN,
+		BindPassword: "wrong",
+		BaseDN:       ldapBaseDN,
+	})
+	if s.AuthenticateUser("alice", "alice-pw") {
+		t.Fatal("login should fail when the service bind fails")
+	}
+}
+
+func TestLDAPDisabledUserRejected(t *testing.T) {
+	srv := newLDAPDirectory(t, false)
+	s := newTestService(t)
+	setTestLDAP(t, LDAPConfig{URL: srv.URL, BaseDN: ldapBaseDN})
+
+	if !s.AuthenticateUser("carol", "carol-pw") {
+		t.Fatal("first login failed")
+	}
+	user, _ := s.GetUserByUsername("carol")
+	disabled := true
+	if _, err := s.UpdateUser(user.ID, UpdateUserRequest{Disabled: &disabled}); err != nil {
+		t.Fatal(err)
+	}
+	if s.AuthenticateUser("carol", "carol-pw") {
+		t.Fatal("disabled user should be rejected")
+	}
+}
+
+func TestLDAPUserCannotSetLocalPassword(t *testing.T) {
+	srv := newLDAPDirectory(t, false)
+	s := newTestService(t)
+	setTestLDAP(t, LDAPConfig{URL: srv.URL, BaseDN: ldapBaseDN})
+
+	// 首次修改密码时通过目录校验并自动创建本地用户，同样不能写入本地密码
+	for i := 0; i < 2; i++ {
+		if ok, msg := s.ChangePassword("carol", "carol-pw", "local-pw-123"); ok {
+			t.Fatalf("attempt %d: local password change for directory user succeeded: %s", i, msg)
+		}
+	}
+	if _, passwordHash, err := s.getUser("carol"); err != nil || passwordHash != "" {
+		t.Fatalf("passwordHash = %q, %v; want no local password", passwordHash, err)
+	}
+
+	// 目录中停用后（此处以关闭 LDAP 模拟）无法再登录
+	SetLDAP(LDAPConfig{})
+	if s.AuthenticateUser("carol", "local-pw-123") || s.AuthenticateUser("carol", "carol-pw") {
+		t.Fatal("directory user must not keep a usable local credential")
+	}
+}
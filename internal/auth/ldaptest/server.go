@@ -0,0 +1,515 @@
+// Package ldaptest 提供进程内的 LDAP 服务端替身，用法类似 net/http/httptest：
+// 支持简单绑定、子树查找（与 / 或 / 非、等值、存在、子串过滤器）以及 StartTLS，
+// 用于在没有真实目录服务的环境下验证 LDAP 登录流程
+package ldaptest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+)
+
+// LDAP 协议操作标签（RFC 4511）
+const (
+	opBindRequest       = 0
+	opBindResponse      = 1
+	opUnbindRequest     = 2
+	opSearchRequest     = 3
+	opSearchResultEntry = 4
+	opSearchResultDone  = 5
+	opExtendedRequest   = 23
+	opExtendedResponse  = 24
+)
+
+// LDAP 结果码
+const (
+	resultSuccess            = 0
+	resultOperationsError    = 1
+	resultProtocolError      = 2
+	resultNoSuchObject       = 32
+	resultInvalidCredentials = 49
+	resultUnwillingToPerform = 53
+)
+
+// oidStartTLS StartTLS 扩展操作
+const oidStartTLS = "1.3.6.1.4.1.1466.20037"
+
+// Entry 目录条目；Password 非空时可使用该条目的 DN 绑定
+type Entry struct {
+	DN         string
+	Password   string
+	Attributes map[string][]string
+}
+
+// Server 进程内 LDAP 服务端，监听 127.0.0.1 的随机端口
+type Server struct {
+	// URL 形如 ldap://127.0.0.1:port，NewTLSServer 创建时为 ldaps://
+	URL string
+	// Listener 底层监听器
+	Listener net.Listener
+
+	tlsConfig *tls.Config
+	certPool  *x509.CertPool
+
+	mu      sync.RWMutex
+	entries []Entry
+	binds   []string
+
+	wg     sync.WaitGroup
+	connMu sync.Mutex
+	conns  map[net.Conn]bool
+	closed bool
+}
+
+// NewServer 启动明文 LDAP 服务端（支持 StartTLS）
+func NewServer(entries ...Entry) *Server {
+	return start(false, entries)
+}
+
+// NewTLSServer 启动 LDAPS 服务端
+func NewTLSServer(entries ...Entry) *Server {
+	return start(true, entries)
+}
+
+func start(useTLS bool, entries []Entry) *Server {
+	cert, pool := selfSignedCert()
+	s := &Server{
+		tlsConfig: &tls.Config{Certificates: []tls.Certificate{cert}},
+		certPool:  pool,
+		entries:   entries,
+		conns:     map[net.Conn]bool{},
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic("ldaptest: 监听失败: " + err.Error())
+	}
+	scheme := "ldap"
+	if useTLS {
+		ln = tls.NewListener(ln, s.tlsConfig)
+		scheme = "ldaps"
+	}
+	s.Listener = ln
+	s.URL = scheme + "://" + ln.Addr().String()
+
+	s.wg.Add(1)
+	go s.serve()
+	return s
+}
+
+// Certificate 返回服务端使用的自签名证书
+func (s *Server) Certificate() *x509.Certificate {
+	return s.tlsConfig.Certificates[0].Leaf
+}
+
+// CertPool 返回信任服务端自签名证书的证书池
+func (s *Server) CertPool() *x509.CertPool {
+	return s.certPool
+}
+
+// AddEntry 添加目录条目
+func (s *Server) AddEntry(e Entry) {
+	s.mu.Lock()
+	s.entries = append(s.entries, e)
+	s.mu.Unlock()
+}
+
+// Binds 返回成功绑定过的 DN（匿名绑定记为空字符串），按时间顺序
+func (s *Server) Binds() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]string(nil), s.binds...)
+}
+
+// Close 停止监听并断开所有连接
+func (s *Server) Close() {
+	s.connMu.Lock()
+	s.closed = true
+	s.Listener.Close()
+	for c := range s.conns {
+		c.Close()
+	}
+	s.connMu.Unlock()
+	s.wg.Wait()
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.Listener.Accept()
+		if err != nil {
+			return
+		}
+		s.connMu.Lock()
+		if s.closed {
+			s.connMu.Unlock()
+			conn.Close()
+			return
+		}
+		s.conns[conn] = true
+		s.connMu.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handle(conn)
+		}()
+	}
+}
+
+// trackConn 替换连接跟踪中的连接（StartTLS 后）
+func (s *Server) trackConn(old, conn net.Conn) {
+	s.connMu.Lock()
+	delete(s.conns, old)
+	s.conns[conn] = true
+	s.connMu.Unlock()
+}
+
+// handle 处理单个连接上的请求，按顺序逐条应答
+func (s *Server) handle(conn net.Conn) {
+	defer func() {
+		s.connMu.Lock()
+		delete(s.conns, conn)
+		s.connMu.Unlock()
+		conn.Close()
+	}()
+
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil {
+			return
+		}
+		if len(packet.Children) < 2 {
+			return
+		}
+		id, ok := packet.Children[0].Value.(int64)
+		if !ok {
+			return
+		}
+		op := packet.Children[1]
+		if op.ClassType != ber.ClassApplication {
+			return
+		}
+
+		switch op.Tag {
+		case opBindRequest:
+			code, msg := s.bind(op)
+			writeResult(conn, id, opBindResponse, code, msg)
+		case opUnbindRequest:
+			return
+		case opSearchRequest:
+			s.search(conn, id, op)
+		case opExtendedRequest:
+			if len(op.Children) == 0 || op.Children[0].Data.String() != oidStartTLS {
+				writeResult(conn, id, opExtendedResponse, resultProtocolError, "不支持的扩展操作")
+				continue
+			}
+			if _, isTLS := conn.(*tls.Conn); isTLS {
+				writeResult(conn, id, opExtendedResponse, resultOperationsError, "连接已启用 TLS")
+				continue
+			}
+			writeResult(conn, id, opExtendedResponse, resultSuccess, "")
+			tlsConn := tls.Server(conn, s.tlsConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			s.trackConn(conn, tlsConn)
+			conn = tlsConn
+		default:
+			// 其余操作（如 Abandon）无需应答
+		}
+	}
+}
+
+// bind 处理简单绑定；DN 和密码均为空时视为匿名绑定
+func (s *Server) bind(op *ber.Packet) (int64, string) {
+	if len(op.Children) < 3 {
+		return resultProtocolError, "无效的绑定请求"
+	}
+	dn := op.Children[1].Data.String()
+	auth := op.Children[2]
+	if auth.ClassType != ber.ClassContext || auth.Tag != 0 {
+		return resultUnwillingToPerform, "仅支持简单绑定"
+	}
+	password := auth.Data.String()
+
+	if dn == "" && password == "" {
+		s.recordBind("")
+		return resultSuccess, ""
+	}
+	if password == "" {
+		return resultUnwillingToPerform, "不允许未认证绑定"
+	}
+
+	s.mu.RLock()
+	entry, ok := s.lookup(dn)
+	s.mu.RUnlock()
+	if !ok || entry.Password == "" || entry.Password != password {
+		return resultInvalidCredentials, "Invalid credentials"
+	}
+	s.recordBind(entry.DN)
+	return resultSuccess, ""
+}
+
+func (s *Server) recordBind(dn string) {
+	s.mu.Lock()
+	s.binds = append(s.binds, dn)
+	s.mu.Unlock()
+}
+
+// lookup 按 DN 查找条目，调用方需持有读锁
+func (s *Server) lookup(dn string) (Entry, bool) {
+	for _, e := range s.entries {
+		if normalizeDN(e.DN) == normalizeDN(dn) {
+			return e, true
+		}
+	}
+	return Entry{}, false
+}
+
+// search 处理查找请求，逐条返回匹配的条目
+func (s *Server) search(w io.Writer, id int64, op *ber.Packet) {
+	if len(op.Children) < 8 {
+		writeResult(w, id, opSearchResultDone, resultProtocolError, "无效的查找请求")
+		return
+	}
+	base := normalizeDN(op.Children[0].Data.String())
+	scope, _ := op.Children[1].Value.(int64)
+	filter := op.Children[6]
+	var attrs []string
+	for _, a := range op.Children[7].Children {
+		attrs = append(attrs, a.Data.String())
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if base != "" {
+		if _, ok := s.lookup(base); !ok && !s.hasDescendant(base) {
+			writeResult(w, id, opSearchResultDone, resultNoSuchObject, "")
+			return
+		}
+	}
+
+	for _, e := range s.entries {
+		if !inScope(normalizeDN(e.DN), base, scope) || !matches(e, filter) {
+			continue
+		}
+		writeEntry(w, id, e, attrs)
+	}
+	writeResult(w, id, opSearchResultDone, resultSuccess, "")
+}
+
+// hasDescendant 判断是否存在 base 之下的条目（允许不显式创建中间节点）
+func (s *Server) hasDescendant(base string) bool {
+	for _, e := range s.entries {
+		if strings.HasSuffix(normalizeDN(e.DN), ","+base) {
+			return true
+		}
+	}
+	return false
+}
+
+// inScope 判断条目是否在查找范围内：0 仅 base，1 base 的直接子节点，2 整棵子树
+func inScope(dn, base string, scope int64) bool {
+	if base == "" {
+		return scope == 2 || (scope == 1 && !strings.Contains(dn, ","))
+	}
+	switch scope {
+	case 0:
+		return dn == base
+	case 1:
+		return strings.HasSuffix(dn, ","+base) && !strings.Contains(strings.TrimSuffix(dn, ","+base), ",")
+	default:
+		return dn == base || strings.HasSuffix(dn, ","+base)
+	}
+}
+
+// matches 计算过滤器，属性名与属性值均不区分大小写
+func matches(e Entry, f *ber.Packet) bool {
+	if f.ClassType != ber.ClassContext {
+		return false
+	}
+	switch f.Tag {
+	case 0: // and
+		for _, c := range f.Children {
+			if !matches(e, c) {
+				return false
+			}
+		}
+		return true
+	case 1: // or
+		for _, c := range f.Children {
+			if matches(e, c) {
+				return true
+			}
+		}
+		return false
+	case 2: // not
+		return len(f.Children) == 1 && !matches(e, f.Children[0])
+	case 3: // equalityMatch
+		if len(f.Children) != 2 {
+			return false
+		}
+		want := f.Children[1].Data.String()
+		for _, v := range values(e, f.Children[0].Data.String()) {
+			if strings.EqualFold(v, want) {
+				return true
+			}
+		}
+		return false
+	case 4: // substrings
+		if len(f.Children) != 2 {
+			return false
+		}
+		for _, v := range values(e, f.Children[0].Data.String()) {
+			if matchSubstrings(strings.ToLower(v), f.Children[1].Children) {
+				return true
+			}
+		}
+		return false
+	case 7: // present
+		return len(values(e, f.Data.String())) > 0
+	}
+	return false
+}
+
+// matchSubstrings 依次匹配 initial / any / final 片段
+func matchSubstrings(v string, parts []*ber.Packet) bool {
+	for _, p := range parts {
+		sub := strings.ToLower(p.Data.String())
+		switch p.Tag {
+		case 0: // initial
+			if !strings.HasPrefix(v, sub) {
+				return false
+			}
+			v = v[len(sub):]
+		case 1: // any
+			i := strings.Index(v, sub)
+			if i < 0 {
+				return false
+			}
+			v = v[i+len(sub):]
+		case 2: // final
+			if !strings.HasSuffix(v, sub) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// values 返回条目的属性值，属性名不区分大小写
+func values(e Entry, attr string) []string {
+	if strings.EqualFold(attr, "dn") || strings.EqualFold(attr, "distinguishedName") {
+		return []string{e.DN}
+	}
+	for name, vals := range e.Attributes {
+		if strings.EqualFold(name, attr) {
+			return vals
+		}
+	}
+	return nil
+}
+
+// writeEntry 写入 SearchResultEntry，attrs 为空或包含 * 时返回全部属性
+func writeEntry(w io.Writer, id int64, e Entry, attrs []string) {
+	all := len(attrs) == 0
+	for _, a := range attrs {
+		if a == "*" {
+			all = true
+		}
+	}
+
+	entry := ber.Encode(ber.ClassApplication, ber.TypeConstructed, opSearchResultEntry, nil, "Search Result Entry")
+	entry.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, e.DN, "DN"))
+	list := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes")
+	for name, vals := range e.Attributes {
+		if !all && !containsFold(attrs, name) {
+			continue
+		}
+		attr := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attribute")
+		attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "Type"))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+		for _, v := range vals {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, "Value"))
+		}
+		attr.AppendChild(set)
+		list.AppendChild(attr)
+	}
+	entry.AppendChild(list)
+	writeMessage(w, id, entry)
+}
+
+// writeResult 写入仅包含 LDAPResult 的应答
+func writeResult(w io.Writer, id int64, tag ber.Tag, code int64, msg string) {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Response")
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, "Result Code"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, msg, "Diagnostic Message"))
+	writeMessage(w, id, op)
+}
+
+// writeMessage 以 LDAPMessage 包装并写入
+func writeMessage(w io.Writer, id int64, op *ber.Packet) {
+	msg := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	msg.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "Message ID"))
+	msg.AppendChild(op)
+	w.Write(msg.Bytes())
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeDN 小写并去掉 RDN 之间的空格
+func normalizeDN(dn string) string {
+	parts := strings.Split(dn, ",")
+	for i, p := range parts {
+		parts[i] = strings.TrimSpace(p)
+	}
+	return strings.ToLower(strings.Join(parts, ","))
+}
+
+// selfSignedCert 为 127.0.0.1 / localhost 生成临时自签名证书
+func selfSignedCert() (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic("ldaptest: 生成密钥失败: " + err.Error())
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ldaptest"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		DNSNames:              []string{"localhost"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		panic("ldaptest: 生成证书失败: " + err.Error())
+	}
+	leaf, _ := x509.ParseCertificate(der)
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, pool
+}
@@ -4,8 +4,9 @@ import "time"
 
 // LoginRequest 登录请求结构
 type LoginRequest struct {
-	Username string `json:"username"`
-	Password string `json:"password"`
+	Username   string `json:"username"`
+	Password   string `json:"password"`
+	RememberMe bool   `json:"rememberMe"` // 记住我：使用更长的会话有效期并持久化 Cookie
 }
 
 // LoginResponse 登录响应结构
@@ -13,14 +14,234 @@ type LoginResponse struct {
 	Success bool   `json:"success"`
 	Message string `json:"message"`
 	Error   string `json:"error,omitempty"`
+	// 启用两步验证时密码校验通过后返回，需携带 Challenge 调用 /api/auth/login/2fa
+	TwoFactorRequired bool   `json:"twoFactorRequired,omitempty"`
+	Challenge         string `json:"challenge,omitempty"`
+}
+
+// TwoFactorLoginRequest 两步验证登录请求，Code 可以是动态码或恢复码
+type TwoFactorLoginRequest struct {
+	Challenge  string `json:"challenge"`
+	Code       string `json:"code"`
+	RememberMe bool   `json:"rememberMe"`
+}
+
+// TOTPSetup 两步验证密钥及认证器扫码地址
+type TOTPSetup struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioningUri"`
+}
+
+// TOTPStatus 两步验证状态
+type TOTPStatus struct {
+	Enabled                bool `json:"enabled"`
+	RecoveryCodesRemaining int  `json:"recoveryCodesRemaining"`
 }
 
 // Session 用户会话结构
 type Session struct {
-	SessionID string    `json:"sessionId"`
+	SessionID  string    `json:"sessionId"`
+	Username   string    `json:"username"`
+	ExpiresAt  time.Time `json:"expiresAt"` // 绝对过期时间
+	IsActive   bool      `json:"isActive"`
+	LastSeenAt time.Time `json:"lastSeenAt"`
+	RememberMe bool      `json:"rememberMe"`
+}
+
+// SessionMeta 创建会话时记录的客户端信息
+type SessionMeta struct {
+	IP         string
+	UserAgent  string
+	RememberMe bool
+}
+
+// SessionInfo 会话列表项，不包含会话令牌本身
+type SessionInfo struct {
+	ID         int64     `json:"id"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"userAgent"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastSeenAt time.Time `json:"lastSeenAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+	RememberMe bool      `json:"rememberMe"`
+	Current    bool      `json:"current"`
+}
+
+// SessionSettings 会话有效期设置（分钟）
+type SessionSettings struct {
+	AbsoluteTimeout   int `json:"absoluteTimeout"`   // 普通会话自登录起的最长有效期
+	IdleTimeout       int `json:"idleTimeout"`       // 无操作超过该时长后失效，0 表示不限制
+	RememberMeTimeout int `json:"rememberMeTimeout"` // 勾选“记住我”时的最长有效期
+}
+
+// AuthType 认证方式
+type AuthType string
+
+const (
+	AuthTypeSession AuthType = "session"
+	AuthTypeToken   AuthType = "token"
+)
+
+// Role 用户角色
+type Role string
+
+const (
+	RoleAdmin    Role = "admin"
+	RoleOperator Role = "operator"
+	RoleViewer   Role = "viewer"
+)
+
+// roleLevels 角色等级，数值越大权限越高
+var roleLevels = map[Role]int{
+	RoleViewer:   1,
+	RoleOperator: 2,
+	RoleAdmin:    3,
+}
+
+// Valid 检查角色是否合法
+func (r Role) Valid() bool {
+	_, ok := roleLevels[r]
+	return ok
+}
+
+// Allows 检查当前角色是否满足所需角色
+func (r Role) Allows(required Role) bool {
+	return roleLevels[r] >= roleLevels[required]
+}
+
+// User 本地用户
+type User struct {
+	ID        int64     `json:"id"`
 	Username  string    `json:"username"`
-	ExpiresAt time.Time `json:"expiresAt"`
-	IsActive  bool      `json:"isActive"`
+	Role      Role      `json:"role"`
+	Disabled  bool      `json:"disabled"`
+	HasPasswd bool      `json:"hasPassword"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// CreateUserRequest 创建用户请求
+type CreateUserRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Role     Role   `json:"role"`
+}
+
+// UpdateUserRequest 更新用户请求，字段为空表示保持不变
+type UpdateUserRequest struct {
+	Password string `json:"password,omitempty"`
+	Role     Role   `json:"role,omitempty"`
+	Disabled *bool  `json:"disabled,omitempty"`
+}
+
+// OAuthIdentity 第三方登录身份及其映射的本地用户
+type OAuthIdentity struct {
+	ID            int64     `json:"id"`
+	Provider      string    `json:"provider"`
+	ProviderID    string    `json:"providerId"`
+	Username      string    `json:"username"`
+	UserID        *int64    `json:"userId,omitempty"`
+	LocalUsername string    `json:"localUsername,omitempty"`
+	Status        string    `json:"status"`
+	CreatedAt     time.Time `json:"createdAt"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+}
+
+// OAuth 身份状态
+const (
+	OAuthStatusPending  = "pending"  // 未命中白名单，等待管理员审批
+	OAuthStatusAllowed  = "allowed"  // 最近一次登录时命中白名单
+	OAuthStatusApproved = "approved" // 管理员已批准，不再受白名单限制
+	OAuthStatusRevoked  = "revoked"  // 管理员已撤销，禁止登录
+)
+
+// OAuthAllowlist OAuth2 登录白名单，各项满足其一即可登录；全部为空表示未启用
+type OAuthAllowlist struct {
+	Logins      []string `json:"logins"`      // 第三方登录名，如 octocat
+	Emails      []string `json:"emails"`      // 已验证的邮箱
+	Domains     []string `json:"domains"`     // 邮箱域名，如 example.com
+	GitHubOrgs  []string `json:"githubOrgs"`  // GitHub 组织
+	GitHubTeams []string `json:"githubTeams"` // GitHub 团队，格式 org/team-slug
+}
+
+// OAuthProfile 白名单校验使用的第三方账户信息
+type OAuthProfile struct {
+	Login  string
+	Emails []string
+	Orgs   []string
+	Teams  []string // 格式 org/team-slug
+}
+
+// Principal 已认证的调用方信息
+type Principal struct {
+	UserID    int64    `json:"userId"`
+	Username  string   `json:"username"`
+	Role      Role     `json:"role"`
+	AuthType  AuthType `json:"authType"`
+	SessionID string   `json:"-"`
+	TokenID   int64    `json:"-"`
+	Scopes    []string `json:"scopes,omitempty"` // 仅 API Token 有效，会话登录不受限
+}
+
+// HasScope 检查调用方是否具备指定权限范围
+func (p *Principal) HasScope(scope string) bool {
+	if p.AuthType != AuthTypeToken {
+		return true
+	}
+	for _, s := range p.Scopes {
+		if s == scope || impliedScopes[s][scope] {
+			return true
+		}
+	}
+	return false
+}
+
+// API Token 权限范围
+const (
+	ScopeTunnelsRead    = "tunnels:read"
+	ScopeTunnelsWrite   = "tunnels:write"
+	ScopeEndpointsRead  = "endpoints:read"
+	ScopeEndpointsAdmin = "endpoints:admin"
+	ScopeMetricsRead    = "metrics:read"
+)
+
+// AllScopes 所有可分配的权限范围
+var AllScopes = []string{ScopeTunnelsRead, ScopeTunnelsWrite, ScopeEndpointsRead, ScopeEndpointsAdmin, ScopeMetricsRead}
+
+// impliedScopes 高权限范围隐含的低权限范围
+var impliedScopes = map[string]map[string]bool{
+	ScopeTunnelsWrite:   {ScopeTunnelsRead: true},
+	ScopeEndpointsAdmin: {ScopeEndpointsRead: true},
+}
+
+// APIToken API 令牌（不含明文）
+type APIToken struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Username   string     `json:"username"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	Revoked    bool       `json:"revoked"`
+}
+
+// CreateAPITokenRequest 创建 API 令牌请求
+type CreateAPITokenRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// LoginLockout 登录失败计数及锁定状态
+type LoginLockout struct {
+	Kind          string     `json:"kind"`  // ip | username
+	Value         string     `json:"value"` // IP 地址或用户名
+	Failures      int        `json:"failures"`
+	LastFailureAt time.Time  `json:"lastFailureAt"`
+	NextAttemptAt *time.Time `json:"nextAttemptAt,omitempty"` // 指数退避下允许再次尝试的时间
+	LockedUntil   *time.Time `json:"lockedUntil,omitempty"`
 }
 
 // SystemConfig 系统配置结构
@@ -35,4 +256,17 @@ const (
 	ConfigKeyIsInitialized = "system_initialized"
 	ConfigKeyAdminUsername = "admin_username"
 	ConfigKeyAdminPassword = "admin_password_hash"
+	// ConfigKeyOAuthDefaultRole 首次通过 OAuth2 登录且未映射本地用户时自动创建账户的角色，未配置时为只读
+	ConfigKeyOAuthDefaultRole = "oauth2_default_role"
+	// ConfigKeyOAuthAllowlist OAuth2 登录白名单（JSON）
+	ConfigKeyOAuthAllowlist = "oauth2_allowlist"
+	// ConfigKeySessionSettings 会话有效期设置（JSON）
+	ConfigKeySessionSettings = "session_settings"
 )
+
+// OAuthStateData OAuth2 state 关联的数据，回调校验 state 时一并取出
+type OAuthStateData struct {
+	CreatedAt    int64
+	CodeVerifier string // PKCE code_verifier（仅 OIDC）
+	Nonce        string // ID Token nonce（仅 OIDC）
+}
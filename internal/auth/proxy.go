@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// ProxyAuthConfig 反向代理认证配置：由前置的 SSO 代理（如 oauth2-proxy、Authelia）完成登录，
+// 通过请求头传递用户身份，仅信任来自 CIDRs 的请求
+type ProxyAuthConfig struct {
+	Enabled     bool
+	CIDRs       []string
+	UserHeader  string // 默认 X-Forwarded-User
+	EmailHeader string // 默认 X-Forwarded-Email
+	DefaultRole Role   // 自动创建用户时授予的角色，默认 viewer
+}
+
+// ProxyIdentity 代理传递的用户身份
+type ProxyIdentity struct {
+	Username string
+	Email    string
+}
+
+var (
+	proxyAuth   ProxyAuthConfig
+	proxyNets   []*net.IPNet
+	proxyAuthMu sync.RWMutex
+)
+
+// SetProxyAuth 设置反向代理认证，启用时必须指定代理网段
+func SetProxyAuth(cfg ProxyAuthConfig) error {
+	var nets []*net.IPNet
+	if cfg.Enabled {
+		var err error
+		if nets, err = parseNets(cfg.CIDRs); err != nil {
+			return err
+		}
+		if len(nets) == 0 {
+			return errors.New("启用反向代理认证时必须指定代理的 IP / CIDR")
+		}
+		if cfg.UserHeader == "" {
+			cfg.UserHeader = "X-Forwarded-User"
+		}
+		if cfg.EmailHeader == "" {
+			cfg.EmailHeader = "X-Forwarded-Email"
+		}
+		if cfg.DefaultRole == "" {
+			cfg.DefaultRole = RoleViewer
+		}
+		if !cfg.DefaultRole.Valid() {
+			return errors.New("无效的默认角色: " + string(cfg.DefaultRole))
+		}
+	}
+
+	proxyAuthMu.Lock()
+	proxyAuth = cfg
+	proxyNets = nets
+	proxyAuthMu.Unlock()
+	return nil
+}
+
+// ProxyAuthEnabled 是否启用反向代理认证
+func ProxyAuthEnabled() bool {
+	proxyAuthMu.RLock()
+	defer proxyAuthMu.RUnlock()
+	return proxyAuth.Enabled
+}
+
+// ProxyIdentityFromRequest 读取代理传递的用户身份；
+// 仅当直连地址属于配置的代理网段时才采信请求头，用户名为空时使用邮箱
+func ProxyIdentityFromRequest(r *http.Request) (ProxyIdentity, bool) {
+	proxyAuthMu.RLock()
+	cfg := proxyAuth
+	nets := proxyNets
+	proxyAuthMu.RUnlock()
+
+	if !cfg.Enabled || !containsIP(nets, RemoteIP(r)) {
+		return ProxyIdentity{}, false
+	}
+	id := ProxyIdentity{
+		Username: strings.TrimSpace(r.Header.Get(cfg.UserHeader)),
+		Email:    strings.TrimSpace(r.Header.Get(cfg.EmailHeader)),
+	}
+	if id.Username == "" {
+		id.Username = id.Email
+	}
+	if id.Username == "" || len(id.Username) > 128 {
+		return ProxyIdentity{}, false
+	}
+	return id, true
+}
+
+// ResolveProxyLogin 返回代理身份对应的本地用户，不存在时按默认角色自动创建（无密码，仅能经代理登录）
+func (s *Service) ResolveProxyLogin(id ProxyIdentity) (*User, error) {
+	if user, err := s.GetUserByUsername(id.Username); err == nil {
+		if user.Disabled {
+			return nil, errors.New("该账户已被禁用")
+		}
+		return user, nil
+	}
+
+	proxyAuthMu.RLock()
+	role := proxyAuth.DefaultRole
+	proxyAuthMu.RUnlock()
+	user, err := s.CreateUser(CreateUserRequest{Username: id.Username, Role: role})
+	if err != nil {
+		// 并发的首次请求可能已创建该用户
+		if existing, getErr := s.GetUserByUsername(id.Username); getErr == nil && !existing.Disabled {
+			return existing, nil
+		}
+		return nil, err
+	}
+	return user, nil
+}
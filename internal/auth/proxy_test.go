@@ -0,0 +1,145 @@
+package auth
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+// setTestTrustedProxies 设置受信任的反向代理，测试结束后清空
+func setTestTrustedProxies(t *testing.T, entries ...string) {
+	t.Helper()
+	if err := SetTrustedProxies(entries); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { SetTrustedProxies(nil) })
+}
+
+// setTestProxyAuth 启用反向代理认证，测试结束后关闭
+func setTestProxyAuth(t *testing.T, cfg ProxyAuthConfig) {
+	t.Helper()
+	cfg.Enabled = true
+	if err := SetProxyAuth(cfg); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { SetProxyAuth(ProxyAuthConfig{}) })
+}
+
+func TestClientIP(t *testing.T) {
+	setTestTrustedProxies(t, "10.0.0.0/8", "192.168.1.1", "::1")
+
+	cases := []struct {
+		name, remote string
+		xff          []string
+		want         string
+	}{
+		{"untrusted peer ignores header", "203.0.113.9:1234", []string{"1.2.3.4"}, "203.0.113.9"},
+		{"trusted peer without header", "10.1.2.3:1234", nil, "10.1.2.3"},
+		{"trusted peer", "10.1.2.3:1234", []string{"1.2.3.4"}, "1.2.3.4"},
+		{"spoofed leftmost hop skipped", "10.1.2.3:1234", []string{"6.6.6.6, 1.2.3.4"}, "1.2.3.4"},
+		{"chained trusted proxies", "192.168.1.1:1234", []string{"1.2.3.4, 10.0.0.5"}, "1.2.3.4"},
+		{"multiple header lines", "10.1.2.3:1234", []string{"6.6.6.6", "1.2.3.4, 10.9.9.9"}, "1.2.3.4"},
+		{"invalid hop stops parsing", "10.1.2.3:1234", []string{"1.2.3.4, garbage"}, "10.1.2.3"},
+		{"single ip entry is exact", "192.168.1.2:1234", []string{"1.2.3.4"}, "192.168.1.2"},
+		{"ipv6 trusted peer", "[::1]:1234", []string{"2001:db8::1"}, "2001:db8::1"},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = c.remote
+		for _, v := range c.xff {
+			r.Header.Add("X-Forwarded-For", v)
+		}
+		if got := ClientIP(r); got != c.want {
+			t.Errorf("%s: ClientIP = %s, want %s", c.name, got, c.want)
+		}
+	}
+}
+
+func TestSetTrustedProxiesRejectsInvalid(t *testing.T) {
+	for _, entry := range []string{"not-an-ip", "10.0.0.0/99"} {
+		if err := SetTrustedProxies([]string{entry}); err == nil {
+			t.Errorf("SetTrustedProxies(%q) should fail", entry)
+		}
+	}
+}
+
+func TestSetProxyAuthValidates(t *testing.T) {
+	t.Cleanup(func() { SetProxyAuth(ProxyAuthConfig{}) })
+	invalid := []ProxyAuthConfig{
+		{Enabled: true},
+		{Enabled: true, CIDRs: []string{" "}},
+		{Enabled: true, CIDRs: []string{"bad"}},
+		{Enabled: true, CIDRs: []string{"10.0.0.1"}, DefaultRole: "root"},
+	}
+	for _, cfg := range invalid {
+		if err := SetProxyAuth(cfg); err == nil {
+			t.Errorf("SetProxyAuth(%+v) should fail", cfg)
+		}
+	}
+	if ProxyAuthEnabled() {
+		t.Fatal("rejected config must not enable proxy auth")
+	}
+}
+
+func TestProxyIdentityOnlyFromConfiguredCIDRs(t *testing.T) {
+	// 受信任的 X-Forwarded-For 代理不等于可传递身份的代理
+	setTestTrustedProxies(t, "10.0.0.0/8")
+	setTestProxyAuth(t, ProxyAuthConfig{CIDRs: []string{"10.0.0.1", "fd00::/8"}, UserHeader: "Remote-User"})
+
+	cases := []struct {
+		name, remote   string
+		headers        map[string]string
+		wantOK         bool
+		wantUser, mail string
+	}{
+		{"configured proxy", "10.0.0.1:1", map[string]string{"Remote-User": " alice "}, true, "alice", ""},
+		{"configured ipv6 proxy", "[fd00::5]:1", map[string]string{"Remote-User": "alice"}, true, "alice", ""},
+		{"email fallback", "10.0.0.1:1", map[string]string{"X-Forwarded-Email": "bob@example.com"}, true, "bob@example.com", "bob@example.com"},
+		{"direct client", "203.0.113.9:1", map[string]string{"Remote-User": "alice"}, false, "", ""},
+		{"trusted xff proxy outside auth cidrs", "10.0.0.2:1", map[string]string{"Remote-User": "alice"}, false, "", ""},
+		{"forwarded-for does not grant trust", "203.0.113.9:1", map[string]string{"Remote-User": "alice", "X-Forwarded-For": "10.0.0.1"}, false, "", ""},
+		{"default header ignored when overridden", "10.0.0.1:1", map[string]string{"X-Forwarded-User": "alice"}, false, "", ""},
+		{"empty identity", "10.0.0.1:1", nil, false, "", ""},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = c.remote
+		for k, v := range c.headers {
+			r.Header.Set(k, v)
+		}
+		id, ok := ProxyIdentityFromRequest(r)
+		if ok != c.wantOK || id.Username != c.wantUser || id.Email != c.mail {
+			t.Errorf("%s: identity = %+v, %v; want %q, %v", c.name, id, ok, c.wantUser, c.wantOK)
+		}
+	}
+}
+
+func TestProxyIdentityIgnoredWhenDisabled(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "10.0.0.1:1"
+	r.Header.Set("X-Forwarded-User", "alice")
+	if _, ok := ProxyIdentityFromRequest(r); ok {
+		t.Fatal("identity header must be ignored when proxy auth is disabled")
+	}
+}
+
+func TestResolveProxyLogin(t *testing.T) {
+	s := newTestService(t)
+	setTestProxyAuth(t, ProxyAuthConfig{CIDRs: []string{"10.0.0.1"}, DefaultRole: RoleOperator})
+
+	user, err := s.ResolveProxyLogin(ProxyIdentity{Username: "alice"})
+	if err != nil || user.Role != RoleOperator {
+		t.Fatalf("user = %+v, %v; want auto-created operator", user, err)
+	}
+	// 自动创建的用户没有本地密码
+	if s.AuthenticateUser("alice", "") {
+		t.Fatal("proxy user must not log in with an empty password")
+	}
+
+	disabled := true
+	if _, err := s.UpdateUser(user.ID, UpdateUserRequest{Disabled: &disabled}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ResolveProxyLogin(ProxyIdentity{Username: "alice"}); err == nil {
+		t.Fatal("disabled proxy user should be rejected")
+	}
+}
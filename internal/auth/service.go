@@ -8,6 +8,7 @@ import (
 	"math/big"
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
@@ -20,12 +21,16 @@ var (
 	// 内存中的系统配置存储
 	configCache = sync.Map{}
 	// OAuth2 state 缓存，防止 CSRF
-	oauthStateCache = sync.Map{} // key:string state, value:int64 timestamp
+	oauthStateCache = sync.Map{} // key:string state, value:OAuthStateData
 )
 
 // Service 认证服务
 type Service struct {
 	db *sql.DB
+	// sessionSettings 会话有效期设置缓存，每次校验会话都会用到；修改设置时清空。
+	// 重新加载与清空都在 sessionSettingsMu 内进行，避免并发读取把旧设置写回缓存
+	sessionSettings   atomic.Pointer[SessionSettings]
+	sessionSettingsMu sync.Mutex
 }
 
 // NewService 创建认证服务实例，需要传入数据库连接
@@ -83,6 +88,11 @@ func (s *Service) SetSystemConfig(key, value, description string) error {
 
 	// 更新缓存
 	configCache.Store(key, value)
+	if key == ConfigKeySessionSettings {
+		s.sessionSettingsMu.Lock()
+		s.sessionSettings.Store(nil)
+		s.sessionSettingsMu.Unlock()
+	}
 	return nil
 }
 
@@ -92,83 +102,95 @@ func (s *Service) IsSystemInitialized() bool {
 	return value == "true"
 }
 
-// AuthenticateUser 用户登录验证
+// AuthenticateUser 用户登录验证；设置了本地密码的用户只校验本地密码，
+// 其余用户（不存在或无本地密码）在启用 LDAP 时改为到目录中校验
 func (s *Service) AuthenticateUser(username, password string) bool {
-	storedUsername, _ := s.GetSystemConfig(ConfigKeyAdminUsername)
-	storedPasswordHash, _ := s.GetSystemConfig(ConfigKeyAdminPassword)
+	_ = s.EnsureAdminUser()
 
-	if storedUsername == "" || storedPasswordHash == "" {
+	user, passwordHash, err := s.getUser(username)
+	if err == nil && user.Disabled {
 		return false
 	}
-
-	if username != storedUsername {
-		return false
+	if err == nil && passwordHash != "" {
+		return s.VerifyPassword(password, passwordHash)
 	}
-
-	return s.VerifyPassword(password, storedPasswordHash)
+	if LDAPEnabled() {
+		return s.authenticateLDAPUser(username, password)
+	}
+	return false
 }
 
-// CreateUserSession 创建用户会话
-func (s *Service) CreateUserSession(username string) (string, error) {
-	sessionID := uuid.New().String()
-	expiresAt := time.Now().Add(24 * time.Hour)
+// CreateUserSession 创建用户会话，有效期按会话设置及“记住我”决定
+func (s *Service) CreateUserSession(username string, meta SessionMeta) (*Session, error) {
+	settings := s.GetSessionSettings()
+	now := time.Now()
+	timeout := settings.AbsoluteTimeout
+	if meta.RememberMe {
+		timeout = settings.RememberMeTimeout
+	}
+
+	session := Session{
+		SessionID:  uuid.New().String(),
+		Username:   username,
+		ExpiresAt:  now.Add(time.Duration(timeout) * time.Minute),
+		IsActive:   true,
+		LastSeenAt: now,
+		RememberMe: meta.RememberMe,
+	}
 
 	// 写入数据库
 	_, err := s.db.Exec(`
-		INSERT INTO "UserSession" (sessionId, username, createdAt, expiresAt, isActive)
-		VALUES (?, ?, CURRENT_TIMESTAMP, ?, 1);
-	`, sessionID, username, expiresAt)
+		INSERT INTO "UserSession" (sessionId, username, createdAt, expiresAt, isActive, ipAddress, userAgent, lastSeenAt, rememberMe)
+		VALUES (?, ?, CURRENT_TIMESTAMP, ?, 1, ?, ?, ?, ?);
+	`, session.SessionID, username, session.ExpiresAt, meta.IP, meta.UserAgent, session.LastSeenAt, meta.RememberMe)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	// 写入缓存
-	sessionCache.Store(sessionID, Session{
-		SessionID: sessionID,
-		Username:  username,
-		ExpiresAt: expiresAt,
-		IsActive:  true,
-	})
+	sessionCache.Store(session.SessionID, session)
 
-	return sessionID, nil
+	return &session, nil
 }
 
-// ValidateSession 验证会话
+// ValidateSession 验证会话（绝对过期与空闲超时）
 func (s *Service) ValidateSession(sessionID string) bool {
-	// 先查缓存
-	if value, ok := sessionCache.Load(sessionID); ok {
-		session := value.(Session)
-		if session.IsActive && time.Now().Before(session.ExpiresAt) {
-			return true
-		}
-		// 缓存过期或失效，删除
-		sessionCache.Delete(sessionID)
-	}
+	_, ok := s.GetSession(sessionID)
+	return ok
+}
 
-	// 查询数据库
-	var username string
-	var expiresAt time.Time
-	var isActive bool
-	err := s.db.QueryRow(`SELECT username, expiresAt, isActive FROM "UserSession" WHERE sessionId = ?`, sessionID).Scan(&username, &expiresAt, &isActive)
-	if err != nil {
-		return false
+// AuthenticateSession 校验会话并返回对应的调用方信息，同时刷新最近活动时间
+func (s *Service) AuthenticateSession(sessionID string) (*Principal, bool) {
+	if sessionID == "" {
+		return nil, false
 	}
-
-	if !isActive || time.Now().After(expiresAt) {
-		// 标记为失效
-		s.db.Exec(`UPDATE "UserSession" SET isActive = 0 WHERE sessionId = ?`, sessionID)
-		return false
+	session, ok := s.GetSession(sessionID)
+	if !ok {
+		return nil, false
 	}
-
-	// 更新缓存
-	sessionCache.Store(sessionID, Session{
+	user, err := s.GetUserByUsername(session.Username)
+	if err != nil || user.Disabled {
+		return nil, false
+	}
+	s.touchSession(session)
+	return &Principal{
+		UserID:    user.ID,
+		Username:  session.Username,
+		Role:      user.Role,
+		AuthType:  AuthTypeSession,
 		SessionID: sessionID,
-		Username:  username,
-		ExpiresAt: expiresAt,
-		IsActive:  isActive,
-	})
+	}, true
+}
 
-	return true
+// touchSession 刷新会话最近活动时间，数据库最多每分钟写一次
+func (s *Service) touchSession(session *Session) {
+	now := time.Now()
+	if now.Sub(session.LastSeenAt) < sessionTouchInterval {
+		return
+	}
+	session.LastSeenAt = now
+	sessionCache.Store(session.SessionID, *session)
+	s.db.Exec(`UPDATE "UserSession" SET lastSeenAt = ? WHERE sessionId = ?`, now, session.SessionID)
 }
 
 // DestroySession 销毁会话
@@ -179,15 +201,22 @@ func (s *Service) DestroySession(sessionID string) {
 	sessionCache.Delete(sessionID)
 }
 
-// CleanupExpiredSessions 清理过期会话
+// CleanupExpiredSessions 清理过期及空闲超时的会话
 func (s *Service) CleanupExpiredSessions() {
+	settings := s.GetSessionSettings()
+	now := time.Now()
+
 	// 更新数据库
-	s.db.Exec(`UPDATE "UserSession" SET isActive = 0 WHERE expiresAt < CURRENT_TIMESTAMP AND isActive = 1`)
+	s.db.Exec(`UPDATE "UserSession" SET isActive = 0 WHERE expiresAt < ? AND isActive = 1`, now)
+	if settings.IdleTimeout > 0 {
+		s.db.Exec(`UPDATE "UserSession" SET isActive = 0 WHERE lastSeenAt < ? AND isActive = 1`,
+			now.Add(-time.Duration(settings.IdleTimeout)*time.Minute))
+	}
 
 	// 清理缓存
 	sessionCache.Range(func(key, value interface{}) bool {
 		session := value.(Session)
-		if !session.IsActive || time.Now().After(session.ExpiresAt) {
+		if !sessionAlive(session, settings, now) {
 			sessionCache.Delete(key)
 		}
 		return true
@@ -218,6 +247,9 @@ func (s *Service) InitializeSystem() (string, string, error) {
 	if err := s.SetSystemConfig(ConfigKeyIsInitialized, "true", "系统是否已初始化"); err != nil {
 		return "", "", err
 	}
+	if err := s.EnsureAdminUser(); err != nil {
+		return "", "", err
+	}
 
 	// 日志输出
 	// 重要: 输出初始密码
@@ -234,33 +266,40 @@ func (s *Service) InitializeSystem() (string, string, error) {
 	return username, password, nil
 }
 
-// GetSession 根据 SessionID 获取会话信息
+// GetSession 根据 SessionID 获取有效的会话信息，过期或空闲超时的会话会被标记为失效
 func (s *Service) GetSession(sessionID string) (*Session, bool) {
-	if value, ok := sessionCache.Load(sessionID); ok {
-		session := value.(Session)
-		return &session, true
-	}
+	settings := s.GetSessionSettings()
+	now := time.Now()
 
-	// 查询数据库
-	var username string
-	var expiresAt time.Time
-	var isActive bool
-	err := s.db.QueryRow(`SELECT username, expiresAt, isActive FROM "UserSession" WHERE sessionId = ?`, sessionID).
-		Scan(&username, &expiresAt, &isActive)
-	if err != nil {
-		return nil, false
+	var session Session
+	if value, ok := sessionCache.Load(sessionID); ok {
+		session = value.(Session)
+	} else {
+		// 查询数据库
+		var createdAt time.Time
+		var lastSeenAt sql.NullTime
+		err := s.db.QueryRow(`SELECT username, createdAt, expiresAt, isActive, lastSeenAt, rememberMe FROM "UserSession" WHERE sessionId = ?`, sessionID).
+			Scan(&session.Username, &createdAt, &session.ExpiresAt, &session.IsActive, &lastSeenAt, &session.RememberMe)
+		if err != nil {
+			return nil, false
+		}
+		session.SessionID = sessionID
+		// 升级前创建的会话没有活动时间，以创建时间代替
+		session.LastSeenAt = createdAt
+		if lastSeenAt.Valid {
+			session.LastSeenAt = lastSeenAt.Time
+		}
 	}
 
-	if !isActive || time.Now().After(expiresAt) {
+	if !sessionAlive(session, settings, now) {
+		// 标记为失效
+		sessionCache.Delete(sessionID)
+		if session.IsActive {
+			s.db.Exec(`UPDATE "UserSession" SET isActive = 0 WHERE sessionId = ?`, sessionID)
+		}
 		return nil, false
 	}
 
-	session := Session{
-		SessionID: sessionID,
-		Username:  username,
-		ExpiresAt: expiresAt,
-		IsActive:  isActive,
-	}
 	// 更新缓存
 	sessionCache.Store(sessionID, session)
 
@@ -288,6 +327,10 @@ func (s *Service) ChangePassword(username, currentPassword, newPassword string)
 	if !s.AuthenticateUser(username, currentPassword) {
 		return false, "当前密码不正确"
 	}
+	// LDAP 等外部身份源创建的用户没有本地密码，写入本地密码后将绕过目录校验
+	if _, passwordHash, err := s.getUser(username); err != nil || passwordHash == "" {
+		return false, "该账户由外部身份源（如 LDAP）管理，请在身份源中修改密码"
+	}
 
 	// 加密新密码
 	hash, err := s.HashPassword(newPassword)
@@ -295,43 +338,33 @@ func (s *Service) ChangePassword(username, currentPassword, newPassword string)
 		return false, "密码加密失败"
 	}
 
-	// 更新系统配置
-	if err := s.SetSystemConfig(ConfigKeyAdminPassword, hash, "管理员密码哈希"); err != nil {
+	if _, err := s.db.Exec(`UPDATE "User" SET passwordHash = ?, updatedAt = CURRENT_TIMESTAMP WHERE username = ?`, hash, username); err != nil {
 		return false, "更新密码失败"
 	}
+	s.syncLegacyAdmin(username, "", hash)
 
-	// 使所有现有 Session 失效
-	s.invalidateAllSessions()
+	// 使该用户所有现有 Session 失效
+	s.invalidateUserSessions(username)
 	return true, "密码修改成功"
 }
 
 // ChangeUsername 修改用户名
 func (s *Service) ChangeUsername(currentUsername, newUsername string) (bool, string) {
-	storedUsername, _ := s.GetSystemConfig(ConfigKeyAdminUsername)
-	if currentUsername != storedUsername {
+	if _, err := s.GetUserByUsername(currentUsername); err != nil {
 		return false, "当前用户名不正确"
 	}
+	if _, err := s.GetUserByUsername(newUsername); err == nil {
+		return false, "用户名已存在"
+	}
 
-	// 更新系统配置中的用户名
-	if err := s.SetSystemConfig(ConfigKeyAdminUsername, newUsername, "管理员用户名"); err != nil {
+	// 更新用户表中的用户名
+	if _, err := s.db.Exec(`UPDATE "User" SET username = ?, updatedAt = CURRENT_TIMESTAMP WHERE username = ?`, newUsername, currentUsername); err != nil {
 		return false, "更新用户名失败"
 	}
+	s.syncLegacyAdmin(currentUsername, newUsername, "")
 
-	// 更新数据库中的会话记录
-	_, _ = s.db.Exec(`UPDATE "UserSession" SET username = ? WHERE username = ? AND isActive = 1`, newUsername, currentUsername)
-
-	// 更新缓存中的会话
-	sessionCache.Range(func(key, value interface{}) bool {
-		sess := value.(Session)
-		if sess.Username == currentUsername {
-			sess.Username = newUsername
-			sessionCache.Store(key, sess)
-		}
-		return true
-	})
-
-	// 使所有现有 Session 失效
-	s.invalidateAllSessions()
+	// 使该用户所有现有 Session 失效
+	s.invalidateUserSessions(currentUsername)
 	return true, "用户名修改成功"
 }
 
@@ -360,9 +393,15 @@ func (s *Service) ResetAdminPassword() (string, string, error) {
 	if err := s.SetSystemConfig(ConfigKeyAdminPassword, hash, "管理员密码哈希"); err != nil {
 		return "", "", err
 	}
+	if err := s.EnsureAdminUser(); err != nil {
+		return "", "", err
+	}
+	if _, err := s.db.Exec(`UPDATE "User" SET passwordHash = ?, disabled = 0, updatedAt = CURRENT_TIMESTAMP WHERE username = ?`, hash, username); err != nil {
+		return "", "", err
+	}
 
-	// 使所有现有 Session 失效
-	s.invalidateAllSessions()
+	// 使该用户所有现有 Session 失效
+	s.invalidateUserSessions(username)
 
 	// 输出提示
 	fmt.Println("================================")
@@ -377,17 +416,6 @@ func (s *Service) ResetAdminPassword() (string, string, error) {
 	return username, newPassword, nil
 }
 
-// invalidateAllSessions 使所有会话失效（数据库 + 缓存）
-func (s *Service) invalidateAllSessions() {
-	// 更新数据库会话状态
-	_, _ = s.db.Exec(`UPDATE "UserSession" SET isActive = 0`)
-	// 清空缓存
-	sessionCache.Range(func(key, value interface{}) bool {
-		sessionCache.Delete(key)
-		return true
-	})
-}
-
 // SaveOAuthUser 保存或更新 OAuth 用户信息
 // provider: github / cloudflare 等
 // providerID: 第三方平台返回的用户唯一 ID
@@ -401,6 +429,8 @@ func (s *Service) SaveOAuthUser(provider, providerID, username, dataJSON string)
 		providerId TEXT NOT NULL,
 		username TEXT NOT NULL,
 		data TEXT,
+		userId INTEGER,
+		status TEXT NOT NULL DEFAULT 'pending',
 		createdAt DATETIME DEFAULT CURRENT_TIMESTAMP,
 		updatedAt DATETIME DEFAULT CURRENT_TIMESTAMP,
 		UNIQUE(provider, providerId)
@@ -409,36 +439,11 @@ func (s *Service) SaveOAuthUser(provider, providerID, username, dataJSON string)
 		return err
 	}
 
-	// 检查是否已存在 OAuth 用户（只允许第一个用户登录）
-	var existingCount int
-	err := s.db.QueryRow(`SELECT COUNT(*) FROM "OAuthUser"`).Scan(&existingCount)
-	if err != nil {
-		return err
-	}
-
-	// 如果已有用户，检查是否是同一个用户
-	if existingCount > 0 {
-		var existingProviderID string
-		err := s.db.QueryRow(`SELECT providerId FROM "OAuthUser" WHERE provider = ?`, provider).Scan(&existingProviderID)
-		if err != nil {
-			if err == sql.ErrNoRows {
-				// 当前 provider 没有用户，但其他 provider 有用户，不允许登录
-				return errors.New("系统已绑定其他 OAuth2 用户，不允许使用不同的 OAuth2 账户登录")
-			}
-			return err
-		}
-
-		// 如果是不同的用户ID，拒绝登录
-		if existingProviderID != providerID {
-			return errors.New("系统已绑定其他 OAuth2 用户，不允许使用不同的账户登录")
-		}
-	}
-
-	// 插入或更新（只有同一用户才能更新）
-	_, err = s.db.Exec(`INSERT INTO "OAuthUser" (provider, providerId, username, data, createdAt, updatedAt)
-		VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+	// 新身份默认待审批，是否允许登录由 AuthorizeOAuthLogin 决定；已有身份仅更新资料，保留状态
+	_, err := s.db.Exec(`INSERT INTO "OAuthUser" (provider, providerId, username, data, status, createdAt, updatedAt)
+		VALUES (?, ?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
 		ON CONFLICT(provider, providerId) DO UPDATE SET username = excluded.username, data = excluded.data, updatedAt = CURRENT_TIMESTAMP;`,
-		provider, providerID, username, dataJSON)
+		provider, providerID, username, dataJSON, OAuthStatusPending)
 	return err
 }
 
@@ -450,20 +455,30 @@ func (s *Service) DeleteAllOAuthUsers() error {
 
 // GenerateOAuthState 生成并缓存 state 值（10 分钟有效）
 func (s *Service) GenerateOAuthState() string {
+	return s.GenerateOAuthStateWithData(OAuthStateData{})
+}
+
+// GenerateOAuthStateWithData 生成 state 并关联 PKCE code_verifier、nonce 等回调时需要的数据
+func (s *Service) GenerateOAuthStateWithData(data OAuthStateData) string {
 	state := uuid.NewString()
-	oauthStateCache.Store(state, time.Now().Unix())
+	data.CreatedAt = time.Now().Unix()
+	oauthStateCache.Store(state, data)
 	return state
 }
 
 // ValidateOAuthState 校验 state 并清除，返回是否有效
 func (s *Service) ValidateOAuthState(state string) bool {
-	if v, ok := oauthStateCache.Load(state); ok {
-		ts := v.(int64)
-		if time.Now().Unix()-ts < 600 { // 10 分钟
-			oauthStateCache.Delete(state)
-			return true
+	_, ok := s.ConsumeOAuthState(state)
+	return ok
+}
+
+// ConsumeOAuthState 校验 state 并清除，返回生成时关联的数据
+func (s *Service) ConsumeOAuthState(state string) (OAuthStateData, bool) {
+	if v, ok := oauthStateCache.LoadAndDelete(state); ok {
+		data := v.(OAuthStateData)
+		if time.Now().Unix()-data.CreatedAt < 600 { // 10 分钟
+			return data, true
 		}
-		oauthStateCache.Delete(state)
 	}
-	return false
+	return OAuthStateData{}, false
 }
@@ -0,0 +1,160 @@
+package auth
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+const (
+	// sessionTouchInterval 刷新会话最近活动时间写库的最小间隔
+	sessionTouchInterval = time.Minute
+
+	defaultSessionAbsoluteTimeout   = 24 * 60      // 24 小时，与升级前的固定有效期一致
+	defaultSessionIdleTimeout       = 0            // 默认不启用空闲超时
+	defaultSessionRememberMeTimeout = 30 * 24 * 60 // 30 天
+)
+
+// sessionAlive 判断会话是否仍然有效
+func sessionAlive(session Session, settings SessionSettings, now time.Time) bool {
+	if !session.IsActive || !now.Before(session.ExpiresAt) {
+		return false
+	}
+	if settings.IdleTimeout > 0 && now.Sub(session.LastSeenAt) > time.Duration(settings.IdleTimeout)*time.Minute {
+		return false
+	}
+	return true
+}
+
+// GetSessionSettings 读取会话有效期设置（优先缓存），未配置的项使用默认值
+func (s *Service) GetSessionSettings() SessionSettings {
+	if cached := s.sessionSettings.Load(); cached != nil {
+		return *cached
+	}
+	s.sessionSettingsMu.Lock()
+	defer s.sessionSettingsMu.Unlock()
+	if cached := s.sessionSettings.Load(); cached != nil {
+		return *cached
+	}
+
+	settings := SessionSettings{
+		AbsoluteTimeout:   defaultSessionAbsoluteTimeout,
+		IdleTimeout:       defaultSessionIdleTimeout,
+		RememberMeTimeout: defaultSessionRememberMeTimeout,
+	}
+	if v, err := s.GetSystemConfig(ConfigKeySessionSettings); err == nil && v != "" {
+		var stored SessionSettings
+		if json.Unmarshal([]byte(v), &stored) == nil {
+			if stored.AbsoluteTimeout > 0 {
+				settings.AbsoluteTimeout = stored.AbsoluteTimeout
+			}
+			if stored.IdleTimeout >= 0 {
+				settings.IdleTimeout = stored.IdleTimeout
+			}
+			if stored.RememberMeTimeout > 0 {
+				settings.RememberMeTimeout = stored.RememberMeTimeout
+			}
+		}
+	}
+	s.sessionSettings.Store(&settings)
+	return settings
+}
+
+// SetSessionSettings 保存会话有效期设置，仅影响之后创建的会话的绝对有效期，空闲超时立即生效
+func (s *Service) SetSessionSettings(settings SessionSettings) error {
+	if settings.AbsoluteTimeout <= 0 || settings.RememberMeTimeout <= 0 {
+		return errors.New("会话有效期必须大于 0")
+	}
+	if settings.IdleTimeout < 0 {
+		return errors.New("空闲超时不能为负数")
+	}
+	if settings.RememberMeTimeout < settings.AbsoluteTimeout {
+		return errors.New("“记住我”的有效期不能短于普通会话")
+	}
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	return s.SetSystemConfig(ConfigKeySessionSettings, string(data), "会话有效期设置")
+}
+
+// ListUserSessions 列出用户当前有效的会话，currentSessionID 对应的会话标记为当前会话
+func (s *Service) ListUserSessions(username, currentSessionID string) ([]SessionInfo, error) {
+	rows, err := s.db.Query(`
+		SELECT id, sessionId, COALESCE(ipAddress, ''), COALESCE(userAgent, ''), createdAt,
+			lastSeenAt, expiresAt, rememberMe
+		FROM "UserSession"
+		WHERE username = ? AND isActive = 1
+		ORDER BY id DESC
+	`, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	settings := s.GetSessionSettings()
+	now := time.Now()
+	sessions := make([]SessionInfo, 0)
+	for rows.Next() {
+		var info SessionInfo
+		var sessionID string
+		var lastSeenAt sql.NullTime
+		if err := rows.Scan(&info.ID, &sessionID, &info.IP, &info.UserAgent, &info.CreatedAt,
+			&lastSeenAt, &info.ExpiresAt, &info.RememberMe); err != nil {
+			return nil, err
+		}
+		info.LastSeenAt = info.CreatedAt
+		if lastSeenAt.Valid {
+			info.LastSeenAt = lastSeenAt.Time
+		}
+		// 缓存中的最近活动时间可能比数据库更新
+		if v, ok := sessionCache.Load(sessionID); ok {
+			info.LastSeenAt = v.(Session).LastSeenAt
+		}
+		session := Session{IsActive: true, ExpiresAt: info.ExpiresAt, LastSeenAt: info.LastSeenAt}
+		if !sessionAlive(session, settings, now) {
+			continue
+		}
+		info.Current = sessionID == currentSessionID
+		sessions = append(sessions, info)
+	}
+	return sessions, rows.Err()
+}
+
+// RevokeUserSession 撤销用户自己的某个会话
+func (s *Service) RevokeUserSession(username string, id int64) error {
+	var sessionID string
+	err := s.db.QueryRow(`SELECT sessionId FROM "UserSession" WHERE id = ? AND username = ? AND isActive = 1`, id, username).Scan(&sessionID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return errors.New("会话不存在")
+		}
+		return err
+	}
+	s.DestroySession(sessionID)
+	return nil
+}
+
+// RevokeOtherSessions 撤销用户除当前会话外的所有会话，返回撤销数量
+func (s *Service) RevokeOtherSessions(username, currentSessionID string) (int, error) {
+	rows, err := s.db.Query(`SELECT sessionId FROM "UserSession" WHERE username = ? AND isActive = 1 AND sessionId != ?`, username, currentSessionID)
+	if err != nil {
+		return 0, err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		s.DestroySession(id)
+	}
+	return len(ids), nil
+}
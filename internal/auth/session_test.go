@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSessionAlive(t *testing.T) {
+	now := time.Now()
+	settings := SessionSettings{AbsoluteTimeout: 60, IdleTimeout: 10, RememberMeTimeout: 120}
+	cases := []struct {
+		name    string
+		session Session
+		want    bool
+	}{
+		{"active", Session{IsActive: true, ExpiresAt: now.Add(time.Hour), LastSeenAt: now.Add(-time.Minute)}, true},
+		{"revoked", Session{IsActive: false, ExpiresAt: now.Add(time.Hour), LastSeenAt: now}, false},
+		{"expired", Session{IsActive: true, ExpiresAt: now.Add(-time.Second), LastSeenAt: now}, false},
+		{"idle", Session{IsActive: true, ExpiresAt: now.Add(time.Hour), LastSeenAt: now.Add(-11 * time.Minute)}, false},
+	}
+	for _, c := range cases {
+		if got := sessionAlive(c.session, settings, now); got != c.want {
+			t.Errorf("%s: sessionAlive = %v, want %v", c.name, got, c.want)
+		}
+	}
+
+	// 未启用空闲超时时只看绝对有效期
+	settings.IdleTimeout = 0
+	if !sessionAlive(Session{IsActive: true, ExpiresAt: now.Add(time.Hour), LastSeenAt: now.Add(-24 * time.Hour)}, settings, now) {
+		t.Error("idle session should stay alive when idle timeout is disabled")
+	}
+}
+
+func TestSessionSettingsCachedUntilUpdated(t *testing.T) {
+	s := newTestService(t)
+
+	if got := s.GetSessionSettings(); got.AbsoluteTimeout != defaultSessionAbsoluteTimeout ||
+		got.IdleTimeout != defaultSessionIdleTimeout || got.RememberMeTimeout != defaultSessionRememberMeTimeout {
+		t.Fatalf("defaults = %+v", got)
+	}
+
+	// 绕过 SetSessionSettings 修改底层配置，缓存的设置不受影响
+	configCache.Store(ConfigKeySessionSettings, `{"absoluteTimeout":5,"idleTimeout":1,"rememberMeTimeout":5}`)
+	if got := s.GetSessionSettings(); got.AbsoluteTimeout != defaultSessionAbsoluteTimeout {
+		t.Fatalf("settings reloaded without update: %+v", got)
+	}
+
+	want := SessionSettings{AbsoluteTimeout: 60, IdleTimeout: 15, RememberMeTimeout: 600}
+	if err := s.SetSessionSettings(want); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.GetSessionSettings(); got != want {
+		t.Fatalf("settings after update = %+v, want %+v", got, want)
+	}
+}
+
+func TestSetSessionSettingsValidates(t *testing.T) {
+	s := newTestService(t)
+	invalid := []SessionSettings{
+		{AbsoluteTimeout: 0, RememberMeTimeout: 60},
+		{AbsoluteTimeout: 60, RememberMeTimeout: 0},
+		{AbsoluteTimeout: 60, IdleTimeout: -1, RememberMeTimeout: 60},
+		{AbsoluteTimeout: 120, RememberMeTimeout: 60},
+	}
+	for _, settings := range invalid {
+		if err := s.SetSessionSettings(settings); err == nil {
+			t.Errorf("SetSessionSettings(%+v) should fail", settings)
+		}
+	}
+}
+
+func TestCreateUserSessionUsesConfiguredTimeouts(t *testing.T) {
+	s := newTestService(t)
+	if err := s.SetSessionSettings(SessionSettings{AbsoluteTimeout: 60, RememberMeTimeout: 600}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		rememberMe bool
+		want       time.Duration
+	}{
+		{false, time.Hour},
+		{true, 10 * time.Hour},
+	} {
+		session, err := s.CreateUserSession("alice", SessionMeta{RememberMe: c.rememberMe})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d := time.Until(session.ExpiresAt); d > c.want || d < c.want-time.Minute {
+			t.Errorf("rememberMe=%v: expires in %v, want about %v", c.rememberMe, d, c.want)
+		}
+	}
+}
+
+func TestGetSessionEnforcesIdleTimeout(t *testing.T) {
+	s := newTestService(t)
+	session, err := s.CreateUserSession("alice", SessionMeta{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.GetSession(session.SessionID); !ok {
+		t.Fatal("new session should be valid")
+	}
+
+	// 开启空闲超时后立即作用于已有会话
+	if err := s.SetSessionSettings(SessionSettings{AbsoluteTimeout: 60, IdleTimeout: 5, RememberMeTimeout: 600}); err != nil {
+		t.Fatal(err)
+	}
+	idle := *session
+	idle.LastSeenAt = time.Now().Add(-10 * time.Minute)
+	sessionCache.Store(idle.SessionID, idle)
+
+	if _, ok := s.GetSession(session.SessionID); ok {
+		t.Fatal("idle session should be rejected")
+	}
+	var active bool
+	if err := s.db.QueryRow(`SELECT isActive FROM "UserSession" WHERE sessionId = ?`, session.SessionID).Scan(&active); err != nil {
+		t.Fatal(err)
+	}
+	if active {
+		t.Fatal("idle session should be marked inactive")
+	}
+}
@@ -0,0 +1,266 @@
+package auth
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// loginFreeAttempts 不触发退避的连续失败次数
+	loginFreeAttempts = 3
+	// loginBaseDelay 第一次退避的等待时间，之后每次失败翻倍
+	loginBaseDelay = time.Second
+	// loginMaxDelay 单次退避的最长等待时间
+	loginMaxDelay = time.Minute
+	// loginUserLockThreshold 同一用户名连续失败达到该次数后临时锁定
+	loginUserLockThreshold = 10
+	// loginIPLockThreshold 同一 IP 连续失败达到该次数后临时锁定
+	loginIPLockThreshold = 30
+	// loginLockDuration 临时锁定时长
+	loginLockDuration = 15 * time.Minute
+	// loginFailureWindow 超过该时间没有新的失败则清零计数
+	loginFailureWindow = 30 * time.Minute
+
+	lockoutKindIP       = "ip"
+	lockoutKindUsername = "username"
+)
+
+// loginFailure 单个 IP 或用户名的失败记录
+type loginFailure struct {
+	count       int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// nextAttempt 指数退避下允许再次尝试的时间
+func (f *loginFailure) nextAttempt() time.Time {
+	if f.count < loginFreeAttempts {
+		return time.Time{}
+	}
+	delay := loginBaseDelay << uint(f.count-loginFreeAttempts)
+	if delay > loginMaxDelay || delay <= 0 {
+		delay = loginMaxDelay
+	}
+	return f.lastFailure.Add(delay)
+}
+
+// expired 计数是否已过期且未处于锁定状态
+func (f *loginFailure) expired(now time.Time) bool {
+	return now.After(f.lockedUntil) && now.Sub(f.lastFailure) > loginFailureWindow
+}
+
+var (
+	// 内存中的登录失败记录，key: kind + ":" + value
+	loginFailures   = map[string]*loginFailure{}
+	loginFailuresMu sync.Mutex
+)
+
+// LoginThrottleError 登录被限流或锁定时返回的错误，RetryAfter 为需要等待的时间
+type LoginThrottleError struct {
+	Locked     bool
+	RetryAfter time.Duration
+}
+
+func (e *LoginThrottleError) Error() string {
+	wait := e.RetryAfter.Round(time.Second)
+	if wait < time.Second {
+		wait = time.Second
+	}
+	if e.Locked {
+		return fmt.Sprintf("登录失败次数过多，账户已临时锁定，请 %s 后重试", wait)
+	}
+	return fmt.Sprintf("登录尝试过于频繁，请 %s 后重试", wait)
+}
+
+func lockoutKey(kind, value string) string {
+	if kind == lockoutKindUsername {
+		value = strings.ToLower(strings.TrimSpace(value))
+	}
+	return kind + ":" + value
+}
+
+// LoginAttempt 已预占的一次登录尝试，凭据校验通过后调用 Release 撤销其计数
+type LoginAttempt struct {
+	at    time.Time
+	slots []attemptSlot
+}
+
+// attemptSlot 预占前单个计数的状态，用于撤销
+type attemptSlot struct {
+	key         string
+	failure     *loginFailure
+	count       int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// ReserveLoginAttempt 在校验凭据前检查 IP 与用户名是否处于退避或锁定期，未被限制时
+// 在同一把锁内先按失败计入本次尝试，使并发请求无法同时通过检查；校验失败时无需再记录，
+// 校验通过后调用 Release 撤销。返回 *LoginThrottleError 表示本次尝试应被拒绝
+func (s *Service) ReserveLoginAttempt(ip, username string) (*LoginAttempt, error) {
+	now := time.Now()
+	keys := throttleKeys(ip, username)
+	loginFailuresMu.Lock()
+	defer loginFailuresMu.Unlock()
+
+	var lockWait, delayWait time.Duration
+	for _, key := range keys {
+		f, ok := loginFailures[key]
+		if !ok {
+			continue
+		}
+		if f.expired(now) {
+			delete(loginFailures, key)
+			continue
+		}
+		if wait := f.lockedUntil.Sub(now); wait > lockWait {
+			lockWait = wait
+		}
+		if wait := f.nextAttempt().Sub(now); wait > delayWait {
+			delayWait = wait
+		}
+	}
+
+	switch {
+	case lockWait > 0:
+		return nil, &LoginThrottleError{Locked: true, RetryAfter: lockWait}
+	case delayWait > 0:
+		return nil, &LoginThrottleError{RetryAfter: delayWait}
+	}
+
+	// 顺带清理过期记录，避免伪造大量用户名撑爆内存
+	if len(loginFailures) > 1024 {
+		for key, f := range loginFailures {
+			if f.expired(now) {
+				delete(loginFailures, key)
+			}
+		}
+	}
+
+	attempt := &LoginAttempt{at: now, slots: make([]attemptSlot, 0, len(keys))}
+	for _, key := range keys {
+		f, ok := loginFailures[key]
+		if !ok {
+			f = &loginFailure{}
+			loginFailures[key] = f
+		}
+		attempt.slots = append(attempt.slots, attemptSlot{
+			key:         key,
+			failure:     f,
+			count:       f.count,
+			lastFailure: f.lastFailure,
+			lockedUntil: f.lockedUntil,
+		})
+		f.count++
+		f.lastFailure = now
+
+		threshold := loginIPLockThreshold
+		if strings.HasPrefix(key, lockoutKindUsername+":") {
+			threshold = loginUserLockThreshold
+		}
+		if f.count >= threshold && now.After(f.lockedUntil) {
+			f.lockedUntil = now.Add(loginLockDuration)
+			// 锁定后重新计数，解锁后再失败 threshold 次才会再次锁定
+			f.count = 0
+		}
+	}
+	return attempt, nil
+}
+
+// Release 凭据校验通过后撤销预占的计数；其后已有新的尝试时只减少计数，不回退时间与锁定
+func (a *LoginAttempt) Release() {
+	if a == nil {
+		return
+	}
+	loginFailuresMu.Lock()
+	defer loginFailuresMu.Unlock()
+
+	for _, slot := range a.slots {
+		f, ok := loginFailures[slot.key]
+		if !ok || f != slot.failure {
+			continue
+		}
+		if f.lastFailure.Equal(a.at) {
+			f.count = slot.count
+			f.lastFailure = slot.lastFailure
+			f.lockedUntil = slot.lockedUntil
+		} else if f.count > 0 {
+			f.count--
+		}
+		if f.count == 0 && f.lastFailure.IsZero() {
+			delete(loginFailures, slot.key)
+		}
+	}
+}
+
+// RecordLoginSuccess 登录成功后清除该用户名的失败计数；
+// IP 计数不清除，防止攻击者用自己的账户登录来重置对其他账户的猜测
+func (s *Service) RecordLoginSuccess(username string) {
+	loginFailuresMu.Lock()
+	delete(loginFailures, lockoutKey(lockoutKindUsername, username))
+	loginFailuresMu.Unlock()
+}
+
+// ListLoginLockouts 列出当前仍有效的登录失败计数及锁定状态
+func (s *Service) ListLoginLockouts() []LoginLockout {
+	now := time.Now()
+	loginFailuresMu.Lock()
+	defer loginFailuresMu.Unlock()
+
+	list := make([]LoginLockout, 0, len(loginFailures))
+	for key, f := range loginFailures {
+		if f.expired(now) {
+			delete(loginFailures, key)
+			continue
+		}
+		parts := strings.SplitN(key, ":", 2)
+		item := LoginLockout{
+			Kind:          parts[0],
+			Value:         parts[1],
+			Failures:      f.count,
+			LastFailureAt: f.lastFailure,
+		}
+		if next := f.nextAttempt(); now.Before(next) {
+			item.NextAttemptAt = &next
+		}
+		if now.Before(f.lockedUntil) {
+			until := f.lockedUntil
+			item.LockedUntil = &until
+		}
+		list = append(list, item)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].LastFailureAt.After(list[j].LastFailureAt)
+	})
+	return list
+}
+
+// UnlockLogin 清除指定 IP 或用户名的失败计数与锁定，返回是否存在对应记录
+func (s *Service) UnlockLogin(ip, username string) bool {
+	loginFailuresMu.Lock()
+	defer loginFailuresMu.Unlock()
+
+	found := false
+	for _, key := range throttleKeys(ip, username) {
+		if _, ok := loginFailures[key]; ok {
+			delete(loginFailures, key)
+			found = true
+		}
+	}
+	return found
+}
+
+// throttleKeys 返回需要检查的计数键，空值跳过
+func throttleKeys(ip, username string) []string {
+	keys := make([]string, 0, 2)
+	if ip != "" {
+		keys = append(keys, lockoutKey(lockoutKindIP, ip))
+	}
+	if strings.TrimSpace(username) != "" {
+		keys = append(keys, lockoutKey(lockoutKindUsername, username))
+	}
+	return keys
+}
@@ -0,0 +1,138 @@
+package auth
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// resetLoginFailures 清空内存中的登录失败记录
+func resetLoginFailures(t *testing.T) {
+	t.Helper()
+	loginFailuresMu.Lock()
+	loginFailures = map[string]*loginFailure{}
+	loginFailuresMu.Unlock()
+	t.Cleanup(func() {
+		loginFailuresMu.Lock()
+		loginFailures = map[string]*loginFailure{}
+		loginFailuresMu.Unlock()
+	})
+}
+
+func TestReserveLoginAttemptConcurrent(t *testing.T) {
+	resetLoginFailures(t)
+	s := &Service{}
+
+	const n = 50
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	allowed := 0
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := s.ReserveLoginAttempt("10.0.0.1", "alice"); err == nil {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	// 只有不触发退避的次数能通过，其余并发请求在同一把锁内被拒绝
+	if allowed != loginFreeAttempts {
+		t.Fatalf("allowed = %d, want %d", allowed, loginFreeAttempts)
+	}
+}
+
+func TestReserveLoginAttemptBacksOff(t *testing.T) {
+	resetLoginFailures(t)
+	s := &Service{}
+
+	for i := 0; i < loginFreeAttempts; i++ {
+		if _, err := s.ReserveLoginAttempt("10.0.0.1", "alice"); err != nil {
+			t.Fatalf("attempt %d: %v", i, err)
+		}
+	}
+	_, err := s.ReserveLoginAttempt("10.0.0.1", "alice")
+	var throttled *LoginThrottleError
+	if !errors.As(err, &throttled) || throttled.Locked || throttled.RetryAfter <= 0 {
+		t.Fatalf("err = %v, want backoff", err)
+	}
+
+	// 其他 IP 尝试同一用户名同样受限
+	if _, err := s.ReserveLoginAttempt("10.0.0.2", "ALICE "); err == nil {
+		t.Fatal("username backoff should apply across IPs")
+	}
+}
+
+func TestReleaseLoginAttemptUndoesCount(t *testing.T) {
+	resetLoginFailures(t)
+	s := &Service{}
+
+	attempt, err := s.ReserveLoginAttempt("10.0.0.1", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	attempt.Release()
+	if list := s.ListLoginLockouts(); len(list) != 0 {
+		t.Fatalf("lockouts after release = %+v, want none", list)
+	}
+
+	// 失败记录保留，成功的一次不计入
+	if _, err := s.ReserveLoginAttempt("10.0.0.1", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	attempt, err = s.ReserveLoginAttempt("10.0.0.1", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	attempt.Release()
+	for _, item := range s.ListLoginLockouts() {
+		if item.Failures != 1 {
+			t.Fatalf("%s failures = %d, want 1", item.Kind, item.Failures)
+		}
+	}
+}
+
+func TestReserveLoginAttemptLocksUser(t *testing.T) {
+	resetLoginFailures(t)
+	s := &Service{}
+
+	// 模拟此前已失败 threshold-1 次且退避时间已过
+	key := lockoutKey(lockoutKindUsername, "alice")
+	loginFailures[key] = &loginFailure{count: loginUserLockThreshold - 1, lastFailure: time.Now().Add(-2 * loginMaxDelay)}
+
+	attempt, err := s.ReserveLoginAttempt("10.0.0.1", "alice")
+	if err != nil {
+		t.Fatalf("last attempt before lock: %v", err)
+	}
+	_, err = s.ReserveLoginAttempt("10.0.0.2", "alice")
+	var throttled *LoginThrottleError
+	if !errors.As(err, &throttled) || !throttled.Locked {
+		t.Fatalf("err = %v, want lockout", err)
+	}
+
+	// 触发锁定的那次尝试校验通过时撤销锁定
+	attempt.Release()
+	if _, err := s.ReserveLoginAttempt("10.0.0.3", "alice"); err != nil {
+		t.Fatalf("after release: %v", err)
+	}
+}
+
+func TestRecordLoginSuccessKeepsIPCount(t *testing.T) {
+	resetLoginFailures(t)
+	s := &Service{}
+
+	if _, err := s.ReserveLoginAttempt("10.0.0.1", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	s.RecordLoginSuccess("alice")
+
+	list := s.ListLoginLockouts()
+	if len(list) != 1 || list[0].Kind != lockoutKindIP {
+		t.Fatalf("lockouts = %+v, want only the IP entry", list)
+	}
+}
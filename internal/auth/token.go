@@ -0,0 +1,178 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+)
+
+// apiTokenPrefix 令牌明文前缀，便于在日志和密钥扫描中识别
+const apiTokenPrefix = "npd_"
+
+// hashAPIToken 计算令牌明文的 SHA-256 摘要，数据库只保存摘要
+func hashAPIToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// validScope 检查权限范围是否合法
+func validScope(scope string) bool {
+	for _, s := range AllScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateAPIToken 为指定用户创建 API 令牌，返回仅此一次可见的明文
+func (s *Service) CreateAPIToken(username string, req CreateAPITokenRequest) (string, *APIToken, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return "", nil, errors.New("令牌名称不能为空")
+	}
+	if len(req.Scopes) == 0 {
+		return "", nil, errors.New("至少需要一个权限范围")
+	}
+	for _, scope := range req.Scopes {
+		if !validScope(scope) {
+			return "", nil, errors.New("无效的权限范围: " + scope)
+		}
+	}
+	if req.ExpiresAt != nil && req.ExpiresAt.Before(time.Now()) {
+		return "", nil, errors.New("过期时间不能早于当前时间")
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", nil, err
+	}
+	raw := apiTokenPrefix + hex.EncodeToString(buf)
+	prefix := raw[:len(apiTokenPrefix)+8]
+
+	now := time.Now()
+	var expiresAt interface{}
+	if req.ExpiresAt != nil {
+		expiresAt = *req.ExpiresAt
+	}
+	result, err := s.db.Exec(`
+		INSERT INTO "ApiToken" (name, tokenHash, prefix, username, scopes, expiresAt, createdAt, revoked)
+		VALUES (?, ?, ?, ?, ?, ?, ?, 0)
+	`, name, hashAPIToken(raw), prefix, username, strings.Join(req.Scopes, ","), expiresAt, now)
+	if err != nil {
+		return "", nil, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return "", nil, err
+	}
+
+	return raw, &APIToken{
+		ID:        id,
+		Name:      name,
+		Prefix:    prefix,
+		Username:  username,
+		Scopes:    req.Scopes,
+		ExpiresAt: req.ExpiresAt,
+		CreatedAt: now,
+	}, nil
+}
+
+// ListAPITokens 列出所有 API 令牌（不含明文）
+func (s *Service) ListAPITokens() ([]APIToken, error) {
+	rows, err := s.db.Query(`
+		SELECT id, name, prefix, username, scopes, expiresAt, lastUsedAt, createdAt, revoked
+		FROM "ApiToken" ORDER BY createdAt DESC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := make([]APIToken, 0)
+	for rows.Next() {
+		var t APIToken
+		var scopes string
+		var expiresAt, lastUsedAt sql.NullTime
+		if err := rows.Scan(&t.ID, &t.Name, &t.Prefix, &t.Username, &scopes, &expiresAt, &lastUsedAt, &t.CreatedAt, &t.Revoked); err != nil {
+			return nil, err
+		}
+		t.Scopes = splitScopes(scopes)
+		if expiresAt.Valid {
+			t.ExpiresAt = &expiresAt.Time
+		}
+		if lastUsedAt.Valid {
+			t.LastUsedAt = &lastUsedAt.Time
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, nil
+}
+
+// RevokeAPIToken 吊销 API 令牌
+func (s *Service) RevokeAPIToken(id int64) error {
+	res, err := s.db.Exec(`UPDATE "ApiToken" SET revoked = 1 WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return errors.New("令牌不存在")
+	}
+	return nil
+}
+
+// AuthenticateToken 校验 Bearer 令牌并返回对应的调用方信息，同时刷新最后使用时间
+func (s *Service) AuthenticateToken(raw string) (*Principal, bool) {
+	if !strings.HasPrefix(raw, apiTokenPrefix) {
+		return nil, false
+	}
+
+	var id int64
+	var username, scopes string
+	var expiresAt sql.NullTime
+	var revoked bool
+	err := s.db.QueryRow(`SELECT id, username, scopes, expiresAt, revoked FROM "ApiToken" WHERE tokenHash = ?`, hashAPIToken(raw)).
+		Scan(&id, &username, &scopes, &expiresAt, &revoked)
+	if err != nil {
+		return nil, false
+	}
+	if revoked || (expiresAt.Valid && time.Now().After(expiresAt.Time)) {
+		return nil, false
+	}
+
+	// 令牌继承创建者当前的角色，创建者被禁用或删除后令牌随之失效
+	user, err := s.GetUserByUsername(username)
+	if err != nil || user.Disabled {
+		return nil, false
+	}
+
+	_, _ = s.db.Exec(`UPDATE "ApiToken" SET lastUsedAt = ? WHERE id = ?`, time.Now(), id)
+
+	return &Principal{
+		UserID:   user.ID,
+		Username: username,
+		Role:     user.Role,
+		AuthType: AuthTypeToken,
+		TokenID:  id,
+		Scopes:   splitScopes(scopes),
+	}, true
+}
+
+// splitScopes 解析以逗号分隔的权限范围
+func splitScopes(raw string) []string {
+	scopes := make([]string, 0)
+	for _, s := range strings.Split(raw, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes
+}
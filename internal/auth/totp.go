@@ -0,0 +1,392 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"database/sql"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// totpIssuer 认证器 App 中显示的发行方名称
+	totpIssuer = "NodePassDash"
+	// totpPeriod RFC 6238 时间步长（秒）
+	totpPeriod = 30
+	// totpDigits 动态码位数
+	totpDigits = 6
+	// totpSkew 允许前后偏移的时间步数，容忍客户端时钟误差
+	totpSkew = 1
+	// recoveryCodeCount 每次生成的恢复码数量
+	recoveryCodeCount = 10
+	// loginChallengeTTL 两步验证登录挑战的有效期
+	loginChallengeTTL = 5 * time.Minute
+	// loginChallengeMaxAttempts 单个挑战允许的最大尝试次数
+	loginChallengeMaxAttempts = 5
+)
+
+// loginChallenge 密码校验通过、等待第二步验证的登录挑战
+type loginChallenge struct {
+	username  string
+	expiresAt time.Time
+	attempts  int
+}
+
+var (
+	// 内存中的两步验证登录挑战，key: challenge ID
+	loginChallenges   = map[string]*loginChallenge{}
+	loginChallengesMu sync.Mutex
+)
+
+// generateTOTPSecret 生成 160 位随机密钥，以无填充 Base32 编码
+func generateTOTPSecret() (string, error) {
+	buf := make([]byte, 20)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(buf), nil
+}
+
+// totpCode 按 RFC 6238 / RFC 4226 计算指定时间步的动态码
+func totpCode(secret string, counter uint64) (string, error) {
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000), nil
+}
+
+// validateTOTP 校验动态码，返回匹配的时间步；lastCounter 之前（含）的时间步视为已使用，防止重放
+func validateTOTP(secret, code string, lastCounter int64, now time.Time) (int64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != totpDigits {
+		return 0, false
+	}
+	current := now.Unix() / totpPeriod
+	for i := -totpSkew; i <= totpSkew; i++ {
+		counter := current + int64(i)
+		if counter <= lastCounter {
+			continue
+		}
+		expected, err := totpCode(secret, uint64(counter))
+		if err != nil {
+			return 0, false
+		}
+		if hmac.Equal([]byte(expected), []byte(code)) {
+			return counter, true
+		}
+	}
+	return 0, false
+}
+
+// totpProvisioningURI 生成认证器 App 扫码使用的 otpauth:// 地址
+func totpProvisioningURI(username, secret string) string {
+	label := url.PathEscape(totpIssuer + ":" + username)
+	q := url.Values{}
+	q.Set("secret", secret)
+	q.Set("issuer", totpIssuer)
+	q.Set("algorithm", "SHA1")
+	q.Set("digits", fmt.Sprintf("%d", totpDigits))
+	q.Set("period", fmt.Sprintf("%d", totpPeriod))
+	return "otpauth://totp/" + label + "?" + q.Encode()
+}
+
+// getTOTP 读取用户的两步验证配置
+func (s *Service) getTOTP(username string) (id int64, secret string, enabled bool, lastCounter int64, err error) {
+	err = s.db.QueryRow(`SELECT id, totpSecret, totpEnabled, totpLastCounter FROM "User" WHERE username = ?`, username).
+		Scan(&id, &secret, &enabled, &lastCounter)
+	if err == sql.ErrNoRows {
+		err = errors.New("用户不存在")
+	}
+	return
+}
+
+// IsTOTPEnabled 判断用户是否已启用两步验证
+func (s *Service) IsTOTPEnabled(username string) bool {
+	_, _, enabled, _, err := s.getTOTP(username)
+	return err == nil && enabled
+}
+
+// GetTOTPStatus 获取用户两步验证状态
+func (s *Service) GetTOTPStatus(username string) (*TOTPStatus, error) {
+	id, _, enabled, _, err := s.getTOTP(username)
+	if err != nil {
+		return nil, err
+	}
+	status := &TOTPStatus{Enabled: enabled}
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM "RecoveryCode" WHERE userId = ? AND usedAt IS NULL`, id).
+		Scan(&status.RecoveryCodesRemaining); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// SetupTOTP 生成新的待确认密钥；启用前可重复调用，已启用时需先关闭
+func (s *Service) SetupTOTP(username string) (*TOTPSetup, error) {
+	_, _, enabled, _, err := s.getTOTP(username)
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		return nil, errors.New("两步验证已启用，如需更换请先关闭")
+	}
+
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.db.Exec(`UPDATE "User" SET totpSecret = ?, totpLastCounter = 0, updatedAt = CURRENT_TIMESTAMP WHERE username = ?`, secret, username); err != nil {
+		return nil, err
+	}
+
+	return &TOTPSetup{
+		Secret:          secret,
+		ProvisioningURI: totpProvisioningURI(username, secret),
+	}, nil
+}
+
+// EnableTOTP 使用认证器生成的动态码确认并启用两步验证，返回仅此一次可见的恢复码
+func (s *Service) EnableTOTP(username, code string) ([]string, error) {
+	id, secret, enabled, lastCounter, err := s.getTOTP(username)
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		return nil, errors.New("两步验证已启用")
+	}
+	if secret == "" {
+		return nil, errors.New("请先生成两步验证密钥")
+	}
+
+	counter, ok := validateTOTP(secret, code, lastCounter, time.Now())
+	if !ok {
+		return nil, errors.New("动态码错误")
+	}
+
+	if err := s.claimTOTPCounter(id, counter); err != nil {
+		return nil, err
+	}
+	if _, err := s.db.Exec(`UPDATE "User" SET totpEnabled = 1, updatedAt = CURRENT_TIMESTAMP WHERE id = ?`, id); err != nil {
+		return nil, err
+	}
+	return s.regenerateRecoveryCodes(id)
+}
+
+// DisableTOTP 关闭两步验证，需要当前密码以及动态码或恢复码
+func (s *Service) DisableTOTP(username, password, code string) error {
+	if !s.AuthenticateUser(username, password) {
+		return errors.New("密码错误")
+	}
+	if err := s.verifySecondFactor(username, code); err != nil {
+		return err
+	}
+	return s.ResetTOTP(username)
+}
+
+// RegenerateRecoveryCodes 校验动态码后重新生成恢复码，旧恢复码全部作废
+func (s *Service) RegenerateRecoveryCodes(username, code string) ([]string, error) {
+	id, secret, enabled, lastCounter, err := s.getTOTP(username)
+	if err != nil {
+		return nil, err
+	}
+	if !enabled {
+		return nil, errors.New("两步验证未启用")
+	}
+	counter, ok := validateTOTP(secret, code, lastCounter, time.Now())
+	if !ok {
+		return nil, errors.New("动态码错误")
+	}
+	if err := s.claimTOTPCounter(id, counter); err != nil {
+		return nil, err
+	}
+	return s.regenerateRecoveryCodes(id)
+}
+
+// ResetTOTP 清除用户的两步验证配置与恢复码（供关闭操作及 --reset-2fa 使用）
+func (s *Service) ResetTOTP(username string) error {
+	id, _, _, _, err := s.getTOTP(username)
+	if err != nil {
+		return err
+	}
+	if _, err := s.db.Exec(`UPDATE "User" SET totpSecret = '', totpEnabled = 0, totpLastCounter = 0, updatedAt = CURRENT_TIMESTAMP WHERE id = ?`, id); err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`DELETE FROM "RecoveryCode" WHERE userId = ?`, id)
+	return err
+}
+
+// regenerateRecoveryCodes 生成新的恢复码，数据库仅保存 bcrypt 哈希
+func (s *Service) regenerateRecoveryCodes(userID int64) ([]string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		buf := make([]byte, 5)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, err
+		}
+		raw := hex.EncodeToString(buf)
+		code := raw[:5] + "-" + raw[5:]
+		hash, err := s.HashPassword(code)
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+		hashes = append(hashes, hash)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM "RecoveryCode" WHERE userId = ?`, userID); err != nil {
+		return nil, err
+	}
+	for _, hash := range hashes {
+		if _, err := tx.Exec(`INSERT INTO "RecoveryCode" (userId, codeHash, createdAt) VALUES (?, ?, CURRENT_TIMESTAMP)`, userID, hash); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// useRecoveryCode 校验并消耗（删除）一个恢复码
+func (s *Service) useRecoveryCode(userID int64, code string) bool {
+	code = strings.ToLower(strings.TrimSpace(code))
+	rows, err := s.db.Query(`SELECT id, codeHash FROM "RecoveryCode" WHERE userId = ? AND usedAt IS NULL`, userID)
+	if err != nil {
+		return false
+	}
+	var matched int64
+	for rows.Next() {
+		var id int64
+		var hash string
+		if err := rows.Scan(&id, &hash); err != nil {
+			continue
+		}
+		if matched == 0 && s.VerifyPassword(code, hash) {
+			matched = id
+		}
+	}
+	rows.Close()
+	if matched == 0 {
+		return false
+	}
+
+	// 条件删除保证并发提交同一恢复码时只有一个请求成功
+	res, err := s.db.Exec(`DELETE FROM "RecoveryCode" WHERE id = ? AND usedAt IS NULL`, matched)
+	if err != nil {
+		return false
+	}
+	affected, err := res.RowsAffected()
+	return err == nil && affected == 1
+}
+
+// claimTOTPCounter 记录已使用的时间步；仅当其大于已记录的时间步时更新成功，
+// 并发提交同一动态码时只有一个请求通过
+func (s *Service) claimTOTPCounter(userID, counter int64) error {
+	res, err := s.db.Exec(`UPDATE "User" SET totpLastCounter = ? WHERE id = ? AND totpLastCounter < ?`, counter, userID, counter)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return errors.New("动态码已使用")
+	}
+	return nil
+}
+
+// verifySecondFactor 校验动态码或恢复码
+func (s *Service) verifySecondFactor(username, code string) error {
+	id, secret, enabled, lastCounter, err := s.getTOTP(username)
+	if err != nil {
+		return err
+	}
+	if !enabled {
+		return errors.New("两步验证未启用")
+	}
+
+	if counter, ok := validateTOTP(secret, code, lastCounter, time.Now()); ok {
+		return s.claimTOTPCounter(id, counter)
+	}
+	if s.useRecoveryCode(id, code) {
+		return nil
+	}
+	return errors.New("动态码或恢复码错误")
+}
+
+// CreateLoginChallenge 密码校验通过后为启用两步验证的用户创建登录挑战
+func (s *Service) CreateLoginChallenge(username string) string {
+	loginChallengesMu.Lock()
+	defer loginChallengesMu.Unlock()
+
+	// 顺带清理过期挑战
+	now := time.Now()
+	for id, c := range loginChallenges {
+		if now.After(c.expiresAt) {
+			delete(loginChallenges, id)
+		}
+	}
+
+	id := uuid.New().String()
+	loginChallenges[id] = &loginChallenge{username: username, expiresAt: now.Add(loginChallengeTTL)}
+	return id
+}
+
+// CompleteLoginChallenge 校验登录挑战的第二步，成功后返回用户名；
+// 挑战过期或失败次数过多后失效，需要重新输入密码
+func (s *Service) CompleteLoginChallenge(challengeID, code string) (string, error) {
+	loginChallengesMu.Lock()
+	c, ok := loginChallenges[challengeID]
+	if ok && time.Now().After(c.expiresAt) {
+		delete(loginChallenges, challengeID)
+		ok = false
+	}
+	if !ok {
+		loginChallengesMu.Unlock()
+		return "", errors.New("登录已过期，请重新输入密码")
+	}
+	c.attempts++
+	if c.attempts > loginChallengeMaxAttempts {
+		delete(loginChallenges, challengeID)
+		loginChallengesMu.Unlock()
+		return "", errors.New("尝试次数过多，请重新输入密码")
+	}
+	username := c.username
+	loginChallengesMu.Unlock()
+
+	if err := s.verifySecondFactor(username, code); err != nil {
+		return "", err
+	}
+
+	loginChallengesMu.Lock()
+	delete(loginChallenges, challengeID)
+	loginChallengesMu.Unlock()
+	return username, nil
+}
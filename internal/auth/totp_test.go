@@ -0,0 +1,119 @@
+package auth
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// enableTestTOTP 创建用户并启用两步验证，返回密钥及恢复码
+func enableTestTOTP(t *testing.T, s *Service, username string) (string, []string) {
+	t.Helper()
+	if _, err := s.CreateUser(CreateUserRequest{Username: username, Password: "secret123", Role: RoleViewer}); err != nil {
+		t.Fatal(err)
+	}
+	setup, err := s.SetupTOTP(username)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 启用时使用上一个时间步，留出当前时间步供后续校验
+	code, err := totpCode(setup.Secret, uint64(time.Now().Unix()/totpPeriod-1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	codes, err := s.EnableTOTP(username, code)
+	if err != nil {
+		t.Fatalf("EnableTOTP: %v", err)
+	}
+	return setup.Secret, codes
+}
+
+func TestTOTPCodeCannotBeReplayed(t *testing.T) {
+	s := newTestService(t)
+	secret, _ := enableTestTOTP(t, s, "alice")
+
+	code, err := totpCode(secret, uint64(time.Now().Unix()/totpPeriod))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.verifySecondFactor("alice", code); err != nil {
+		t.Fatalf("first use: %v", err)
+	}
+	if err := s.verifySecondFactor("alice", code); err == nil {
+		t.Fatal("replayed code should be rejected")
+	}
+}
+
+func TestTOTPConcurrentSubmissionsAcceptOnce(t *testing.T) {
+	s := newTestService(t)
+	secret, _ := enableTestTOTP(t, s, "bob")
+
+	code, err := totpCode(secret, uint64(time.Now().Unix()/totpPeriod))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const n = 8
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	accepted := 0
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if s.verifySecondFactor("bob", code) == nil {
+				mu.Lock()
+				accepted++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if accepted != 1 {
+		t.Fatalf("accepted = %d, want 1", accepted)
+	}
+}
+
+func TestClaimTOTPCounterRejectsStaleCounter(t *testing.T) {
+	s := newTestService(t)
+	enableTestTOTP(t, s, "carol")
+	user, err := s.GetUserByUsername("carol")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 模拟两个请求读取到相同的 lastCounter 后先后提交
+	counter := time.Now().Unix()/totpPeriod + 1
+	if err := s.claimTOTPCounter(user.ID, counter); err != nil {
+		t.Fatalf("first claim: %v", err)
+	}
+	if err := s.claimTOTPCounter(user.ID, counter); err == nil {
+		t.Fatal("second claim of the same counter should fail")
+	}
+	if err := s.claimTOTPCounter(user.ID, counter-1); err == nil {
+		t.Fatal("claim of an older counter should fail")
+	}
+}
+
+func TestRecoveryCodeUsableOnce(t *testing.T) {
+	s := newTestService(t)
+	_, codes := enableTestTOTP(t, s, "dave")
+	if len(codes) == 0 {
+		t.Fatal("no recovery codes generated")
+	}
+
+	if err := s.verifySecondFactor("dave", codes[0]); err != nil {
+		t.Fatalf("first use: %v", err)
+	}
+	if err := s.verifySecondFactor("dave", codes[0]); err == nil {
+		t.Fatal("recovery code should only be usable once")
+	}
+
+	status, err := s.GetTOTPStatus("dave")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.RecoveryCodesRemaining != len(codes)-1 {
+		t.Fatalf("recovery codes left = %d, want %d", status.RecoveryCodesRemaining, len(codes)-1)
+	}
+}
@@ -0,0 +1,323 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+)
+
+// EnsureAdminUser 将旧版保存在 SystemConfig 中的管理员迁移到 User 表（仅在 User 表为空时执行）
+func (s *Service) EnsureAdminUser() error {
+	var count int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM "User"`).Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	username, _ := s.GetSystemConfig(ConfigKeyAdminUsername)
+	passwordHash, _ := s.GetSystemConfig(ConfigKeyAdminPassword)
+	if username == "" || passwordHash == "" {
+		return nil
+	}
+
+	_, err := s.db.Exec(`
+		INSERT INTO "User" (username, passwordHash, role, disabled, createdAt, updatedAt)
+		VALUES (?, ?, ?, 0, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+	`, username, passwordHash, RoleAdmin)
+	return err
+}
+
+// getUser 根据用户名查询用户及其密码哈希
+func (s *Service) getUser(username string) (*User, string, error) {
+	var u User
+	var passwordHash string
+	err := s.db.QueryRow(`SELECT id, username, passwordHash, role, disabled, createdAt, updatedAt FROM "User" WHERE username = ?`, username).
+		Scan(&u.ID, &u.Username, &passwordHash, &u.Role, &u.Disabled, &u.CreatedAt, &u.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, "", errors.New("用户不存在")
+		}
+		return nil, "", err
+	}
+	u.HasPasswd = passwordHash != ""
+	return &u, passwordHash, nil
+}
+
+// GetUserByUsername 根据用户名获取用户
+func (s *Service) GetUserByUsername(username string) (*User, error) {
+	u, _, err := s.getUser(username)
+	return u, err
+}
+
+// GetUserByID 根据 ID 获取用户
+func (s *Service) GetUserByID(id int64) (*User, error) {
+	var username string
+	if err := s.db.QueryRow(`SELECT username FROM "User" WHERE id = ?`, id).Scan(&username); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("用户不存在")
+		}
+		return nil, err
+	}
+	return s.GetUserByUsername(username)
+}
+
+// ListUsers 获取所有用户
+func (s *Service) ListUsers() ([]User, error) {
+	rows, err := s.db.Query(`SELECT id, username, passwordHash != '', role, disabled, createdAt, updatedAt FROM "User" ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := make([]User, 0)
+	for rows.Next() {
+		var u User
+		if err := rows.Scan(&u.ID, &u.Username, &u.HasPasswd, &u.Role, &u.Disabled, &u.CreatedAt, &u.UpdatedAt); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, nil
+}
+
+// CreateUser 创建本地用户，密码为空表示仅允许第三方登录
+func (s *Service) CreateUser(req CreateUserRequest) (*User, error) {
+	username := strings.TrimSpace(req.Username)
+	if username == "" {
+		return nil, errors.New("用户名不能为空")
+	}
+	if !req.Role.Valid() {
+		return nil, errors.New("无效的角色")
+	}
+	if _, err := s.GetUserByUsername(username); err == nil {
+		return nil, errors.New("用户名已存在")
+	}
+
+	passwordHash := ""
+	if req.Password != "" {
+		hash, err := s.HashPassword(req.Password)
+		if err != nil {
+			return nil, err
+		}
+		passwordHash = hash
+	}
+
+	if _, err := s.db.Exec(`
+		INSERT INTO "User" (username, passwordHash, role, disabled, createdAt, updatedAt)
+		VALUES (?, ?, ?, 0, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+	`, username, passwordHash, req.Role); err != nil {
+		return nil, err
+	}
+	return s.GetUserByUsername(username)
+}
+
+// UpdateUser 更新用户角色、密码或禁用状态
+func (s *Service) UpdateUser(id int64, req UpdateUserRequest) (*User, error) {
+	user, err := s.GetUserByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Role != "" && !req.Role.Valid() {
+		return nil, errors.New("无效的角色")
+	}
+
+	// 降级或禁用管理员时，至少保留一个可用的管理员
+	demote := req.Role != "" && req.Role != RoleAdmin
+	disable := req.Disabled != nil && *req.Disabled
+	if user.Role == RoleAdmin && !user.Disabled && (demote || disable) {
+		if err := s.ensureOtherAdmin(id); err != nil {
+			return nil, err
+		}
+	}
+
+	if req.Role != "" {
+		if _, err := s.db.Exec(`UPDATE "User" SET role = ?, updatedAt = CURRENT_TIMESTAMP WHERE id = ?`, req.Role, id); err != nil {
+			return nil, err
+		}
+	}
+	if req.Password != "" {
+		hash, err := s.HashPassword(req.Password)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := s.db.Exec(`UPDATE "User" SET passwordHash = ?, updatedAt = CURRENT_TIMESTAMP WHERE id = ?`, hash, id); err != nil {
+			return nil, err
+		}
+		s.syncLegacyAdmin(user.Username, "", hash)
+		s.invalidateUserSessions(user.Username)
+	}
+	if req.Disabled != nil {
+		if _, err := s.db.Exec(`UPDATE "User" SET disabled = ?, updatedAt = CURRENT_TIMESTAMP WHERE id = ?`, *req.Disabled, id); err != nil {
+			return nil, err
+		}
+		if *req.Disabled {
+			s.invalidateUserSessions(user.Username)
+		}
+	}
+
+	return s.GetUserByID(id)
+}
+
+// DeleteUser 删除用户，并使其会话失效、解除第三方身份映射与工作区成员关系
+func (s *Service) DeleteUser(id int64) error {
+	user, err := s.GetUserByID(id)
+	if err != nil {
+		return err
+	}
+	if user.Role == RoleAdmin && !user.Disabled {
+		if err := s.ensureOtherAdmin(id); err != nil {
+			return err
+		}
+	}
+
+	if _, err := s.db.Exec(`DELETE FROM "User" WHERE id = ?`, id); err != nil {
+		return err
+	}
+	_, _ = s.db.Exec(`UPDATE "OAuthUser" SET userId = NULL WHERE userId = ?`, id)
+	_, _ = s.db.Exec(`DELETE FROM "WorkspaceMember" WHERE userId = ?`, id)
+	s.invalidateUserSessions(user.Username)
+	return nil
+}
+
+// ensureOtherAdmin 确认除指定用户外仍存在可用的管理员
+func (s *Service) ensureOtherAdmin(excludeID int64) error {
+	var count int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM "User" WHERE role = ? AND disabled = 0 AND id != ?`, RoleAdmin, excludeID).Scan(&count); err != nil {
+		return err
+	}
+	if count == 0 {
+		return errors.New("至少需要保留一个可用的管理员")
+	}
+	return nil
+}
+
+// syncLegacyAdmin 保持 SystemConfig 中的旧版管理员配置与 User 表一致
+func (s *Service) syncLegacyAdmin(username, newUsername, passwordHash string) {
+	legacy, _ := s.GetSystemConfig(ConfigKeyAdminUsername)
+	if legacy == "" || legacy != username {
+		return
+	}
+	if newUsername != "" {
+		_ = s.SetSystemConfig(ConfigKeyAdminUsername, newUsername, "管理员用户名")
+	}
+	if passwordHash != "" {
+		_ = s.SetSystemConfig(ConfigKeyAdminPassword, passwordHash, "管理员密码哈希")
+	}
+}
+
+// SetUserRole 按用户名设置角色（用于第三方登录的分组→角色同步）
+func (s *Service) SetUserRole(username string, role Role) error {
+	user, err := s.GetUserByUsername(username)
+	if err != nil {
+		return err
+	}
+	if user.Role == role {
+		return nil
+	}
+	_, err = s.UpdateUser(user.ID, UpdateUserRequest{Role: role})
+	return err
+}
+
+// ListOAuthIdentities 列出所有第三方登录身份及其映射的本地用户
+func (s *Service) ListOAuthIdentities() ([]OAuthIdentity, error) {
+	rows, err := s.db.Query(`
+		SELECT o.id, o.provider, o.providerId, o.username, o.userId, COALESCE(u.username, ''), o.status, o.createdAt, o.updatedAt
+		FROM "OAuthUser" o
+		LEFT JOIN "User" u ON o.userId = u.id
+		ORDER BY o.id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	identities := make([]OAuthIdentity, 0)
+	for rows.Next() {
+		var oi OAuthIdentity
+		var userID sql.NullInt64
+		if err := rows.Scan(&oi.ID, &oi.Provider, &oi.ProviderID, &oi.Username, &userID, &oi.LocalUsername, &oi.Status, &oi.CreatedAt, &oi.UpdatedAt); err != nil {
+			return nil, err
+		}
+		if userID.Valid {
+			oi.UserID = &userID.Int64
+		}
+		identities = append(identities, oi)
+	}
+	return identities, nil
+}
+
+// MapOAuthIdentity 将第三方登录身份映射到本地用户，userID 为 nil 表示解除映射
+func (s *Service) MapOAuthIdentity(identityID int64, userID *int64) error {
+	if userID != nil {
+		if _, err := s.GetUserByID(*userID); err != nil {
+			return err
+		}
+	}
+	res, err := s.db.Exec(`UPDATE "OAuthUser" SET userId = ?, updatedAt = CURRENT_TIMESTAMP WHERE id = ?`, userID, identityID)
+	if err != nil {
+		return err
+	}
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		return errors.New("OAuth 身份不存在")
+	}
+	return nil
+}
+
+// ErrOAuthUsernameTaken 未映射的第三方身份与已有本地账户同名，需管理员手动映射
+var ErrOAuthUsernameTaken = errors.New("已存在同名本地账户，请联系管理员映射该登录身份")
+
+// ResolveOAuthLogin 返回第三方身份登录后使用的本地用户名：
+// 仅通过 OAuthUser 映射关联本地用户；未映射时按 oauth2_default_role（默认只读）自动创建同名用户并建立映射，
+// 不会因同名而关联到已有账户
+func (s *Service) ResolveOAuthLogin(provider, providerID, oauthUsername string) (string, error) {
+	var identityID int64
+	var userID sql.NullInt64
+	err := s.db.QueryRow(`SELECT id, userId FROM "OAuthUser" WHERE provider = ? AND providerId = ?`, provider, providerID).Scan(&identityID, &userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", errors.New("OAuth 身份不存在")
+		}
+		return "", err
+	}
+	if userID.Valid {
+		user, err := s.GetUserByID(userID.Int64)
+		if err != nil {
+			return "", err
+		}
+		if user.Disabled {
+			return "", errors.New("该账户已被禁用")
+		}
+		return user.Username, nil
+	}
+
+	if _, err := s.GetUserByUsername(oauthUsername); err == nil {
+		return "", ErrOAuthUsernameTaken
+	}
+
+	role := RoleViewer
+	if v, _ := s.GetSystemConfig(ConfigKeyOAuthDefaultRole); Role(v).Valid() {
+		role = Role(v)
+	}
+	user, err := s.CreateUser(CreateUserRequest{Username: oauthUsername, Role: role})
+	if err != nil {
+		return "", err
+	}
+	if err := s.MapOAuthIdentity(identityID, &user.ID); err != nil {
+		return "", err
+	}
+	return user.Username, nil
+}
+
+// invalidateUserSessions 使指定用户的所有会话失效（数据库 + 缓存）
+func (s *Service) invalidateUserSessions(username string) {
+	_, _ = s.db.Exec(`UPDATE "UserSession" SET isActive = 0 WHERE username = ?`, username)
+	sessionCache.Range(func(key, value interface{}) bool {
+		if value.(Session).Username == username {
+			sessionCache.Delete(key)
+		}
+		return true
+	})
+}
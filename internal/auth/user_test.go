@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"NodePassDash/internal/db/dbtest"
+)
+
+// newTestService 创建使用临时数据库的 Service，并清空包级缓存避免测试之间相互影响
+func newTestService(t *testing.T) *Service {
+	t.Helper()
+	configCache = sync.Map{}
+	sessionCache = sync.Map{}
+	return NewService(dbtest.Open(t))
+}
+
+// saveIdentity 登记一个已批准的第三方身份
+func saveIdentity(t *testing.T, s *Service, provider, providerID, username string) {
+	t.Helper()
+	if err := s.SaveOAuthUser(provider, providerID, username, "{}"); err != nil {
+		t.Fatalf("SaveOAuthUser: %v", err)
+	}
+	if _, err := s.db.Exec(`UPDATE "OAuthUser" SET status = 'approved' WHERE provider = ? AND providerId = ?`, provider, providerID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResolveOAuthLoginCreatesViewerByDefault(t *testing.T) {
+	s := newTestService(t)
+	saveIdentity(t, s, "github", "1001", "alice")
+
+	username, err := s.ResolveOAuthLogin("github", "1001", "alice")
+	if err != nil {
+		t.Fatalf("ResolveOAuthLogin: %v", err)
+	}
+	if username != "alice" {
+		t.Fatalf("username = %q, want alice", username)
+	}
+	user, err := s.GetUserByUsername("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Role != RoleViewer {
+		t.Fatalf("role = %q, want %q", user.Role, RoleViewer)
+	}
+
+	// 再次登录通过映射找到同一用户
+	if username, err := s.ResolveOAuthLogin("github", "1001", "renamed"); err != nil || username != "alice" {
+		t.Fatalf("second login = %q, %v; want alice", username, err)
+	}
+}
+
+func TestResolveOAuthLoginUsesConfiguredDefaultRole(t *testing.T) {
+	s := newTestService(t)
+	if err := s.SetSystemConfig(ConfigKeyOAuthDefaultRole, string(RoleOperator), ""); err != nil {
+		t.Fatal(err)
+	}
+	saveIdentity(t, s, "github", "1002", "bob")
+
+	if _, err := s.ResolveOAuthLogin("github", "1002", "bob"); err != nil {
+		t.Fatalf("ResolveOAuthLogin: %v", err)
+	}
+	user, err := s.GetUserByUsername("bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Role != RoleOperator {
+		t.Fatalf("role = %q, want %q", user.Role, RoleOperator)
+	}
+}
+
+func TestResolveOAuthLoginDoesNotBindByUsername(t *testing.T) {
+	s := newTestService(t)
+	if _, err := s.CreateUser(CreateUserRequest{Username: "admin", Password: "secret123", Role: RoleAdmin}); err != nil {
+		t.Fatal(err)
+	}
+	saveIdentity(t, s, "github", "1003", "admin")
+
+	if _, err := s.ResolveOAuthLogin("github", "1003", "admin"); !errors.Is(err, ErrOAuthUsernameTaken) {
+		t.Fatalf("err = %v, want ErrOAuthUsernameTaken", err)
+	}
+
+	// 管理员显式映射后允许登录
+	identities, err := s.ListOAuthIdentities()
+	if err != nil || len(identities) != 1 {
+		t.Fatalf("ListOAuthIdentities = %v, %v", identities, err)
+	}
+	admin, _ := s.GetUserByUsername("admin")
+	if err := s.MapOAuthIdentity(identities[0].ID, &admin.ID); err != nil {
+		t.Fatal(err)
+	}
+	if username, err := s.ResolveOAuthLogin("github", "1003", "admin"); err != nil || username != "admin" {
+		t.Fatalf("mapped login = %q, %v; want admin", username, err)
+	}
+}
+
+func TestResolveOAuthLoginRejectsDisabledUser(t *testing.T) {
+	s := newTestService(t)
+	saveIdentity(t, s, "github", "1004", "carol")
+	if _, err := s.ResolveOAuthLogin("github", "1004", "carol"); err != nil {
+		t.Fatal(err)
+	}
+	user, _ := s.GetUserByUsername("carol")
+	disabled := true
+	if _, err := s.UpdateUser(user.ID, UpdateUserRequest{Disabled: &disabled}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ResolveOAuthLogin("github", "1004", "carol"); err == nil {
+		t.Fatal("disabled user should not be able to log in")
+	}
+}
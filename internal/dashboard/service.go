@@ -4,6 +4,8 @@ import (
 	"database/sql"
 	"fmt"
 	"time"
+
+	"NodePassDash/internal/workspace"
 )
 
 // Service 仪表盘服务
@@ -16,10 +18,19 @@ func NewService(db *sql.DB) *Service {
 	return &Service{db: db}
 }
 
-// GetStats 获取仪表盘统计数据
-func (s *Service) GetStats(timeRange TimeRange) (*DashboardStats, error) {
+// GetStats 获取可见工作区内的仪表盘统计数据
+func (s *Service) GetStats(timeRange TimeRange, scope workspace.Scope) (*DashboardStats, error) {
 	stats := &DashboardStats{}
 
+	// 工作区过滤条件：主控按 workspaceId，隧道按所属主控，操作日志按所属隧道
+	endpointCond, endpointArgs := scope.Where("workspaceId")
+	overviewCond, _ := scope.Where("e.workspaceId")
+	tunnelCond, tunnelArgs := scope.EndpointWhere("endpointId")
+	logCond := "1 = 1"
+	if !scope.All {
+		logCond = `tunnelId IN (SELECT id FROM "Tunnel" WHERE ` + tunnelCond + `)`
+	}
+
 	// 获取时间范围
 	startTime := time.Now()
 	switch timeRange {
@@ -47,8 +58,8 @@ func (s *Service) GetStats(timeRange TimeRange) (*DashboardStats, error) {
 			COALESCE(SUM(t.tcpRx + t.tcpTx + t.udpRx + t.udpTx), 0) as total_traffic
 		FROM "Endpoint" e
 		LEFT JOIN "Tunnel" t ON e.id = t.endpointId
-		WHERE (? = '' OR t.createdAt >= ?)
-	`, startTime, startTime).Scan(
+		WHERE (? = '' OR t.createdAt >= ?) AND `+overviewCond+`
+	`, append([]interface{}{startTime, startTime}, endpointArgs...)...).Scan(
 		&stats.Overview.TotalEndpoints,
 		&stats.Overview.TotalTunnels,
 		&stats.Overview.RunningTunnels,
@@ -70,8 +81,8 @@ func (s *Service) GetStats(timeRange TimeRange) (*DashboardStats, error) {
 			COALESCE(SUM(udpRx), 0) as udp_rx,
 			COALESCE(SUM(udpTx), 0) as udp_tx
 		FROM "Tunnel"
-		WHERE (? = '' OR createdAt >= ?)
-	`, startTime, startTime).Scan(&tcpRx, &tcpTx, &udpRx, &udpTx)
+		WHERE (? = '' OR createdAt >= ?) AND `+tunnelCond+`
+	`, append([]interface{}{startTime, startTime}, tunnelArgs...)...).Scan(&tcpRx, &tcpTx, &udpRx, &udpTx)
 	if err != nil {
 		return nil, fmt.Errorf("获取流量统计失败: %v", err)
 	}
@@ -97,8 +108,8 @@ func (s *Service) GetStats(timeRange TimeRange) (*DashboardStats, error) {
 			COUNT(CASE WHEN lastCheck < datetime('now', '-5 minutes') THEN 1 END) as offline,
 			COUNT(*) as total
 		FROM "Endpoint"
-		WHERE (? = '' OR createdAt >= ?)
-	`, startTime, startTime).Scan(
+		WHERE (? = '' OR createdAt >= ?) AND `+endpointCond+`
+	`, append([]interface{}{startTime, startTime}, endpointArgs...)...).Scan(
 		&stats.EndpointStatus.Online,
 		&stats.EndpointStatus.Offline,
 		&stats.EndpointStatus.Total,
@@ -114,8 +125,8 @@ func (s *Service) GetStats(timeRange TimeRange) (*DashboardStats, error) {
 			COUNT(CASE WHEN mode = 'client' THEN 1 END) as client,
 			COUNT(*) as total
 		FROM "Tunnel"
-		WHERE (? = '' OR createdAt >= ?)
-	`, startTime, startTime).Scan(
+		WHERE (? = '' OR createdAt >= ?) AND `+tunnelCond+`
+	`, append([]interface{}{startTime, startTime}, tunnelArgs...)...).Scan(
 		&stats.TunnelTypes.Server,
 		&stats.TunnelTypes.Client,
 		&stats.TunnelTypes.Total,
@@ -129,10 +140,10 @@ func (s *Service) GetStats(timeRange TimeRange) (*DashboardStats, error) {
 		SELECT 
 			id, tunnelId, tunnelName, action, status, message, createdAt
 		FROM "TunnelOperationLog"
-		WHERE (? = '' OR createdAt >= ?)
+		WHERE (? = '' OR createdAt >= ?) AND `+logCond+`
 		ORDER BY createdAt DESC
 		LIMIT 10
-	`, startTime, startTime)
+	`, append([]interface{}{startTime, startTime}, tunnelArgs...)...)
 	if err != nil {
 		return nil, fmt.Errorf("获取操作日志失败: %v", err)
 	}
@@ -169,10 +180,10 @@ func (s *Service) GetStats(timeRange TimeRange) (*DashboardStats, error) {
 			id, name, mode,
 			(tcpRx + tcpTx + udpRx + udpTx) as total_traffic
 		FROM "Tunnel"
-		WHERE (? = '' OR createdAt >= ?)
+		WHERE (? = '' OR createdAt >= ?) AND `+tunnelCond+`
 		ORDER BY total_traffic DESC
 		LIMIT 5
-	`, startTime, startTime)
+	`, append([]interface{}{startTime, startTime}, tunnelArgs...)...)
 	if err != nil {
 		return nil, fmt.Errorf("获取最活跃隧道失败: %v", err)
 	}
@@ -0,0 +1,27 @@
+// Package dbtest 为测试创建带完整表结构的临时 SQLite 数据库
+package dbtest
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"NodePassDash/internal/db"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Open 在测试临时目录中创建数据库并初始化表结构，测试结束后自动关闭
+func Open(t testing.TB) *sql.DB {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.db")
+	conn, err := sql.Open("sqlite3", "file:"+path+"?_journal_mode=WAL&_busy_timeout=5000&_fk=1")
+	if err != nil {
+		t.Fatalf("打开测试数据库失败: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	if err := db.InitSchema(conn); err != nil {
+		t.Fatalf("初始化测试数据库失败: %v", err)
+	}
+	return conn
+}
@@ -0,0 +1,591 @@
+package db
+
+import (
+	"database/sql"
+
+	log "NodePassDash/internal/log"
+)
+
+// InitSchema 创建必须的表结构（如不存在）并完成旧库字段升级，可重复执行
+func InitSchema(db *sql.DB) error {
+	createEndpointsTable := `
+	CREATE TABLE IF NOT EXISTS "Endpoint" (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL UNIQUE,
+		url TEXT NOT NULL UNIQUE,
+		apiPath TEXT NOT NULL,
+		apiKey TEXT NOT NULL,
+		status TEXT NOT NULL DEFAULT 'OFFLINE',
+		color TEXT DEFAULT 'default',
+		lastCheck DATETIME DEFAULT CURRENT_TIMESTAMP,
+		createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		updatedAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		tunnelCount INTEGER DEFAULT 0,
+		os TEXT DEFAULT '',
+		arch TEXT DEFAULT '',
+		ver TEXT DEFAULT '',
+		log TEXT DEFAULT '',
+		tls TEXT DEFAULT '',
+		crt TEXT DEFAULT '',
+		key_path TEXT DEFAULT '',
+		uptime INTEGER DEFAULT NULL
+	);`
+
+	createTunnelTable := `
+	CREATE TABLE IF NOT EXISTS "Tunnel" (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		endpointId INTEGER NOT NULL,
+		mode TEXT NOT NULL,
+		status TEXT NOT NULL DEFAULT 'stopped',
+		tunnelAddress TEXT NOT NULL,
+		tunnelPort TEXT NOT NULL,
+		targetAddress TEXT NOT NULL,
+		targetPort TEXT NOT NULL,
+		tlsMode TEXT NOT NULL,
+		certPath TEXT,
+		keyPath TEXT,
+		logLevel TEXT NOT NULL DEFAULT 'info',
+		commandLine TEXT NOT NULL,
+		instanceId TEXT,
+		password TEXT DEFAULT '',
+		tcpRx INTEGER DEFAULT 0,
+		tcpTx INTEGER DEFAULT 0,
+		udpRx INTEGER DEFAULT 0,
+		udpTx INTEGER DEFAULT 0,
+		min INTEGER,
+		max INTEGER,
+		restart BOOLEAN DEFAULT FALSE,
+		createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		updatedAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		lastEventTime DATETIME
+	);`
+
+	createTunnelRecycleTable := `
+	CREATE TABLE IF NOT EXISTS "TunnelRecycle" (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		endpointId INTEGER NOT NULL,
+		mode TEXT NOT NULL,
+		tunnelAddress TEXT NOT NULL,
+		tunnelPort TEXT NOT NULL,
+		targetAddress TEXT NOT NULL,
+		targetPort TEXT NOT NULL,
+		tlsMode TEXT NOT NULL,
+		certPath TEXT,
+		keyPath TEXT,
+		logLevel TEXT NOT NULL DEFAULT 'info',
+		commandLine TEXT NOT NULL,
+		instanceId TEXT,
+		password TEXT DEFAULT '',
+		tcpRx INTEGER DEFAULT 0,
+		tcpTx INTEGER DEFAULT 0,
+		udpRx INTEGER DEFAULT 0,
+		udpTx INTEGER DEFAULT 0,
+		min INTEGER,
+		max INTEGER
+	);`
+
+	createEndpointSSE := `
+	CREATE TABLE IF NOT EXISTS "EndpointSSE" (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		eventType TEXT NOT NULL,
+		pushType TEXT NOT NULL,
+		eventTime DATETIME NOT NULL,
+		endpointId INTEGER NOT NULL,
+		instanceId TEXT NOT NULL,
+		instanceType TEXT,
+		status TEXT,
+		url TEXT,
+		tcpRx INTEGER DEFAULT 0,
+		tcpTx INTEGER DEFAULT 0,
+		udpRx INTEGER DEFAULT 0,
+		udpTx INTEGER DEFAULT 0,
+		logs TEXT,
+		createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	createTunnelLog := `
+	CREATE TABLE IF NOT EXISTS "TunnelOperationLog" (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		tunnelId INTEGER,
+		tunnelName TEXT NOT NULL,
+		action TEXT NOT NULL,
+		status TEXT NOT NULL,
+		message TEXT,
+		createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	createSystemConfig := `
+	CREATE TABLE IF NOT EXISTS "SystemConfig" (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		KEY TEXT NOT NULL UNIQUE,
+		value TEXT NOT NULL,
+		description TEXT,
+		createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		updatedAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	createUserSession := `
+	CREATE TABLE IF NOT EXISTS "UserSession" (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		sessionId TEXT NOT NULL UNIQUE,
+		username TEXT NOT NULL,
+		createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		expiresAt DATETIME NOT NULL,
+		isActive BOOLEAN NOT NULL DEFAULT 1,
+		ipAddress TEXT,
+		userAgent TEXT,
+		lastSeenAt DATETIME,
+		rememberMe BOOLEAN NOT NULL DEFAULT 0
+	);`
+
+	createUser := `
+	CREATE TABLE IF NOT EXISTS "User" (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		username TEXT NOT NULL UNIQUE,
+		passwordHash TEXT NOT NULL DEFAULT '',
+		role TEXT NOT NULL DEFAULT 'viewer',
+		disabled BOOLEAN NOT NULL DEFAULT 0,
+		totpSecret TEXT NOT NULL DEFAULT '',
+		totpEnabled BOOLEAN NOT NULL DEFAULT 0,
+		totpLastCounter INTEGER NOT NULL DEFAULT 0,
+		createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		updatedAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	createRecoveryCode := `
+	CREATE TABLE IF NOT EXISTS "RecoveryCode" (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		userId INTEGER NOT NULL,
+		codeHash TEXT NOT NULL,
+		usedAt DATETIME,
+		createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	createOAuthUser := `
+	CREATE TABLE IF NOT EXISTS "OAuthUser" (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		provider TEXT NOT NULL,
+		providerId TEXT NOT NULL,
+		username TEXT NOT NULL,
+		data TEXT,
+		userId INTEGER,
+		status TEXT NOT NULL DEFAULT 'pending',
+		createdAt DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updatedAt DATETIME DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE(provider, providerId)
+	);`
+
+	createWorkspace := `
+	CREATE TABLE IF NOT EXISTS "Workspace" (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL UNIQUE,
+		description TEXT DEFAULT '',
+		createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		updatedAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	createWorkspaceMember := `
+	CREATE TABLE IF NOT EXISTS "WorkspaceMember" (
+		workspaceId INTEGER NOT NULL,
+		userId INTEGER NOT NULL,
+		createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (workspaceId, userId),
+		FOREIGN KEY (workspaceId) REFERENCES "Workspace"(id) ON DELETE CASCADE
+	);`
+
+	createApiToken := `
+	CREATE TABLE IF NOT EXISTS "ApiToken" (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		tokenHash TEXT NOT NULL UNIQUE,
+		prefix TEXT NOT NULL,
+		username TEXT NOT NULL,
+		scopes TEXT NOT NULL DEFAULT '',
+		expiresAt DATETIME,
+		lastUsedAt DATETIME,
+		createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		revoked BOOLEAN NOT NULL DEFAULT 0
+	);`
+
+	// 幂等键表：保存创建类请求的摘要及响应，status 为 0 表示处理中
+	createIdempotencyKey := `
+	CREATE TABLE IF NOT EXISTS "IdempotencyKey" (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		actor TEXT NOT NULL DEFAULT '',
+		idempotencyKey TEXT NOT NULL,
+		requestHash TEXT NOT NULL,
+		status INTEGER NOT NULL DEFAULT 0,
+		contentType TEXT NOT NULL DEFAULT '',
+		body TEXT,
+		createdAt DATETIME NOT NULL,
+		expiresAt DATETIME NOT NULL,
+		UNIQUE(actor, idempotencyKey)
+	);`
+
+	// 审计日志表
+	createAuditLog := `
+	CREATE TABLE IF NOT EXISTS "AuditLog" (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		actor TEXT NOT NULL DEFAULT '',
+		authType TEXT NOT NULL DEFAULT '',
+		ip TEXT NOT NULL DEFAULT '',
+		userAgent TEXT NOT NULL DEFAULT '',
+		method TEXT NOT NULL DEFAULT '',
+		path TEXT NOT NULL DEFAULT '',
+		action TEXT NOT NULL DEFAULT '',
+		targetType TEXT NOT NULL DEFAULT '',
+		targetId TEXT NOT NULL DEFAULT '',
+		status INTEGER NOT NULL DEFAULT 0,
+		success BOOLEAN NOT NULL DEFAULT 0,
+		error TEXT NOT NULL DEFAULT '',
+		before TEXT,
+		after TEXT,
+		diff TEXT
+	);`
+
+	// Webhook 订阅表：secret 用于签名，启用加密时加密存储；过滤条件为 JSON 数组，空数组表示不限
+	createWebhook := `
+	CREATE TABLE IF NOT EXISTS "Webhook" (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		url TEXT NOT NULL,
+		secret TEXT NOT NULL,
+		eventTypes TEXT NOT NULL DEFAULT '[]',
+		endpointIds TEXT NOT NULL DEFAULT '[]',
+		tagIds TEXT NOT NULL DEFAULT '[]',
+		enabled BOOLEAN NOT NULL DEFAULT 1,
+		createdBy TEXT NOT NULL DEFAULT '',
+		createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		updatedAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	// Webhook 投递记录表，同时作为待重试队列（status 为 pending 且到达 nextAttemptAt 的记录）
+	createWebhookDelivery := `
+	CREATE TABLE IF NOT EXISTS "WebhookDelivery" (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		webhookId INTEGER NOT NULL,
+		eventId TEXT NOT NULL,
+		eventType TEXT NOT NULL,
+		payload TEXT NOT NULL,
+		status TEXT NOT NULL DEFAULT 'pending',
+		attempts INTEGER NOT NULL DEFAULT 0,
+		nextAttemptAt DATETIME,
+		responseStatus INTEGER NOT NULL DEFAULT 0,
+		responseBody TEXT NOT NULL DEFAULT '',
+		error TEXT NOT NULL DEFAULT '',
+		durationMs INTEGER NOT NULL DEFAULT 0,
+		createdAt DATETIME NOT NULL,
+		deliveredAt DATETIME,
+		FOREIGN KEY (webhookId) REFERENCES "Webhook"(id) ON DELETE CASCADE
+	);`
+
+	// 创建隧道分组表
+	// createTunnelGroups := `
+	// CREATE TABLE IF NOT EXISTS tunnel_groups (
+	// 	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	// 	name TEXT NOT NULL UNIQUE,
+	// 	description TEXT,
+	// 	type TEXT NOT NULL DEFAULT 'custom',
+	// 	color TEXT DEFAULT '#3B82F6',
+	// 	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	// 	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	// );`
+
+	// 创建隧道分组成员表
+	// createTunnelGroupMembers := `
+	// CREATE TABLE IF NOT EXISTS tunnel_group_members (
+	// 	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	// 	group_id INTEGER NOT NULL,
+	// 	tunnel_id TEXT NOT NULL,
+	// 	role TEXT DEFAULT 'member',
+	// 	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	// 	FOREIGN KEY (group_id) REFERENCES tunnel_groups(id) ON DELETE CASCADE,
+	// 	UNIQUE(group_id, tunnel_id)
+	// );`
+
+	// 创建标签表
+	createTagsTable := `
+	CREATE TABLE IF NOT EXISTS Tags (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL UNIQUE,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	// 创建隧道标签关联表
+	createTunnelTagsTable := `
+	CREATE TABLE IF NOT EXISTS TunnelTags (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		tunnel_id INTEGER NOT NULL,
+		tag_id INTEGER NOT NULL,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (tunnel_id) REFERENCES "Tunnel"(id) ON DELETE CASCADE,
+		FOREIGN KEY (tag_id) REFERENCES Tags(id) ON DELETE CASCADE,
+		UNIQUE(tunnel_id, tag_id)
+	);`
+
+	// 依次执行创建表 SQL
+	if _, err := db.Exec(createEndpointsTable); err != nil {
+		return err
+	}
+	if _, err := db.Exec(createTunnelTable); err != nil {
+		return err
+	}
+	if _, err := db.Exec(createTunnelRecycleTable); err != nil {
+		return err
+	}
+	if _, err := db.Exec(createEndpointSSE); err != nil {
+		return err
+	}
+	if _, err := db.Exec(createTunnelLog); err != nil {
+		return err
+	}
+	if _, err := db.Exec(createSystemConfig); err != nil {
+		return err
+	}
+	if _, err := db.Exec(createUserSession); err != nil {
+		return err
+	}
+	if _, err := db.Exec(createUser); err != nil {
+		return err
+	}
+	if _, err := db.Exec(createOAuthUser); err != nil {
+		return err
+	}
+	if _, err := db.Exec(createRecoveryCode); err != nil {
+		return err
+	}
+	if _, err := db.Exec(createApiToken); err != nil {
+		return err
+	}
+	if _, err := db.Exec(createAuditLog); err != nil {
+		return err
+	}
+	if _, err := db.Exec(createIdempotencyKey); err != nil {
+		return err
+	}
+	if _, err := db.Exec(createWebhook); err != nil {
+		return err
+	}
+	if _, err := db.Exec(createWebhookDelivery); err != nil {
+		return err
+	}
+	if _, err := db.Exec(createWorkspace); err != nil {
+		return err
+	}
+	if _, err := db.Exec(createWorkspaceMember); err != nil {
+		return err
+	}
+	// 默认工作区，升级前的主控与标签均归属于此
+	if _, err := db.Exec(`INSERT OR IGNORE INTO "Workspace" (id, name, description) VALUES (1, 'default', '默认工作区')`); err != nil {
+		return err
+	}
+	// if _, err := db.Exec(createTunnelGroups); err != nil {
+	// 	return err
+	// }
+	// if _, err := db.Exec(createTunnelGroupMembers); err != nil {
+	// 	return err
+	// }
+	if _, err := db.Exec(createTagsTable); err != nil {
+		return err
+	}
+	if _, err := db.Exec(createTunnelTagsTable); err != nil {
+		return err
+	}
+
+	// ---- 旧库兼容：为 Tunnel 表添加 min / max 列 ----
+	if err := ensureColumn(db, "Tunnel", "min", "INTEGER"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "Tunnel", "max", "INTEGER"); err != nil {
+		return err
+	}
+
+	// ---- 为 Tunnel 表添加密码字段 ----
+	if err := ensureColumn(db, "Tunnel", "password", "TEXT DEFAULT ''"); err != nil {
+		return err
+	}
+
+	// ---- 为 TunnelRecycle 表添加密码字段 ----
+	if err := ensureColumn(db, "TunnelRecycle", "password", "TEXT DEFAULT ''"); err != nil {
+		return err
+	}
+
+	// ---- 为 Endpoint 表添加系统信息字段 ----
+	if err := ensureColumn(db, "Endpoint", "os", "TEXT DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "Endpoint", "arch", "TEXT DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "Endpoint", "ver", "TEXT DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "Endpoint", "log", "TEXT DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "Endpoint", "tls", "TEXT DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "Endpoint", "crt", "TEXT DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "Endpoint", "key_path", "TEXT DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "Endpoint", "uptime", "INTEGER DEFAULT NULL"); err != nil {
+		return err
+	}
+
+	// ---- 为 Tunnel 表添加 restart 字段 ----
+	if err := ensureColumn(db, "Tunnel", "restart", "BOOLEAN DEFAULT FALSE"); err != nil {
+		return err
+	}
+
+	// ---- 为 TunnelRecycle 表添加 restart 字段 ----
+	if err := ensureColumn(db, "TunnelRecycle", "restart", "BOOLEAN DEFAULT FALSE"); err != nil {
+		return err
+	}
+
+	// ---- 为 EndpointSSE 表添加 alias 和 restart 字段 ----
+	if err := ensureColumn(db, "EndpointSSE", "alias", "TEXT"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "EndpointSSE", "restart", "BOOLEAN"); err != nil {
+		return err
+	}
+
+	// ---- 为 Tunnel 表添加 pool 和 ping 字段 ----
+	if err := ensureColumn(db, "Tunnel", "pool", "INTEGER DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "Tunnel", "ping", "INTEGER DEFAULT 0"); err != nil {
+		return err
+	}
+
+	// ---- 为 User 表添加两步验证字段 ----
+	if err := ensureColumn(db, "User", "totpSecret", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "User", "totpEnabled", "BOOLEAN NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "User", "totpLastCounter", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+
+	// ---- 为 Endpoint 与 Tags 表添加工作区字段 ----
+	if err := ensureColumn(db, "Endpoint", "workspaceId", "INTEGER NOT NULL DEFAULT 1"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "Tags", "workspace_id", "INTEGER NOT NULL DEFAULT 1"); err != nil {
+		return err
+	}
+
+	// ---- 为 OAuthUser 表添加本地用户映射与审批状态字段 ----
+	if err := ensureColumn(db, "OAuthUser", "userId", "INTEGER"); err != nil {
+		return err
+	}
+	// 升级前已绑定的身份视为已批准
+	if err := ensureColumn(db, "OAuthUser", "status", "TEXT NOT NULL DEFAULT 'approved'"); err != nil {
+		return err
+	}
+
+	// ---- 为 UserSession 表添加客户端信息与活动时间字段 ----
+	if err := ensureColumn(db, "UserSession", "ipAddress", "TEXT"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "UserSession", "userAgent", "TEXT"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "UserSession", "lastSeenAt", "DATETIME"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "UserSession", "rememberMe", "BOOLEAN NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+
+	// ---- 为 EndpointSSE 表添加 pool 和 ping 字段 ----
+	if err := ensureColumn(db, "EndpointSSE", "pool", "INTEGER DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "EndpointSSE", "ping", "INTEGER DEFAULT 0"); err != nil {
+		return err
+	}
+
+	// ---- 为 Tunnel 与 Endpoint 表添加配置修订号（ETag / If-Match） ----
+	if err := ensureColumn(db, "Tunnel", "revision", "INTEGER NOT NULL DEFAULT 1"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "Endpoint", "revision", "INTEGER NOT NULL DEFAULT 1"); err != nil {
+		return err
+	}
+	// 修订号由触发器维护：配置字段的值实际发生变化时加一，无论修改来自接口、SSE 同步还是主控刷新；
+	// 状态、流量等运行数据的更新不影响修订号。每次启动重建以便字段列表随版本更新
+	revisionTriggers := []string{
+		`DROP TRIGGER IF EXISTS trg_tunnel_revision`,
+		`CREATE TRIGGER trg_tunnel_revision AFTER UPDATE ON "Tunnel"
+		WHEN OLD.revision = NEW.revision AND (
+			OLD.name IS NOT NEW.name OR OLD.endpointId IS NOT NEW.endpointId OR OLD.instanceId IS NOT NEW.instanceId OR
+			OLD.mode IS NOT NEW.mode OR OLD.tunnelAddress IS NOT NEW.tunnelAddress OR OLD.tunnelPort IS NOT NEW.tunnelPort OR
+			OLD.targetAddress IS NOT NEW.targetAddress OR OLD.targetPort IS NOT NEW.targetPort OR
+			OLD.tlsMode IS NOT NEW.tlsMode OR OLD.certPath IS NOT NEW.certPath OR OLD.keyPath IS NOT NEW.keyPath OR
+			OLD.logLevel IS NOT NEW.logLevel OR OLD.commandLine IS NOT NEW.commandLine OR OLD.password IS NOT NEW.password OR
+			OLD.min IS NOT NEW.min OR OLD.max IS NOT NEW.max OR OLD.restart IS NOT NEW.restart)
+		BEGIN
+			UPDATE "Tunnel" SET revision = OLD.revision + 1 WHERE id = NEW.id;
+		END`,
+		`DROP TRIGGER IF EXISTS trg_endpoint_revision`,
+		`CREATE TRIGGER trg_endpoint_revision AFTER UPDATE ON "Endpoint"
+		WHEN OLD.revision = NEW.revision AND (
+			OLD.name IS NOT NEW.name OR OLD.url IS NOT NEW.url OR OLD.apiPath IS NOT NEW.apiPath OR
+			OLD.apiKey IS NOT NEW.apiKey OR OLD.color IS NOT NEW.color OR OLD.workspaceId IS NOT NEW.workspaceId)
+		BEGIN
+			UPDATE "Endpoint" SET revision = OLD.revision + 1 WHERE id = NEW.id;
+		END`,
+	}
+	for _, triggerSQL := range revisionTriggers {
+		if _, err := db.Exec(triggerSQL); err != nil {
+			return err
+		}
+	}
+
+	// ---- 创建分组表索引 ----
+	groupIndexes := []string{
+		// `CREATE INDEX IF NOT EXISTS idx_tunnel_groups_name ON tunnel_groups(name)`,
+		// `CREATE INDEX IF NOT EXISTS idx_tunnel_groups_type ON tunnel_groups(type)`,
+		// `CREATE INDEX IF NOT EXISTS idx_tunnel_groups_created_at ON tunnel_groups(created_at)`,
+		// `CREATE INDEX IF NOT EXISTS idx_tunnel_group_members_group_id ON tunnel_group_members(group_id)`,
+		// `CREATE INDEX IF NOT EXISTS idx_tunnel_group_members_tunnel_id ON tunnel_group_members(tunnel_id)`,
+		// `CREATE INDEX IF NOT EXISTS idx_tunnel_group_members_role ON tunnel_group_members(role)`,
+		`CREATE INDEX IF NOT EXISTS idx_tags_name ON Tags(name)`,
+		`CREATE INDEX IF NOT EXISTS idx_tags_workspace_id ON Tags(workspace_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_endpoint_workspace_id ON "Endpoint"(workspaceId)`,
+		`CREATE INDEX IF NOT EXISTS idx_recovery_code_user_id ON "RecoveryCode"(userId)`,
+		`CREATE INDEX IF NOT EXISTS idx_user_session_username ON "UserSession"(username)`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_log_created_at ON "AuditLog"(createdAt)`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_log_actor ON "AuditLog"(actor)`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_log_action ON "AuditLog"(action)`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_log_target ON "AuditLog"(targetType, targetId)`,
+		`CREATE INDEX IF NOT EXISTS idx_tags_created_at ON Tags(created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_tunnel_tags_tunnel_id ON TunnelTags(tunnel_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_tunnel_tags_tag_id ON TunnelTags(tag_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_tunnel_endpoint_id ON "Tunnel"(endpointId)`,
+		`CREATE INDEX IF NOT EXISTS idx_tunnel_status ON "Tunnel"(status)`,
+		`CREATE INDEX IF NOT EXISTS idx_idempotency_key_expires_at ON "IdempotencyKey"(expiresAt)`,
+		`CREATE INDEX IF NOT EXISTS idx_webhook_delivery_due ON "WebhookDelivery"(status, nextAttemptAt)`,
+		`CREATE INDEX IF NOT EXISTS idx_webhook_delivery_webhook_id ON "WebhookDelivery"(webhookId)`,
+	}
+
+	for _, indexSQL := range groupIndexes {
+		if _, err := db.Exec(indexSQL); err != nil {
+			log.Errorf("创建分组表索引失败: %v", err)
+			// 索引创建失败不影响程序运行，只记录日志
+		}
+	}
+
+	return nil
+}
@@ -14,24 +14,26 @@ const (
 
 // Endpoint 端点基本信息
 type Endpoint struct {
-	ID        int64          `json:"id"`
-	Name      string         `json:"name"`
-	URL       string         `json:"url"`
-	APIPath   string         `json:"apiPath"`
-	APIKey    string         `json:"apiKey"`
-	Status    EndpointStatus `json:"status"`
-	Color     string         `json:"color,omitempty"`
-	OS        string         `json:"os,omitempty"`
-	Arch      string         `json:"arch,omitempty"`
-	Ver       string         `json:"ver,omitempty"`
-	Log       string         `json:"log,omitempty"`
-	TLS       string         `json:"tls,omitempty"`
-	Crt       string         `json:"crt,omitempty"`
-	KeyPath   string         `json:"keyPath,omitempty"`
-	Uptime    *int64         `json:"uptime,omitempty"`
-	LastCheck time.Time      `json:"lastCheck"`
-	CreatedAt time.Time      `json:"createdAt"`
-	UpdatedAt time.Time      `json:"updatedAt"`
+	ID          int64          `json:"id"`
+	Name        string         `json:"name"`
+	URL         string         `json:"url"`
+	APIPath     string         `json:"apiPath"`
+	APIKey      string         `json:"apiKey"`
+	Status      EndpointStatus `json:"status"`
+	Color       string         `json:"color,omitempty"`
+	OS          string         `json:"os,omitempty"`
+	Arch        string         `json:"arch,omitempty"`
+	Ver         string         `json:"ver,omitempty"`
+	Log         string         `json:"log,omitempty"`
+	TLS         string         `json:"tls,omitempty"`
+	Crt         string         `json:"crt,omitempty"`
+	KeyPath     string         `json:"keyPath,omitempty"`
+	Uptime      *int64         `json:"uptime,omitempty"`
+	WorkspaceID int64          `json:"workspaceId"`
+	Revision    int64          `json:"revision"` // 配置修订号，用于 ETag / If-Match 并发控制
+	LastCheck   time.Time      `json:"lastCheck"`
+	CreatedAt   time.Time      `json:"createdAt"`
+	UpdatedAt   time.Time      `json:"updatedAt"`
 }
 
 // EndpointWithStats 带统计信息的端点
@@ -48,6 +50,8 @@ type CreateEndpointRequest struct {
 	APIPath string `json:"apiPath" validate:"required"`
 	APIKey  string `json:"apiKey" validate:"required,max=200"`
 	Color   string `json:"color,omitempty"`
+	// WorkspaceID 所属工作区，为 0 时归入默认工作区
+	WorkspaceID int64 `json:"workspaceId,omitempty"`
 }
 
 // UpdateEndpointRequest 更新端点请求
@@ -4,6 +4,9 @@ import (
 	"database/sql"
 	"errors"
 	"time"
+
+	"NodePassDash/internal/secret"
+	"NodePassDash/internal/workspace"
 )
 
 // Service 端点管理服务
@@ -21,22 +24,24 @@ func (s *Service) DB() *sql.DB {
 	return s.db
 }
 
-// GetEndpoints 获取所有端点列表
-func (s *Service) GetEndpoints() ([]EndpointWithStats, error) {
+// GetEndpoints 获取可见工作区内的端点列表
+func (s *Service) GetEndpoints(scope workspace.Scope) ([]EndpointWithStats, error) {
+	cond, args := scope.Where("e.workspaceId")
 	query := `
 		SELECT 
 			e.id, e.name, e.url, e.apiPath, e.apiKey, e.status, e.color,
-			e.os, e.arch, e.ver, e.log, e.tls, e.crt, e.key_path, e.uptime,
-			e.lastCheck, e.createdAt, e.updatedAt,
+			e.os, e.arch, e.ver, e.log, e.tls, e.crt, e.key_path, e.uptime, e.workspaceId,
+			e.revision, e.lastCheck, e.createdAt, e.updatedAt,
 			COUNT(t.id) as tunnel_count,
 			COUNT(CASE WHEN t.status = 'running' THEN 1 END) as active_tunnels
 		FROM "Endpoint" e
 		LEFT JOIN "Tunnel" t ON e.id = t.endpointId
+		WHERE ` + cond + `
 		GROUP BY e.id
 		ORDER BY e.createdAt DESC
 	`
 
-	rows, err := s.db.Query(query)
+	rows, err := s.db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -49,14 +54,17 @@ func (s *Service) GetEndpoints() ([]EndpointWithStats, error) {
 		var uptime sql.NullInt64
 		err := rows.Scan(
 			&e.ID, &e.Name, &e.URL, &e.APIPath, &e.APIKey, &statusStr, &e.Color,
-			&e.OS, &e.Arch, &e.Ver, &e.Log, &e.TLS, &e.Crt, &e.KeyPath, &uptime,
-			&e.LastCheck, &e.CreatedAt, &e.UpdatedAt,
+			&e.OS, &e.Arch, &e.Ver, &e.Log, &e.TLS, &e.Crt, &e.KeyPath, &uptime, &e.WorkspaceID,
+			&e.Revision, &e.LastCheck, &e.CreatedAt, &e.UpdatedAt,
 			&e.TunnelCount, &e.ActiveTunnels,
 		)
 		if err != nil {
 			return nil, err
 		}
 		e.Status = EndpointStatus(statusStr)
+		if e.APIKey, err = secret.Reveal(e.APIKey); err != nil {
+			return nil, err
+		}
 		if uptime.Valid {
 			uptimeVal := uptime.Int64
 			e.Uptime = &uptimeVal
@@ -88,10 +96,27 @@ func (s *Service) CreateEndpoint(req CreateEndpointRequest) (*Endpoint, error) {
 		return nil, errors.New("该URL已存在")
 	}
 
+	if req.WorkspaceID == 0 {
+		req.WorkspaceID = workspace.DefaultWorkspaceID
+	}
+	err = s.db.QueryRow("SELECT EXISTS(SELECT 1 FROM \"Workspace\" WHERE id = ?)", req.WorkspaceID).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, errors.New("工作区不存在")
+	}
+
+	// API Key 加密存储
+	storedKey, err := secret.Encrypt(req.APIKey)
+	if err != nil {
+		return nil, err
+	}
+
 	// 创建新端点
 	query := `
-		INSERT INTO "Endpoint" (name, url, apiPath, apiKey, status, color, lastCheck, createdAt, updatedAt)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO "Endpoint" (name, url, apiPath, apiKey, status, color, workspaceId, lastCheck, createdAt, updatedAt)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
 	now := time.Now()
@@ -99,9 +124,10 @@ func (s *Service) CreateEndpoint(req CreateEndpointRequest) (*Endpoint, error) {
 		req.Name,
 		req.URL,
 		req.APIPath,
-		req.APIKey,
+		storedKey,
 		StatusOffline,
 		req.Color,
+		req.WorkspaceID,
 		now,
 		now,
 		now,
@@ -116,16 +142,18 @@ func (s *Service) CreateEndpoint(req CreateEndpointRequest) (*Endpoint, error) {
 	}
 
 	return &Endpoint{
-		ID:        id,
-		Name:      req.Name,
-		URL:       req.URL,
-		APIPath:   req.APIPath,
-		APIKey:    req.APIKey,
-		Status:    StatusOffline,
-		Color:     req.Color,
-		LastCheck: now,
-		CreatedAt: now,
-		UpdatedAt: now,
+		ID:          id,
+		Name:        req.Name,
+		URL:         req.URL,
+		APIPath:     req.APIPath,
+		APIKey:      req.APIKey,
+		Status:      StatusOffline,
+		Color:       req.Color,
+		WorkspaceID: req.WorkspaceID,
+		Revision:    1,
+		LastCheck:   now,
+		CreatedAt:   now,
+		UpdatedAt:   now,
 	}, nil
 }
 
@@ -149,6 +177,9 @@ func (s *Service) UpdateEndpoint(req UpdateEndpointRequest) (*Endpoint, error) {
 		return nil, err
 	}
 	endpoint.Status = EndpointStatus(statusStr)
+	if endpoint.APIKey, err = secret.Reveal(endpoint.APIKey); err != nil {
+		return nil, err
+	}
 	if uptime.Valid {
 		uptimeVal := uptime.Int64
 		endpoint.Uptime = &uptimeVal
@@ -205,10 +236,20 @@ func (s *Service) UpdateEndpoint(req UpdateEndpointRequest) (*Endpoint, error) {
 			newAPIPath = req.APIPath
 		}
 
+		// 前端回传的脱敏占位值表示不修改 API Key
 		newAPIKey := endpoint.APIKey
-		if req.APIKey != "" {
+		if req.APIKey != "" && !secret.IsMasked(req.APIKey) {
 			newAPIKey = req.APIKey
 		}
+		// API Key 未变时沿用已有密文，否则重新保存相同配置也会递增修订号
+		var curKey string
+		if err := s.db.QueryRow(`SELECT apiKey FROM "Endpoint" WHERE id = ?`, req.ID).Scan(&curKey); err != nil {
+			return nil, err
+		}
+		storedKey, err := secret.Reprotect(curKey, newAPIKey)
+		if err != nil {
+			return nil, err
+		}
 
 		// 更新端点信息
 		query := `
@@ -220,7 +261,7 @@ func (s *Service) UpdateEndpoint(req UpdateEndpointRequest) (*Endpoint, error) {
 			newName,
 			newURL,
 			newAPIPath,
-			newAPIKey,
+			storedKey,
 			time.Now(),
 			req.ID,
 		)
@@ -235,6 +276,10 @@ func (s *Service) UpdateEndpoint(req UpdateEndpointRequest) (*Endpoint, error) {
 	}
 
 	endpoint.UpdatedAt = time.Now()
+	// 修订号由触发器在配置变化时递增，重新读取以便调用方返回新的 ETag
+	if err := s.db.QueryRow(`SELECT revision FROM "Endpoint" WHERE id = ?`, req.ID).Scan(&endpoint.Revision); err != nil {
+		return nil, err
+	}
 	return &endpoint, nil
 }
 
@@ -293,13 +338,23 @@ func (s *Service) UpdateEndpointStatus(id int64, status EndpointStatus) error {
 	return err
 }
 
+// EndpointVisible 判断端点是否属于可见工作区；不受限的范围直接返回 true，端点是否存在由调用方判断
+func (s *Service) EndpointVisible(id int64, scope workspace.Scope) bool {
+	if scope.All {
+		return true
+	}
+	var workspaceID int64
+	err := s.db.QueryRow(`SELECT workspaceId FROM "Endpoint" WHERE id = ?`, id).Scan(&workspaceID)
+	return err == nil && scope.Allows(workspaceID)
+}
+
 // GetEndpointByID 根据ID获取端点信息
 func (s *Service) GetEndpointByID(id int64) (*Endpoint, error) {
 	var e Endpoint
 	var statusStr sql.NullString
 	var uptime sql.NullInt64
-	err := s.db.QueryRow(`SELECT id, name, url, apiPath, apiKey, status, color, os, arch, ver, log, tls, crt, key_path, uptime, lastCheck, createdAt, updatedAt FROM "Endpoint" WHERE id = ?`, id).
-		Scan(&e.ID, &e.Name, &e.URL, &e.APIPath, &e.APIKey, &statusStr, &e.Color, &e.OS, &e.Arch, &e.Ver, &e.Log, &e.TLS, &e.Crt, &e.KeyPath, &uptime, &e.LastCheck, &e.CreatedAt, &e.UpdatedAt)
+	err := s.db.QueryRow(`SELECT id, name, url, apiPath, apiKey, status, color, os, arch, ver, log, tls, crt, key_path, uptime, workspaceId, revision, lastCheck, createdAt, updatedAt FROM "Endpoint" WHERE id = ?`, id).
+		Scan(&e.ID, &e.Name, &e.URL, &e.APIPath, &e.APIKey, &statusStr, &e.Color, &e.OS, &e.Arch, &e.Ver, &e.Log, &e.TLS, &e.Crt, &e.KeyPath, &uptime, &e.WorkspaceID, &e.Revision, &e.LastCheck, &e.CreatedAt, &e.UpdatedAt)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, errors.New("端点不存在")
@@ -307,6 +362,9 @@ func (s *Service) GetEndpointByID(id int64) (*Endpoint, error) {
 		return nil, err
 	}
 	e.Status = EndpointStatus(statusStr.String)
+	if e.APIKey, err = secret.Reveal(e.APIKey); err != nil {
+		return nil, err
+	}
 	if uptime.Valid {
 		uptimeVal := uptime.Int64
 		e.Uptime = &uptimeVal
@@ -330,15 +388,16 @@ type SimpleEndpoint struct {
 	Uptime      *int64         `json:"uptime,omitempty"`
 }
 
-// GetSimpleEndpoints 获取简化端点列表，可排除 FAIL
-func (s *Service) GetSimpleEndpoints(excludeFail bool) ([]SimpleEndpoint, error) {
-	query := `SELECT e.id, e.name, e.url, e.apiPath, e.status, e.tunnelCount, e.ver, e.tls, e.log, e.crt, e.key_path, e.uptime FROM "Endpoint" e`
+// GetSimpleEndpoints 获取可见工作区内的简化端点列表，可排除 FAIL
+func (s *Service) GetSimpleEndpoints(excludeFail bool, scope workspace.Scope) ([]SimpleEndpoint, error) {
+	cond, args := scope.Where("e.workspaceId")
+	query := `SELECT e.id, e.name, e.url, e.apiPath, e.status, e.tunnelCount, e.ver, e.tls, e.log, e.crt, e.key_path, e.uptime FROM "Endpoint" e WHERE ` + cond
 	if excludeFail {
-		query += ` WHERE e.status not in ('FAIL', 'DISCONNECT')`
+		query += ` AND e.status not in ('FAIL', 'DISCONNECT')`
 	}
 	query += ` ORDER BY e.createdAt DESC`
 
-	rows, err := s.db.Query(query)
+	rows, err := s.db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,130 @@
+package idempotency
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"NodePassDash/internal/secret"
+)
+
+const (
+	// TTL 幂等键的保留时间，过期后同一个键可重新使用
+	TTL = 24 * time.Hour
+	// processingTimeout 处理中的记录超过该时间视为已中断（如服务重启），允许重试接管
+	processingTimeout = 10 * time.Minute
+	// MaxKeyLength 幂等键的最大长度
+	MaxKeyLength = 255
+)
+
+var (
+	// ErrInProgress 使用相同幂等键的请求仍在处理中
+	ErrInProgress = errors.New("相同 Idempotency-Key 的请求正在处理中，请稍后重试")
+	// ErrMismatch 幂等键已用于内容不同的请求
+	ErrMismatch = errors.New("Idempotency-Key 已用于内容不同的请求")
+)
+
+// Record 已完成请求的响应
+type Record struct {
+	Status      int
+	ContentType string
+	Body        []byte
+	CreatedAt   time.Time
+}
+
+// Service 幂等键服务：记录请求摘要及响应，重试时重放原响应
+type Service struct {
+	db *sql.DB
+}
+
+// NewService 创建幂等键服务实例
+func NewService(db *sql.DB) *Service {
+	return &Service{db: db}
+}
+
+// RequestHash 计算请求摘要，同一幂等键的重试须与首次请求一致
+func RequestHash(method, path string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method + " " + path + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Begin 登记幂等键。首次使用（或原请求已中断）时返回 nil, nil，调用方处理请求后须调用 Complete 或 Abort；
+// 相同请求已完成时返回原响应；请求摘要不一致返回 ErrMismatch，原请求仍在处理中返回 ErrInProgress
+func (s *Service) Begin(actor, key, hash string) (*Record, error) {
+	now := time.Now().UTC()
+	if _, err := s.db.Exec(`DELETE FROM "IdempotencyKey" WHERE expiresAt < ?`, now); err != nil {
+		return nil, err
+	}
+
+	res, err := s.db.Exec(`
+		INSERT OR IGNORE INTO "IdempotencyKey" (actor, idempotencyKey, requestHash, createdAt, expiresAt)
+		VALUES (?, ?, ?, ?, ?)`, actor, key, hash, now, now.Add(TTL))
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 1 {
+		return nil, nil
+	}
+
+	var storedHash, contentType string
+	var status int
+	var body sql.NullString
+	var rec Record
+	err = s.db.QueryRow(`
+		SELECT requestHash, status, contentType, body, createdAt
+		FROM "IdempotencyKey" WHERE actor = ? AND idempotencyKey = ?`, actor, key,
+	).Scan(&storedHash, &status, &contentType, &body, &rec.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if storedHash != hash {
+		return nil, ErrMismatch
+	}
+
+	if status == 0 {
+		// 原请求处理超时未完成，由本次请求接管
+		res, err := s.db.Exec(`
+			UPDATE "IdempotencyKey" SET createdAt = ?, expiresAt = ?
+			WHERE actor = ? AND idempotencyKey = ? AND status = 0 AND createdAt < ?`,
+			now, now.Add(TTL), actor, key, now.Add(-processingTimeout))
+		if err != nil {
+			return nil, err
+		}
+		if n, _ := res.RowsAffected(); n == 1 {
+			return nil, nil
+		}
+		return nil, ErrInProgress
+	}
+
+	plain, err := secret.Reveal(body.String)
+	if err != nil {
+		return nil, err
+	}
+	rec.Status = status
+	rec.ContentType = contentType
+	rec.Body = []byte(plain)
+	return &rec, nil
+}
+
+// Complete 保存请求的响应，响应中可能包含隧道密码等敏感数据，启用加密时加密存储
+func (s *Service) Complete(actor, key string, status int, contentType string, body []byte) error {
+	stored, err := secret.Protect(string(body))
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`
+		UPDATE "IdempotencyKey" SET status = ?, contentType = ?, body = ?
+		WHERE actor = ? AND idempotencyKey = ?`,
+		status, contentType, stored, actor, key)
+	return err
+}
+
+// Abort 放弃幂等键，用于请求处理失败且可安全重试的情况
+func (s *Service) Abort(actor, key string) error {
+	_, err := s.db.Exec(`DELETE FROM "IdempotencyKey" WHERE actor = ? AND idempotencyKey = ? AND status = 0`, actor, key)
+	return err
+}
@@ -0,0 +1,172 @@
+package metrics
+
+import (
+	"database/sql"
+	"strconv"
+
+	log "NodePassDash/internal/log"
+	"NodePassDash/internal/models"
+	"NodePassDash/internal/sse"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "nodepassdash"
+
+var (
+	tunnelLabels   = []string{"endpoint_id", "endpoint", "tunnel_id", "tunnel", "tag"}
+	endpointLabels = []string{"endpoint_id", "endpoint"}
+
+	tunnelTCPRx = prometheus.NewDesc(namespace+"_tunnel_tcp_rx_bytes_total",
+		"隧道 TCP 接收字节数", tunnelLabels, nil)
+	tunnelTCPTx = prometheus.NewDesc(namespace+"_tunnel_tcp_tx_bytes_total",
+		"隧道 TCP 发送字节数", tunnelLabels, nil)
+	tunnelUDPRx = prometheus.NewDesc(namespace+"_tunnel_udp_rx_bytes_total",
+		"隧道 UDP 接收字节数", tunnelLabels, nil)
+	tunnelUDPTx = prometheus.NewDesc(namespace+"_tunnel_udp_tx_bytes_total",
+		"隧道 UDP 发送字节数", tunnelLabels, nil)
+	tunnelPool = prometheus.NewDesc(namespace+"_tunnel_pool_connections",
+		"隧道连接池中的连接数", tunnelLabels, nil)
+	tunnelPing = prometheus.NewDesc(namespace+"_tunnel_ping_seconds",
+		"隧道延迟", tunnelLabels, nil)
+	tunnelStatus = prometheus.NewDesc(namespace+"_tunnel_status",
+		"隧道状态，当前状态为 1，其余为 0", append(tunnelLabels, "status"), nil)
+
+	endpointConnected = prometheus.NewDesc(namespace+"_endpoint_connected",
+		"主控 SSE 连接是否已建立", endpointLabels, nil)
+	endpointReconnects = prometheus.NewDesc(namespace+"_endpoint_reconnect_attempts",
+		"主控自上次连接成功以来的重连尝试次数", endpointLabels, nil)
+
+	queueDepth = prometheus.NewDesc(namespace+"_sse_queue_depth",
+		"主控事件队列的当前长度", []string{"queue"}, nil)
+	queueCapacity = prometheus.NewDesc(namespace+"_sse_queue_capacity",
+		"主控事件队列的容量", []string{"queue"}, nil)
+	queueDropped = prometheus.NewDesc(namespace+"_sse_dropped_messages_total",
+		"因队列已满丢弃的主控事件数", []string{"queue"}, nil)
+)
+
+// tunnelStatuses 隧道状态的全部取值，每个隧道为每种状态各输出一条序列，便于告警
+var tunnelStatuses = []models.TunnelStatus{
+	models.TunnelStatusRunning,
+	models.TunnelStatusStopped,
+	models.TunnelStatusError,
+	models.TunnelStatusOffline,
+}
+
+// collector 在每次抓取时读取隧道、主控及事件队列的当前状态
+type collector struct {
+	db         *sql.DB
+	sseService *sse.Service
+	sseManager *sse.Manager
+}
+
+// Describe 实现 prometheus.Collector
+func (c *collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{
+		tunnelTCPRx, tunnelTCPTx, tunnelUDPRx, tunnelUDPTx, tunnelPool, tunnelPing, tunnelStatus,
+		endpointConnected, endpointReconnects, queueDepth, queueCapacity, queueDropped,
+	} {
+		ch <- d
+	}
+}
+
+// Collect 实现 prometheus.Collector
+func (c *collector) Collect(ch chan<- prometheus.Metric) {
+	if err := c.collectTunnels(ch); err != nil {
+		log.Errorf("[Metrics] 读取隧道指标失败: %v", err)
+	}
+	if err := c.collectEndpoints(ch); err != nil {
+		log.Errorf("[Metrics] 读取主控指标失败: %v", err)
+	}
+
+	depth, capacity, dropped := c.sseManager.QueueStats()
+	ch <- prometheus.MustNewConstMetric(queueDepth, prometheus.GaugeValue, float64(depth), "process")
+	ch <- prometheus.MustNewConstMetric(queueCapacity, prometheus.GaugeValue, float64(capacity), "process")
+	ch <- prometheus.MustNewConstMetric(queueDropped, prometheus.CounterValue, float64(dropped), "process")
+
+	depth, capacity, dropped = c.sseService.StoreQueueStats()
+	ch <- prometheus.MustNewConstMetric(queueDepth, prometheus.GaugeValue, float64(depth), "store")
+	ch <- prometheus.MustNewConstMetric(queueCapacity, prometheus.GaugeValue, float64(capacity), "store")
+	ch <- prometheus.MustNewConstMetric(queueDropped, prometheus.CounterValue, float64(dropped), "store")
+}
+
+// collectTunnels 输出每个隧道的流量、连接池、延迟及状态；多个标签以逗号连接
+func (c *collector) collectTunnels(ch chan<- prometheus.Metric) error {
+	rows, err := c.db.Query(`
+		SELECT t.id, t.name, t.status, COALESCE(t.tcpRx, 0), COALESCE(t.tcpTx, 0), COALESCE(t.udpRx, 0), COALESCE(t.udpTx, 0),
+			COALESCE(t.pool, 0), t.ping, e.id, e.name,
+			COALESCE((SELECT GROUP_CONCAT(name, ',') FROM (
+				SELECT tg.name FROM TunnelTags tt JOIN Tags tg ON tg.id = tt.tag_id WHERE tt.tunnel_id = t.id ORDER BY tg.name
+			)), '')
+		FROM "Tunnel" t
+		JOIN "Endpoint" e ON e.id = t.endpointId
+		ORDER BY t.id`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			tunnelID, endpointID            int64
+			name, status, endpointName, tag string
+			tcpRx, tcpTx, udpRx, udpTx      int64
+			pool                            int64
+			ping                            sql.NullInt64
+		)
+		if err := rows.Scan(&tunnelID, &name, &status, &tcpRx, &tcpTx, &udpRx, &udpTx,
+			&pool, &ping, &endpointID, &endpointName, &tag); err != nil {
+			return err
+		}
+		labels := []string{strconv.FormatInt(endpointID, 10), endpointName, strconv.FormatInt(tunnelID, 10), name, tag}
+
+		ch <- prometheus.MustNewConstMetric(tunnelTCPRx, prometheus.CounterValue, float64(tcpRx), labels...)
+		ch <- prometheus.MustNewConstMetric(tunnelTCPTx, prometheus.CounterValue, float64(tcpTx), labels...)
+		ch <- prometheus.MustNewConstMetric(tunnelUDPRx, prometheus.CounterValue, float64(udpRx), labels...)
+		ch <- prometheus.MustNewConstMetric(tunnelUDPTx, prometheus.CounterValue, float64(udpTx), labels...)
+		ch <- prometheus.MustNewConstMetric(tunnelPool, prometheus.GaugeValue, float64(pool), labels...)
+		// NodePass 上报的延迟单位为毫秒；尚未测得延迟时不输出，避免被当作 0 延迟
+		if ping.Valid {
+			ch <- prometheus.MustNewConstMetric(tunnelPing, prometheus.GaugeValue, float64(ping.Int64)/1000, labels...)
+		}
+		for _, st := range tunnelStatuses {
+			v := 0.0
+			if status == string(st) {
+				v = 1
+			}
+			ch <- prometheus.MustNewConstMetric(tunnelStatus, prometheus.GaugeValue, v, append(labels, string(st))...)
+		}
+	}
+	return rows.Err()
+}
+
+// collectEndpoints 输出每个主控的 SSE 连接状态；未建立连接的主控视为未连接
+func (c *collector) collectEndpoints(ch chan<- prometheus.Metric) error {
+	states := make(map[int64]sse.ConnectionState)
+	for _, st := range c.sseManager.ConnectionStates() {
+		states[st.EndpointID] = st
+	}
+
+	rows, err := c.db.Query(`SELECT id, name FROM "Endpoint" ORDER BY id`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return err
+		}
+		labels := []string{strconv.FormatInt(id, 10), name}
+		st := states[id]
+		connected := 0.0
+		if st.Connected {
+			connected = 1
+		}
+		ch <- prometheus.MustNewConstMetric(endpointConnected, prometheus.GaugeValue, connected, labels...)
+		ch <- prometheus.MustNewConstMetric(endpointReconnects, prometheus.GaugeValue, float64(st.ReconnectAttempts), labels...)
+	}
+	return rows.Err()
+}
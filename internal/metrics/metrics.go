@@ -0,0 +1,101 @@
+package metrics
+
+import (
+	"bufio"
+	"database/sql"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"NodePassDash/internal/sse"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Service Prometheus 指标服务
+type Service struct {
+	registry        *prometheus.Registry
+	requestDuration *prometheus.HistogramVec
+}
+
+// NewService 创建指标服务实例，隧道与主控指标在抓取时实时读取
+func NewService(db *sql.DB, sseService *sse.Service, sseManager *sse.Manager) *Service {
+	s := &Service{
+		registry: prometheus.NewRegistry(),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "API 请求处理耗时",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route", "code"}),
+	}
+	s.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		&collector{db: db, sseService: sseService, sseManager: sseManager},
+		s.requestDuration,
+	)
+	return s
+}
+
+// Handler 返回 Prometheus 文本格式的指标
+func (s *Service) Handler() http.Handler {
+	return promhttp.HandlerFor(s.registry, promhttp.HandlerOpts{})
+}
+
+// Middleware 记录 API 请求耗时；route 为路由模板以控制序列数量，
+// 持续推送的 SSE 及 WebSocket 请求不计入
+func (s *Service) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := r.URL.Path
+		if cur := mux.CurrentRoute(r); cur != nil {
+			if tpl, err := cur.GetPathTemplate(); err == nil {
+				route = tpl
+			}
+		}
+
+		start := time.Now()
+		rw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rw, r)
+		if rw.streaming || strings.HasPrefix(rw.Header().Get("Content-Type"), "text/event-stream") {
+			return
+		}
+		s.requestDuration.WithLabelValues(r.Method, route, strconv.Itoa(rw.status)).Observe(time.Since(start).Seconds())
+	})
+}
+
+// statusWriter 记录响应状态码
+type statusWriter struct {
+	http.ResponseWriter
+	status    int
+	streaming bool
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Flush 支持 SSE 等流式响应，调用过 Flush 的请求不计入耗时统计
+func (w *statusWriter) Flush() {
+	w.streaming = true
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap 供 http.ResponseController 访问底层 ResponseWriter
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Hijack 支持 WebSocket 升级，升级后的连接不计入耗时统计
+func (w *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.streaming = true
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
@@ -0,0 +1,258 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha512" // 注册 SHA-384 / SHA-512，供 RS384、ES512 等算法使用
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// jwk JSON Web Key 中用到的字段
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// publicKey 解析后的签名公钥
+type publicKey struct {
+	kid string
+	key crypto.PublicKey
+}
+
+// jwksCache 按 JWKS 地址缓存已获取的公钥。Provider 在每次登录时重新创建，缓存放在包级别；
+// 只有遇到缓存中没有的 kid（签名密钥轮换）时才重新获取
+var (
+	jwksCacheMu sync.Mutex
+	jwksCache   = make(map[string][]publicKey)
+)
+
+// cachedJWKS 返回 jwksURI 的公钥，缓存中找不到 kid 时重新获取；
+// kid 为空时只要已有缓存即直接使用，由调用方在验签失败后通过 refreshJWKS 重试
+func cachedJWKS(ctx context.Context, client *http.Client, jwksURI, kid string) ([]publicKey, error) {
+	jwksCacheMu.Lock()
+	keys, ok := jwksCache[jwksURI]
+	jwksCacheMu.Unlock()
+	if ok && (kid == "" || hasKeyID(keys, kid)) {
+		return keys, nil
+	}
+	return refreshJWKS(ctx, client, jwksURI)
+}
+
+// refreshJWKS 重新获取 JWKS 并替换缓存
+func refreshJWKS(ctx context.Context, client *http.Client, jwksURI string) ([]publicKey, error) {
+	keys, err := fetchJWKS(ctx, client, jwksURI)
+	if err != nil {
+		return nil, err
+	}
+	jwksCacheMu.Lock()
+	jwksCache[jwksURI] = keys
+	jwksCacheMu.Unlock()
+	return keys, nil
+}
+
+// hasKeyID 判断公钥集合中是否有指定 kid
+func hasKeyID(keys []publicKey, kid string) bool {
+	for _, k := range keys {
+		if k.kid == kid {
+			return true
+		}
+	}
+	return false
+}
+
+// fetchJWKS 获取并解析 JWKS，忽略非签名用途及不支持的密钥类型
+func fetchJWKS(ctx context.Context, client *http.Client, jwksURI string) ([]publicKey, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := getJSON(ctx, client, jwksURI, &set); err != nil {
+		return nil, err
+	}
+
+	keys := make([]publicKey, 0, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			continue
+		}
+		keys = append(keys, publicKey{kid: k.Kid, key: key})
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("JWKS 中没有可用的签名公钥")
+	}
+	return keys, nil
+}
+
+// publicKey 将 JWK 转换为 RSA 或 ECDSA 公钥
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("不支持的曲线 %s", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("不支持的密钥类型 %s", k.Kty)
+}
+
+// jwtHeader JWS 头部中用到的字段
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// parseJWT 拆分 JWS 紧凑序列化并解析头部
+func parseJWT(raw string) (jwtHeader, []string, error) {
+	var header jwtHeader
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return header, nil, errors.New("ID Token 格式错误")
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return header, nil, errors.New("ID Token 头部解码失败")
+	}
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return header, nil, errors.New("ID Token 头部解析失败")
+	}
+	return header, parts, nil
+}
+
+// verifyJWT 校验 JWS 紧凑序列化的签名并返回载荷声明
+func verifyJWT(raw string, keys []publicKey) (Claims, error) {
+	header, parts, err := parseJWT(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	hash, err := hashForAlg(header.Alg)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("ID Token 签名解码失败")
+	}
+
+	h := hash.New()
+	h.Write([]byte(parts[0] + "." + parts[1]))
+	digest := h.Sum(nil)
+
+	verified := false
+	for _, k := range keys {
+		if header.Kid != "" && k.kid != "" && k.kid != header.Kid {
+			continue
+		}
+		if verifySignature(header.Alg, hash, k.key, digest, sig) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, errors.New("ID Token 签名校验失败")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errors.New("ID Token 载荷解码失败")
+	}
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, errors.New("ID Token 载荷解析失败")
+	}
+	return claims, nil
+}
+
+// hashForAlg 返回签名算法对应的摘要算法，拒绝 none 及 HMAC 等算法
+func hashForAlg(alg string) (crypto.Hash, error) {
+	switch alg {
+	case "RS256", "PS256", "ES256":
+		return crypto.SHA256, nil
+	case "RS384", "PS384", "ES384":
+		return crypto.SHA384, nil
+	case "RS512", "PS512", "ES512":
+		return crypto.SHA512, nil
+	}
+	return 0, fmt.Errorf("不支持的签名算法 %s", alg)
+}
+
+// verifySignature 按算法族校验签名，公钥类型须与算法匹配
+func verifySignature(alg string, hash crypto.Hash, key crypto.PublicKey, digest, sig []byte) bool {
+	switch alg[:2] {
+	case "RS":
+		pub, ok := key.(*rsa.PublicKey)
+		return ok && rsa.VerifyPKCS1v15(pub, hash, digest, sig) == nil
+	case "PS":
+		pub, ok := key.(*rsa.PublicKey)
+		return ok && rsa.VerifyPSS(pub, hash, digest, sig, nil) == nil
+	case "ES":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return false
+		}
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return false
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		return ecdsa.Verify(pub, digest, r, s)
+	}
+	return false
+}
+
+// decodeBigInt 解码 Base64URL 编码的大整数
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
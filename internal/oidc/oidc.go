@@ -0,0 +1,341 @@
+// Package oidc 实现通用 OpenID Connect 授权码登录（Discovery、PKCE、基于 JWKS 的 ID Token 验签），
+// 仅依赖标准库，所有网络请求都通过调用方传入的 http.Client 发出，便于对接本地模拟的 Issuer。
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultUsernameClaim 未配置时用作用户名的声明
+const DefaultUsernameClaim = "preferred_username"
+
+// DefaultGroupsClaim 未配置时用作分组的声明
+const DefaultGroupsClaim = "groups"
+
+// clockSkew 校验 exp / iat 时允许的时钟误差
+const clockSkew = 2 * time.Minute
+
+// Config OIDC 提供者配置，保存在 oauth2_config 中
+type Config struct {
+	Issuer       string   `json:"issuer"`
+	ClientID     string   `json:"clientId"`
+	ClientSecret string   `json:"clientSecret"`
+	RedirectURI  string   `json:"redirectUri"`
+	Scopes       []string `json:"scopes"`
+	// UsernameClaim 作为用户名的声明，支持以 . 分隔的嵌套路径
+	UsernameClaim string `json:"usernameClaim"`
+	// GroupsClaim 分组声明，支持以 . 分隔的嵌套路径（如 Keycloak 的 realm_access.roles）
+	GroupsClaim string `json:"groupsClaim"`
+	// GroupRoles 分组到本地角色（admin / operator / viewer）的映射
+	GroupRoles map[string]string `json:"groupRoles"`
+	// DefaultRole 配置了 GroupRoles 但未命中任何分组时使用的角色，为空表示拒绝登录
+	DefaultRole string `json:"defaultRole"`
+}
+
+// Discovery OpenID Provider 元数据（/.well-known/openid-configuration）
+type Discovery struct {
+	Issuer                string   `json:"issuer"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	UserinfoEndpoint      string   `json:"userinfo_endpoint"`
+	JWKSURI               string   `json:"jwks_uri"`
+	CodeChallengeMethods  []string `json:"code_challenge_methods_supported"`
+}
+
+// Claims ID Token 中的声明
+type Claims map[string]interface{}
+
+// Provider 完成一次发现后的 OIDC 提供者
+type Provider struct {
+	cfg       Config
+	client    *http.Client
+	discovery Discovery
+}
+
+// NewProvider 读取 Issuer 的发现文档并校验其 issuer 与配置一致
+func NewProvider(ctx context.Context, cfg Config, client *http.Client) (*Provider, error) {
+	if cfg.Issuer == "" || cfg.ClientID == "" {
+		return nil, errors.New("OIDC 配置不完整：缺少 issuer 或 clientId")
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	issuer := strings.TrimSuffix(cfg.Issuer, "/")
+	var d Discovery
+	if err := getJSON(ctx, client, issuer+"/.well-known/openid-configuration", &d); err != nil {
+		return nil, fmt.Errorf("获取 OIDC 发现文档失败: %v", err)
+	}
+	if strings.TrimSuffix(d.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("发现文档 issuer 不匹配: %s", d.Issuer)
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return nil, errors.New("发现文档缺少必要的端点")
+	}
+
+	return &Provider{cfg: cfg, client: client, discovery: d}, nil
+}
+
+// Discovery 返回发现文档
+func (p *Provider) Discovery() Discovery {
+	return p.discovery
+}
+
+// NewPKCE 生成 PKCE code_verifier 及其 S256 code_challenge
+func NewPKCE() (verifier, challenge string, err error) {
+	verifier, err = randomString(32)
+	if err != nil {
+		return "", "", err
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// NewNonce 生成 ID Token 防重放使用的 nonce
+func NewNonce() (string, error) {
+	return randomString(16)
+}
+
+// AuthCodeURL 构造授权地址
+func (p *Provider) AuthCodeURL(state, nonce, codeChallenge string) string {
+	scopes := p.cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"openid", "profile", "email"}
+	}
+	hasOpenID := false
+	for _, s := range scopes {
+		if s == "openid" {
+			hasOpenID = true
+		}
+	}
+	if !hasOpenID {
+		scopes = append([]string{"openid"}, scopes...)
+	}
+
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", p.cfg.ClientID)
+	q.Set("redirect_uri", p.cfg.RedirectURI)
+	q.Set("scope", strings.Join(scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", codeChallenge)
+	q.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(p.discovery.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return p.discovery.AuthorizationEndpoint + sep + q.Encode()
+}
+
+// Exchange 使用授权码与 code_verifier 换取令牌，并校验返回的 ID Token
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (Claims, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.cfg.RedirectURI)
+	form.Set("client_id", p.cfg.ClientID)
+	form.Set("code_verifier", codeVerifier)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.cfg.ClientSecret != "" {
+		// client_secret_basic，按 RFC 6749 2.3.1 先做表单编码
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("请求令牌失败: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("令牌端点返回 %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var token struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.Unmarshal(body, &token); err != nil {
+		return nil, fmt.Errorf("解析令牌响应失败: %v", err)
+	}
+	if token.IDToken == "" {
+		return nil, errors.New("令牌响应中缺少 id_token")
+	}
+
+	return p.VerifyIDToken(ctx, token.IDToken, nonce)
+}
+
+// VerifyIDToken 使用 JWKS（按 kid 缓存）校验 ID Token 签名，并检查 iss / aud / azp / exp / iat / nonce
+func (p *Provider) VerifyIDToken(ctx context.Context, raw, nonce string) (Claims, error) {
+	header, _, err := parseJWT(raw)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := cachedJWKS(ctx, p.client, p.discovery.JWKSURI, header.Kid)
+	if err != nil {
+		return nil, fmt.Errorf("获取 JWKS 失败: %v", err)
+	}
+
+	claims, err := verifyJWT(raw, keys)
+	if err != nil && header.Kid == "" {
+		// 未声明 kid 时无法判断密钥是否已轮换，验签失败后重新获取一次
+		if keys, ferr := refreshJWKS(ctx, p.client, p.discovery.JWKSURI); ferr == nil {
+			claims, err = verifyJWT(raw, keys)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if iss, _ := claims["iss"].(string); strings.TrimSuffix(iss, "/") != strings.TrimSuffix(p.discovery.Issuer, "/") {
+		return nil, errors.New("ID Token issuer 不匹配")
+	}
+	if !claims.hasAudience(p.cfg.ClientID) {
+		return nil, errors.New("ID Token audience 不匹配")
+	}
+	if azp, ok := claims["azp"].(string); ok && azp != "" && azp != p.cfg.ClientID {
+		return nil, errors.New("ID Token azp 不匹配")
+	}
+
+	now := time.Now()
+	exp, ok := claims.numeric("exp")
+	if !ok || now.After(time.Unix(exp, 0).Add(clockSkew)) {
+		return nil, errors.New("ID Token 已过期")
+	}
+	if iat, ok := claims.numeric("iat"); ok && time.Unix(iat, 0).After(now.Add(clockSkew)) {
+		return nil, errors.New("ID Token 签发时间无效")
+	}
+	if got, _ := claims["nonce"].(string); got != nonce {
+		return nil, errors.New("ID Token nonce 不匹配")
+	}
+	if sub, _ := claims["sub"].(string); sub == "" {
+		return nil, errors.New("ID Token 缺少 sub")
+	}
+
+	return claims, nil
+}
+
+// Subject 返回 sub 声明，作为第三方身份的唯一标识
+func (c Claims) Subject() string {
+	sub, _ := c["sub"].(string)
+	return sub
+}
+
+// Username 按配置的声明读取用户名
+func (c Claims) Username(cfg Config) (string, error) {
+	claim := cfg.UsernameClaim
+	if claim == "" {
+		claim = DefaultUsernameClaim
+	}
+	v, ok := c.lookup(claim).(string)
+	if !ok || strings.TrimSpace(v) == "" {
+		return "", fmt.Errorf("ID Token 中缺少用户名声明 %s", claim)
+	}
+	return strings.TrimSpace(v), nil
+}
+
+// Groups 按配置的声明读取分组，兼容字符串数组与单个字符串
+func (c Claims) Groups(cfg Config) []string {
+	claim := cfg.GroupsClaim
+	if claim == "" {
+		claim = DefaultGroupsClaim
+	}
+	switch v := c.lookup(claim).(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		groups := make([]string, 0, len(v))
+		for _, g := range v {
+			if s, ok := g.(string); ok {
+				groups = append(groups, s)
+			}
+		}
+		return groups
+	}
+	return nil
+}
+
+// lookup 按 . 分隔的路径读取嵌套声明
+func (c Claims) lookup(path string) interface{} {
+	var cur interface{} = map[string]interface{}(c)
+	for _, part := range strings.Split(path, ".") {
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		cur = m[part]
+	}
+	return cur
+}
+
+// hasAudience 判断 aud 是否包含指定客户端
+func (c Claims) hasAudience(clientID string) bool {
+	switch aud := c["aud"].(type) {
+	case string:
+		return aud == clientID
+	case []interface{}:
+		for _, a := range aud {
+			if s, ok := a.(string); ok && s == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// numeric 读取数值型声明（JSON 数字解码为 float64）
+func (c Claims) numeric(name string) (int64, bool) {
+	switch v := c[name].(type) {
+	case float64:
+		return int64(v), true
+	case json.Number:
+		n, err := v.Int64()
+		return n, err == nil
+	}
+	return 0, false
+}
+
+// getJSON 发起 GET 请求并解析 JSON 响应
+func getJSON(ctx context.Context, client *http.Client, rawURL string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s 返回 %d", rawURL, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(out)
+}
+
+// randomString 生成 URL 安全的随机字符串
+func randomString(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
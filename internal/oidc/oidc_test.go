@@ -0,0 +1,296 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testClientID = "dashboard"
+
+// stubIssuer 本地模拟的 OpenID Provider：发现文档、JWKS 及校验 PKCE 的令牌端点
+type stubIssuer struct {
+	t   *testing.T
+	srv *httptest.Server
+
+	mu      sync.Mutex
+	key     *rsa.PrivateKey
+	kid     string
+	pending map[string]pendingCode // 授权码 -> 授权请求中的参数
+
+	jwksFetches atomic.Int32
+	// claims 签发 ID Token 前修改声明，nil 表示使用默认声明
+	claims func(Claims)
+	// signer 用于签名的私钥，nil 表示使用 JWKS 中发布的私钥
+	signer *rsa.PrivateKey
+}
+
+type pendingCode struct {
+	challenge string
+	nonce     string
+}
+
+func newStubIssuer(t *testing.T) *stubIssuer {
+	t.Helper()
+	s := &stubIssuer{t: t, pending: make(map[string]pendingCode)}
+	s.rotate("key-1")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(Discovery{
+			Issuer:                s.srv.URL,
+			AuthorizationEndpoint: s.srv.URL + "/authorize",
+			TokenEndpoint:         s.srv.URL + "/token",
+			JWKSURI:               s.srv.URL + "/jwks",
+			CodeChallengeMethods:  []string{"S256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		s.jwksFetches.Add(1)
+		s.mu.Lock()
+		pub := s.key.PublicKey
+		kid := s.kid
+		s.mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []jwk{{
+			Kty: "RSA",
+			Kid: kid,
+			Use: "sig",
+			Alg: "RS256",
+			N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		s.mu.Lock()
+		p, ok := s.pending[r.PostForm.Get("code")]
+		delete(s.pending, r.PostForm.Get("code"))
+		s.mu.Unlock()
+		sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != p.challenge {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": s.idToken(p.nonce)})
+	})
+	s.srv = httptest.NewServer(mux)
+	t.Cleanup(s.srv.Close)
+	return s
+}
+
+// rotate 生成新的签名密钥并以 kid 发布
+func (s *stubIssuer) rotate(kid string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	s.mu.Lock()
+	s.key, s.kid = key, kid
+	s.mu.Unlock()
+}
+
+// authorize 模拟用户在授权页同意，返回授权码
+func (s *stubIssuer) authorize(authURL string) string {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("client_id") != testClientID {
+		s.t.Fatalf("unexpected authorization request: %s", authURL)
+	}
+	code := "code-" + q.Get("state")
+	s.mu.Lock()
+	s.pending[code] = pendingCode{challenge: q.Get("code_challenge"), nonce: q.Get("nonce")}
+	s.mu.Unlock()
+	return code
+}
+
+// idToken 签发 ID Token
+func (s *stubIssuer) idToken(nonce string) string {
+	now := time.Now()
+	claims := Claims{
+		"iss":                s.srv.URL,
+		"sub":                "user-1",
+		"aud":                testClientID,
+		"exp":                now.Add(time.Hour).Unix(),
+		"iat":                now.Unix(),
+		"nonce":              nonce,
+		"preferred_username": "alice",
+	}
+	if s.claims != nil {
+		s.claims(claims)
+	}
+
+	s.mu.Lock()
+	key, kid := s.key, s.kid
+	s.mu.Unlock()
+	if s.signer != nil {
+		key = s.signer
+	}
+
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signing := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signing))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	return signing + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// login 走完一次授权码流程；tamper 可在换取令牌前修改 code_verifier 或 nonce
+func (s *stubIssuer) login(tamper func(verifier, nonce *string)) (Claims, error) {
+	ctx := context.Background()
+	provider, err := NewProvider(ctx, Config{Issuer: s.srv.URL, ClientID: testClientID, RedirectURI: "http://localhost/callback"}, s.srv.Client())
+	if err != nil {
+		s.t.Fatalf("NewProvider: %v", err)
+	}
+	verifier, challenge, err := NewPKCE()
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	nonce, err := NewNonce()
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	code := s.authorize(provider.AuthCodeURL("state1", nonce, challenge))
+	if tamper != nil {
+		tamper(&verifier, &nonce)
+	}
+	return provider.Exchange(ctx, code, verifier, nonce)
+}
+
+func TestExchangeVerifiesIDToken(t *testing.T) {
+	s := newStubIssuer(t)
+	claims, err := s.login(nil)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if claims.Subject() != "user-1" {
+		t.Fatalf("sub = %q, want user-1", claims.Subject())
+	}
+	if username, err := claims.Username(Config{}); err != nil || username != "alice" {
+		t.Fatalf("username = %q, %v; want alice", username, err)
+	}
+}
+
+func TestExchangeRejectsInvalidTokens(t *testing.T) {
+	cases := []struct {
+		name   string
+		setup  func(s *stubIssuer)
+		tamper func(verifier, nonce *string)
+		want   string
+	}{
+		{
+			name:   "pkce verifier mismatch",
+			tamper: func(verifier, nonce *string) { *verifier = "wrong-verifier" },
+			want:   "令牌端点返回 400",
+		},
+		{
+			name:   "nonce mismatch",
+			tamper: func(verifier, nonce *string) { *nonce = "other-nonce" },
+			want:   "nonce",
+		},
+		{
+			name:  "audience mismatch",
+			setup: func(s *stubIssuer) { s.claims = func(c Claims) { c["aud"] = "another-client" } },
+			want:  "audience",
+		},
+		{
+			name:  "expired",
+			setup: func(s *stubIssuer) { s.claims = func(c Claims) { c["exp"] = time.Now().Add(-time.Hour).Unix() } },
+			want:  "过期",
+		},
+		{
+			name:  "missing exp",
+			setup: func(s *stubIssuer) { s.claims = func(c Claims) { delete(c, "exp") } },
+			want:  "过期",
+		},
+		{
+			name: "signed by unpublished key",
+			setup: func(s *stubIssuer) {
+				key, err := rsa.GenerateKey(rand.Reader, 2048)
+				if err != nil {
+					t.Fatal(err)
+				}
+				s.signer = key
+			},
+			want: "签名校验失败",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s := newStubIssuer(t)
+			if c.setup != nil {
+				c.setup(s)
+			}
+			_, err := s.login(c.tamper)
+			if err == nil || !strings.Contains(err.Error(), c.want) {
+				t.Fatalf("err = %v, want error containing %q", err, c.want)
+			}
+		})
+	}
+}
+
+func TestVerifyIDTokenRejectsAlgNone(t *testing.T) {
+	s := newStubIssuer(t)
+	provider, err := NewProvider(context.Background(), Config{Issuer: s.srv.URL, ClientID: testClientID}, s.srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := s.idToken("n")
+	parts := strings.Split(token, ".")
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","kid":"key-1"}`))
+	if _, err := provider.VerifyIDToken(context.Background(), header+"."+parts[1]+".", "n"); err == nil {
+		t.Fatal("alg none should be rejected")
+	}
+}
+
+func TestJWKSCachedUntilUnknownKid(t *testing.T) {
+	s := newStubIssuer(t)
+	for i := 0; i < 3; i++ {
+		if _, err := s.login(nil); err != nil {
+			t.Fatalf("login %d: %v", i, err)
+		}
+	}
+	if n := s.jwksFetches.Load(); n != 1 {
+		t.Fatalf("jwks fetches = %d, want 1", n)
+	}
+
+	// 已知 kid 的签名错误不应触发重新获取
+	s.signer, _ = rsa.GenerateKey(rand.Reader, 2048)
+	if _, err := s.login(nil); err == nil {
+		t.Fatal("forged token should be rejected")
+	}
+	s.signer = nil
+	if n := s.jwksFetches.Load(); n != 1 {
+		t.Fatalf("jwks fetches after bad signature = %d, want 1", n)
+	}
+
+	// 密钥轮换后出现新的 kid，重新获取一次
+	s.rotate("key-2")
+	if _, err := s.login(nil); err != nil {
+		t.Fatalf("login after rotation: %v", err)
+	}
+	if _, err := s.login(nil); err != nil {
+		t.Fatalf("second login after rotation: %v", err)
+	}
+	if n := s.jwksFetches.Load(); n != 2 {
+		t.Fatalf("jwks fetches after rotation = %d, want 2", n)
+	}
+}
@@ -0,0 +1,105 @@
+package secret
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+// Masked 返回给前端的敏感字段占位值；更新接口收到该值时视为“保持不变”
+const Masked = "******"
+
+// urlCredentialPattern URL 中的凭据部分，如 server://password@host
+var urlCredentialPattern = regexp.MustCompile(`://[^/@\s"]+@`)
+
+// maskedKeys 响应中需要脱敏的字段（小写、去掉 _ 与 -）；
+// API 令牌、两步验证密钥等仅在创建时展示一次的值不在此列
+var maskedKeys = map[string]bool{
+	"apikey":       true,
+	"password":     true,
+	"clientsecret": true,
+}
+
+// IsMasked 判断值是否为脱敏占位值
+func IsMasked(v string) bool {
+	return v == Masked
+}
+
+// MaskURL 隐藏字符串中 URL 携带的凭据
+func MaskURL(s string) string {
+	return urlCredentialPattern.ReplaceAllString(s, "://"+Masked+"@")
+}
+
+// RedactJSON 对 JSON 数据脱敏：敏感字段替换为占位值，字符串中 URL 携带的凭据同样隐藏；
+// 不含敏感内容或无法解析时原样返回
+func RedactJSON(data []byte) []byte {
+	if !mayContainSecret(data) {
+		return data
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return data
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(redactValue(v)); err != nil {
+		return data
+	}
+	out := buf.Bytes()
+	if !bytes.HasSuffix(data, []byte("\n")) {
+		out = bytes.TrimSuffix(out, []byte("\n"))
+	}
+	return out
+}
+
+// mayContainSecret 快速判断数据中是否可能含有敏感内容，避免对每条消息都完整解析
+func mayContainSecret(data []byte) bool {
+	if bytes.Contains(data, []byte("@")) {
+		return true
+	}
+	lower := bytes.ToLower(data)
+	for _, hint := range []string{"apikey", "api_key", "api-key", "password", "secret"} {
+		if bytes.Contains(lower, []byte(hint)) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactValue 递归脱敏通用 JSON 结构
+func redactValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, item := range val {
+			if isMaskedKey(k) {
+				if s, ok := item.(string); ok && s == "" {
+					continue
+				}
+				if item != nil {
+					val[k] = Masked
+				}
+				continue
+			}
+			val[k] = redactValue(item)
+		}
+		return val
+	case []interface{}:
+		for i, item := range val {
+			val[i] = redactValue(item)
+		}
+		return val
+	case string:
+		return MaskURL(val)
+	}
+	return v
+}
+
+// isMaskedKey 判断字段名是否需要脱敏
+func isMaskedKey(key string) bool {
+	return maskedKeys[strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(key))]
+}
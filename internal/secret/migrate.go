@@ -0,0 +1,206 @@
+package secret
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+
+	log "NodePassDash/internal/log"
+)
+
+// column 存放敏感数据的数据表字段
+type column struct {
+	table string
+	name  string
+}
+
+// columns 需要加密存储的字段
+var columns = []column{
+	{"Endpoint", "apiKey"},
+	{"Tunnel", "password"},
+	{"TunnelRecycle", "password"},
+	{"Webhook", "secret"},
+}
+
+// commandLineColumns 保存实例 URL 的字段；其中的密码已单独加密存储，URL 只保留隐藏凭据后的形式
+var commandLineColumns = []column{
+	{"Tunnel", "commandLine"},
+	{"TunnelRecycle", "commandLine"},
+}
+
+// LoadKeys 读取主密钥：优先使用 keyFile（第一行为当前密钥，其余行为轮换前的旧密钥），
+// 否则读取环境变量 NODEPASS_MASTER_KEY 与 NODEPASS_MASTER_KEY_PREVIOUS（逗号分隔）
+func LoadKeys(keyFile string) error {
+	if keyFile != "" {
+		data, err := os.ReadFile(keyFile)
+		if err != nil {
+			return fmt.Errorf("读取主密钥文件失败: %v", err)
+		}
+		var lines []string
+		for _, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+			if line != "" && !strings.HasPrefix(line, "#") {
+				lines = append(lines, line)
+			}
+		}
+		if len(lines) == 0 {
+			return fmt.Errorf("主密钥文件 %s 为空", keyFile)
+		}
+		return Configure(lines[0], lines[1:])
+	}
+	return Configure(os.Getenv("NODEPASS_MASTER_KEY"), strings.Split(os.Getenv("NODEPASS_MASTER_KEY_PREVIOUS"), ","))
+}
+
+// Migrate 将敏感字段统一为当前主密钥加密：明文数据加密，旧密钥加密的数据重新加密数据密钥。
+// 未启用加密时不做修改，仅检查是否存在无法解密的数据；实例 URL 中的明文密码始终隐藏
+func Migrate(db *sql.DB) error {
+	for _, c := range columns {
+		updated, failed, err := migrateColumn(db, c)
+		if err != nil {
+			return fmt.Errorf("迁移 %s.%s 失败: %v", c.table, c.name, err)
+		}
+		if updated > 0 {
+			log.Infof("[密钥] 已使用当前主密钥加密 %s.%s 共 %d 条记录", c.table, c.name, updated)
+		}
+		if failed > 0 {
+			log.Errorf("[密钥] %s.%s 有 %d 条记录无法解密，请检查主密钥配置", c.table, c.name, failed)
+		}
+	}
+	for _, c := range commandLineColumns {
+		updated, err := maskCommandLines(db, c)
+		if err != nil {
+			return fmt.Errorf("迁移 %s.%s 失败: %v", c.table, c.name, err)
+		}
+		if updated > 0 {
+			log.Infof("[密钥] 已隐藏 %s.%s 中 %d 条记录的明文密码", c.table, c.name, updated)
+		}
+	}
+	return nil
+}
+
+// maskCommandLines 隐藏实例 URL 中的凭据，已处理过的记录不会再次更新；无论是否启用加密都会执行
+func maskCommandLines(db *sql.DB, c column) (int, error) {
+	rows, err := db.Query(fmt.Sprintf(`SELECT id, %s FROM "%s" WHERE %s LIKE '%%@%%'`, c.name, c.table, c.name))
+	if err != nil {
+		return 0, err
+	}
+	masked := map[int64]string{}
+	for rows.Next() {
+		var id int64
+		var v string
+		if err := rows.Scan(&id, &v); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if m := MaskURL(v); m != v {
+			masked[id] = m
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	for id, v := range masked {
+		if _, err := tx.Exec(fmt.Sprintf(`UPDATE "%s" SET %s = ? WHERE id = ?`, c.table, c.name), v, id); err != nil {
+			return 0, err
+		}
+	}
+	return len(masked), tx.Commit()
+}
+
+// migrateColumn 处理单个字段，返回更新及失败的记录数
+func migrateColumn(db *sql.DB, c column) (int, int, error) {
+	rows, err := db.Query(fmt.Sprintf(`SELECT id, %s FROM "%s" WHERE %s IS NOT NULL AND %s != ''`, c.name, c.table, c.name, c.name))
+	if err != nil {
+		return 0, 0, err
+	}
+	type item struct {
+		id    int64
+		value string
+	}
+	var items []item
+	for rows.Next() {
+		var it item
+		if err := rows.Scan(&it.id, &it.value); err != nil {
+			rows.Close()
+			return 0, 0, err
+		}
+		items = append(items, it)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, 0, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	updated, failed := 0, 0
+	for _, it := range items {
+		if !Enabled() {
+			// 未启用加密：只检查已加密数据能否解密
+			if _, err := Decrypt(it.value); err != nil {
+				failed++
+			}
+			continue
+		}
+		v, err := Rewrap(it.value)
+		if err != nil {
+			failed++
+			continue
+		}
+		if v == it.value {
+			continue
+		}
+		if _, err := tx.Exec(fmt.Sprintf(`UPDATE "%s" SET %s = ? WHERE id = ?`, c.table, c.name), v, it.id); err != nil {
+			return 0, 0, err
+		}
+		updated++
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, 0, err
+	}
+	return updated, failed, nil
+}
+
+// DecryptAll 将敏感字段全部解密为明文，用于停用加密前的回退
+func DecryptAll(db *sql.DB) error {
+	for _, c := range columns {
+		rows, err := db.Query(fmt.Sprintf(`SELECT id, %s FROM "%s" WHERE %s LIKE 'enc:%%'`, c.name, c.table, c.name))
+		if err != nil {
+			return err
+		}
+		plain := map[int64]string{}
+		for rows.Next() {
+			var id int64
+			var v string
+			if err := rows.Scan(&id, &v); err != nil {
+				rows.Close()
+				return err
+			}
+			p, err := Decrypt(v)
+			if err != nil {
+				rows.Close()
+				return fmt.Errorf("%s.%s#%d: %v", c.table, c.name, id, err)
+			}
+			plain[id] = p
+		}
+		rows.Close()
+		for id, p := range plain {
+			if _, err := db.Exec(fmt.Sprintf(`UPDATE "%s" SET %s = ? WHERE id = ?`, c.table, c.name), p, id); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package secret
+
+import (
+	"testing"
+
+	"NodePassDash/internal/db/dbtest"
+)
+
+func TestMigrateHidesCommandLinePasswords(t *testing.T) {
+	configureKeys(t, "first-master-key")
+	db := dbtest.Open(t)
+	if _, err := db.Exec(`INSERT INTO "Endpoint" (id, name, url, apiPath, apiKey) VALUES (1, 'ep', 'http://127.0.0.1:1', '/api', 'k')`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO "Tunnel" (id, name, endpointId, mode, tunnelAddress, tunnelPort, targetAddress, targetPort, tlsMode, commandLine, instanceId, password)
+		VALUES (1, 't1', 1, 'server', '', '1001', '127.0.0.1', '80', 'inherit', 'server://s3cret@:1001/127.0.0.1:80?log=info', 'i1', 's3cret')`); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	var commandLine, password string
+	if err := db.QueryRow(`SELECT commandLine, password FROM "Tunnel" WHERE id = 1`).Scan(&commandLine, &password); err != nil {
+		t.Fatal(err)
+	}
+	if want := "server://" + Masked + "@:1001/127.0.0.1:80?log=info"; commandLine != want {
+		t.Fatalf("commandLine = %q, want %q", commandLine, want)
+	}
+	if plain, err := Reveal(password); err != nil || plain != "s3cret" {
+		t.Fatalf("password = %q (%q, %v), want encrypted s3cret", password, plain, err)
+	}
+
+	// 再次迁移不修改已处理的记录
+	var revision int64
+	db.QueryRow(`SELECT revision FROM "Tunnel" WHERE id = 1`).Scan(&revision)
+	if err := Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	var after int64
+	db.QueryRow(`SELECT revision FROM "Tunnel" WHERE id = 1`).Scan(&after)
+	if after != revision {
+		t.Fatalf("revision changed from %d to %d on second migration", revision, after)
+	}
+}
@@ -0,0 +1,306 @@
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	log "NodePassDash/internal/log"
+)
+
+// 加密后的格式：enc:v1:<密钥ID>:<主密钥加密的数据密钥>:<数据密钥加密的内容>
+// 每个值使用独立的随机数据密钥（信封加密），轮换主密钥时只需重新加密数据密钥
+const (
+	prefix  = "enc:v1:"
+	keySize = 32
+)
+
+var (
+	// ErrNoKey 数据已加密但未配置对应的主密钥
+	ErrNoKey = errors.New("未配置可解密该数据的主密钥")
+	// ErrMalformed 加密数据格式错误
+	ErrMalformed = errors.New("加密数据格式错误")
+)
+
+// masterKey 主密钥及其 ID
+type masterKey struct {
+	id  string
+	key []byte
+}
+
+var (
+	// current 当前用于加密的主密钥，为 nil 时不加密
+	current *masterKey
+	// keys 所有可用于解密的主密钥（含当前密钥和轮换前的旧密钥）
+	keys   = map[string]*masterKey{}
+	keysMu sync.RWMutex
+)
+
+// Configure 设置主密钥，previous 为轮换前的旧密钥，仅用于解密；
+// currentKey 为空时表示不启用加密，但仍可使用旧密钥解密已有数据
+func Configure(currentKey string, previous []string) error {
+	ring := map[string]*masterKey{}
+	var cur *masterKey
+	if strings.TrimSpace(currentKey) != "" {
+		k, err := parseKey(currentKey)
+		if err != nil {
+			return err
+		}
+		cur = k
+		ring[k.id] = k
+	}
+	for _, p := range previous {
+		if strings.TrimSpace(p) == "" {
+			continue
+		}
+		k, err := parseKey(p)
+		if err != nil {
+			return err
+		}
+		ring[k.id] = k
+	}
+
+	keysMu.Lock()
+	current = cur
+	keys = ring
+	keysMu.Unlock()
+	return nil
+}
+
+// Enabled 是否已配置用于加密的主密钥
+func Enabled() bool {
+	keysMu.RLock()
+	defer keysMu.RUnlock()
+	return current != nil
+}
+
+// CurrentKeyID 返回当前主密钥的 ID，未启用时为空
+func CurrentKeyID() string {
+	keysMu.RLock()
+	defer keysMu.RUnlock()
+	if current == nil {
+		return ""
+	}
+	return current.id
+}
+
+// GenerateKey 生成一个新的随机主密钥（base64 编码）
+func GenerateKey() (string, error) {
+	b := make([]byte, keySize)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+// parseKey 解析主密钥：32 字节的 base64 / hex 直接使用，其余字符串取 SHA-256 作为密钥
+func parseKey(s string) (*masterKey, error) {
+	s = strings.TrimSpace(s)
+	if len(s) < 16 {
+		return nil, errors.New("主密钥长度至少为 16 个字符")
+	}
+	var key []byte
+	if b, err := base64.StdEncoding.DecodeString(s); err == nil && len(b) == keySize {
+		key = b
+	} else if b, err := hex.DecodeString(s); err == nil && len(b) == keySize {
+		key = b
+	} else {
+		sum := sha256.Sum256([]byte(s))
+		key = sum[:]
+	}
+	id := sha256.Sum256(key)
+	return &masterKey{id: hex.EncodeToString(id[:4]), key: key}, nil
+}
+
+// IsEncrypted 判断值是否为加密格式
+func IsEncrypted(v string) bool {
+	return strings.HasPrefix(v, prefix)
+}
+
+// Encrypt 加密敏感值；未启用加密、值为空或已加密时原样返回
+func Encrypt(plain string) (string, error) {
+	if plain == "" || IsEncrypted(plain) {
+		return plain, nil
+	}
+	keysMu.RLock()
+	cur := current
+	keysMu.RUnlock()
+	if cur == nil {
+		return plain, nil
+	}
+
+	dek := make([]byte, keySize)
+	if _, err := rand.Read(dek); err != nil {
+		return "", err
+	}
+	wrapped, err := seal(cur.key, dek)
+	if err != nil {
+		return "", err
+	}
+	payload, err := seal(dek, []byte(plain))
+	if err != nil {
+		return "", err
+	}
+	return prefix + cur.id + ":" + encode(wrapped) + ":" + encode(payload), nil
+}
+
+// Decrypt 解密敏感值；未加密的旧数据原样返回
+func Decrypt(v string) (string, error) {
+	if !IsEncrypted(v) {
+		return v, nil
+	}
+	id, wrapped, payload, err := split(v)
+	if err != nil {
+		return "", err
+	}
+	dek, err := unwrap(id, wrapped)
+	if err != nil {
+		return "", err
+	}
+	plain, err := open(dek, payload)
+	if err != nil {
+		return "", fmt.Errorf("解密失败: %v", err)
+	}
+	return string(plain), nil
+}
+
+// Reveal 解密敏感值，失败时记录日志并返回错误；调用方应拒绝继续操作，而不是使用空值
+func Reveal(v string) (string, error) {
+	plain, err := Decrypt(v)
+	if err != nil {
+		log.Errorf("[密钥] 解密敏感数据失败: %v", err)
+		return "", fmt.Errorf("解密敏感数据失败: %v", err)
+	}
+	return plain, nil
+}
+
+// Protect 加密敏感值，失败时记录日志并返回错误；调用方应拒绝写入，而不是改存明文
+func Protect(plain string) (string, error) {
+	v, err := Encrypt(plain)
+	if err != nil {
+		log.Errorf("[密钥] 加密敏感数据失败: %v", err)
+		return "", fmt.Errorf("加密敏感数据失败: %v", err)
+	}
+	return v, nil
+}
+
+// Reprotect 与 Protect 相同，但 stored 解密后与 plain 一致时原样返回 stored：
+// 每次加密都使用新的数据密钥和随机数，内容未变也重新加密会使修订号递增，导致 If-Match 误判冲突
+func Reprotect(stored, plain string) (string, error) {
+	if IsEncrypted(stored) {
+		if cur, err := Decrypt(stored); err == nil && cur == plain {
+			return stored, nil
+		}
+	}
+	return Protect(plain)
+}
+
+// Rewrap 使用当前主密钥重新加密数据密钥，内容本身不变；
+// 明文数据在启用加密时会被加密，返回值与输入相同表示无需更新
+func Rewrap(v string) (string, error) {
+	if v == "" {
+		return v, nil
+	}
+	if !IsEncrypted(v) {
+		return Encrypt(v)
+	}
+
+	keysMu.RLock()
+	cur := current
+	keysMu.RUnlock()
+	id, wrapped, payload, err := split(v)
+	if err != nil {
+		return "", err
+	}
+	if cur == nil || id == cur.id {
+		return v, nil
+	}
+
+	dek, err := unwrap(id, wrapped)
+	if err != nil {
+		return "", err
+	}
+	rewrapped, err := seal(cur.key, dek)
+	if err != nil {
+		return "", err
+	}
+	return prefix + cur.id + ":" + encode(rewrapped) + ":" + encode(payload), nil
+}
+
+// split 拆分加密值
+func split(v string) (id string, wrapped, payload []byte, err error) {
+	parts := strings.Split(strings.TrimPrefix(v, prefix), ":")
+	if len(parts) != 3 {
+		return "", nil, nil, ErrMalformed
+	}
+	if wrapped, err = decode(parts[1]); err != nil {
+		return "", nil, nil, ErrMalformed
+	}
+	if payload, err = decode(parts[2]); err != nil {
+		return "", nil, nil, ErrMalformed
+	}
+	return parts[0], wrapped, payload, nil
+}
+
+// unwrap 使用对应的主密钥解密数据密钥
+func unwrap(id string, wrapped []byte) ([]byte, error) {
+	keysMu.RLock()
+	k := keys[id]
+	keysMu.RUnlock()
+	if k == nil {
+		return nil, ErrNoKey
+	}
+	dek, err := open(k.key, wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("数据密钥解密失败: %v", err)
+	}
+	return dek, nil
+}
+
+// seal 使用 AES-256-GCM 加密，输出为 nonce || 密文
+func seal(key, plain []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plain, nil), nil
+}
+
+// open 解密 seal 的输出
+func open(key, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, ErrMalformed
+	}
+	return gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decode(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(s)
+}
@@ -0,0 +1,90 @@
+package secret
+
+import "testing"
+
+// configureKeys 设置测试用主密钥，测试结束后恢复为不加密
+func configureKeys(t *testing.T, current string, previous ...string) {
+	t.Helper()
+	if err := Configure(current, previous); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { Configure("", nil) })
+}
+
+func TestProtectRevealRoundTrip(t *testing.T) {
+	configureKeys(t, "first-master-key")
+
+	stored, err := Protect("tunnel-password")
+	if err != nil {
+		t.Fatalf("Protect: %v", err)
+	}
+	if !IsEncrypted(stored) {
+		t.Fatalf("stored value %q is not encrypted", stored)
+	}
+	plain, err := Reveal(stored)
+	if err != nil || plain != "tunnel-password" {
+		t.Fatalf("Reveal = %q, %v; want tunnel-password", plain, err)
+	}
+
+	// 轮换后旧密钥仍可解密
+	configureKeys(t, "second-master-key", "first-master-key")
+	if plain, err := Reveal(stored); err != nil || plain != "tunnel-password" {
+		t.Fatalf("Reveal after rotation = %q, %v", plain, err)
+	}
+}
+
+func TestRevealFailsWithoutKey(t *testing.T) {
+	configureKeys(t, "first-master-key")
+	stored, err := Protect("tunnel-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	configureKeys(t, "unrelated-master-key")
+	if plain, err := Reveal(stored); err == nil || plain != "" {
+		t.Fatalf("Reveal with wrong key = %q, %v; want error", plain, err)
+	}
+
+	// 篡改过的密文同样报错
+	configureKeys(t, "first-master-key")
+	if _, err := Reveal(stored[:len(stored)-4] + "AAAA"); err == nil {
+		t.Fatal("Reveal of tampered value should fail")
+	}
+}
+
+func TestProtectWithoutKeyKeepsPlaintext(t *testing.T) {
+	configureKeys(t, "")
+	stored, err := Protect("tunnel-password")
+	if err != nil || stored != "tunnel-password" {
+		t.Fatalf("Protect without key = %q, %v", stored, err)
+	}
+	if plain, err := Reveal(stored); err != nil || plain != "tunnel-password" {
+		t.Fatalf("Reveal of plaintext = %q, %v", plain, err)
+	}
+}
+
+func TestReprotectKeepsUnchangedCiphertext(t *testing.T) {
+	configureKeys(t, "first-master-key")
+	stored, err := Protect("tunnel-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, err := Reprotect(stored, "tunnel-password"); err != nil || v != stored {
+		t.Fatalf("Reprotect with same plaintext = %q, %v; want stored ciphertext", v, err)
+	}
+	v, err := Reprotect(stored, "new-password")
+	if err != nil || v == stored {
+		t.Fatalf("Reprotect with new plaintext = %q, %v", v, err)
+	}
+	if plain, _ := Reveal(v); plain != "new-password" {
+		t.Fatalf("Reveal = %q, want new-password", plain)
+	}
+
+	// 旧数据为明文或无法解密时重新加密
+	for _, old := range []string{"", "tunnel-password", stored[:len(stored)-4] + "AAAA"} {
+		if v, err := Reprotect(old, "tunnel-password"); err != nil || v == old || !IsEncrypted(v) {
+			t.Errorf("Reprotect(%q) = %q, %v; want fresh ciphertext", old, v, err)
+		}
+	}
+}
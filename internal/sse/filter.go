@@ -0,0 +1,191 @@
+package sse
+
+import (
+	"strconv"
+	"time"
+
+	"NodePassDash/internal/models"
+)
+
+// membershipTTL 隧道标签及分组的缓存时间，修改标签后最多延迟该时间生效
+const membershipTTL = 30 * time.Second
+
+// Filter 全局推送的订阅条件：不同条件之间为"且"，同一条件的多个取值为"或"，为空表示不限。
+// 不属于任何主控的系统消息不受过滤
+type Filter struct {
+	EndpointIDs []int64
+	TagIDs      []int64
+	GroupIDs    []int64
+	EventTypes  []string
+	StatusOnly  bool // 仅推送状态变化：隧道创建、删除、状态改变的更新事件及主控下线
+}
+
+// eventMeta 全局事件的路由信息；标签及分组仅在有客户端按其过滤时才查询
+type eventMeta struct {
+	endpointID    int64 // 0 表示系统消息
+	instanceID    string
+	eventType     string
+	statusChanged bool
+
+	membership *tunnelMembership
+}
+
+// tunnelMembership 隧道所属的标签及分组
+type tunnelMembership struct {
+	tags     []int64
+	groups   []int64
+	loadedAt time.Time
+}
+
+// match 判断事件是否符合订阅条件；调用方需持有全局数据流补发缓冲的锁（membership 在其中延迟加载）
+func (f *Filter) match(s *Service, m *eventMeta) bool {
+	if f == nil || m == nil || m.endpointID == 0 {
+		return true
+	}
+	if len(f.EndpointIDs) > 0 && !containsInt64(f.EndpointIDs, m.endpointID) {
+		return false
+	}
+	if len(f.EventTypes) > 0 && !containsString(f.EventTypes, m.eventType) {
+		return false
+	}
+	if f.StatusOnly && !m.statusChanged {
+		return false
+	}
+	if len(f.TagIDs) > 0 || len(f.GroupIDs) > 0 {
+		if m.instanceID == "" {
+			return false
+		}
+		if m.membership == nil {
+			m.membership = s.membershipOf(m.endpointID, m.instanceID, m.eventType == string(models.SSEEventTypeDelete))
+		}
+		if len(f.TagIDs) > 0 && !intersects(f.TagIDs, m.membership.tags) {
+			return false
+		}
+		if len(f.GroupIDs) > 0 && !intersects(f.GroupIDs, m.membership.groups) {
+			return false
+		}
+	}
+	return true
+}
+
+// newEventMeta 生成主控事件的路由信息，并记录实例状态以判断是否为状态变化
+func (s *Service) newEventMeta(event models.EndpointSSE) *eventMeta {
+	return &eventMeta{
+		endpointID:    event.EndpointID,
+		instanceID:    event.InstanceID,
+		eventType:     string(event.EventType),
+		statusChanged: s.trackStatus(event),
+	}
+}
+
+// trackStatus 记录实例的最新状态，返回事件是否代表状态变化；
+// 首次出现的实例以数据库中的状态为准（更新事件在写入数据库前推送）
+func (s *Service) trackStatus(event models.EndpointSSE) bool {
+	key := strconv.FormatInt(event.EndpointID, 10) + "/" + event.InstanceID
+
+	s.statusMu.Lock()
+	defer s.statusMu.Unlock()
+
+	switch event.EventType {
+	case models.SSEEventTypeShutdown:
+		return true
+	case models.SSEEventTypeDelete:
+		delete(s.instanceStatus, key)
+		return true
+	case models.SSEEventTypeCreate:
+		if event.Status != nil {
+			s.instanceStatus[key] = *event.Status
+		}
+		return true
+	case models.SSEEventTypeUpdate:
+		if event.Status == nil {
+			return false
+		}
+		prev, ok := s.instanceStatus[key]
+		if !ok {
+			_ = s.db.QueryRow(`SELECT status FROM "Tunnel" WHERE endpointId = ? AND instanceId = ?`,
+				event.EndpointID, event.InstanceID).Scan(&prev)
+		}
+		s.instanceStatus[key] = *event.Status
+		return prev != *event.Status
+	}
+	return false
+}
+
+// membershipOf 查询实例对应隧道的标签及分组；结果缓存 membershipTTL，
+// 删除事件到达时隧道已从数据库移除，使用缓存中的结果并清理
+func (s *Service) membershipOf(endpointID int64, instanceID string, deleted bool) *tunnelMembership {
+	key := strconv.FormatInt(endpointID, 10) + "/" + instanceID
+
+	s.membershipMu.Lock()
+	cached, ok := s.memberships[key]
+	if deleted {
+		delete(s.memberships, key)
+	}
+	s.membershipMu.Unlock()
+	if ok && (deleted || time.Since(cached.loadedAt) < membershipTTL) {
+		return cached
+	}
+
+	m := &tunnelMembership{loadedAt: time.Now()}
+	var tunnelID int64
+	if err := s.db.QueryRow(`SELECT id FROM "Tunnel" WHERE endpointId = ? AND instanceId = ?`, endpointID, instanceID).Scan(&tunnelID); err == nil {
+		m.tags = s.queryIDs(`SELECT tag_id FROM TunnelTags WHERE tunnel_id = ?`, tunnelID)
+		// 分组表在部分版本的数据库中不存在，此时隧道不属于任何分组
+		var n int
+		if err := s.db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'tunnel_group_members'`).Scan(&n); err == nil && n > 0 {
+			m.groups = s.queryIDs(`SELECT group_id FROM tunnel_group_members WHERE tunnel_id = ?`, strconv.FormatInt(tunnelID, 10))
+		}
+	}
+
+	if !deleted {
+		s.membershipMu.Lock()
+		s.memberships[key] = m
+		s.membershipMu.Unlock()
+	}
+	return m
+}
+
+// queryIDs 执行返回单列 ID 的查询，出错时返回已读取的部分
+func (s *Service) queryIDs(query string, args ...interface{}) []int64 {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if rows.Scan(&id) == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func containsString(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+func containsInt64(list []int64, v int64) bool {
+	for _, n := range list {
+		if n == v {
+			return true
+		}
+	}
+	return false
+}
+
+func intersects(a, b []int64) bool {
+	for _, v := range a {
+		if containsInt64(b, v) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,212 @@
+package sse
+
+import (
+	"testing"
+	"time"
+
+	"NodePassDash/internal/models"
+)
+
+// newFilterTestService 在 newTestService 的基础上创建以下隧道：
+//
+//	实例 主控 状态    标签 分组
+//	i1   1    running 1    10
+//	i2   1    stopped 2    -
+//	i3   2    running -    -
+func newFilterTestService(t *testing.T) *Service {
+	t.Helper()
+	s := newTestService(t)
+	for _, stmt := range []string{
+		`INSERT INTO "Tunnel" (id, name, endpointId, mode, status, tunnelAddress, tunnelPort, targetAddress, targetPort, tlsMode, commandLine, instanceId)
+			VALUES (1, 't1', 1, 'server', 'running', '', '1001', '127.0.0.1', '80', 'inherit', '', 'i1'),
+			       (2, 't2', 1, 'server', 'stopped', '', '1002', '127.0.0.1', '80', 'inherit', '', 'i2'),
+			       (3, 't3', 2, 'client', 'running', '', '1003', '127.0.0.1', '80', 'inherit', '', 'i3')`,
+		`INSERT INTO "Tags" (id, name) VALUES (1, 'prod'), (2, 'test')`,
+		`INSERT INTO TunnelTags (tunnel_id, tag_id) VALUES (1, 1), (2, 2)`,
+		`CREATE TABLE tunnel_group_members (id INTEGER PRIMARY KEY, group_id INTEGER, tunnel_id INTEGER, role TEXT, created_at DATETIME)`,
+		`INSERT INTO tunnel_group_members (group_id, tunnel_id) VALUES (10, 1)`,
+	} {
+		if _, err := s.db.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	return s
+}
+
+func TestFilterMatch(t *testing.T) {
+	s := newFilterTestService(t)
+	update := func(endpointID int64, instanceID string) *eventMeta {
+		return &eventMeta{endpointID: endpointID, instanceID: instanceID, eventType: "update"}
+	}
+
+	cases := []struct {
+		name   string
+		filter *Filter
+		meta   *eventMeta
+		want   bool
+	}{
+		{"nil filter", nil, update(1, "i1"), true},
+		{"empty filter", &Filter{}, update(2, "i3"), true},
+		{"system message bypasses filter", &Filter{EndpointIDs: []int64{1}, StatusOnly: true}, &eventMeta{eventType: "shutdown"}, true},
+		{"nil meta bypasses filter", &Filter{EndpointIDs: []int64{1}}, nil, true},
+
+		{"endpoint match", &Filter{EndpointIDs: []int64{1}}, update(1, "i1"), true},
+		{"endpoint any of", &Filter{EndpointIDs: []int64{1, 2}}, update(2, "i3"), true},
+		{"endpoint mismatch", &Filter{EndpointIDs: []int64{1}}, update(2, "i3"), false},
+
+		{"event type any of", &Filter{EventTypes: []string{"create", "update"}}, update(1, "i1"), true},
+		{"event type mismatch", &Filter{EventTypes: []string{"log"}}, update(1, "i1"), false},
+
+		{"status only without change", &Filter{StatusOnly: true}, update(1, "i1"), false},
+		{"status only with change", &Filter{StatusOnly: true}, &eventMeta{endpointID: 1, instanceID: "i1", eventType: "update", statusChanged: true}, true},
+
+		{"tag match", &Filter{TagIDs: []int64{1}}, update(1, "i1"), true},
+		{"tag any of", &Filter{TagIDs: []int64{1, 2}}, update(1, "i2"), true},
+		{"tag mismatch", &Filter{TagIDs: []int64{1}}, update(1, "i2"), false},
+		{"untagged tunnel", &Filter{TagIDs: []int64{1}}, update(2, "i3"), false},
+		{"tag filter without instance", &Filter{TagIDs: []int64{1}}, &eventMeta{endpointID: 1, eventType: "shutdown"}, false},
+		{"unknown instance", &Filter{TagIDs: []int64{1}}, update(1, "missing"), false},
+
+		{"group match", &Filter{GroupIDs: []int64{10}}, update(1, "i1"), true},
+		{"group mismatch", &Filter{GroupIDs: []int64{10}}, update(1, "i2"), false},
+
+		// 不同条件之间为“且”
+		{"endpoint and event type", &Filter{EndpointIDs: []int64{1}, EventTypes: []string{"log"}}, update(1, "i1"), false},
+		{"tag and group both match", &Filter{TagIDs: []int64{1}, GroupIDs: []int64{10}}, update(1, "i1"), true},
+		{"tag matches but group does not", &Filter{TagIDs: []int64{2}, GroupIDs: []int64{10}}, update(1, "i2"), false},
+		{"group matches but tag does not", &Filter{TagIDs: []int64{2}, GroupIDs: []int64{10}}, update(1, "i1"), false},
+		{"all conditions", &Filter{EndpointIDs: []int64{1}, TagIDs: []int64{1}, GroupIDs: []int64{10}, EventTypes: []string{"update"}, StatusOnly: true},
+			&eventMeta{endpointID: 1, instanceID: "i1", eventType: "update", statusChanged: true}, true},
+	}
+	for _, c := range cases {
+		if got := c.filter.match(s, c.meta); got != c.want {
+			t.Errorf("%s: match = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestFilterMatchWithoutGroupTable(t *testing.T) {
+	s := newTestService(t)
+	if _, err := s.db.Exec(`INSERT INTO "Tunnel" (id, name, endpointId, mode, tunnelAddress, tunnelPort, targetAddress, targetPort, tlsMode, commandLine, instanceId)
+		VALUES (1, 't1', 1, 'server', '', '1001', '127.0.0.1', '80', 'inherit', '', 'i1')`); err != nil {
+		t.Fatal(err)
+	}
+	if (&Filter{GroupIDs: []int64{10}}).match(s, &eventMeta{endpointID: 1, instanceID: "i1", eventType: "update"}) {
+		t.Fatal("tunnel should belong to no group when the group table is missing")
+	}
+}
+
+func TestFilterMembershipCache(t *testing.T) {
+	s := newFilterTestService(t)
+	byTag := &Filter{TagIDs: []int64{1}}
+
+	// 同一事件被多个客户端过滤时只查询一次
+	meta := &eventMeta{endpointID: 1, instanceID: "i1", eventType: "update"}
+	if !byTag.match(s, meta) || meta.membership == nil {
+		t.Fatal("update event should load and attach membership")
+	}
+	if _, ok := s.memberships["1/i1"]; !ok {
+		t.Fatal("membership should be cached")
+	}
+
+	// 缓存有效期内修改标签不立即生效
+	if _, err := s.db.Exec(`DELETE FROM TunnelTags WHERE tunnel_id = 1`); err != nil {
+		t.Fatal(err)
+	}
+	if !byTag.match(s, &eventMeta{endpointID: 1, instanceID: "i1", eventType: "update"}) {
+		t.Fatal("cached membership should be used within the TTL")
+	}
+	s.memberships["1/i1"].loadedAt = time.Now().Add(-membershipTTL - time.Second)
+	if byTag.match(s, &eventMeta{endpointID: 1, instanceID: "i1", eventType: "update"}) {
+		t.Fatal("expired membership should be reloaded")
+	}
+}
+
+func TestFilterMembershipOnDelete(t *testing.T) {
+	s := newFilterTestService(t)
+	byTag := &Filter{TagIDs: []int64{1}}
+	byGroup := &Filter{GroupIDs: []int64{10}}
+
+	if !byTag.match(s, &eventMeta{endpointID: 1, instanceID: "i1", eventType: "update"}) {
+		t.Fatal("update event should match")
+	}
+
+	// 删除事件到达时隧道已从数据库移除，使用缓存并清理
+	if _, err := s.db.Exec(`DELETE FROM "Tunnel" WHERE id = 1`); err != nil {
+		t.Fatal(err)
+	}
+	del := &eventMeta{endpointID: 1, instanceID: "i1", eventType: string(models.SSEEventTypeDelete)}
+	if !byTag.match(s, del) || !byGroup.match(s, del) {
+		t.Fatal("delete event should match using the cached membership")
+	}
+	if _, ok := s.memberships["1/i1"]; ok {
+		t.Fatal("delete event should evict the cached membership")
+	}
+
+	// 缓存即使已过期，删除事件也只能使用缓存
+	if byTag.match(s, &eventMeta{endpointID: 2, instanceID: "i3", eventType: "update"}) {
+		t.Fatal("untagged tunnel should not match")
+	}
+	cached := s.memberships["2/i3"]
+	cached.tags = []int64{1}
+	cached.loadedAt = time.Now().Add(-time.Hour)
+	if _, err := s.db.Exec(`DELETE FROM "Tunnel" WHERE id = 3`); err != nil {
+		t.Fatal(err)
+	}
+	if !byTag.match(s, &eventMeta{endpointID: 2, instanceID: "i3", eventType: string(models.SSEEventTypeDelete)}) {
+		t.Fatal("delete event should use an expired cached membership")
+	}
+
+	// 没有缓存的删除事件查询不到标签
+	if _, err := s.db.Exec(`DELETE FROM "Tunnel" WHERE id = 2`); err != nil {
+		t.Fatal(err)
+	}
+	if (&Filter{TagIDs: []int64{2}}).match(s, &eventMeta{endpointID: 1, instanceID: "i2", eventType: string(models.SSEEventTypeDelete)}) {
+		t.Fatal("uncached delete event should not match a tag filter")
+	}
+	if len(s.memberships) != 0 {
+		t.Fatalf("delete events should not populate the cache: %v", s.memberships)
+	}
+}
+
+func TestTrackStatus(t *testing.T) {
+	s := newFilterTestService(t)
+	status := func(v string) *string { return &v }
+
+	// 依次处理的事件，instanceStatus 在各步之间保留
+	steps := []struct {
+		name      string
+		eventType models.SSEEventType
+		endpoint  int64
+		instance  string
+		status    *string
+		want      bool
+	}{
+		{"first update uses database status", models.SSEEventTypeUpdate, 1, "i1", status("running"), false},
+		{"first update differing from database", models.SSEEventTypeUpdate, 1, "i2", status("running"), true},
+		{"traffic update", models.SSEEventTypeUpdate, 1, "i1", status("running"), false},
+		{"update without status", models.SSEEventTypeUpdate, 1, "i1", nil, false},
+		{"status change", models.SSEEventTypeUpdate, 1, "i1", status("error"), true},
+		{"status change recorded", models.SSEEventTypeUpdate, 1, "i1", status("error"), false},
+		{"create", models.SSEEventTypeCreate, 1, "new", status("stopped"), true},
+		{"update after create", models.SSEEventTypeUpdate, 1, "new", status("stopped"), false},
+		{"delete", models.SSEEventTypeDelete, 1, "new", nil, true},
+		// 删除后状态记录已清理，未入库的实例与空状态比较
+		{"update after delete", models.SSEEventTypeUpdate, 1, "new", status("stopped"), true},
+		{"same instance id on another endpoint", models.SSEEventTypeUpdate, 2, "i1", status("running"), true},
+		{"shutdown", models.SSEEventTypeShutdown, 1, "", nil, true},
+		{"initial", models.SSEEventTypeInitial, 1, "i1", status("running"), false},
+		{"log", models.SSEEventTypeLog, 1, "i1", nil, false},
+	}
+	for _, st := range steps {
+		e := models.EndpointSSE{EventType: st.eventType, EndpointID: st.endpoint, InstanceID: st.instance, Status: st.status}
+		if got := s.trackStatus(e); got != st.want {
+			t.Errorf("%s: trackStatus = %v, want %v", st.name, got, st.want)
+		}
+	}
+
+	meta := s.newEventMeta(models.EndpointSSE{EventType: models.SSEEventTypeUpdate, EndpointID: 1, InstanceID: "i1", Status: status("running")})
+	if !meta.statusChanged || meta.endpointID != 1 || meta.instanceID != "i1" || meta.eventType != "update" {
+		t.Fatalf("newEventMeta = %+v", meta)
+	}
+}
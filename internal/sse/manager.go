@@ -3,6 +3,7 @@ package sse
 import (
 	log "NodePassDash/internal/log"
 	"NodePassDash/internal/models"
+	"NodePassDash/internal/secret"
 	"context"
 	"crypto/tls"
 	"database/sql"
@@ -11,6 +12,7 @@ import (
 	"net"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/mattn/go-ieproxy"
@@ -27,7 +29,8 @@ type Manager struct {
 	connections map[int64]*EndpointConnection
 
 	// 事件处理 worker pool
-	jobs chan eventJob // 投递待解析/处理的原始 SSE 事件
+	jobs    chan eventJob // 投递待解析/处理的原始 SSE 事件
+	dropped atomic.Int64  // 因队列已满丢弃的消息数
 
 	// 守护进程相关
 	daemonCtx    context.Context    // 守护进程上下文
@@ -236,6 +239,10 @@ func (m *Manager) InitializeSystem() error {
 			log.Errorf("扫描端点数据失败 %v", err)
 			continue
 		}
+		if endpoint.APIKey, err = secret.Reveal(endpoint.APIKey); err != nil {
+			log.Errorf("[Master-%d#SSE]API Key 无法解密，跳过连接", endpoint.ID)
+			continue
+		}
 
 		if err := m.ConnectEndpoint(endpoint.ID, endpoint.URL, endpoint.APIPath, endpoint.APIKey); err != nil {
 			log.Errorf("[Master-%d#SSE]连接失败%v", endpoint.ID, err)
@@ -412,6 +419,7 @@ func (m *Manager) listenSSE(ctx context.Context, conn *EndpointConnection) {
 			case m.jobs <- eventJob{endpointID: conn.EndpointID, payload: string(ev.Data)}:
 			default:
 				// 如果队列已满，记录告警，避免阻塞 r3labs 读取协程
+				m.dropped.Add(1)
 				log.Warnf("[Master-%d#SSE]事件处理队列已满，丢弃消息", conn.EndpointID)
 			}
 		}
@@ -453,6 +461,34 @@ func (m *Manager) GetConnectionStatus() map[int64]map[string]interface{} {
 	return status
 }
 
+// ConnectionState 主控 SSE 连接的运行状态
+type ConnectionState struct {
+	EndpointID        int64
+	Connected         bool
+	ReconnectAttempts int
+}
+
+// ConnectionStates 返回所有已建立（或正在重连）的主控连接状态
+func (m *Manager) ConnectionStates() []ConnectionState {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	states := make([]ConnectionState, 0, len(m.connections))
+	for endpointID, conn := range m.connections {
+		states = append(states, ConnectionState{
+			EndpointID:        endpointID,
+			Connected:         conn.IsConnected(),
+			ReconnectAttempts: conn.GetReconnectAttempts(),
+		})
+	}
+	return states
+}
+
+// QueueStats 返回事件处理队列的当前长度、容量及因队列已满丢弃的消息数
+func (m *Manager) QueueStats() (depth, capacity int, dropped int64) {
+	return len(m.jobs), cap(m.jobs), m.dropped.Load()
+}
+
 // markEndpointFail 更新端点状态为 FAIL
 func (m *Manager) markEndpointFail(endpointID int64) {
 	// 更新端点状态为 FAIL，避免重复写
@@ -2,9 +2,13 @@ package sse
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
 	"sync"
 	"time"
+
+	"NodePassDash/internal/workspace"
 )
 
 // EventType SSE事件类型
@@ -132,9 +136,72 @@ type Event struct {
 	Message string      `json:"message,omitempty"`
 }
 
+// 推送的数据流：全局、单个隧道及单个主控的日志
+const (
+	StreamGlobal = "global"
+	StreamTunnel = "tunnel"
+	StreamLogs   = "logs"
+)
+
+// Sink SSE 以外的推送出口（如 WebSocket）；stream 为数据流，
+// key 为隧道实例 ID 或主控 ID（全局数据流为空），payload 为已脱敏的 JSON
+type Sink interface {
+	Send(stream, key string, payload []byte) error
+}
+
+// errClientClosed 客户端已移除
+var errClientClosed = errors.New("客户端已断开")
+
 // Client SSE 客户端
 type Client struct {
 	ID     string
 	Writer http.ResponseWriter
+	Sink   Sink // 设置后通过 Sink 推送，不使用 Writer
 	Events chan Event
+	Scope  workspace.Scope // 客户端可见的工作区范围，用于过滤全局推送
+	Filter *Filter         // 全局推送的订阅条件，为空时接收所有可见事件
+
+	mu sync.Mutex // 串行化推送，并保证 detach 返回后不再写入 Writer
+}
+
+// active 判断客户端是否仍可推送
+func (c *Client) active() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.Writer != nil || c.Sink != nil
+}
+
+// detach 停止向客户端推送；连接处理函数返回前必须调用（经由 RemoveClient），
+// 否则推送可能写入已结束的响应
+func (c *Client) detach() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Writer = nil
+	c.Sink = nil
+}
+
+// write 推送一条消息：SSE 连接写入 data 帧并立即刷新，其余交给 Sink；
+// id 大于 0 时写入 id 字段，浏览器重连时通过 Last-Event-ID 请求头带回
+func (c *Client) write(stream, key string, id int64, payload []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Sink != nil {
+		return c.Sink.Send(stream, key, payload)
+	}
+	if c.Writer == nil {
+		return errClientClosed
+	}
+	var err error
+	if id > 0 {
+		_, err = fmt.Fprintf(c.Writer, "id: %d\ndata: %s\n\n", id, payload)
+	} else {
+		_, err = fmt.Fprintf(c.Writer, "data: %s\n\n", payload)
+	}
+	if err != nil {
+		return err
+	}
+	if f, ok := c.Writer.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
 }
@@ -0,0 +1,133 @@
+package sse
+
+import (
+	"strconv"
+	"sync"
+
+	log "NodePassDash/internal/log"
+)
+
+// 每个数据流保留的最近事件数，断线时间超出该范围的客户端需重新同步
+const (
+	globalReplaySize = 1000
+	tunnelReplaySize = 200
+)
+
+// resyncPayload 缺失的事件已不在缓冲中时推送，客户端收到后应重新拉取全量数据
+var resyncPayload = []byte(`{"type":"resync","message":"部分事件已过期，请重新加载数据"}`)
+
+// replayEntry 缓冲中的一条已推送事件
+type replayEntry struct {
+	id      int64
+	meta    *eventMeta // 全局事件的路由信息，用于补发时按工作区及订阅条件过滤；为空表示所有客户端可见
+	payload []byte
+}
+
+// replayBuffer 单个数据流最近推送的事件，供客户端断线重连后按 Last-Event-ID 补发。
+// 推送与补发都在 mu 内进行，保证同一数据流的事件按 ID 顺序送达且重连时不遗漏
+type replayBuffer struct {
+	mu      sync.Mutex
+	stream  string
+	key     string
+	size    int
+	entries []replayEntry
+	floor   int64 // 不大于该 ID 的事件已不在缓冲中（含服务重启前的事件）
+}
+
+// replayBufferFor 获取数据流的补发缓冲，不存在时创建
+func (s *Service) replayBufferFor(stream, key string) *replayBuffer {
+	name := stream
+	size := globalReplaySize
+	if key != "" {
+		name = stream + ":" + key
+		size = tunnelReplaySize
+	}
+
+	s.replayMu.Lock()
+	defer s.replayMu.Unlock()
+	buf, ok := s.replays[name]
+	if !ok {
+		// 新建缓冲时该数据流在本次启动后尚未推送过事件，更早的事件只可能来自重启前
+		buf = &replayBuffer{stream: stream, key: key, size: size, floor: s.eventSeqStart}
+		s.replays[name] = buf
+	}
+	return buf
+}
+
+// record 将已分配 ID 的事件加入缓冲，超出容量时移除最早的事件，调用方需持有 mu
+func (b *replayBuffer) record(id int64, meta *eventMeta, payload []byte) {
+	b.entries = append(b.entries, replayEntry{id: id, meta: meta, payload: payload})
+	if len(b.entries) > b.size {
+		drop := len(b.entries) - b.size
+		b.floor = b.entries[drop-1].id
+		b.entries = b.entries[drop:]
+	}
+}
+
+// since 返回 lastID 之后的事件；lastID 之后有事件已被移出缓冲或 lastID 无效时返回 false，调用方需持有 mu
+func (b *replayBuffer) since(lastID, latest int64) ([]replayEntry, bool) {
+	if lastID < b.floor || lastID > latest {
+		return nil, false
+	}
+	for i, e := range b.entries {
+		if e.id > lastID {
+			return b.entries[i:], true
+		}
+	}
+	return nil, true
+}
+
+// resume 登记客户端并补发 lastEventID 之后的事件；lastEventID 为空表示新连接，无需补发
+func (s *Service) resume(buf *replayBuffer, client *Client, lastEventID string, register func()) {
+	buf.mu.Lock()
+	defer buf.mu.Unlock()
+
+	register()
+	if lastEventID == "" {
+		return
+	}
+
+	latest := s.eventSeq.Load()
+	lastID, err := strconv.ParseInt(lastEventID, 10, 64)
+	var missed []replayEntry
+	ok := err == nil
+	if ok {
+		missed, ok = buf.since(lastID, latest)
+	}
+	if !ok {
+		log.Debugf("SSE客户端需要重新同步,clientID=%s lastEventID=%s", client.ID, lastEventID)
+		client.write(buf.stream, buf.key, latest, resyncPayload)
+		return
+	}
+
+	visible := make(map[int64]bool)
+	for _, e := range missed {
+		if e.meta != nil && e.meta.endpointID != 0 {
+			v, checked := visible[e.meta.endpointID]
+			if !checked {
+				v = s.endpointVisibility(e.meta.endpointID)(client.Scope)
+				visible[e.meta.endpointID] = v
+			}
+			if !v || !client.Filter.match(s, e.meta) {
+				continue
+			}
+		}
+		if err := client.write(buf.stream, buf.key, e.id, e.payload); err != nil {
+			return
+		}
+	}
+}
+
+// ResumeGlobal 将客户端加入全局推送，并补发 lastEventID（通常取自 Last-Event-ID 请求头）之后错过的事件
+func (s *Service) ResumeGlobal(client *Client, lastEventID string) {
+	s.resume(s.replayBufferFor(StreamGlobal, ""), client, lastEventID, func() {
+		s.SubscribeGlobal(client)
+	})
+}
+
+// ResumeTunnel 订阅隧道事件，并补发 lastEventID 之后错过的事件；调用方需先通过 InstanceVisible 校验
+func (s *Service) ResumeTunnel(client *Client, tunnelID, lastEventID string) {
+	s.resume(s.replayBufferFor(StreamTunnel, tunnelID), client, lastEventID, func() {
+		s.SubscribeClientToTunnel(client, tunnelID)
+	})
+}
@@ -0,0 +1,238 @@
+package sse
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"NodePassDash/internal/db/dbtest"
+	"NodePassDash/internal/workspace"
+)
+
+// testSeqStart 测试服务本次启动的事件 ID 起点
+const testSeqStart = 1000
+
+// newTestService 创建不启动后台任务的服务：主控 1 属于工作区 1，主控 2 属于工作区 2
+func newTestService(t *testing.T) *Service {
+	t.Helper()
+	conn := dbtest.Open(t)
+	for _, stmt := range []string{
+		`INSERT INTO "Workspace" (id, name) VALUES (2, 'other')`,
+		`INSERT INTO "Endpoint" (id, name, url, apiPath, apiKey, workspaceId) VALUES (1, 'ep1', 'http://127.0.0.1:1', '/api', 'k1', 1)`,
+		`INSERT INTO "Endpoint" (id, name, url, apiPath, apiKey, workspaceId) VALUES (2, 'ep2', 'http://127.0.0.1:2', '/api', 'k2', 2)`,
+	} {
+		if _, err := conn.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	s := &Service{
+		db:             conn,
+		clients:        make(map[string]*Client),
+		tunnelSubs:     make(map[string]map[string]*Client),
+		logSubs:        make(map[int64]map[string]*Client),
+		eventSeqStart:  testSeqStart,
+		replays:        make(map[string]*replayBuffer),
+		instanceStatus: make(map[string]string),
+		memberships:    make(map[string]*tunnelMembership),
+	}
+	s.eventSeq.Store(testSeqStart)
+	return s
+}
+
+// newTestClient 创建写入 ResponseRecorder 的客户端
+func newTestClient(id string, scope workspace.Scope, filter *Filter) (*Client, *httptest.ResponseRecorder) {
+	w := httptest.NewRecorder()
+	return &Client{ID: id, Writer: w, Scope: scope, Filter: filter}, w
+}
+
+// received 解析推送给客户端的事件 ID 及内容
+func received(t *testing.T, w *httptest.ResponseRecorder) ([]int64, []string) {
+	t.Helper()
+	var ids []int64
+	var payloads []string
+	for _, block := range strings.Split(strings.TrimSpace(w.Body.String()), "\n\n") {
+		if block == "" {
+			continue
+		}
+		var id int64
+		for _, line := range strings.Split(block, "\n") {
+			switch {
+			case strings.HasPrefix(line, "id: "):
+				n, err := strconv.ParseInt(strings.TrimPrefix(line, "id: "), 10, 64)
+				if err != nil {
+					t.Fatalf("invalid event id in %q", block)
+				}
+				id = n
+			case strings.HasPrefix(line, "data: "):
+				payloads = append(payloads, strings.TrimPrefix(line, "data: "))
+			}
+		}
+		ids = append(ids, id)
+	}
+	return ids, payloads
+}
+
+func TestReplayBufferSince(t *testing.T) {
+	buf := &replayBuffer{size: 5, floor: 100}
+	for id := int64(101); id <= 105; id++ {
+		buf.record(id, nil, []byte(strconv.FormatInt(id, 10)))
+	}
+
+	ids := func(entries []replayEntry) []int64 {
+		out := []int64{}
+		for _, e := range entries {
+			out = append(out, e.id)
+		}
+		return out
+	}
+	cases := []struct {
+		name           string
+		lastID, latest int64
+		want           []int64
+		wantOK         bool
+	}{
+		{"from floor", 100, 105, []int64{101, 102, 103, 104, 105}, true},
+		{"gap", 102, 105, []int64{103, 104, 105}, true},
+		{"up to date", 105, 105, []int64{}, true},
+		// 其他数据流分配了更大的 ID，本数据流没有新事件
+		{"ahead of stream", 107, 110, []int64{}, true},
+		{"before floor", 99, 105, nil, false},
+		{"after latest", 106, 105, nil, false},
+	}
+	for _, c := range cases {
+		got, ok := buf.since(c.lastID, c.latest)
+		if ok != c.wantOK || (ok && !reflect.DeepEqual(ids(got), c.want)) {
+			t.Errorf("%s: since(%d, %d) = %v, %v; want %v, %v", c.name, c.lastID, c.latest, ids(got), ok, c.want, c.wantOK)
+		}
+	}
+
+	// 超出容量时移除最早的事件并抬高下限
+	buf.record(106, nil, nil)
+	if buf.floor != 101 || len(buf.entries) != 5 {
+		t.Fatalf("floor = %d, entries = %d after eviction", buf.floor, len(buf.entries))
+	}
+	if _, ok := buf.since(100, 106); ok {
+		t.Fatal("evicted event 101 should require resync")
+	}
+	if got, ok := buf.since(101, 106); !ok || !reflect.DeepEqual(ids(got), []int64{102, 103, 104, 105, 106}) {
+		t.Fatalf("since(101) = %v, %v", ids(got), ok)
+	}
+}
+
+func TestResumeGlobalReplaysGap(t *testing.T) {
+	s := newTestService(t)
+	for i := 1; i <= 4; i++ {
+		s.sendGlobalUpdate(&eventMeta{endpointID: 1, instanceID: "i1"}, map[string]int{"n": i})
+	}
+
+	client, w := newTestClient("c1", workspace.Scope{IDs: []int64{1}}, nil)
+	s.ResumeGlobal(client, strconv.Itoa(testSeqStart+2))
+	ids, payloads := received(t, w)
+	if !reflect.DeepEqual(ids, []int64{testSeqStart + 3, testSeqStart + 4}) ||
+		!reflect.DeepEqual(payloads, []string{`{"n":3}`, `{"n":4}`}) {
+		t.Fatalf("replayed ids = %v, payloads = %v", ids, payloads)
+	}
+
+	// 补发后客户端已登记，后续事件直接推送且 ID 连续
+	s.sendGlobalUpdate(&eventMeta{endpointID: 1, instanceID: "i1"}, map[string]int{"n": 5})
+	if ids, _ := received(t, w); ids[len(ids)-1] != testSeqStart+5 {
+		t.Fatalf("live event ids = %v", ids)
+	}
+}
+
+func TestResumeWithoutLastEventIDDoesNotReplay(t *testing.T) {
+	s := newTestService(t)
+	s.sendGlobalUpdate(nil, map[string]int{"n": 1})
+
+	client, w := newTestClient("c1", workspace.AllScope(), nil)
+	s.ResumeGlobal(client, "")
+	if w.Body.Len() != 0 {
+		t.Fatalf("new connection received %q", w.Body.String())
+	}
+	if _, ok := s.clients["c1"]; !ok {
+		t.Fatal("client was not registered")
+	}
+}
+
+func TestResumeRequestsResync(t *testing.T) {
+	s := newTestService(t)
+	for i := 1; i <= 3; i++ {
+		s.sendGlobalUpdate(nil, map[string]int{"n": i})
+	}
+	latest := int64(testSeqStart + 3)
+
+	cases := []struct{ name, lastEventID string }{
+		// 服务重启前的事件不在缓冲中
+		{"before floor", strconv.Itoa(testSeqStart - 1)},
+		{"after latest", strconv.FormatInt(latest+1, 10)},
+		{"not a number", "abc"},
+	}
+	for _, c := range cases {
+		client, w := newTestClient(c.name, workspace.AllScope(), nil)
+		s.ResumeGlobal(client, c.lastEventID)
+		ids, payloads := received(t, w)
+		if !reflect.DeepEqual(ids, []int64{latest}) || payloads[0] != string(resyncPayload) {
+			t.Errorf("%s: ids = %v, payloads = %v; want single resync with id %d", c.name, ids, payloads, latest)
+		}
+	}
+}
+
+func TestResumeTunnelResyncAfterEviction(t *testing.T) {
+	s := newTestService(t)
+	for i := 0; i < tunnelReplaySize+1; i++ {
+		s.sendTunnelUpdateByInstanceId("i1", map[string]int{"n": i})
+	}
+	// 其他隧道的事件不影响 i1 的缓冲
+	s.sendTunnelUpdateByInstanceId("i2", map[string]int{"n": 0})
+
+	evicted, w := newTestClient("evicted", workspace.AllScope(), nil)
+	s.ResumeTunnel(evicted, "i1", strconv.Itoa(testSeqStart))
+	if _, payloads := received(t, w); len(payloads) != 1 || payloads[0] != string(resyncPayload) {
+		t.Fatalf("client behind the buffer got %d events, want resync", len(payloads))
+	}
+
+	recent, w := newTestClient("recent", workspace.AllScope(), nil)
+	s.ResumeTunnel(recent, "i1", strconv.Itoa(testSeqStart+tunnelReplaySize))
+	ids, payloads := received(t, w)
+	want := `{"n":` + strconv.Itoa(tunnelReplaySize) + `}`
+	if !reflect.DeepEqual(ids, []int64{testSeqStart + tunnelReplaySize + 1}) || payloads[0] != want {
+		t.Fatalf("ids = %v, payloads = %v", ids, payloads)
+	}
+}
+
+func TestResumeSkipsInvisibleEvents(t *testing.T) {
+	s := newTestService(t)
+	s.sendGlobalUpdate(&eventMeta{endpointID: 1, instanceID: "i1", eventType: "update"}, map[string]string{"ep": "1"})
+	s.sendGlobalUpdate(&eventMeta{endpointID: 2, instanceID: "i2", eventType: "update"}, map[string]string{"ep": "2"})
+	s.sendGlobalUpdate(nil, map[string]string{"ep": "system"})
+	s.sendGlobalUpdate(&eventMeta{endpointID: 99, instanceID: "i9", eventType: "update"}, map[string]string{"ep": "deleted"})
+	s.sendGlobalUpdate(&eventMeta{endpointID: 1, instanceID: "i1", eventType: "log"}, map[string]string{"ep": "1-log"})
+
+	cases := []struct {
+		name   string
+		scope  workspace.Scope
+		filter *Filter
+		want   []string
+	}{
+		{"workspace 1", workspace.Scope{IDs: []int64{1}}, nil,
+			[]string{`{"ep":"1"}`, `{"ep":"system"}`, `{"ep":"1-log"}`}},
+		{"workspace 2", workspace.Scope{IDs: []int64{2}}, nil,
+			[]string{`{"ep":"2"}`, `{"ep":"system"}`}},
+		{"no workspace", workspace.Scope{}, nil,
+			[]string{`{"ep":"system"}`}},
+		// 已删除主控的事件仅管理员可见
+		{"admin", workspace.AllScope(), nil,
+			[]string{`{"ep":"1"}`, `{"ep":"2"}`, `{"ep":"system"}`, `{"ep":"deleted"}`, `{"ep":"1-log"}`}},
+		{"filter applies to replay", workspace.AllScope(), &Filter{EventTypes: []string{"log"}},
+			[]string{`{"ep":"system"}`, `{"ep":"1-log"}`}},
+	}
+	for _, c := range cases {
+		client, w := newTestClient(c.name, c.scope, c.filter)
+		s.ResumeGlobal(client, strconv.Itoa(testSeqStart))
+		if _, payloads := received(t, w); !reflect.DeepEqual(payloads, c.want) {
+			t.Errorf("%s: replayed %v, want %v", c.name, payloads, c.want)
+		}
+	}
+}
@@ -6,6 +6,9 @@ import (
 	log "NodePassDash/internal/log"
 	"NodePassDash/internal/models"
 	"NodePassDash/internal/nodepass"
+	"NodePassDash/internal/secret"
+	"NodePassDash/internal/webhook"
+	"NodePassDash/internal/workspace"
 	"context"
 	"database/sql"
 	"encoding/json"
@@ -16,6 +19,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -24,8 +28,21 @@ type Service struct {
 	// 客户端管理
 	clients    map[string]*Client            // 全局客户端
 	tunnelSubs map[string]map[string]*Client // 隧道订阅者
+	logSubs    map[int64]map[string]*Client  // 主控日志订阅者
 	mu         sync.RWMutex
 
+	// 断线续传：推送给前端的事件 ID 全局递增，以启动时间（微秒）为起点，重启后仍大于之前的 ID
+	eventSeq      atomic.Int64
+	eventSeqStart int64
+	replays       map[string]*replayBuffer // 各数据流的补发缓冲，key 为 "global" 或 "tunnel:<实例ID>"
+	replayMu      sync.Mutex
+
+	// 全局推送过滤：实例最新状态（判断状态变化）及隧道标签、分组缓存，key 为 "<主控ID>/<实例ID>"
+	instanceStatus map[string]string
+	statusMu       sync.Mutex
+	memberships    map[string]*tunnelMembership
+	membershipMu   sync.Mutex
+
 	// 数据存储
 	db *sql.DB
 
@@ -35,8 +52,12 @@ type Service struct {
 	// Manager引用（用于状态通知）
 	manager *Manager
 
+	// Webhook 服务引用（用于出站事件通知）
+	webhooks *webhook.Service
+
 	// 异步持久化队列
-	storeJobCh chan models.EndpointSSE // 事件持久化任务队列
+	storeJobCh   chan models.EndpointSSE // 事件持久化任务队列
+	storeDropped atomic.Int64            // 因存储队列已满丢弃的事件数
 
 	// 批处理相关
 	batchUpdateCh  chan models.EndpointSSE       // 批量更新通道
@@ -78,6 +99,11 @@ func NewService(db *sql.DB, endpointService *endpoint.Service) *Service {
 	s := &Service{
 		clients:             make(map[string]*Client),
 		tunnelSubs:          make(map[string]map[string]*Client),
+		logSubs:             make(map[int64]map[string]*Client),
+		eventSeqStart:       time.Now().UnixMicro(),
+		replays:             make(map[string]*replayBuffer),
+		instanceStatus:      make(map[string]string),
+		memberships:         make(map[string]*tunnelMembership),
 		db:                  db,
 		endpointService:     endpointService,
 		storeJobCh:          make(chan models.EndpointSSE, 1000), // 缓冲大小按需调整
@@ -99,6 +125,8 @@ func NewService(db *sql.DB, endpointService *endpoint.Service) *Service {
 		cancel:     cancel,
 	}
 
+	s.eventSeq.Store(s.eventSeqStart)
+
 	// 启动异步持久化 worker，默认 1 条，可在外部自行调用 StartStoreWorkers 增加并发
 	s.StartStoreWorkers(1)
 
@@ -118,14 +146,25 @@ func (s *Service) SetManager(manager *Manager) {
 	s.manager = manager
 }
 
-// AddClient 添加新的SSE客户端
-func (s *Service) AddClient(clientID string, w http.ResponseWriter) {
+// SetWebhooks 设置 Webhook 服务引用，主控事件将同时投递给订阅方
+func (s *Service) SetWebhooks(webhooks *webhook.Service) {
+	s.webhooks = webhooks
+}
+
+// StoreQueueStats 返回事件存储队列的当前长度、容量及因队列已满丢弃的事件数
+func (s *Service) StoreQueueStats() (depth, capacity int, dropped int64) {
+	return len(s.storeJobCh), cap(s.storeJobCh), s.storeDropped.Load()
+}
+
+// AddClient 添加新的SSE客户端，scope 为该客户端可见的工作区范围
+func (s *Service) AddClient(clientID string, w http.ResponseWriter, scope workspace.Scope) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	s.clients[clientID] = &Client{
 		ID:     clientID,
 		Writer: w,
+		Scope:  scope,
 	}
 
 	// 记录日志
@@ -135,11 +174,11 @@ func (s *Service) AddClient(clientID string, w http.ResponseWriter) {
 // RemoveClient 移除SSE客户端
 func (s *Service) RemoveClient(clientID string) {
 	s.mu.Lock()
-	defer s.mu.Unlock()
 
-	// 安全地移除客户端，将Writer设为nil防止后续误用
+	// 收集该客户端的所有登记，解锁后统一停止推送，避免等待进行中的写入时阻塞其他推送
+	removed := make(map[*Client]bool)
 	if client, exists := s.clients[clientID]; exists {
-		client.Writer = nil
+		removed[client] = true
 	}
 	delete(s.clients, clientID)
 
@@ -149,13 +188,80 @@ func (s *Service) RemoveClient(clientID string) {
 	// 清理隧道订阅
 	for tunnelID, subs := range s.tunnelSubs {
 		if client, exists := subs[clientID]; exists {
-			client.Writer = nil
+			removed[client] = true
 		}
 		delete(subs, clientID)
 		if len(subs) == 0 {
 			delete(s.tunnelSubs, tunnelID)
 		}
 	}
+
+	// 清理主控日志订阅
+	for endpointID, subs := range s.logSubs {
+		if client, exists := subs[clientID]; exists {
+			removed[client] = true
+		}
+		delete(subs, clientID)
+		if len(subs) == 0 {
+			delete(s.logSubs, endpointID)
+		}
+	}
+	s.mu.Unlock()
+
+	// 将Writer设为nil防止后续误用，返回后不会再有写入
+	for client := range removed {
+		client.detach()
+	}
+}
+
+// SubscribeGlobal 将客户端加入全局推送；用于 WebSocket 等多路复用连接按需订阅，
+// 与 AddClient 不同，客户端的隧道及日志订阅相互独立
+func (s *Service) SubscribeGlobal(client *Client) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clients[client.ID] = client
+}
+
+// UnsubscribeGlobal 将客户端移出全局推送，保留其隧道及日志订阅
+func (s *Service) UnsubscribeGlobal(clientID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.clients, clientID)
+}
+
+// SubscribeClientToTunnel 订阅隧道事件，客户端无需先加入全局推送；调用方需先通过 InstanceVisible 校验
+func (s *Service) SubscribeClientToTunnel(client *Client, tunnelID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.tunnelSubs[tunnelID]; !exists {
+		s.tunnelSubs[tunnelID] = make(map[string]*Client)
+	}
+	s.tunnelSubs[tunnelID][client.ID] = client
+}
+
+// SubscribeEndpointLogs 订阅主控下所有实例的日志事件；调用方需先通过 EndpointVisible 校验
+func (s *Service) SubscribeEndpointLogs(client *Client, endpointID int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.logSubs[endpointID]; !exists {
+		s.logSubs[endpointID] = make(map[string]*Client)
+	}
+	s.logSubs[endpointID][client.ID] = client
+}
+
+// UnsubscribeEndpointLogs 取消主控日志订阅
+func (s *Service) UnsubscribeEndpointLogs(clientID string, endpointID int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if subs, exists := s.logSubs[endpointID]; exists {
+		delete(subs, clientID)
+		if len(subs) == 0 {
+			delete(s.logSubs, endpointID)
+		}
+	}
 }
 
 // SubscribeToTunnel 订阅隧道事件
@@ -194,10 +300,16 @@ func (s *Service) ProcessEvent(endpointID int64, event models.EndpointSSE) error
 	case s.storeJobCh <- event:
 		// 成功投递到存储队列
 	default:
+		s.storeDropped.Add(1)
 		log.Warnf("[Master-%d]事件存储队列已满，丢弃事件", endpointID)
 		return fmt.Errorf("存储队列已满")
 	}
 
+	// 投递给 Webhook 订阅方（非阻塞）
+	if s.webhooks != nil {
+		s.webhooks.Dispatch(event)
+	}
+
 	// 立即处理隧道状态变更（使用重试机制）
 	go func() {
 		if err := s.processEventImmediate(endpointID, event); err != nil {
@@ -210,8 +322,9 @@ func (s *Service) ProcessEvent(endpointID int64, event models.EndpointSSE) error
 
 // processEventImmediate 立即处理事件的核心逻辑
 func (s *Service) processEventImmediate(endpointID int64, event models.EndpointSSE) error {
-	// 对于更新事件，使用批处理以减少数据库锁竞争
+	// 对于更新事件，使用批处理以减少数据库锁竞争；推送给前端不依赖数据库写入，先行推送
 	if event.EventType == models.SSEEventTypeUpdate {
+		s.broadcastEvent(event)
 		select {
 		case s.batchUpdateCh <- event:
 			// 成功投递到批处理队列
@@ -242,13 +355,10 @@ func (s *Service) processEventImmediate(endpointID int64, event models.EndpointS
 	// 更新最后事件时间
 	s.updateLastEventTime(endpointID)
 
-	// 推流转发给前端订阅
-	if event.EventType != models.SSEEventTypeInitial {
-		if event.InstanceID != "" {
-			// log.Debugf("[Master-%d#SSE]准备推送事件给前端，eventType=%s instanceID=%s", endpointID, event.EventType, event.InstanceID)
-			s.sendTunnelUpdateByInstanceId(event.InstanceID, event)
-		}
-		return nil
+	// 推流转发给前端订阅（更新事件已在进入批处理前推送）
+	if event.EventType != models.SSEEventTypeInitial && event.EventType != models.SSEEventTypeUpdate {
+		// log.Debugf("[Master-%d#SSE]准备推送事件给前端，eventType=%s instanceID=%s", endpointID, event.EventType, event.InstanceID)
+		s.broadcastEvent(event)
 	}
 
 	return nil
@@ -424,46 +534,17 @@ func (s *Service) updateEventCache(event models.EndpointSSE) {
 	s.eventCache[event.EndpointID] = cache
 }
 
-// broadcastEvent 广播事件到所有相关客户端
+// broadcastEvent 推送主控事件到所有相关客户端：隧道订阅者、主控日志订阅者及全局客户端，
+// 日志事件数量大，不推送给全局客户端
 func (s *Service) broadcastEvent(event models.EndpointSSE) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	// 序列化事件
-	eventJSON, err := json.Marshal(event)
-	if err != nil {
-		log.Warn("序列化事件失败", "err", err)
-		return
-	}
-
-	// 构造SSE消息
-	message := fmt.Sprintf("data: %s\n\n", eventJSON)
-
-	// 发送到所有全局客户端
-	for _, client := range s.clients {
-		if client.Writer == nil {
-			continue
-		}
-		fmt.Fprint(client.Writer, message)
-		if f, ok := client.Writer.(http.Flusher); ok {
-			f.Flush()
-		}
-	}
-
-	// 如果是隧道相关事件，发送到订阅者
 	if event.InstanceID != "" {
-		if subs, exists := s.tunnelSubs[event.InstanceID]; exists {
-			for _, client := range subs {
-				if client.Writer == nil {
-					continue
-				}
-				fmt.Fprint(client.Writer, message)
-				if f, ok := client.Writer.(http.Flusher); ok {
-					f.Flush()
-				}
-			}
-		}
+		s.sendTunnelUpdateByInstanceId(event.InstanceID, event)
 	}
+	if event.EventType == models.SSEEventTypeLog {
+		s.sendEndpointLog(event)
+		return
+	}
+	s.sendGlobalUpdate(s.newEventMeta(event), event)
 }
 
 // updateLastEventTime 更新最后事件时间
@@ -526,70 +607,87 @@ func valueOrEmpty[T any](p *T, def T) T {
 
 // ============================= 新增辅助方法 =============================
 
-// sendTunnelUpdateByInstanceId 按隧道实例 ID 推送事件，仅发送给订阅了该隧道的客户端
+// sendTunnelUpdateByInstanceId 按隧道实例 ID 推送事件，仅发送给订阅了该隧道的客户端；
+// 没有订阅者时同样记入补发缓冲，供断线重连的客户端补发
 func (s *Service) sendTunnelUpdateByInstanceId(instanceID string, data interface{}) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		log.Warnf("[Inst.%s]序列化隧道事件失败,err=%v", instanceID, err)
+		return
+	}
+
+	payload = secret.RedactJSON(payload)
+
+	buf := s.replayBufferFor(StreamTunnel, instanceID)
+	buf.mu.Lock()
+	defer buf.mu.Unlock()
+
+	id := s.eventSeq.Add(1)
+	buf.record(id, nil, payload)
+
 	// 为避免在读锁状态下修改 map，拆分为两步：读取 +（可能）清理
 	s.mu.RLock()
-	subs, exists := s.tunnelSubs[instanceID]
+	subs := make(map[string]*Client, len(s.tunnelSubs[instanceID]))
+	for cid, cl := range s.tunnelSubs[instanceID] {
+		subs[cid] = cl
+	}
 	s.mu.RUnlock()
 
-	if !exists || len(subs) == 0 {
+	if len(subs) == 0 {
 		// 没有订阅者，记录调试日志后退出
 		// log.Debugf("[Inst.%s]无隧道订阅者，跳过推送", instanceID)
 		return
 	}
 
-	// 记录推送准备日志
-	payload, err := json.Marshal(data)
-	if err != nil {
-		log.Warnf("[Inst.%s]序列化隧道事件失败,err=%v", instanceID, err)
-		return
-	}
-
-	message := fmt.Sprintf("data: %s\n\n", payload)
-
 	failedIDs := make([]string, 0)
 	sent := 0
 
-	for id, client := range subs {
-		if client.Writer == nil {
-			failedIDs = append(failedIDs, id)
+	for cid, client := range subs {
+		if !client.active() {
+			failedIDs = append(failedIDs, cid)
 			continue
 		}
-		if _, err := fmt.Fprint(client.Writer, message); err == nil {
-			if f, ok := client.Writer.(http.Flusher); ok {
-				f.Flush()
-			}
+		if err := client.write(StreamTunnel, instanceID, id, payload); err == nil {
 			sent++
 		} else {
-			failedIDs = append(failedIDs, id)
-			log.Warnf("[Inst.%s]推送失败给客户端: %s, err=%v", instanceID, id, err)
+			failedIDs = append(failedIDs, cid)
+			log.Warnf("[Inst.%s]推送失败给客户端: %s, err=%v", instanceID, cid, err)
 		}
 	}
 
 	if len(failedIDs) > 0 {
 		s.mu.Lock()
-		for _, fid := range failedIDs {
-			delete(subs, fid)
-		}
-		// 若订阅者列表空，则移除隧道映射
-		if len(subs) == 0 {
-			delete(s.tunnelSubs, instanceID)
+		if live, ok := s.tunnelSubs[instanceID]; ok {
+			for _, fid := range failedIDs {
+				delete(live, fid)
+			}
+			// 若订阅者列表空，则移除隧道映射
+			if len(live) == 0 {
+				delete(s.tunnelSubs, instanceID)
+			}
 		}
 		s.mu.Unlock()
 	}
-	log.Debugf("[Inst.%s]隧道事件已推送", instanceID)
+	log.Debugf("[Inst.%s]隧道事件已推送,sent=%d", instanceID, sent)
 }
 
-// sendGlobalUpdate 推送全局事件（仪表盘 / 列表等使用），会发送给所有客户端
-func (s *Service) sendGlobalUpdate(data interface{}) {
+// sendGlobalUpdate 推送全局事件（仪表盘 / 列表等使用），仅发送给可见该主控所属工作区且订阅条件匹配的客户端；
+// meta 为空表示系统消息，所有客户端可见
+func (s *Service) sendGlobalUpdate(meta *eventMeta, data interface{}) {
 	payload, err := json.Marshal(data)
 	if err != nil {
 		log.Warnf("序列化全局事件失败,err=%v", err)
 		return
 	}
 
-	message := fmt.Sprintf("data: %s\n\n", payload)
+	payload = secret.RedactJSON(payload)
+
+	buf := s.replayBufferFor(StreamGlobal, "")
+	buf.mu.Lock()
+	defer buf.mu.Unlock()
+
+	id := s.eventSeq.Add(1)
+	buf.record(id, meta, payload)
 
 	s.mu.RLock()
 	clientsCopy := make(map[string]*Client, len(s.clients))
@@ -601,18 +699,22 @@ func (s *Service) sendGlobalUpdate(data interface{}) {
 	failedIDs := make([]string, 0)
 	sent := 0
 
-	for id, client := range clientsCopy {
-		if client.Writer == nil {
-			failedIDs = append(failedIDs, id)
+	visible := func(workspace.Scope) bool { return true }
+	if meta != nil && meta.endpointID != 0 {
+		visible = s.endpointVisibility(meta.endpointID)
+	}
+	for cid, client := range clientsCopy {
+		if !client.active() {
+			failedIDs = append(failedIDs, cid)
 			continue
 		}
-		if _, err := fmt.Fprint(client.Writer, message); err == nil {
-			if f, ok := client.Writer.(http.Flusher); ok {
-				f.Flush()
-			}
+		if !visible(client.Scope) || !client.Filter.match(s, meta) {
+			continue
+		}
+		if err := client.write(StreamGlobal, "", id, payload); err == nil {
 			sent++
 		} else {
-			failedIDs = append(failedIDs, id)
+			failedIDs = append(failedIDs, cid)
 		}
 	}
 
@@ -624,7 +726,79 @@ func (s *Service) sendGlobalUpdate(data interface{}) {
 		s.mu.Unlock()
 	}
 
-	log.Infof("全局事件已推送,sent=%d", sent)
+	log.Debugf("全局事件已推送,sent=%d", sent)
+}
+
+// endpointVisibility 返回判断客户端能否看到指定主控事件的函数，
+// 主控所属工作区仅在有受限客户端时才查询一次
+func (s *Service) endpointVisibility(endpointID int64) func(workspace.Scope) bool {
+	var workspaceID int64
+	loaded := false
+	return func(scope workspace.Scope) bool {
+		if scope.All {
+			return true
+		}
+		if !loaded {
+			loaded = true
+			if err := s.db.QueryRow(`SELECT workspaceId FROM "Endpoint" WHERE id = ?`, endpointID).Scan(&workspaceID); err != nil {
+				workspaceID = 0
+			}
+		}
+		return workspaceID != 0 && scope.Allows(workspaceID)
+	}
+}
+
+// InstanceVisible 判断隧道实例是否属于可见工作区，用于隧道 SSE 订阅前的校验
+func (s *Service) InstanceVisible(instanceID string, scope workspace.Scope) bool {
+	if scope.All {
+		return true
+	}
+	var workspaceID int64
+	err := s.db.QueryRow(`
+		SELECT e.workspaceId FROM "Tunnel" t
+		JOIN "Endpoint" e ON t.endpointId = e.id
+		WHERE t.instanceId = ?
+	`, instanceID).Scan(&workspaceID)
+	return err == nil && scope.Allows(workspaceID)
+}
+
+// EndpointVisible 判断主控是否属于可见工作区，用于主控日志订阅前的校验
+func (s *Service) EndpointVisible(endpointID int64, scope workspace.Scope) bool {
+	var exists bool
+	if err := s.db.QueryRow(`SELECT EXISTS(SELECT 1 FROM "Endpoint" WHERE id = ?)`, endpointID).Scan(&exists); err != nil || !exists {
+		return false
+	}
+	return s.endpointVisibility(endpointID)(scope)
+}
+
+// sendEndpointLog 推送日志事件给订阅了该主控日志的客户端
+func (s *Service) sendEndpointLog(event models.EndpointSSE) {
+	s.mu.RLock()
+	subs := make([]*Client, 0, len(s.logSubs[event.EndpointID]))
+	for _, client := range s.logSubs[event.EndpointID] {
+		subs = append(subs, client)
+	}
+	s.mu.RUnlock()
+	if len(subs) == 0 {
+		return
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		log.Warnf("[Master-%d]序列化日志事件失败,err=%v", event.EndpointID, err)
+		return
+	}
+	payload = secret.RedactJSON(payload)
+
+	key := strconv.FormatInt(event.EndpointID, 10)
+	for _, client := range subs {
+		if !client.active() {
+			continue
+		}
+		if err := client.write(StreamLogs, key, 0, payload); err != nil {
+			s.UnsubscribeEndpointLogs(client.ID, event.EndpointID)
+		}
+	}
 }
 
 // updateTunnelData 根据事件更新 Tunnel 表及 Endpoint.tunnelCount
@@ -679,7 +853,7 @@ func (s *Service) updateTunnelData(event models.EndpointSSE) {
 					targetPort = cfg.TargetPort
 					tlsMode = cfg.TLSMode
 					logLevel = cfg.LogLevel
-					commandLine = *event.URL
+					commandLine = secret.MaskURL(*event.URL) // 密码单独加密存储
 				}
 
 				if tlsMode == "" {
@@ -689,6 +863,12 @@ func (s *Service) updateTunnelData(event models.EndpointSSE) {
 					logLevel = "inherit"
 				}
 
+				password, err := secret.Protect(cfg.Password)
+				if err != nil {
+					log.Errorf("[Inst.%s]加密隧道密码失败，跳过插入,err=%v", event.InstanceID, err)
+					return
+				}
+
 				_, err = tx.Exec(`INSERT INTO "Tunnel" (
 					instanceId, endpointId, name, mode,
 					status, tunnelAddress, tunnelPort, targetAddress, targetPort,
@@ -696,7 +876,7 @@ func (s *Service) updateTunnelData(event models.EndpointSSE) {
 					password, min, max,
 					tcpRx, tcpTx, udpRx, udpTx, pool, ping,
 					createdAt, updatedAt, lastEventTime
-				) VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)`,
+				) VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)`,
 					event.InstanceID,
 					event.EndpointID,
 					event.InstanceID,
@@ -711,7 +891,7 @@ func (s *Service) updateTunnelData(event models.EndpointSSE) {
 					cfg.KeyPath,
 					logLevel,
 					commandLine,
-					cfg.Password,
+					password,
 					func() interface{} {
 						if cfg.Min != "" {
 							return cfg.Min
@@ -1055,6 +1235,12 @@ func (s *Service) tunnelCreate(tx *sql.Tx, e models.EndpointSSE, cfg parsedURL)
 		log.Infof("[Master-%d#SSE]Inst.%s创建隧道时设置重启策略: %t", e.EndpointID, e.InstanceID, restart)
 	}
 
+	password, err := secret.Protect(cfg.Password)
+	if err != nil {
+		log.Errorf("[Master-%d#SSE]Inst.%s加密隧道密码失败，跳过创建,err=%v", e.EndpointID, e.InstanceID, err)
+		return err
+	}
+
 	// 处理可能为 nil 的字段
 	poolValue := e.Pool
 	pingValue := e.Ping
@@ -1066,11 +1252,11 @@ func (s *Service) tunnelCreate(tx *sql.Tx, e models.EndpointSSE, cfg parsedURL)
 		password, min, max,
 		tcpRx, tcpTx, udpRx, udpTx, pool, ping,
 		restart, createdAt, updatedAt, lastEventTime
-	) VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)`,
+	) VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)`,
 		e.InstanceID, e.EndpointID, name, ptrStringDefault(e.InstanceType, ""), ptrStringDefault(e.Status, "stopped"),
 		cfg.TunnelAddress, cfg.TunnelPort, cfg.TargetAddress, cfg.TargetPort,
-		cfg.TLSMode, cfg.CertPath, cfg.KeyPath, cfg.LogLevel, ptrString(e.URL),
-		cfg.Password,
+		cfg.TLSMode, cfg.CertPath, cfg.KeyPath, cfg.LogLevel, secret.MaskURL(ptrString(e.URL)),
+		password,
 		func() interface{} {
 			if cfg.Min != "" {
 				return cfg.Min
@@ -1107,9 +1293,10 @@ func (s *Service) tunnelUpdate(tx *sql.Tx, e models.EndpointSSE, cfg parsedURL)
 	var curRestart bool
 	// 记录当前模式(server/client)
 	var curMode string
+	var curPassword sql.NullString
 
-	err := tx.QueryRow(`SELECT status, tcpRx, tcpTx, udpRx, udpTx, lastEventTime, name, restart, mode FROM "Tunnel" WHERE endpointId = ? AND instanceId = ?`, e.EndpointID, e.InstanceID).
-		Scan(&curStatus, &curTCPRx, &curTCPTx, &curUDPRx, &curUDPTx, &curEventTime, &curName, &curRestart, &curMode)
+	err := tx.QueryRow(`SELECT status, tcpRx, tcpTx, udpRx, udpTx, lastEventTime, name, restart, mode, password FROM "Tunnel" WHERE endpointId = ? AND instanceId = ?`, e.EndpointID, e.InstanceID).
+		Scan(&curStatus, &curTCPRx, &curTCPTx, &curUDPRx, &curUDPTx, &curEventTime, &curName, &curRestart, &curMode, &curPassword)
 	if err == sql.ErrNoRows {
 		log.Infof("[Master-%d#SSE]Inst.%s不存在，跳过更新", e.EndpointID, e.InstanceID)
 		return nil // 尚未创建对应记录，等待后续 create/initial
@@ -1172,6 +1359,13 @@ func (s *Service) tunnelUpdate(tx *sql.Tx, e models.EndpointSSE, cfg parsedURL)
 		return nil
 	}()
 
+	// 密码未变时沿用已有密文，避免每次事件都递增修订号
+	password, err := secret.Reprotect(curPassword.String, cfg.Password)
+	if err != nil {
+		log.Errorf("[Master-%d#SSE]Inst.%s加密隧道密码失败，跳过更新,err=%v", e.EndpointID, e.InstanceID, err)
+		return err
+	}
+
 	// 处理可能为 nil 的字段
 	poolValue := e.Pool
 	pingValue := e.Ping
@@ -1187,8 +1381,8 @@ func (s *Service) tunnelUpdate(tx *sql.Tx, e models.EndpointSSE, cfg parsedURL)
 		newStatus, e.TCPRx, e.TCPTx, e.UDPRx, e.UDPTx, poolValue, pingValue,
 		newName, newMode, newRestart,
 		cfg.TunnelAddress, cfg.TunnelPort, cfg.TargetAddress, cfg.TargetPort,
-		cfg.TLSMode, cfg.CertPath, cfg.KeyPath, cfg.LogLevel, ptrString(e.URL),
-		cfg.Password, minVal, maxVal,
+		cfg.TLSMode, cfg.CertPath, cfg.KeyPath, cfg.LogLevel, secret.MaskURL(ptrString(e.URL)),
+		password, minVal, maxVal,
 		e.EventTime, time.Now(),
 		e.EndpointID, e.InstanceID)
 	if err != nil {
@@ -1259,6 +1453,12 @@ func (s *Service) tunnelCreateOrUpdate(tx *sql.Tx, e models.EndpointSSE, cfg par
 			log.Infof("[Master-%d#SSE]Inst.%s创建隧道时设置重启策略: %t", e.EndpointID, e.InstanceID, restart)
 		}
 
+		password, err := secret.Protect(cfg.Password)
+		if err != nil {
+			log.Errorf("[Master-%d#SSE]Inst.%s加密隧道密码失败，跳过创建,err=%v", e.EndpointID, e.InstanceID, err)
+			return err
+		}
+
 		// 处理可能为 nil 的字段
 		poolValue := e.Pool
 		pingValue := e.Ping
@@ -1270,11 +1470,11 @@ func (s *Service) tunnelCreateOrUpdate(tx *sql.Tx, e models.EndpointSSE, cfg par
 			password, min, max,
 			tcpRx, tcpTx, udpRx, udpTx, pool, ping,
 			restart, createdAt, updatedAt, lastEventTime
-		) VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)`,
+		) VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)`,
 			e.InstanceID, e.EndpointID, name, ptrStringDefault(e.InstanceType, ""), ptrStringDefault(e.Status, "stopped"),
 			cfg.TunnelAddress, cfg.TunnelPort, cfg.TargetAddress, cfg.TargetPort,
-			cfg.TLSMode, cfg.CertPath, cfg.KeyPath, cfg.LogLevel, ptrString(e.URL),
-			cfg.Password,
+			cfg.TLSMode, cfg.CertPath, cfg.KeyPath, cfg.LogLevel, secret.MaskURL(ptrString(e.URL)),
+			password,
 			func() interface{} {
 				if cfg.Min != "" {
 					return cfg.Min
@@ -1466,26 +1666,7 @@ func (s *Service) fetchAndUpdateEndpointInfo(endpointID int64) {
 
 // BroadcastToAll 广播事件到所有客户端（用于系统更新等全局消息）
 func (s *Service) BroadcastToAll(event Event) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	eventJSON, err := json.Marshal(event)
-	if err != nil {
-		log.Warn("序列化事件失败", "err", err)
-		return
-	}
-
-	message := fmt.Sprintf("data: %s\n\n", eventJSON)
-
-	for _, client := range s.clients {
-		if client.Writer == nil {
-			continue
-		}
-		fmt.Fprint(client.Writer, message)
-		if f, ok := client.Writer.(http.Flusher); ok {
-			f.Flush()
-		}
-	}
+	s.sendGlobalUpdate(nil, event)
 }
 
 // ==================== 日志清理相关方法 ====================
@@ -0,0 +1,79 @@
+package sse
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"NodePassDash/internal/db/dbtest"
+	"NodePassDash/internal/models"
+	"NodePassDash/internal/secret"
+)
+
+func TestTunnelUpdateKeepsPasswordCiphertext(t *testing.T) {
+	if err := secret.Configure("sse-test-master-key", nil); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { secret.Configure("", nil) })
+
+	conn := dbtest.Open(t)
+	if _, err := conn.Exec(`INSERT INTO "Endpoint" (id, name, url, apiPath, apiKey) VALUES (1, 'ep', 'http://127.0.0.1:1', '/api', 'k')`); err != nil {
+		t.Fatal(err)
+	}
+	s := &Service{db: conn}
+
+	instanceType, status := "server", "running"
+	start := time.Now()
+	apply := func(fn func(*sql.Tx, models.EndpointSSE, parsedURL) error, url string, tick int) {
+		t.Helper()
+		e := models.EndpointSSE{
+			EndpointID:   1,
+			InstanceID:   "i1",
+			InstanceType: &instanceType,
+			Status:       &status,
+			URL:          &url,
+			TCPRx:        int64(tick * 100),
+			EventTime:    start.Add(time.Duration(tick) * time.Second),
+		}
+		tx, err := conn.Begin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := fn(tx, e, parseInstanceURL(url, instanceType)); err != nil {
+			tx.Rollback()
+			t.Fatal(err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stored := func() (password string, revision int64) {
+		t.Helper()
+		if err := conn.QueryRow(`SELECT password, revision FROM "Tunnel" WHERE instanceId = 'i1'`).Scan(&password, &revision); err != nil {
+			t.Fatal(err)
+		}
+		return password, revision
+	}
+
+	url := "server://s3cret@:1001/127.0.0.1:80?log=info"
+	apply(s.tunnelCreate, url, 0)
+	password, revision := stored()
+	if !secret.IsEncrypted(password) {
+		t.Fatalf("password stored as %q, want ciphertext", password)
+	}
+
+	// 流量更新及重连后的 initial 事件携带相同的密码，不应改写密文或递增修订号
+	apply(s.tunnelUpdate, url, 1)
+	apply(s.tunnelUpdate, url, 2)
+	apply(s.tunnelCreateOrUpdate, url, 3)
+	if p, r := stored(); p != password || r != revision {
+		t.Fatalf("unchanged password rewritten: revision %d -> %d", revision, r)
+	}
+
+	// 密码变化时重新加密并递增修订号
+	apply(s.tunnelUpdate, "server://n3w@:1001/127.0.0.1:80?log=info", 4)
+	p, r := stored()
+	if plain, err := secret.Reveal(p); err != nil || plain != "n3w" || r == revision {
+		t.Fatalf("changed password: plain = %q (%v), revision %d -> %d", plain, err, revision, r)
+	}
+}
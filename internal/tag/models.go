@@ -6,10 +6,11 @@ import (
 
 // Tag 标签模型
 type Tag struct {
-	ID        int64     `json:"id"`
-	Name      string    `json:"name"`
-	CreatedAt time.Time `json:"createdAt"`
-	UpdatedAt time.Time `json:"updatedAt"`
+	ID          int64     `json:"id"`
+	Name        string    `json:"name"`
+	WorkspaceID int64     `json:"workspaceId"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
 }
 
 // TunnelTag 隧道标签关联模型
@@ -22,7 +23,8 @@ type TunnelTag struct {
 
 // CreateTagRequest 创建标签请求
 type CreateTagRequest struct {
-	Name string `json:"name" validate:"required"`
+	Name        string `json:"name" validate:"required"`
+	WorkspaceID int64  `json:"workspaceId,omitempty"` // 所属工作区，为空时使用调用方的默认工作区
 }
 
 // UpdateTagRequest 更新标签请求
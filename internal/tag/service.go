@@ -5,6 +5,8 @@ import (
 	"errors"
 	"strings"
 	"time"
+
+	"NodePassDash/internal/workspace"
 )
 
 type Service struct {
@@ -30,10 +32,14 @@ func (s *Service) CreateTag(req *CreateTagRequest) (*Tag, error) {
 		return nil, err
 	}
 
+	if req.WorkspaceID == 0 {
+		req.WorkspaceID = workspace.DefaultWorkspaceID
+	}
+
 	// 插入标签
 	result, err := s.db.Exec(
-		"INSERT INTO Tags (name, created_at, updated_at) VALUES (?, ?, ?)",
-		req.Name, time.Now(), time.Now(),
+		"INSERT INTO Tags (name, workspace_id, created_at, updated_at) VALUES (?, ?, ?, ?)",
+		req.Name, req.WorkspaceID, time.Now(), time.Now(),
 	)
 	if err != nil {
 		return nil, err
@@ -45,16 +51,18 @@ func (s *Service) CreateTag(req *CreateTagRequest) (*Tag, error) {
 	}
 
 	return &Tag{
-		ID:        id,
-		Name:      req.Name,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+		ID:          id,
+		Name:        req.Name,
+		WorkspaceID: req.WorkspaceID,
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
 	}, nil
 }
 
-// GetTags 获取所有标签
-func (s *Service) GetTags() ([]*Tag, error) {
-	rows, err := s.db.Query("SELECT id, name, created_at, updated_at FROM Tags ORDER BY name")
+// GetTags 获取可见工作区内的标签
+func (s *Service) GetTags(scope workspace.Scope) ([]*Tag, error) {
+	cond, args := scope.Where("workspace_id")
+	rows, err := s.db.Query("SELECT id, name, workspace_id, created_at, updated_at FROM Tags WHERE "+cond+" ORDER BY name", args...)
 	if err != nil {
 		return nil, err
 	}
@@ -63,7 +71,7 @@ func (s *Service) GetTags() ([]*Tag, error) {
 	var tags []*Tag
 	for rows.Next() {
 		var tag Tag
-		err := rows.Scan(&tag.ID, &tag.Name, &tag.CreatedAt, &tag.UpdatedAt)
+		err := rows.Scan(&tag.ID, &tag.Name, &tag.WorkspaceID, &tag.CreatedAt, &tag.UpdatedAt)
 		if err != nil {
 			return nil, err
 		}
@@ -77,9 +85,9 @@ func (s *Service) GetTags() ([]*Tag, error) {
 func (s *Service) GetTagByID(id int64) (*Tag, error) {
 	var tag Tag
 	err := s.db.QueryRow(
-		"SELECT id, name, created_at, updated_at FROM Tags WHERE id = ?",
+		"SELECT id, name, workspace_id, created_at, updated_at FROM Tags WHERE id = ?",
 		id,
-	).Scan(&tag.ID, &tag.Name, &tag.CreatedAt, &tag.UpdatedAt)
+	).Scan(&tag.ID, &tag.Name, &tag.WorkspaceID, &tag.CreatedAt, &tag.UpdatedAt)
 	if err != nil {
 		return nil, err
 	}
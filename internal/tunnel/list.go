@@ -0,0 +1,274 @@
+package tunnel
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"NodePassDash/internal/workspace"
+)
+
+const (
+	defaultListPageSize = 50
+	maxListPageSize     = 500
+)
+
+// ListQueryError 查询条件无效（排序字段、游标、端口范围等）
+type ListQueryError struct {
+	msg string
+}
+
+func (e *ListQueryError) Error() string {
+	return e.msg
+}
+
+func listQueryError(format string, args ...interface{}) error {
+	return &ListQueryError{msg: fmt.Sprintf(format, args...)}
+}
+
+// listSortExpr 排序字段对应的 SQL 表达式，均为整数以便游标比较；
+// 延迟为空的隧道无论升降序均排在最后
+func listSortExpr(sort, order string) (string, error) {
+	if order != "asc" && order != "desc" {
+		return "", listQueryError("不支持的排序方向: %s", order)
+	}
+	switch sort {
+	case "createdAt":
+		return `COALESCE(CAST(strftime('%s', t.createdAt) AS INTEGER), 0)`, nil
+	case "traffic":
+		return `(t.tcpRx + t.tcpTx + t.udpRx + t.udpTx)`, nil
+	case "ping":
+		if order == "asc" {
+			return `COALESCE(t.ping, 9223372036854775807)`, nil
+		}
+		return `COALESCE(t.ping, -1)`, nil
+	}
+	return "", listQueryError("不支持的排序字段: %s", sort)
+}
+
+// ListTunnels 按条件分页查询可见工作区内的隧道，过滤、排序与分页均在 SQL 中完成；
+// 支持页码分页和游标分页，游标分页在翻页期间有新增或删除隧道时不会重复或遗漏
+func (s *Service) ListTunnels(scope workspace.Scope, q ListQuery) (*ListPage, error) {
+	if q.Sort == "" {
+		q.Sort = "createdAt"
+	}
+	if q.Order == "" {
+		q.Order = "desc"
+	}
+	sortExpr, err := listSortExpr(q.Sort, q.Order)
+	if err != nil {
+		return nil, err
+	}
+	if q.Page < 1 {
+		q.Page = 1
+	}
+	if q.PageSize < 1 {
+		q.PageSize = defaultListPageSize
+	}
+	if q.PageSize > maxListPageSize {
+		q.PageSize = maxListPageSize
+	}
+	if q.PortFrom < 0 || q.PortTo < 0 || (q.PortTo > 0 && q.PortFrom > q.PortTo) {
+		return nil, listQueryError("端口范围无效")
+	}
+
+	where, args, err := s.listWhere(scope, q)
+	if err != nil {
+		return nil, err
+	}
+
+	// 各状态数量（忽略状态过滤），总数由其中命中状态过滤的部分相加得到
+	statusWhere, statusArgs := listStatusWhere(q.Statuses)
+	counts := map[TunnelStatus]int{}
+	rows, err := s.db.Query(`
+		SELECT t.status, COUNT(*)
+		FROM "Tunnel" t
+		LEFT JOIN "Endpoint" e ON t.endpointId = e.id
+		WHERE `+where+`
+		GROUP BY t.status`, args...)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var status string
+		var n int
+		if err := rows.Scan(&status, &n); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		counts[TunnelStatus(status)] = n
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	page := &ListPage{StatusCounts: counts, PageSize: q.PageSize}
+	for status, n := range counts {
+		if len(q.Statuses) == 0 || containsStatus(q.Statuses, status) {
+			page.Total += n
+		}
+	}
+
+	cmp, dir := "<", "DESC"
+	if q.Order == "asc" {
+		cmp, dir = ">", "ASC"
+	}
+	where += " AND " + statusWhere
+	args = append(args, statusArgs...)
+	if q.Cursor != "" {
+		key, id, err := decodeListCursor(q.Cursor, q.Sort, q.Order)
+		if err != nil {
+			return nil, err
+		}
+		where += fmt.Sprintf(" AND (%s %s ? OR (%s = ? AND t.id %s ?))", sortExpr, cmp, sortExpr, cmp)
+		args = append(args, key, key, id)
+	} else {
+		page.Page = q.Page
+	}
+
+	// 多取一条用于判断是否还有下一页
+	query := `
+		SELECT ` + tunnelListColumns + `, ` + sortExpr + ` AS sortKey` + tunnelListJoins + `
+		WHERE ` + where + `
+		ORDER BY sortKey ` + dir + `, t.id ` + dir + `
+		LIMIT ?`
+	args = append(args, q.PageSize+1)
+	if q.Cursor == "" {
+		query += ` OFFSET ?`
+		args = append(args, (q.Page-1)*q.PageSize)
+	}
+
+	rows, err = s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	page.Tunnels = []TunnelWithStats{}
+	var keys []int64
+	for rows.Next() {
+		var key int64
+		t, err := scanTunnelWithStats(rows, &key)
+		if err != nil {
+			return nil, err
+		}
+		page.Tunnels = append(page.Tunnels, t)
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(page.Tunnels) > q.PageSize {
+		page.Tunnels = page.Tunnels[:q.PageSize]
+		last := page.Tunnels[q.PageSize-1]
+		page.NextCursor = encodeListCursor(q.Sort, q.Order, keys[q.PageSize-1], last.ID)
+	}
+	return page, nil
+}
+
+// listWhere 构造除状态外的过滤条件
+func (s *Service) listWhere(scope workspace.Scope, q ListQuery) (string, []interface{}, error) {
+	cond, args := scope.Where("e.workspaceId")
+	conds := []string{cond}
+
+	if q.EndpointID > 0 {
+		conds = append(conds, "t.endpointId = ?")
+		args = append(args, q.EndpointID)
+	}
+	if q.Mode != "" {
+		conds = append(conds, "t.mode = ?")
+		args = append(args, string(q.Mode))
+	}
+	if q.TagID != nil {
+		if *q.TagID == 0 {
+			conds = append(conds, "NOT EXISTS (SELECT 1 FROM TunnelTags WHERE tunnel_id = t.id)")
+		} else {
+			conds = append(conds, "EXISTS (SELECT 1 FROM TunnelTags WHERE tunnel_id = t.id AND tag_id = ?)")
+			args = append(args, *q.TagID)
+		}
+	}
+	if q.GroupID > 0 {
+		// 分组表在部分版本的数据库中不存在，此时没有隧道属于任何分组
+		var n int
+		if err := s.db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'tunnel_group_members'`).Scan(&n); err != nil {
+			return "", nil, err
+		}
+		if n == 0 {
+			conds = append(conds, "0 = 1")
+		} else {
+			conds = append(conds, "t.id IN (SELECT tunnel_id FROM tunnel_group_members WHERE group_id = ?)")
+			args = append(args, q.GroupID)
+		}
+	}
+	if q.Name != "" {
+		conds = append(conds, `t.name LIKE ? ESCAPE '\'`)
+		args = append(args, "%"+escapeLike(q.Name)+"%")
+	}
+	if q.PortFrom > 0 || q.PortTo > 0 {
+		to := q.PortTo
+		if to == 0 {
+			to = 65535
+		}
+		conds = append(conds, `(CAST(t.tunnelPort AS INTEGER) BETWEEN ? AND ? OR CAST(t.targetPort AS INTEGER) BETWEEN ? AND ?)`)
+		args = append(args, q.PortFrom, to, q.PortFrom, to)
+	}
+	return strings.Join(conds, " AND "), args, nil
+}
+
+// listStatusWhere 构造状态过滤条件
+func listStatusWhere(statuses []TunnelStatus) (string, []interface{}) {
+	if len(statuses) == 0 {
+		return "1 = 1", nil
+	}
+	args := make([]interface{}, len(statuses))
+	for i, status := range statuses {
+		args[i] = string(status)
+	}
+	return "t.status IN (" + strings.TrimSuffix(strings.Repeat("?,", len(statuses)), ",") + ")", args
+}
+
+func containsStatus(statuses []TunnelStatus, status TunnelStatus) bool {
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeListCursor 游标记录排序方式、最后一条记录的排序值及 ID
+func encodeListCursor(sort, order string, key, id int64) string {
+	raw := fmt.Sprintf("%s.%s:%d:%d", sort, order, key, id)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeListCursor 解析游标，排序方式与本次查询不一致时返回错误
+func decodeListCursor(cursor, sort, order string) (key, id int64, err error) {
+	invalid := listQueryError("cursor 参数无效")
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, 0, invalid
+	}
+	parts := strings.Split(string(raw), ":")
+	if len(parts) != 3 {
+		return 0, 0, invalid
+	}
+	if parts[0] != sort+"."+order {
+		return 0, 0, listQueryError("cursor 与当前排序方式不一致，请从第一页重新查询")
+	}
+	if key, err = strconv.ParseInt(parts[1], 10, 64); err != nil {
+		return 0, 0, invalid
+	}
+	if id, err = strconv.ParseInt(parts[2], 10, 64); err != nil {
+		return 0, 0, invalid
+	}
+	return key, id, nil
+}
+
+// escapeLike 转义 LIKE 模式中的通配符
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,321 @@
+package tunnel
+
+import (
+	"database/sql"
+	"errors"
+	"reflect"
+	"testing"
+
+	"NodePassDash/internal/db/dbtest"
+	"NodePassDash/internal/workspace"
+)
+
+// visibleScope 测试中可见的工作区，隧道 6 所在的工作区 2 不可见
+var visibleScope = workspace.Scope{IDs: []int64{1}}
+
+// newListTestService 创建带以下隧道的服务（均在工作区 1，隧道 6 除外）：
+//
+//	id name    主控 模式    状态     端口        创建日期    流量 延迟
+//	1  web-a   1    server  running  1001/80     01-01       100  10
+//	2  web-b   1    server  stopped  1002/8080   01-01       100  -
+//	3  db_1    2    client  running  3306/3306   01-02       300  5
+//	4  cache   2    client  error    6379/6379   01-01       50   30
+//	5  web-c   1    server  running  1003/443    01-03       100  -
+//	6  hidden  3    server  running  1004/80     01-01       999  1
+//
+// 标签 1 关联隧道 1、3
+func newListTestService(t *testing.T) (*Service, *sql.DB) {
+	t.Helper()
+	db := dbtest.Open(t)
+	stmts := []string{
+		`INSERT INTO "Workspace" (id, name) VALUES (2, 'other')`,
+		`INSERT INTO "Endpoint" (id, name, url, apiPath, apiKey, workspaceId) VALUES (1, 'ep1', 'http://127.0.0.1:1', '/api', 'k1', 1)`,
+		`INSERT INTO "Endpoint" (id, name, url, apiPath, apiKey, workspaceId) VALUES (2, 'ep2', 'http://127.0.0.1:2', '/api', 'k2', 1)`,
+		`INSERT INTO "Endpoint" (id, name, url, apiPath, apiKey, workspaceId) VALUES (3, 'ep3', 'http://127.0.0.1:3', '/api', 'k3', 2)`,
+		`INSERT INTO "Tags" (id, name) VALUES (1, 'prod')`,
+	}
+	tunnels := []struct {
+		id                 int64
+		name               string
+		endpointID         int64
+		mode, status       string
+		tunnelPort, target string
+		createdAt          string
+		traffic            int64
+		ping               interface{}
+	}{
+		{1, "web-a", 1, "server", "running", "1001", "80", "2024-01-01 00:00:00", 100, 10},
+		{2, "web-b", 1, "server", "stopped", "1002", "8080", "2024-01-01 00:00:00", 100, nil},
+		{3, "db_1", 2, "client", "running", "3306", "3306", "2024-01-02 00:00:00", 300, 5},
+		{4, "cache", 2, "client", "error", "6379", "6379", "2024-01-01 00:00:00", 50, 30},
+		{5, "web-c", 1, "server", "running", "1003", "443", "2024-01-03 00:00:00", 100, nil},
+		{6, "hidden", 3, "server", "running", "1004", "80", "2024-01-01 00:00:00", 999, 1},
+	}
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	for _, tn := range tunnels {
+		if _, err := db.Exec(`INSERT INTO "Tunnel" (id, name, endpointId, mode, status, tunnelAddress, tunnelPort, targetAddress, targetPort,
+			tlsMode, commandLine, instanceId, createdAt, tcpRx, ping)
+			VALUES (?, ?, ?, ?, ?, '', ?, '127.0.0.1', ?, 'inherit', '', ?, ?, ?, ?)`,
+			tn.id, tn.name, tn.endpointID, tn.mode, tn.status, tn.tunnelPort, tn.target, tn.name, tn.createdAt, tn.traffic, tn.ping); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, id := range []int{1, 3} {
+		if _, err := db.Exec(`INSERT INTO TunnelTags (tunnel_id, tag_id) VALUES (?, 1)`, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return NewService(db), db
+}
+
+func tunnelIDs(page *ListPage) []int64 {
+	ids := make([]int64, 0, len(page.Tunnels))
+	for _, t := range page.Tunnels {
+		ids = append(ids, t.ID)
+	}
+	return ids
+}
+
+// walkCursor 按游标翻页直到最后一页，返回依次得到的隧道 ID
+func walkCursor(t *testing.T, s *Service, q ListQuery) []int64 {
+	t.Helper()
+	var ids []int64
+	for i := 0; i < 20; i++ {
+		page, err := s.ListTunnels(visibleScope, q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if q.Cursor != "" && page.Page != 0 {
+			t.Fatalf("cursor page reported page number %d", page.Page)
+		}
+		ids = append(ids, tunnelIDs(page)...)
+		if page.NextCursor == "" {
+			return ids
+		}
+		q.Cursor = page.NextCursor
+	}
+	t.Fatal("cursor pagination did not terminate")
+	return nil
+}
+
+func TestListTunnelsCursorPagination(t *testing.T) {
+	s, _ := newListTestService(t)
+
+	// 排序值相同的隧道按 ID 排列，跨页时既不重复也不遗漏
+	cases := []struct {
+		sort, order string
+		want        []int64
+	}{
+		{"createdAt", "desc", []int64{5, 3, 4, 2, 1}},
+		{"createdAt", "asc", []int64{1, 2, 4, 3, 5}},
+		{"traffic", "desc", []int64{3, 5, 2, 1, 4}},
+		{"traffic", "asc", []int64{4, 1, 2, 5, 3}},
+		// 延迟未知的隧道无论升降序均排在最后
+		{"ping", "asc", []int64{3, 1, 4, 2, 5}},
+		{"ping", "desc", []int64{4, 1, 3, 5, 2}},
+	}
+	for _, c := range cases {
+		for _, size := range []int{1, 2, 3, 5} {
+			got := walkCursor(t, s, ListQuery{Sort: c.sort, Order: c.order, PageSize: size})
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("%s %s pageSize=%d: ids = %v, want %v", c.sort, c.order, size, got, c.want)
+			}
+		}
+	}
+}
+
+func TestListTunnelsCursorStableAcrossInserts(t *testing.T) {
+	s, db := newListTestService(t)
+
+	first, err := s.ListTunnels(visibleScope, ListQuery{PageSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := tunnelIDs(first); !reflect.DeepEqual(got, []int64{5, 3}) {
+		t.Fatalf("first page = %v", got)
+	}
+
+	// 翻页期间新增最新的隧道并删除尚未返回的一条
+	if _, err := db.Exec(`INSERT INTO "Tunnel" (id, name, endpointId, mode, tunnelAddress, tunnelPort, targetAddress, targetPort, tlsMode, commandLine, instanceId, createdAt)
+		VALUES (7, 'new', 1, 'server', '', '1007', '127.0.0.1', '80', 'inherit', '', 'new', '2024-02-01 00:00:00')`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`DELETE FROM "Tunnel" WHERE id = 2`); err != nil {
+		t.Fatal(err)
+	}
+
+	rest := walkCursor(t, s, ListQuery{PageSize: 2, Cursor: first.NextCursor})
+	if !reflect.DeepEqual(rest, []int64{4, 1}) {
+		t.Fatalf("remaining pages = %v, want [4 1]", rest)
+	}
+}
+
+func TestListTunnelsOffsetPagination(t *testing.T) {
+	s, _ := newListTestService(t)
+
+	cases := []struct {
+		page     int
+		want     []int64
+		wantNext bool
+	}{
+		{1, []int64{5, 3}, true},
+		{2, []int64{4, 2}, true},
+		{3, []int64{1}, false},
+		{4, []int64{}, false},
+	}
+	for _, c := range cases {
+		page, err := s.ListTunnels(visibleScope, ListQuery{Page: c.page, PageSize: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := tunnelIDs(page); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("page %d: ids = %v, want %v", c.page, got, c.want)
+		}
+		if page.Page != c.page || page.Total != 5 || (page.NextCursor != "") != c.wantNext {
+			t.Errorf("page %d: page = %d, total = %d, nextCursor = %q", c.page, page.Page, page.Total, page.NextCursor)
+		}
+	}
+
+	// 页码之后可改用游标继续翻页
+	second, _ := s.ListTunnels(visibleScope, ListQuery{Page: 2, PageSize: 2})
+	if rest := walkCursor(t, s, ListQuery{PageSize: 2, Cursor: second.NextCursor}); !reflect.DeepEqual(rest, []int64{1}) {
+		t.Fatalf("cursor after offset page = %v", rest)
+	}
+}
+
+func TestListTunnelsFilters(t *testing.T) {
+	s, db := newListTestService(t)
+	tag := func(id int64) *int64 { return &id }
+
+	cases := []struct {
+		name string
+		q    ListQuery
+		want []int64
+	}{
+		{"no filter hides other workspaces", ListQuery{}, []int64{5, 3, 4, 2, 1}},
+		{"endpoint", ListQuery{EndpointID: 2}, []int64{3, 4}},
+		{"endpoint in other workspace", ListQuery{EndpointID: 3}, []int64{}},
+		{"status", ListQuery{Statuses: []TunnelStatus{StatusRunning}}, []int64{5, 3, 1}},
+		{"multiple statuses", ListQuery{Statuses: []TunnelStatus{StatusStopped, StatusError}}, []int64{4, 2}},
+		{"mode", ListQuery{Mode: ModeClient}, []int64{3, 4}},
+		{"tag", ListQuery{TagID: tag(1)}, []int64{3, 1}},
+		{"untagged", ListQuery{TagID: tag(0)}, []int64{5, 4, 2}},
+		{"group without group table", ListQuery{GroupID: 1}, []int64{}},
+		{"name is case-insensitive", ListQuery{Name: "WEB"}, []int64{5, 2, 1}},
+		{"name wildcards are literal", ListQuery{Name: "_"}, []int64{3}},
+		{"name percent is literal", ListQuery{Name: "%"}, []int64{}},
+		{"tunnel or target port range", ListQuery{PortFrom: 3000, PortTo: 4000}, []int64{3}},
+		{"open-ended port range", ListQuery{PortFrom: 8000}, []int64{2}},
+		{"combined", ListQuery{Mode: ModeServer, Statuses: []TunnelStatus{StatusRunning}, Name: "web"}, []int64{5, 1}},
+	}
+	for _, c := range cases {
+		page, err := s.ListTunnels(visibleScope, c.q)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if got := tunnelIDs(page); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: ids = %v, want %v", c.name, got, c.want)
+		}
+		if page.Total != len(c.want) {
+			t.Errorf("%s: total = %d, want %d", c.name, page.Total, len(c.want))
+		}
+	}
+
+	// 存在分组表时按成员过滤
+	if _, err := db.Exec(`CREATE TABLE tunnel_group_members (id INTEGER PRIMARY KEY, group_id INTEGER, tunnel_id INTEGER, role TEXT, created_at DATETIME)`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO tunnel_group_members (group_id, tunnel_id) VALUES (1, 2), (1, 6), (2, 3)`); err != nil {
+		t.Fatal(err)
+	}
+	page, err := s.ListTunnels(visibleScope, ListQuery{GroupID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := tunnelIDs(page); !reflect.DeepEqual(got, []int64{2}) {
+		t.Fatalf("group filter = %v, want [2]", got)
+	}
+}
+
+func TestListTunnelsCounts(t *testing.T) {
+	s, _ := newListTestService(t)
+
+	page, err := s.ListTunnels(visibleScope, ListQuery{Statuses: []TunnelStatus{StatusRunning}, PageSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 总数只计命中状态过滤的隧道，各状态数量忽略状态过滤，且均不含不可见的隧道
+	want := map[TunnelStatus]int{StatusRunning: 3, StatusStopped: 1, StatusError: 1}
+	if page.Total != 3 || !reflect.DeepEqual(page.StatusCounts, want) || len(page.Tunnels) != 1 {
+		t.Fatalf("total = %d, counts = %v, tunnels = %d", page.Total, page.StatusCounts, len(page.Tunnels))
+	}
+
+	// 其他过滤条件同样作用于各状态数量
+	page, err = s.ListTunnels(visibleScope, ListQuery{EndpointID: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = map[TunnelStatus]int{StatusRunning: 1, StatusError: 1}
+	if page.Total != 2 || !reflect.DeepEqual(page.StatusCounts, want) {
+		t.Fatalf("endpoint filter: total = %d, counts = %v", page.Total, page.StatusCounts)
+	}
+
+	all, err := s.ListTunnels(workspace.AllScope(), ListQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if all.Total != 6 || all.StatusCounts[StatusRunning] != 4 {
+		t.Fatalf("all scope: total = %d, counts = %v", all.Total, all.StatusCounts)
+	}
+}
+
+func TestListTunnelsPageSize(t *testing.T) {
+	s, _ := newListTestService(t)
+	cases := []struct{ requested, want int }{
+		{0, defaultListPageSize},
+		{-1, defaultListPageSize},
+		{20, 20},
+		{maxListPageSize, maxListPageSize},
+		{1000, maxListPageSize},
+	}
+	for _, c := range cases {
+		page, err := s.ListTunnels(visibleScope, ListQuery{PageSize: c.requested})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if page.PageSize != c.want {
+			t.Errorf("pageSize %d: got %d, want %d", c.requested, page.PageSize, c.want)
+		}
+	}
+}
+
+func TestListTunnelsRejectsInvalidQuery(t *testing.T) {
+	s, _ := newListTestService(t)
+	first, err := s.ListTunnels(visibleScope, ListQuery{PageSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name string
+		q    ListQuery
+	}{
+		{"sort field", ListQuery{Sort: "name"}},
+		{"sort order", ListQuery{Order: "up"}},
+		{"port range", ListQuery{PortFrom: 2000, PortTo: 1000}},
+		{"negative port", ListQuery{PortFrom: -1}},
+		{"garbage cursor", ListQuery{Cursor: "not-a-cursor"}},
+		{"cursor from another sort", ListQuery{Sort: "traffic", Cursor: first.NextCursor}},
+	}
+	for _, c := range cases {
+		_, err := s.ListTunnels(visibleScope, c.q)
+		var qerr *ListQueryError
+		if !errors.As(err, &qerr) {
+			t.Errorf("%s: err = %v, want ListQueryError", c.name, err)
+		}
+	}
+}
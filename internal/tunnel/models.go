@@ -66,6 +66,7 @@ type Tunnel struct {
 	Max           *int         `json:"max"`
 	Restart       bool         `json:"restart"`
 	Status        TunnelStatus `json:"status"`
+	Revision      int64        `json:"revision"` // 配置修订号，用于 ETag / If-Match 并发控制
 	CreatedAt     time.Time    `json:"createdAt"`
 	UpdatedAt     time.Time    `json:"updatedAt"`
 }
@@ -230,3 +231,32 @@ type TunnelResponse struct {
 	Tunnel    interface{} `json:"tunnel,omitempty"`
 	TunnelIDs []int64     `json:"tunnel_ids,omitempty"` // 创建的隧道ID列表
 }
+
+// ListQuery 隧道列表的过滤、排序与分页条件
+type ListQuery struct {
+	EndpointID int64
+	Statuses   []TunnelStatus
+	Mode       TunnelMode
+	TagID      *int64 // 0 表示未设置标签的隧道
+	GroupID    int64
+	Name       string // 名称子串，不区分大小写
+	PortFrom   int    // 隧道端口或目标端口落在 [PortFrom, PortTo] 内，0 表示不限
+	PortTo     int
+	Sort       string // createdAt（默认）、traffic、ping
+	Order      string // desc（默认）、asc
+	Page       int
+	PageSize   int
+	Cursor     string // 上一页返回的 nextCursor，指定时忽略 Page
+}
+
+// ListPage 隧道分页查询结果
+type ListPage struct {
+	Tunnels []TunnelWithStats `json:"tunnels"`
+	// Total 满足过滤条件的隧道总数
+	Total int `json:"total"`
+	// StatusCounts 忽略状态过滤时各状态的隧道数，便于展示状态筛选项
+	StatusCounts map[TunnelStatus]int `json:"statusCounts"`
+	Page         int                  `json:"page,omitempty"` // 游标分页时为空
+	PageSize     int                  `json:"pageSize"`
+	NextCursor   string               `json:"nextCursor,omitempty"` // 没有下一页时为空
+}
@@ -11,6 +11,8 @@ import (
 	"time"
 
 	"NodePassDash/internal/nodepass"
+	"NodePassDash/internal/secret"
+	"NodePassDash/internal/workspace"
 )
 
 // Service 隧道管理服务
@@ -211,26 +213,34 @@ func NewService(db *sql.DB) *Service {
 	return &Service{db: db}
 }
 
-// GetTunnels 获取所有隧道列表
-func (s *Service) GetTunnels() ([]TunnelWithStats, error) {
-	// log.Debugf("[API] 获取所有隧道列表")
-	query := `
-		SELECT 
+// tunnelListColumns 隧道列表查询的字段，与 scanTunnelWithStats 的扫描顺序一致
+const tunnelListColumns = `
 			t.id, t.instanceId, t.name, t.endpointId, t.mode,
 			t.tunnelAddress, t.tunnelPort, t.targetAddress, t.targetPort,
 			t.tlsMode, t.certPath, t.keyPath, t.logLevel, t.commandLine,
 			t.password, t.restart, t.status, t.min, t.max, t.tcpRx, t.tcpTx, t.udpRx, t.udpTx, t.pool, t.ping,
-			t.createdAt, t.updatedAt,
+			t.revision, t.createdAt, t.updatedAt,
 			e.name as endpointName,
-			tag.id as tagId, tag.name as tagName
+			tag.id as tagId, tag.name as tagName`
+
+// tunnelListJoins 隧道列表查询关联的主控及标签
+const tunnelListJoins = `
 		FROM "Tunnel" t
 		LEFT JOIN "Endpoint" e ON t.endpointId = e.id
 		LEFT JOIN TunnelTags tt ON t.id = tt.tunnel_id
-		LEFT JOIN Tags tag ON tt.tag_id = tag.id
+		LEFT JOIN Tags tag ON tt.tag_id = tag.id`
+
+// GetTunnels 获取可见工作区内的隧道列表
+func (s *Service) GetTunnels(scope workspace.Scope) ([]TunnelWithStats, error) {
+	// log.Debugf("[API] 获取所有隧道列表")
+	cond, args := scope.Where("e.workspaceId")
+	query := `
+		SELECT ` + tunnelListColumns + tunnelListJoins + `
+		WHERE ` + cond + `
 		ORDER BY t.createdAt DESC
 	`
 
-	rows, err := s.db.Query(query)
+	rows, err := s.db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -238,115 +248,188 @@ func (s *Service) GetTunnels() ([]TunnelWithStats, error) {
 
 	var tunnels []TunnelWithStats
 	for rows.Next() {
-		var t TunnelWithStats
-		var modeStr, statusStr, tlsModeStr, logLevelStr string
-		var instanceID sql.NullString
-		var certPathNS, keyPathNS, passwordNS sql.NullString
-		var endpointNameNS sql.NullString
-		var minNS, maxNS sql.NullInt64
-		var tagIDNS sql.NullInt64
-		var tagNameNS sql.NullString
-		var poolNS, pingNS sql.NullInt64
-		err := rows.Scan(
-			&t.ID, &instanceID, &t.Name, &t.EndpointID, &modeStr,
-			&t.TunnelAddress, &t.TunnelPort, &t.TargetAddress, &t.TargetPort,
-			&tlsModeStr, &certPathNS, &keyPathNS, &logLevelStr, &t.CommandLine,
-			&passwordNS, &t.Restart, &statusStr, &minNS, &maxNS, &t.Traffic.TCPRx, &t.Traffic.TCPTx, &t.Traffic.UDPRx, &t.Traffic.UDPTx, &poolNS, &pingNS,
-			&t.CreatedAt, &t.UpdatedAt,
-			&endpointNameNS,
-			&tagIDNS, &tagNameNS,
-		)
+		t, err := scanTunnelWithStats(rows)
 		if err != nil {
 			return nil, err
 		}
-		if instanceID.Valid {
-			t.InstanceID = instanceID.String
-		}
-		if certPathNS.Valid {
-			t.CertPath = certPathNS.String
-		}
-		if keyPathNS.Valid {
-			t.KeyPath = keyPathNS.String
-		}
-		if passwordNS.Valid {
-			t.Password = passwordNS.String
-		}
-		if endpointNameNS.Valid {
-			t.EndpointName = endpointNameNS.String
-		}
-		if minNS.Valid {
-			minVal := int(minNS.Int64)
-			t.Min = &minVal
-		}
-		if maxNS.Valid {
-			maxVal := int(maxNS.Int64)
-			t.Max = &maxVal
-		}
+		tunnels = append(tunnels, t)
+	}
 
-		// 处理pool和ping字段
-		if poolNS.Valid {
-			poolVal := poolNS.Int64
-			t.Traffic.Pool = &poolVal
-		}
-		if pingNS.Valid {
-			pingVal := pingNS.Int64
-			t.Traffic.Ping = &pingVal
+	return tunnels, nil
+}
+
+// TunnelVisible 判断隧道是否属于可见工作区（通过所属主控关联）；
+// 不受限的范围直接返回 true，隧道是否存在由调用方判断
+func (s *Service) TunnelVisible(id int64, scope workspace.Scope) bool {
+	if scope.All {
+		return true
+	}
+	var workspaceID int64
+	err := s.db.QueryRow(`
+		SELECT e.workspaceId FROM "Tunnel" t
+		JOIN "Endpoint" e ON t.endpointId = e.id
+		WHERE t.id = ?
+	`, id).Scan(&workspaceID)
+	return err == nil && scope.Allows(workspaceID)
+}
+
+// InstanceVisible 判断实例 ID 对应的隧道是否属于可见工作区，规则同 TunnelVisible
+func (s *Service) InstanceVisible(instanceID string, scope workspace.Scope) bool {
+	if scope.All {
+		return true
+	}
+	var workspaceID int64
+	err := s.db.QueryRow(`
+		SELECT e.workspaceId FROM "Tunnel" t
+		JOIN "Endpoint" e ON t.endpointId = e.id
+		WHERE t.instanceId = ?
+	`, instanceID).Scan(&workspaceID)
+	return err == nil && scope.Allows(workspaceID)
+}
+
+// EndpointVisible 判断主控是否属于可见工作区，用于创建隧道前校验目标主控，规则同 TunnelVisible
+func (s *Service) EndpointVisible(endpointID int64, scope workspace.Scope) bool {
+	if scope.All {
+		return true
+	}
+	var workspaceID int64
+	err := s.db.QueryRow(`SELECT workspaceId FROM "Endpoint" WHERE id = ?`, endpointID).Scan(&workspaceID)
+	return err == nil && scope.Allows(workspaceID)
+}
+
+// GetTunnelWithStats 根据ID获取单个隧道（字段与隧道列表一致）
+func (s *Service) GetTunnelWithStats(id int64) (*TunnelWithStats, error) {
+	rows, err := s.db.Query(`SELECT `+tunnelListColumns+tunnelListJoins+` WHERE t.id = ? LIMIT 1`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, err
 		}
+		return nil, errors.New("隧道不存在")
+	}
+	t, err := scanTunnelWithStats(rows)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
 
-		// 处理标签信息
-		if tagIDNS.Valid && tagNameNS.Valid {
-			t.Tag = &Tag{
-				ID:   tagIDNS.Int64,
-				Name: tagNameNS.String,
-			}
+// scanTunnelWithStats 扫描一行 tunnelListColumns，extra 为追加在其后的字段
+func scanTunnelWithStats(rows *sql.Rows, extra ...interface{}) (TunnelWithStats, error) {
+	var t TunnelWithStats
+	var modeStr, statusStr, tlsModeStr, logLevelStr string
+	var instanceID sql.NullString
+	var certPathNS, keyPathNS, passwordNS sql.NullString
+	var endpointNameNS sql.NullString
+	var minNS, maxNS sql.NullInt64
+	var tagIDNS sql.NullInt64
+	var tagNameNS sql.NullString
+	var poolNS, pingNS sql.NullInt64
+	dest := []interface{}{
+		&t.ID, &instanceID, &t.Name, &t.EndpointID, &modeStr,
+		&t.TunnelAddress, &t.TunnelPort, &t.TargetAddress, &t.TargetPort,
+		&tlsModeStr, &certPathNS, &keyPathNS, &logLevelStr, &t.CommandLine,
+		&passwordNS, &t.Restart, &statusStr, &minNS, &maxNS, &t.Traffic.TCPRx, &t.Traffic.TCPTx, &t.Traffic.UDPRx, &t.Traffic.UDPTx, &poolNS, &pingNS,
+		&t.Revision, &t.CreatedAt, &t.UpdatedAt,
+		&endpointNameNS,
+		&tagIDNS, &tagNameNS,
+	}
+	if err := rows.Scan(append(dest, extra...)...); err != nil {
+		return t, err
+	}
+	if instanceID.Valid {
+		t.InstanceID = instanceID.String
+	}
+	if certPathNS.Valid {
+		t.CertPath = certPathNS.String
+	}
+	if keyPathNS.Valid {
+		t.KeyPath = keyPathNS.String
+	}
+	if passwordNS.Valid {
+		password, err := secret.Reveal(passwordNS.String)
+		if err != nil {
+			return t, err
 		}
+		t.Password = password
+	}
+	if endpointNameNS.Valid {
+		t.EndpointName = endpointNameNS.String
+	}
+	if minNS.Valid {
+		minVal := int(minNS.Int64)
+		t.Min = &minVal
+	}
+	if maxNS.Valid {
+		maxVal := int(maxNS.Int64)
+		t.Max = &maxVal
+	}
 
-		t.Mode = TunnelMode(modeStr)
-		t.Status = TunnelStatus(statusStr)
-		t.TLSMode = TLSMode(tlsModeStr)
-		t.LogLevel = LogLevel(logLevelStr)
+	// 处理pool和ping字段
+	if poolNS.Valid {
+		poolVal := poolNS.Int64
+		t.Traffic.Pool = &poolVal
+	}
+	if pingNS.Valid {
+		pingVal := pingNS.Int64
+		t.Traffic.Ping = &pingVal
+	}
 
-		// 计算总流量
-		t.Traffic.Total = t.Traffic.TCPRx + t.Traffic.TCPTx + t.Traffic.UDPRx + t.Traffic.UDPTx
+	// 处理标签信息
+	if tagIDNS.Valid && tagNameNS.Valid {
+		t.Tag = &Tag{
+			ID:   tagIDNS.Int64,
+			Name: tagNameNS.String,
+		}
+	}
 
-		// 格式化流量数据
-		t.Traffic.Formatted.TCPRx = formatTrafficBytes(t.Traffic.TCPRx)
-		t.Traffic.Formatted.TCPTx = formatTrafficBytes(t.Traffic.TCPTx)
-		t.Traffic.Formatted.UDPRx = formatTrafficBytes(t.Traffic.UDPRx)
-		t.Traffic.Formatted.UDPTx = formatTrafficBytes(t.Traffic.UDPTx)
-		t.Traffic.Formatted.Total = formatTrafficBytes(t.Traffic.Total)
+	t.Mode = TunnelMode(modeStr)
+	t.Status = TunnelStatus(statusStr)
+	t.TLSMode = TLSMode(tlsModeStr)
+	t.LogLevel = LogLevel(logLevelStr)
 
-		// 设置类型和头像
-		t.Type = string(t.Mode)
-		if t.Type == "server" {
-			t.Type = "服务端"
-		} else {
-			t.Type = "客户端"
-		}
-		if len(t.EndpointName) > 0 {
-			t.Avatar = string([]rune(t.EndpointName)[0])
-		}
-
-		// 设置状态信息
-		switch t.Status {
-		case StatusRunning:
-			t.StatusInfo.Type = "success"
-			t.StatusInfo.Text = "运行中"
-		case StatusError:
-			t.StatusInfo.Type = "warning"
-			t.StatusInfo.Text = "错误"
-		case StatusOffline:
-			t.StatusInfo.Type = "default"
-			t.StatusInfo.Text = "离线"
-		default:
-			t.StatusInfo.Type = "danger"
-			t.StatusInfo.Text = "已停止"
-		}
+	// 计算总流量
+	t.Traffic.Total = t.Traffic.TCPRx + t.Traffic.TCPTx + t.Traffic.UDPRx + t.Traffic.UDPTx
 
-		tunnels = append(tunnels, t)
+	// 格式化流量数据
+	t.Traffic.Formatted.TCPRx = formatTrafficBytes(t.Traffic.TCPRx)
+	t.Traffic.Formatted.TCPTx = formatTrafficBytes(t.Traffic.TCPTx)
+	t.Traffic.Formatted.UDPRx = formatTrafficBytes(t.Traffic.UDPRx)
+	t.Traffic.Formatted.UDPTx = formatTrafficBytes(t.Traffic.UDPTx)
+	t.Traffic.Formatted.Total = formatTrafficBytes(t.Traffic.Total)
+
+	// 设置类型和头像
+	t.Type = string(t.Mode)
+	if t.Type == "server" {
+		t.Type = "服务端"
+	} else {
+		t.Type = "客户端"
+	}
+	if len(t.EndpointName) > 0 {
+		t.Avatar = string([]rune(t.EndpointName)[0])
+	}
+
+	// 设置状态信息
+	switch t.Status {
+	case StatusRunning:
+		t.StatusInfo.Type = "success"
+		t.StatusInfo.Text = "运行中"
+	case StatusError:
+		t.StatusInfo.Type = "warning"
+		t.StatusInfo.Text = "错误"
+	case StatusOffline:
+		t.StatusInfo.Type = "default"
+		t.StatusInfo.Text = "离线"
+	default:
+		t.StatusInfo.Type = "danger"
+		t.StatusInfo.Text = "已停止"
 	}
 
-	return tunnels, nil
+	return t, nil
 }
 
 // CreateTunnel 创建新隧道
@@ -364,6 +447,14 @@ func (s *Service) CreateTunnel(req CreateTunnelRequest) (*Tunnel, error) {
 		}
 		return nil, err
 	}
+	if endpointAPIKey, err = secret.Reveal(endpointAPIKey); err != nil {
+		return nil, err
+	}
+	// 密码加密失败时在创建远端实例前拒绝，避免以明文写入数据库
+	storedPassword, err := secret.Protect(req.Password)
+	if err != nil {
+		return nil, err
+	}
 
 	// 移除隧道名称唯一性检查 - 允许重复名称
 
@@ -388,7 +479,7 @@ func (s *Service) CreateTunnel(req CreateTunnelRequest) (*Tunnel, error) {
 		)
 	}
 
-	log.Infof("[API] 构建的命令行: %s", commandLine)
+	log.Infof("[API] 构建的命令行: %s", secret.MaskURL(commandLine))
 
 	// 添加查询参数
 	var queryParams []string
@@ -435,7 +526,7 @@ func (s *Service) CreateTunnel(req CreateTunnelRequest) (*Tunnel, error) {
 	instanceID, remoteStatus, err := npClient.CreateInstance(commandLine)
 	if err != nil {
 		// 记录 NodePass API 错误，包含关键上下文信息
-		log.Errorf("[NodePass] 创建实例失败 endpoint=%d cmd=%s err=%v", req.EndpointID, commandLine, err)
+		log.Errorf("[NodePass] 创建实例失败 endpoint=%d cmd=%s err=%v", req.EndpointID, secret.MaskURL(commandLine), err)
 		return nil, err
 	}
 
@@ -470,8 +561,8 @@ func (s *Service) CreateTunnel(req CreateTunnelRequest) (*Tunnel, error) {
 			req.CertPath,
 			req.KeyPath,
 			req.LogLevel,
-			commandLine,
-			req.Password,
+			secret.MaskURL(commandLine), // 密码已单独加密存储，命令行中不保留
+			storedPassword,
 			func() interface{} {
 				if req.Min != nil {
 					return req.Min
@@ -533,6 +624,7 @@ func (s *Service) CreateTunnel(req CreateTunnelRequest) (*Tunnel, error) {
 		EndpointID:    req.EndpointID,
 		Mode:          TunnelMode(req.Mode),
 		Status:        TunnelStatus(remoteStatus),
+		Revision:      1,
 		TunnelAddress: req.TunnelAddress,
 		TunnelPort:    req.TunnelPort,
 		TargetAddress: req.TargetAddress,
@@ -541,7 +633,7 @@ func (s *Service) CreateTunnel(req CreateTunnelRequest) (*Tunnel, error) {
 		CertPath:      req.CertPath,
 		KeyPath:       req.KeyPath,
 		LogLevel:      req.LogLevel,
-		CommandLine:   commandLine,
+		CommandLine:   secret.MaskURL(commandLine),
 		Password:      req.Password,
 		Min: func() *int {
 			if req.Min != nil {
@@ -609,6 +701,9 @@ func (s *Service) DeleteTunnel(instanceID string) error {
 	if err != nil {
 		return err
 	}
+	if endpoint.APIKey, err = secret.Reveal(endpoint.APIKey); err != nil {
+		return err
+	}
 
 	// 调用 NodePass API 删除隧道实例
 	npClient := nodepass.NewClient(endpoint.URL, endpoint.APIPath, endpoint.APIKey, nil)
@@ -712,6 +807,9 @@ func (s *Service) ControlTunnel(req TunnelActionRequest) error {
 		}
 		return err
 	}
+	if endpoint.APIKey, err = secret.Reveal(endpoint.APIKey); err != nil {
+		return err
+	}
 
 	// 调用 NodePass API
 	npClient := nodepass.NewClient(endpoint.URL, endpoint.APIPath, endpoint.APIKey, nil)
@@ -884,6 +982,9 @@ func (s *Service) UpdateTunnel(req UpdateTunnelRequest) error {
 		}
 		return err
 	}
+	if endpointAPIKey, err = secret.Reveal(endpointAPIKey); err != nil {
+		return err
+	}
 
 	// 更新隧道信息
 	if req.Name != "" {
@@ -1003,12 +1104,22 @@ func (s *Service) UpdateTunnel(req UpdateTunnelRequest) error {
 	return nil
 }
 
-// GetOperationLogs 获取最近 limit 条隧道操作日志
-func (s *Service) GetOperationLogs(limit int) ([]OperationLog, error) {
+// operationLogWhere 返回按工作区过滤操作日志的 SQL 条件；受限范围内仅包含可见主控下现存隧道的日志
+func operationLogWhere(scope workspace.Scope) (string, []interface{}) {
+	if scope.All {
+		return "1 = 1", nil
+	}
+	cond, args := scope.EndpointWhere("endpointId")
+	return `tunnelId IN (SELECT id FROM "Tunnel" WHERE ` + cond + `)`, args
+}
+
+// GetOperationLogs 获取可见工作区内最近 limit 条隧道操作日志
+func (s *Service) GetOperationLogs(limit int, scope workspace.Scope) ([]OperationLog, error) {
 	if limit <= 0 {
 		limit = 50
 	}
-	rows, err := s.db.Query(`SELECT id, tunnelId, tunnelName, action, status, message, createdAt FROM "TunnelOperationLog" ORDER BY createdAt DESC LIMIT ?`, limit)
+	cond, args := operationLogWhere(scope)
+	rows, err := s.db.Query(`SELECT id, tunnelId, tunnelName, action, status, message, createdAt FROM "TunnelOperationLog" WHERE `+cond+` ORDER BY createdAt DESC LIMIT ?`, append(args, limit)...)
 	if err != nil {
 		return nil, err
 	}
@@ -1084,6 +1195,9 @@ func (s *Service) DeleteTunnelAndWait(instanceID string, timeout time.Duration,
 		Scan(&endpoint.URL, &endpoint.APIPath, &endpoint.APIKey); err != nil {
 		return err
 	}
+	if endpoint.APIKey, err = secret.Reveal(endpoint.APIKey); err != nil {
+		return err
+	}
 
 	// 在删除之前，如选择移入回收站，则先复制记录
 	if recycle {
@@ -1173,6 +1287,14 @@ func (s *Service) CreateTunnelAndWait(req CreateTunnelRequest, timeout time.Dura
 		}
 		return nil, err
 	}
+	if endpointAPIKey, err = secret.Reveal(endpointAPIKey); err != nil {
+		return nil, err
+	}
+	// 密码加密失败时在创建远端实例前拒绝，避免以明文写入数据库
+	storedPassword, err := secret.Protect(req.Password)
+	if err != nil {
+		return nil, err
+	}
 
 	// 构建命令行（复用原有逻辑）
 	var commandLine string
@@ -1231,13 +1353,13 @@ func (s *Service) CreateTunnelAndWait(req CreateTunnelRequest, timeout time.Dura
 		commandLine += "?" + strings.Join(queryParams, "&")
 	}
 
-	log.Infof("[API] 构建的命令行: %s", commandLine)
+	log.Infof("[API] 构建的命令行: %s", secret.MaskURL(commandLine))
 
 	// 1. 使用 NodePass 客户端创建实例
 	npClient := nodepass.NewClient(endpointURL, endpointAPIPath, endpointAPIKey, nil)
 	instanceID, remoteStatus, err := npClient.CreateInstance(commandLine)
 	if err != nil {
-		log.Errorf("[NodePass] 创建实例失败 endpoint=%d cmd=%s err=%v", req.EndpointID, commandLine, err)
+		log.Errorf("[NodePass] 创建实例失败 endpoint=%d cmd=%s err=%v", req.EndpointID, secret.MaskURL(commandLine), err)
 		return nil, err
 	}
 
@@ -1301,6 +1423,7 @@ func (s *Service) CreateTunnelAndWait(req CreateTunnelRequest, timeout time.Dura
 			EndpointID:    req.EndpointID,
 			Mode:          TunnelMode(req.Mode),
 			Status:        TunnelStatus(remoteStatus),
+			Revision:      1,
 			TunnelAddress: req.TunnelAddress,
 			TunnelPort:    req.TunnelPort,
 			TargetAddress: req.TargetAddress,
@@ -1309,7 +1432,7 @@ func (s *Service) CreateTunnelAndWait(req CreateTunnelRequest, timeout time.Dura
 			CertPath:      req.CertPath,
 			KeyPath:       req.KeyPath,
 			LogLevel:      req.LogLevel,
-			CommandLine:   commandLine,
+			CommandLine:   secret.MaskURL(commandLine),
 			Password:      req.Password,
 			Min: func() *int {
 				if req.Min != nil {
@@ -1355,8 +1478,8 @@ func (s *Service) CreateTunnelAndWait(req CreateTunnelRequest, timeout time.Dura
 		`,
 			instanceID, req.Name, req.EndpointID, req.Mode,
 			req.TunnelAddress, req.TunnelPort, req.TargetAddress, req.TargetPort,
-			req.TLSMode, req.CertPath, req.KeyPath, req.LogLevel, commandLine,
-			req.Password,
+			req.TLSMode, req.CertPath, req.KeyPath, req.LogLevel, secret.MaskURL(commandLine),
+			storedPassword,
 			func() interface{} {
 				if req.Min != nil {
 					return req.Min
@@ -1418,6 +1541,7 @@ func (s *Service) CreateTunnelAndWait(req CreateTunnelRequest, timeout time.Dura
 		EndpointID:    req.EndpointID,
 		Mode:          TunnelMode(req.Mode),
 		Status:        TunnelStatus(remoteStatus),
+		Revision:      1,
 		TunnelAddress: req.TunnelAddress,
 		TunnelPort:    req.TunnelPort,
 		TargetAddress: req.TargetAddress,
@@ -1426,7 +1550,7 @@ func (s *Service) CreateTunnelAndWait(req CreateTunnelRequest, timeout time.Dura
 		CertPath:      req.CertPath,
 		KeyPath:       req.KeyPath,
 		LogLevel:      req.LogLevel,
-		CommandLine:   commandLine,
+		CommandLine:   secret.MaskURL(commandLine),
 		Password:      req.Password,
 		Min: func() *int {
 			if req.Min != nil {
@@ -1476,6 +1600,9 @@ func (s *Service) PatchTunnel(id int64, updates map[string]interface{}) error {
 		}
 		return err
 	}
+	if endpoint.APIKey, err = secret.Reveal(endpoint.APIKey); err != nil {
+		return err
+	}
 
 	// 准备本地数据库更新和远程API更新
 	localUpdates := make(map[string]interface{})
@@ -1569,6 +1696,9 @@ func (s *Service) SetTunnelAlias(tunnelID int64, alias string) error {
 		}
 		return err
 	}
+	if endpoint.APIKey, err = secret.Reveal(endpoint.APIKey); err != nil {
+		return err
+	}
 
 	// 调用 NodePass API 设置别名
 	npClient := nodepass.NewClient(endpoint.URL, endpoint.APIPath, endpoint.APIKey, nil)
@@ -1616,6 +1746,9 @@ func (s *Service) RenameTunnel(id int64, newName string) error {
 		}
 		return err
 	}
+	if endpoint.APIKey, err = secret.Reveal(endpoint.APIKey); err != nil {
+		return err
+	}
 
 	// 首先调用 NodePass API 尝试重命名远程实例
 	npClient := nodepass.NewClient(endpoint.URL, endpoint.APIPath, endpoint.APIKey, nil)
@@ -1793,6 +1926,9 @@ func (s *Service) BatchCreateTunnels(req BatchCreateTunnelRequest) (*BatchCreate
 				log.Errorf("[API] 批量创建: 查询端点 %d 失败: %v", item.EndpointID, err)
 				continue
 			}
+			if apiKey, err = secret.Reveal(apiKey); err != nil {
+				continue
+			}
 			endpointMap[item.EndpointID] = struct {
 				URL     string
 				APIPath string
@@ -2038,6 +2174,9 @@ func (s *Service) NewBatchCreateTunnels(req NewBatchCreateRequest) (*NewBatchCre
 				log.Errorf("[API] 新批量创建: 查询端点 %d 失败: %v", item.EndpointID, err)
 				continue
 			}
+			if apiKey, err = secret.Reveal(apiKey); err != nil {
+				continue
+			}
 			endpointMap[item.EndpointID] = struct {
 				URL     string
 				APIPath string
@@ -2198,6 +2337,9 @@ func (s *Service) SetTunnelRestart(tunnelID int64, restart bool) error {
 		}
 		return err
 	}
+	if endpoint.APIKey, err = secret.Reveal(endpoint.APIKey); err != nil {
+		return err
+	}
 
 	// 先调用 NodePass API 设置重启策略
 	npClient := nodepass.NewClient(endpoint.URL, endpoint.APIPath, endpoint.APIKey, nil)
@@ -2227,10 +2369,11 @@ func (s *Service) SetTunnelRestart(tunnelID int64, restart bool) error {
 	return nil
 }
 
-// ClearOperationLogs 删除所有隧道操作日志，返回删除的行数
-func (s *Service) ClearOperationLogs() (int64, error) {
+// ClearOperationLogs 删除可见工作区内的隧道操作日志，返回删除的行数
+func (s *Service) ClearOperationLogs(scope workspace.Scope) (int64, error) {
 	// 执行删除操作
-	result, err := s.db.Exec(`DELETE FROM "TunnelOperationLog"`)
+	cond, args := operationLogWhere(scope)
+	result, err := s.db.Exec(`DELETE FROM "TunnelOperationLog" WHERE `+cond, args...)
 	if err != nil {
 		return 0, err
 	}
@@ -2338,6 +2481,9 @@ func (s *Service) ResetTunnelTrafficByInstanceID(instanceID string) error {
 		}
 		return fmt.Errorf("查询隧道失败: %v", err)
 	}
+	if endpoint.APIKey, err = secret.Reveal(endpoint.APIKey); err != nil {
+		return err
+	}
 
 	// 先调用 NodePass API 重置流量统计
 	npClient := nodepass.NewClient(endpoint.URL, endpoint.APIPath, endpoint.APIKey, nil)
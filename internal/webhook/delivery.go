@@ -0,0 +1,554 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	log "NodePassDash/internal/log"
+	"NodePassDash/internal/models"
+	"NodePassDash/internal/secret"
+)
+
+const (
+	// maxAttempts 单次投递的最大尝试次数，用尽后标记为失败
+	maxAttempts = 8
+	// retryBaseDelay 首次重试的等待时间，之后每次翻倍
+	retryBaseDelay = 30 * time.Second
+	// retryMaxDelay 重试等待时间上限
+	retryMaxDelay = time.Hour
+	// requestTimeout 单次请求超时时间
+	requestTimeout = 10 * time.Second
+	// pollInterval 检查到期重试的间隔
+	pollInterval = 5 * time.Second
+	// deliveryConcurrency 同时进行的投递数量
+	deliveryConcurrency = 4
+	// deliveryBatchSize 每轮取出的待投递记录数
+	deliveryBatchSize = 20
+	// deliveryRetention 已完成投递记录的保留时间
+	deliveryRetention = 7 * 24 * time.Hour
+	// maxResponseBody 记录的响应体最大长度
+	maxResponseBody = 2048
+)
+
+// ErrDeliveryNotFound 投递记录不存在
+var ErrDeliveryNotFound = errors.New("投递记录不存在")
+
+// 请求头：订阅方使用 Signature 校验请求来自本面板，Delivery 可用于去重
+const (
+	headerEvent     = "X-NodePassDash-Event"
+	headerDelivery  = "X-NodePassDash-Delivery"
+	headerTimestamp = "X-NodePassDash-Timestamp"
+	headerSignature = "X-NodePassDash-Signature"
+)
+
+// Start 加载订阅并启动事件分发及投递协程
+func (s *Service) Start() error {
+	if err := s.reload(); err != nil {
+		return err
+	}
+	s.wg.Add(2)
+	go s.dispatchLoop()
+	go s.deliveryLoop()
+	return nil
+}
+
+// Close 停止后台协程，未完成的投递保留在队列中，下次启动后继续
+func (s *Service) Close() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+// Dispatch 接收主控事件，有订阅时异步写入投递队列；不阻塞 SSE 处理
+func (s *Service) Dispatch(event models.EndpointSSE) {
+	if !s.subscribed(string(event.EventType)) {
+		return
+	}
+	select {
+	case s.events <- event:
+	default:
+		log.Warnf("[Webhook] 事件分发队列已满，丢弃 %s 事件", event.EventType)
+	}
+}
+
+// subscribed 判断是否有启用的 Webhook 订阅了该事件类型
+func (s *Service) subscribed(eventType string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, h := range s.hooks {
+		if h.Enabled && containsString(h.EventTypes, eventType) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Service) dispatchLoop() {
+	defer s.wg.Done()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case event := <-s.events:
+			if err := s.enqueue(event); err != nil {
+				log.Errorf("[Webhook] 写入投递队列失败: %v", err)
+			}
+		}
+	}
+}
+
+// enqueue 为匹配的 Webhook 各生成一条待投递记录
+func (s *Service) enqueue(event models.EndpointSSE) error {
+	eventType := string(event.EventType)
+	var matched []*Webhook
+	needTags := false
+	s.mu.RLock()
+	for _, h := range s.hooks {
+		if !h.Enabled || !containsString(h.EventTypes, eventType) {
+			continue
+		}
+		if len(h.EndpointIDs) > 0 && !containsInt64(h.EndpointIDs, event.EndpointID) {
+			continue
+		}
+		matched = append(matched, h)
+		needTags = needTags || len(h.TagIDs) > 0
+	}
+	s.mu.RUnlock()
+	if len(matched) == 0 {
+		return nil
+	}
+
+	payload := Payload{
+		EventID:    newEventID(),
+		Event:      eventType,
+		OccurredAt: event.EventTime,
+		Endpoint:   s.endpointRef(event.EndpointID),
+	}
+	if payload.OccurredAt.IsZero() {
+		payload.OccurredAt = time.Now()
+	}
+	if event.InstanceID != "" {
+		payload.Tunnel = s.tunnelRef(event.EndpointID, event.InstanceID)
+	}
+	var tags []int64
+	if needTags && payload.Tunnel != nil && payload.Tunnel.ID > 0 {
+		tags = s.tunnelTags(payload.Tunnel.ID)
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	payload.Data = data
+	body, err := encodePayload(payload)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	queued := 0
+	for _, h := range matched {
+		if len(h.TagIDs) > 0 && !intersects(h.TagIDs, tags) {
+			continue
+		}
+		if _, err := s.db.Exec(`
+			INSERT INTO "WebhookDelivery" (webhookId, eventId, eventType, payload, status, nextAttemptAt, createdAt)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			h.ID, payload.EventID, eventType, string(body), DeliveryPending, now, now); err != nil {
+			return err
+		}
+		queued++
+	}
+	if queued > 0 {
+		s.notify()
+	}
+	return nil
+}
+
+// notify 唤醒投递协程
+func (s *Service) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Service) deliveryLoop() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	lastCleanup := time.Time{}
+	for {
+		s.deliverDue()
+		if time.Since(lastCleanup) > time.Hour {
+			s.cleanup()
+			lastCleanup = time.Now()
+		}
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.wake:
+		}
+	}
+}
+
+// deliverDue 投递到期的记录，直到队列中没有到期记录
+func (s *Service) deliverDue() {
+	for s.ctx.Err() == nil {
+		due, err := s.dueDeliveries()
+		if err != nil {
+			log.Errorf("[Webhook] 读取投递队列失败: %v", err)
+			return
+		}
+		if len(due) == 0 {
+			return
+		}
+
+		sem := make(chan struct{}, deliveryConcurrency)
+		var wg sync.WaitGroup
+		for _, d := range due {
+			d := d
+			sem <- struct{}{}
+			wg.Add(1)
+			go func() {
+				defer func() {
+					<-sem
+					wg.Done()
+				}()
+				s.attempt(d, true)
+			}()
+		}
+		wg.Wait()
+	}
+}
+
+// dueDeliveries 取出到期的待投递记录
+func (s *Service) dueDeliveries() ([]Delivery, error) {
+	rows, err := s.db.Query(`
+		SELECT id, webhookId, eventId, eventType, payload, attempts
+		FROM "WebhookDelivery"
+		WHERE status = ? AND nextAttemptAt <= ?
+		ORDER BY nextAttemptAt, id
+		LIMIT ?`, DeliveryPending, time.Now().UTC(), deliveryBatchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var due []Delivery
+	for rows.Next() {
+		var d Delivery
+		var payload string
+		if err := rows.Scan(&d.ID, &d.WebhookID, &d.EventID, &d.EventType, &payload, &d.Attempts); err != nil {
+			return nil, err
+		}
+		d.Payload = json.RawMessage(payload)
+		due = append(due, d)
+	}
+	return due, rows.Err()
+}
+
+// attempt 投递一次并记录结果；retry 为 false 时失败后不再重试（测试投递）
+func (s *Service) attempt(d Delivery, retry bool) {
+	h, ok := s.cached(d.WebhookID)
+	if !ok {
+		// Webhook 已删除，投递记录随之级联删除
+		return
+	}
+
+	now := time.Now().UTC()
+	attempts := d.Attempts + 1
+	var status int
+	var respBody, errMsg string
+	start := time.Now()
+	if !h.Enabled && d.EventType != EventPing {
+		errMsg = "Webhook 已停用"
+	} else {
+		status, respBody, errMsg = s.send(h, d)
+	}
+	duration := time.Since(start).Milliseconds()
+
+	if errMsg == "" {
+		_, err := s.db.Exec(`
+			UPDATE "WebhookDelivery" SET status = ?, attempts = ?, nextAttemptAt = NULL, responseStatus = ?,
+				responseBody = ?, error = '', durationMs = ?, deliveredAt = ?
+			WHERE id = ?`, DeliverySuccess, attempts, status, respBody, duration, now, d.ID)
+		if err != nil {
+			log.Errorf("[Webhook] 更新投递记录失败: %v", err)
+		}
+		return
+	}
+
+	next := sql.NullTime{}
+	result := DeliveryFailed
+	if retry && h.Enabled && attempts < maxAttempts {
+		next = sql.NullTime{Time: now.Add(retryDelay(attempts)), Valid: true}
+		result = DeliveryPending
+	}
+	_, err := s.db.Exec(`
+		UPDATE "WebhookDelivery" SET status = ?, attempts = ?, nextAttemptAt = ?, responseStatus = ?,
+			responseBody = ?, error = ?, durationMs = ?
+		WHERE id = ?`, result, attempts, next, status, respBody, errMsg, duration, d.ID)
+	if err != nil {
+		log.Errorf("[Webhook] 更新投递记录失败: %v", err)
+	}
+	if result == DeliveryFailed {
+		log.Warnf("[Webhook] %s 投递失败（已尝试 %d 次）: %s", h.Name, attempts, errMsg)
+	}
+}
+
+// send 发送签名请求，返回状态码、截断的响应体及错误信息（成功时为空）
+func (s *Service) send(h *Webhook, d Delivery) (int, string, string) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req, err := http.NewRequestWithContext(s.ctx, http.MethodPost, h.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return 0, "", err.Error()
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "NodePassDash-Webhook")
+	req.Header.Set(headerEvent, d.EventType)
+	req.Header.Set(headerDelivery, strconv.FormatInt(d.ID, 10))
+	req.Header.Set(headerTimestamp, timestamp)
+	req.Header.Set(headerSignature, "sha256="+Sign(h.secret, timestamp, d.Payload))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, "", err.Error()
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, string(body), fmt.Sprintf("订阅方返回 HTTP %d", resp.StatusCode)
+	}
+	return resp.StatusCode, string(body), ""
+}
+
+// Sign 计算签名：以签名密钥对 "时间戳.请求体" 做 HMAC-SHA256，结果为十六进制
+func Sign(key, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// retryDelay 第 attempts 次失败后的等待时间：30 秒起每次翻倍，最长 1 小时
+func retryDelay(attempts int) time.Duration {
+	d := retryBaseDelay
+	for i := 1; i < attempts && d < retryMaxDelay; i++ {
+		d *= 2
+	}
+	if d > retryMaxDelay {
+		d = retryMaxDelay
+	}
+	return d
+}
+
+// SendTest 立即向 Webhook 投递一条 ping 事件并返回结果，失败时不重试；停用的 Webhook 同样可以测试
+func (s *Service) SendTest(id int64) (*Delivery, error) {
+	if _, ok := s.cached(id); !ok {
+		return nil, ErrNotFound
+	}
+	data, _ := json.Marshal(map[string]string{"message": "NodePassDash Webhook 测试"})
+	eventID := newEventID()
+	body, err := encodePayload(Payload{
+		EventID:    eventID,
+		Event:      EventPing,
+		OccurredAt: time.Now(),
+		Data:       data,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// nextAttemptAt 为空，不会被投递协程取出
+	res, err := s.db.Exec(`
+		INSERT INTO "WebhookDelivery" (webhookId, eventId, eventType, payload, status, createdAt)
+		VALUES (?, ?, ?, ?, ?, ?)`, id, eventID, EventPing, string(body), DeliveryPending, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	deliveryID, _ := res.LastInsertId()
+	s.attempt(Delivery{ID: deliveryID, WebhookID: id, EventID: eventID, EventType: EventPing, Payload: body}, false)
+	return s.GetDelivery(id, deliveryID)
+}
+
+// Redeliver 立即重新投递：已完成的记录重新放入队列，等待重试的记录提前到现在，尝试次数重新计算
+func (s *Service) Redeliver(webhookID, deliveryID int64) (*Delivery, error) {
+	res, err := s.db.Exec(`
+		UPDATE "WebhookDelivery" SET status = ?, attempts = 0, nextAttemptAt = ?, error = ''
+		WHERE id = ? AND webhookId = ?`,
+		DeliveryPending, time.Now().UTC(), deliveryID, webhookID)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, ErrDeliveryNotFound
+	}
+	s.notify()
+	return s.GetDelivery(webhookID, deliveryID)
+}
+
+const deliveryColumns = `id, webhookId, eventId, eventType, payload, status, attempts, nextAttemptAt,
+	responseStatus, responseBody, error, durationMs, createdAt, deliveredAt`
+
+// GetDelivery 获取单条投递记录
+func (s *Service) GetDelivery(webhookID, deliveryID int64) (*Delivery, error) {
+	row := s.db.QueryRow(`SELECT `+deliveryColumns+` FROM "WebhookDelivery" WHERE id = ? AND webhookId = ?`, deliveryID, webhookID)
+	d, err := scanDelivery(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrDeliveryNotFound
+	}
+	return d, err
+}
+
+// ListDeliveries 按时间倒序分页查询投递记录
+func (s *Service) ListDeliveries(q DeliveryQuery) (*DeliveryPage, error) {
+	if q.Page < 1 {
+		q.Page = 1
+	}
+	if q.PageSize < 1 || q.PageSize > 200 {
+		q.PageSize = 50
+	}
+	where, args := `webhookId = ?`, []interface{}{q.WebhookID}
+	if q.Status != "" {
+		where += ` AND status = ?`
+		args = append(args, q.Status)
+	}
+
+	page := &DeliveryPage{Deliveries: []Delivery{}, Page: q.Page, PageSize: q.PageSize}
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM "WebhookDelivery" WHERE `+where, args...).Scan(&page.Total); err != nil {
+		return nil, err
+	}
+	rows, err := s.db.Query(`SELECT `+deliveryColumns+` FROM "WebhookDelivery" WHERE `+where+` ORDER BY id DESC LIMIT ? OFFSET ?`,
+		append(args, q.PageSize, (q.Page-1)*q.PageSize)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		page.Deliveries = append(page.Deliveries, *d)
+	}
+	return page, rows.Err()
+}
+
+// cleanup 删除超过保留时间的已完成投递记录
+func (s *Service) cleanup() {
+	res, err := s.db.Exec(`DELETE FROM "WebhookDelivery" WHERE status != ? AND createdAt < ?`,
+		DeliveryPending, time.Now().UTC().Add(-deliveryRetention))
+	if err != nil {
+		log.Errorf("[Webhook] 清理投递记录失败: %v", err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		log.Infof("[Webhook] 已清理 %d 条过期投递记录", n)
+	}
+}
+
+func scanDelivery(row rowScanner) (*Delivery, error) {
+	var d Delivery
+	var payload string
+	var next, delivered sql.NullTime
+	if err := row.Scan(&d.ID, &d.WebhookID, &d.EventID, &d.EventType, &payload, &d.Status, &d.Attempts, &next,
+		&d.ResponseStatus, &d.ResponseBody, &d.Error, &d.DurationMs, &d.CreatedAt, &delivered); err != nil {
+		return nil, err
+	}
+	d.Payload = json.RawMessage(payload)
+	if next.Valid {
+		d.NextAttemptAt = &next.Time
+	}
+	if delivered.Valid {
+		d.DeliveredAt = &delivered.Time
+	}
+	return &d, nil
+}
+
+// endpointRef 查询事件所属主控的名称
+func (s *Service) endpointRef(endpointID int64) *EndpointRef {
+	ref := &EndpointRef{ID: endpointID}
+	_ = s.db.QueryRow(`SELECT name FROM "Endpoint" WHERE id = ?`, endpointID).Scan(&ref.Name)
+	return ref
+}
+
+// tunnelRef 查询实例对应的隧道
+func (s *Service) tunnelRef(endpointID int64, instanceID string) *TunnelRef {
+	ref := &TunnelRef{InstanceID: instanceID}
+	_ = s.db.QueryRow(`SELECT id, name FROM "Tunnel" WHERE endpointId = ? AND instanceId = ?`, endpointID, instanceID).
+		Scan(&ref.ID, &ref.Name)
+	return ref
+}
+
+// tunnelTags 查询隧道的标签
+func (s *Service) tunnelTags(tunnelID int64) []int64 {
+	rows, err := s.db.Query(`SELECT tag_id FROM TunnelTags WHERE tunnel_id = ?`, tunnelID)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+	var tags []int64
+	for rows.Next() {
+		var id int64
+		if rows.Scan(&id) == nil {
+			tags = append(tags, id)
+		}
+	}
+	return tags
+}
+
+// encodePayload 序列化事件内容，隧道密码等敏感信息与 API 响应一样脱敏
+func encodePayload(p Payload) ([]byte, error) {
+	body, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+	return secret.RedactJSON(body), nil
+}
+
+// newEventID 生成事件 ID，同一事件投递给多个 Webhook 时相同
+func newEventID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func containsString(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+func containsInt64(list []int64, v int64) bool {
+	for _, n := range list {
+		if n == v {
+			return true
+		}
+	}
+	return false
+}
+
+func intersects(a, b []int64) bool {
+	for _, v := range a {
+		if containsInt64(b, v) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,93 @@
+package webhook
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"NodePassDash/internal/db/dbtest"
+)
+
+func TestSign(t *testing.T) {
+	body := []byte(`{"event":"ping"}`)
+	// 订阅方以 HMAC-SHA256(key, "时间戳.请求体") 校验，结果须与标准实现一致
+	const want = "aa8efe37b751e71157c508c5ac4acb1e9fe5225db98355dfc00f4b680afbc447"
+	if got := Sign("whsec_test", "1700000000", body); got != want {
+		t.Fatalf("Sign = %s, want %s", got, want)
+	}
+
+	// 密钥、时间戳或请求体任一不同签名都不同
+	for name, got := range map[string]string{
+		"key":       Sign("whsec_other", "1700000000", body),
+		"timestamp": Sign("whsec_test", "1700000001", body),
+		"body":      Sign("whsec_test", "1700000000", []byte(`{"event":"pong"}`)),
+	} {
+		if got == want {
+			t.Errorf("signature unchanged when %s differs", name)
+		}
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	cases := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, retryBaseDelay},
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{7, 32 * time.Minute},
+		{8, retryMaxDelay},
+		{100, retryMaxDelay},
+	}
+	for _, c := range cases {
+		if got := retryDelay(c.attempts); got != c.want {
+			t.Errorf("retryDelay(%d) = %v, want %v", c.attempts, got, c.want)
+		}
+	}
+}
+
+func TestSendTestSignsRequest(t *testing.T) {
+	type received struct {
+		header http.Header
+		body   []byte
+	}
+	got := make(chan received, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got <- received{r.Header.Clone(), body}
+		w.Write([]byte("ok"))
+	}))
+	defer receiver.Close()
+
+	s := NewService(dbtest.Open(t))
+	key, h, err := s.Create("admin", CreateWebhookRequest{
+		Name:       "receiver",
+		URL:        receiver.URL,
+		Secret:     "whsec_test",
+		EventTypes: []string{"create"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := s.SendTest(h.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Status != DeliverySuccess || d.ResponseStatus != http.StatusOK || d.Attempts != 1 {
+		t.Fatalf("delivery = %+v, want one successful attempt", d)
+	}
+
+	req := <-got
+	want := "sha256=" + Sign(key, req.header.Get(headerTimestamp), req.body)
+	if sig := req.header.Get(headerSignature); sig != want {
+		t.Fatalf("signature = %q, want %q", sig, want)
+	}
+	if req.header.Get(headerEvent) != EventPing {
+		t.Fatalf("event header = %q", req.header.Get(headerEvent))
+	}
+}
@@ -0,0 +1,115 @@
+package webhook
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// EventPing 测试投递使用的事件类型
+const EventPing = "ping"
+
+// DeliveryStatus 投递状态
+type DeliveryStatus string
+
+const (
+	DeliveryPending DeliveryStatus = "pending" // 等待投递或重试
+	DeliverySuccess DeliveryStatus = "success"
+	DeliveryFailed  DeliveryStatus = "failed" // 重试次数用尽
+)
+
+// Webhook 出站 Webhook 订阅
+type Webhook struct {
+	ID          int64     `json:"id"`
+	Name        string    `json:"name"`
+	URL         string    `json:"url"`
+	EventTypes  []string  `json:"eventTypes"`
+	EndpointIDs []int64   `json:"endpointIds"` // 为空表示所有主控
+	TagIDs      []int64   `json:"tagIds"`      // 为空表示不按标签过滤
+	Enabled     bool      `json:"enabled"`
+	CreatedBy   string    `json:"createdBy"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+
+	// secret 签名密钥，仅在创建或重新生成时返回一次
+	secret string
+}
+
+// CreateWebhookRequest 创建 Webhook 请求，secret 为空时自动生成
+type CreateWebhookRequest struct {
+	Name        string   `json:"name" validate:"required"`
+	URL         string   `json:"url" validate:"required"`
+	Secret      string   `json:"secret"`
+	EventTypes  []string `json:"eventTypes" validate:"required"`
+	EndpointIDs []int64  `json:"endpointIds"`
+	TagIDs      []int64  `json:"tagIds"`
+	Enabled     *bool    `json:"enabled"`
+}
+
+// UpdateWebhookRequest 更新 Webhook 请求，未提供的字段保持不变；
+// rotateSecret 为 true 时重新生成签名密钥
+type UpdateWebhookRequest struct {
+	Name         *string   `json:"name"`
+	URL          *string   `json:"url"`
+	EventTypes   *[]string `json:"eventTypes"`
+	EndpointIDs  *[]int64  `json:"endpointIds"`
+	TagIDs       *[]int64  `json:"tagIds"`
+	Enabled      *bool     `json:"enabled"`
+	RotateSecret bool      `json:"rotateSecret"`
+}
+
+// Delivery 一次事件投递及最近一次尝试的结果
+type Delivery struct {
+	ID             int64           `json:"id"`
+	WebhookID      int64           `json:"webhookId"`
+	EventID        string          `json:"eventId"`
+	EventType      string          `json:"eventType"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         DeliveryStatus  `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  *time.Time      `json:"nextAttemptAt,omitempty"`
+	ResponseStatus int             `json:"responseStatus"`
+	ResponseBody   string          `json:"responseBody"`
+	Error          string          `json:"error"`
+	DurationMs     int64           `json:"durationMs"`
+	CreatedAt      time.Time       `json:"createdAt"`
+	DeliveredAt    *time.Time      `json:"deliveredAt,omitempty"`
+}
+
+// DeliveryQuery 投递记录查询条件
+type DeliveryQuery struct {
+	WebhookID int64
+	Status    DeliveryStatus
+	Page      int
+	PageSize  int
+}
+
+// DeliveryPage 投递记录分页结果
+type DeliveryPage struct {
+	Deliveries []Delivery `json:"deliveries"`
+	Total      int        `json:"total"`
+	Page       int        `json:"page"`
+	PageSize   int        `json:"pageSize"`
+}
+
+// Payload 投递给订阅方的事件内容
+type Payload struct {
+	EventID    string          `json:"eventId"`
+	Event      string          `json:"event"`
+	OccurredAt time.Time       `json:"occurredAt"`
+	Endpoint   *EndpointRef    `json:"endpoint,omitempty"`
+	Tunnel     *TunnelRef      `json:"tunnel,omitempty"`
+	Data       json.RawMessage `json:"data"`
+}
+
+// EndpointRef 事件所属主控
+type EndpointRef struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+// TunnelRef 事件对应的隧道，主控上存在但尚未同步到面板的实例只有 instanceId
+type TunnelRef struct {
+	ID         int64  `json:"id,omitempty"`
+	Name       string `json:"name,omitempty"`
+	InstanceID string `json:"instanceId"`
+}
@@ -0,0 +1,300 @@
+package webhook
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	log "NodePassDash/internal/log"
+	"NodePassDash/internal/models"
+	"NodePassDash/internal/secret"
+)
+
+// ErrNotFound Webhook 不存在
+var ErrNotFound = errors.New("Webhook 不存在")
+
+// eventTypes 可订阅的事件类型，与 NodePass 主控的 SSE 事件一致
+var eventTypes = map[string]bool{
+	string(models.SSEEventTypeInitial):  true,
+	string(models.SSEEventTypeCreate):   true,
+	string(models.SSEEventTypeUpdate):   true,
+	string(models.SSEEventTypeDelete):   true,
+	string(models.SSEEventTypeShutdown): true,
+	string(models.SSEEventTypeLog):      true,
+}
+
+// Service Webhook 服务：管理订阅，将主控事件写入投递队列并在后台投递
+type Service struct {
+	db     *sql.DB
+	client *http.Client
+
+	// 订阅缓存，事件分发时无需查询数据库
+	mu    sync.RWMutex
+	hooks map[int64]*Webhook
+
+	events chan models.EndpointSSE // 待匹配的主控事件
+	wake   chan struct{}           // 有新的待投递记录
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewService 创建 Webhook 服务实例，调用 Start 后开始投递
+func NewService(db *sql.DB) *Service {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Service{
+		db: db,
+		client: &http.Client{
+			Timeout: requestTimeout,
+		},
+		hooks:  map[int64]*Webhook{},
+		events: make(chan models.EndpointSSE, 1000),
+		wake:   make(chan struct{}, 1),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// List 返回所有 Webhook
+func (s *Service) List() ([]Webhook, error) {
+	rows, err := s.db.Query(`
+		SELECT id, name, url, secret, eventTypes, endpointIds, tagIds, enabled, createdBy, createdAt, updatedAt
+		FROM "Webhook" ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hooks := []Webhook{}
+	for rows.Next() {
+		h, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, *h)
+	}
+	return hooks, rows.Err()
+}
+
+// Get 根据 ID 获取 Webhook
+func (s *Service) Get(id int64) (*Webhook, error) {
+	row := s.db.QueryRow(`
+		SELECT id, name, url, secret, eventTypes, endpointIds, tagIds, enabled, createdBy, createdAt, updatedAt
+		FROM "Webhook" WHERE id = ?`, id)
+	h, err := scanWebhook(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return h, err
+}
+
+// Create 创建 Webhook，返回签名密钥明文（仅此一次）
+func (s *Service) Create(createdBy string, req CreateWebhookRequest) (string, *Webhook, error) {
+	h := &Webhook{
+		Name:        strings.TrimSpace(req.Name),
+		URL:         strings.TrimSpace(req.URL),
+		EventTypes:  req.EventTypes,
+		EndpointIDs: req.EndpointIDs,
+		TagIDs:      req.TagIDs,
+		Enabled:     req.Enabled == nil || *req.Enabled,
+		CreatedBy:   createdBy,
+	}
+	if err := validate(h); err != nil {
+		return "", nil, err
+	}
+	key := req.Secret
+	if key == "" {
+		var err error
+		if key, err = generateSecret(); err != nil {
+			return "", nil, err
+		}
+	}
+
+	stored, err := secret.Protect(key)
+	if err != nil {
+		return "", nil, err
+	}
+	now := time.Now()
+	res, err := s.db.Exec(`
+		INSERT INTO "Webhook" (name, url, secret, eventTypes, endpointIds, tagIds, enabled, createdBy, createdAt, updatedAt)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		h.Name, h.URL, stored, mustJSON(h.EventTypes), mustJSON(h.EndpointIDs), mustJSON(h.TagIDs),
+		h.Enabled, createdBy, now, now)
+	if err != nil {
+		return "", nil, err
+	}
+	id, _ := res.LastInsertId()
+	if err := s.reload(); err != nil {
+		log.Errorf("[Webhook] 刷新订阅缓存失败: %v", err)
+	}
+	h, err = s.Get(id)
+	return key, h, err
+}
+
+// Update 更新 Webhook；重新生成签名密钥时返回新密钥明文，否则返回空字符串
+func (s *Service) Update(id int64, req UpdateWebhookRequest) (string, *Webhook, error) {
+	h, err := s.Get(id)
+	if err != nil {
+		return "", nil, err
+	}
+	if req.Name != nil {
+		h.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.URL != nil {
+		h.URL = strings.TrimSpace(*req.URL)
+	}
+	if req.EventTypes != nil {
+		h.EventTypes = *req.EventTypes
+	}
+	if req.EndpointIDs != nil {
+		h.EndpointIDs = *req.EndpointIDs
+	}
+	if req.TagIDs != nil {
+		h.TagIDs = *req.TagIDs
+	}
+	if req.Enabled != nil {
+		h.Enabled = *req.Enabled
+	}
+	if err := validate(h); err != nil {
+		return "", nil, err
+	}
+
+	// 不重新生成时 secret 参数为 NULL，保留原值
+	var key string
+	var stored interface{}
+	if req.RotateSecret {
+		if key, err = generateSecret(); err != nil {
+			return "", nil, err
+		}
+		if stored, err = secret.Protect(key); err != nil {
+			return "", nil, err
+		}
+	}
+
+	_, err = s.db.Exec(`
+		UPDATE "Webhook" SET name = ?, url = ?, secret = COALESCE(?, secret), eventTypes = ?, endpointIds = ?, tagIds = ?, enabled = ?, updatedAt = ?
+		WHERE id = ?`,
+		h.Name, h.URL, stored, mustJSON(h.EventTypes), mustJSON(h.EndpointIDs), mustJSON(h.TagIDs),
+		h.Enabled, time.Now(), id)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := s.reload(); err != nil {
+		log.Errorf("[Webhook] 刷新订阅缓存失败: %v", err)
+	}
+	h, err = s.Get(id)
+	return key, h, err
+}
+
+// Delete 删除 Webhook 及其投递记录
+func (s *Service) Delete(id int64) error {
+	res, err := s.db.Exec(`DELETE FROM "Webhook" WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	if err := s.reload(); err != nil {
+		log.Errorf("[Webhook] 刷新订阅缓存失败: %v", err)
+	}
+	return nil
+}
+
+// reload 重新加载订阅缓存
+func (s *Service) reload() error {
+	hooks, err := s.List()
+	if err != nil {
+		return err
+	}
+	m := make(map[int64]*Webhook, len(hooks))
+	for i := range hooks {
+		m[hooks[i].ID] = &hooks[i]
+	}
+	s.mu.Lock()
+	s.hooks = m
+	s.mu.Unlock()
+	return nil
+}
+
+// cached 返回缓存中的 Webhook（含签名密钥）
+func (s *Service) cached(id int64) (*Webhook, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	h, ok := s.hooks[id]
+	return h, ok
+}
+
+// validate 校验名称、地址及订阅的事件类型
+func validate(h *Webhook) error {
+	if h.Name == "" {
+		return errors.New("名称不能为空")
+	}
+	u, err := url.Parse(h.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("URL 无效，须为 http:// 或 https:// 开头的完整地址")
+	}
+	if len(h.EventTypes) == 0 {
+		return errors.New("至少订阅一种事件类型")
+	}
+	for _, t := range h.EventTypes {
+		if !eventTypes[t] {
+			return fmt.Errorf("不支持的事件类型: %s", t)
+		}
+	}
+	if h.EndpointIDs == nil {
+		h.EndpointIDs = []int64{}
+	}
+	if h.TagIDs == nil {
+		h.TagIDs = []int64{}
+	}
+	return nil
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanWebhook 扫描一行 Webhook 记录并解密签名密钥
+func scanWebhook(row rowScanner) (*Webhook, error) {
+	var h Webhook
+	var events, endpoints, tags string
+	if err := row.Scan(&h.ID, &h.Name, &h.URL, &h.secret, &events, &endpoints, &tags,
+		&h.Enabled, &h.CreatedBy, &h.CreatedAt, &h.UpdatedAt); err != nil {
+		return nil, err
+	}
+	plain, err := secret.Reveal(h.secret)
+	if err != nil {
+		return nil, err
+	}
+	h.secret = plain
+	h.EventTypes, h.EndpointIDs, h.TagIDs = []string{}, []int64{}, []int64{}
+	_ = json.Unmarshal([]byte(events), &h.EventTypes)
+	_ = json.Unmarshal([]byte(endpoints), &h.EndpointIDs)
+	_ = json.Unmarshal([]byte(tags), &h.TagIDs)
+	return &h, nil
+}
+
+// generateSecret 生成随机签名密钥
+func generateSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+func mustJSON(v interface{}) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
@@ -0,0 +1,17 @@
+package workspace
+
+import "context"
+
+// scopeKey 上下文中存放调用方可见工作区范围的键
+type scopeKey struct{}
+
+// WithScope 将调用方可见的工作区范围写入上下文
+func WithScope(ctx context.Context, scope Scope) context.Context {
+	return context.WithValue(ctx, scopeKey{}, scope)
+}
+
+// ScopeFromContext 从上下文中读取可见范围，未设置时不可见任何工作区
+func ScopeFromContext(ctx context.Context) Scope {
+	scope, _ := ctx.Value(scopeKey{}).(Scope)
+	return scope
+}
@@ -0,0 +1,89 @@
+package workspace
+
+import (
+	"strings"
+	"time"
+)
+
+// DefaultWorkspaceID 默认工作区 ID，升级前的主控与标签均归属于此
+const DefaultWorkspaceID int64 = 1
+
+// Workspace 工作区（租户），主控及其隧道、标签归属于某个工作区
+type Workspace struct {
+	ID            int64     `json:"id"`
+	Name          string    `json:"name"`
+	Description   string    `json:"description"`
+	MemberIDs     []int64   `json:"memberIds"`
+	EndpointCount int       `json:"endpointCount"`
+	CreatedAt     time.Time `json:"createdAt"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+}
+
+// CreateWorkspaceRequest 创建工作区请求
+type CreateWorkspaceRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// UpdateWorkspaceRequest 更新工作区请求
+type UpdateWorkspaceRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// Scope 调用方可见的工作区范围
+// All 为 true 时不做过滤（管理员），否则仅可见 IDs 中的工作区
+type Scope struct {
+	All bool
+	IDs []int64
+}
+
+// AllScope 返回不受限制的可见范围，供管理员与后台任务使用
+func AllScope() Scope {
+	return Scope{All: true}
+}
+
+// Allows 判断指定工作区是否可见
+func (s Scope) Allows(workspaceID int64) bool {
+	if s.All {
+		return true
+	}
+	for _, id := range s.IDs {
+		if id == workspaceID {
+			return true
+		}
+	}
+	return false
+}
+
+// Default 返回创建资源时未指定工作区所使用的默认工作区
+func (s Scope) Default() int64 {
+	if s.All || len(s.IDs) == 0 {
+		return DefaultWorkspaceID
+	}
+	return s.IDs[0]
+}
+
+// Where 返回按工作区过滤的 SQL 条件及参数，column 为工作区 ID 字段
+func (s Scope) Where(column string) (string, []interface{}) {
+	if s.All {
+		return "1 = 1", nil
+	}
+	if len(s.IDs) == 0 {
+		return "0 = 1", nil
+	}
+	args := make([]interface{}, len(s.IDs))
+	for i, id := range s.IDs {
+		args[i] = id
+	}
+	return column + " IN (" + strings.TrimSuffix(strings.Repeat("?,", len(s.IDs)), ",") + ")", args
+}
+
+// EndpointWhere 返回按工作区过滤主控 ID 字段的 SQL 条件，适用于 Tunnel.endpointId 等引用主控的字段
+func (s Scope) EndpointWhere(column string) (string, []interface{}) {
+	if s.All {
+		return "1 = 1", nil
+	}
+	cond, args := s.Where("workspaceId")
+	return column + ` IN (SELECT id FROM "Endpoint" WHERE ` + cond + `)`, args
+}
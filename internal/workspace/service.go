@@ -0,0 +1,271 @@
+package workspace
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+)
+
+// Service 工作区服务
+type Service struct {
+	db *sql.DB
+}
+
+// NewService 创建工作区服务实例
+func NewService(db *sql.DB) *Service {
+	return &Service{db: db}
+}
+
+// ScopeFor 计算用户可见的工作区范围：管理员可见全部，其他用户仅可见所属工作区
+func (s *Service) ScopeFor(userID int64, isAdmin bool) (Scope, error) {
+	if isAdmin {
+		return AllScope(), nil
+	}
+
+	rows, err := s.db.Query(`SELECT workspaceId FROM "WorkspaceMember" WHERE userId = ? ORDER BY workspaceId`, userID)
+	if err != nil {
+		return Scope{}, err
+	}
+	defer rows.Close()
+
+	scope := Scope{IDs: make([]int64, 0)}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return Scope{}, err
+		}
+		scope.IDs = append(scope.IDs, id)
+	}
+	return scope, nil
+}
+
+// ListWorkspaces 获取可见范围内的工作区列表
+func (s *Service) ListWorkspaces(scope Scope) ([]Workspace, error) {
+	cond, args := scope.Where("w.id")
+	rows, err := s.db.Query(`
+		SELECT w.id, w.name, COALESCE(w.description, ''), w.createdAt, w.updatedAt,
+			(SELECT COUNT(*) FROM "Endpoint" e WHERE e.workspaceId = w.id)
+		FROM "Workspace" w
+		WHERE `+cond+`
+		ORDER BY w.id
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	workspaces := make([]Workspace, 0)
+	for rows.Next() {
+		var ws Workspace
+		if err := rows.Scan(&ws.ID, &ws.Name, &ws.Description, &ws.CreatedAt, &ws.UpdatedAt, &ws.EndpointCount); err != nil {
+			return nil, err
+		}
+		workspaces = append(workspaces, ws)
+	}
+	rows.Close()
+
+	for i := range workspaces {
+		members, err := s.members(workspaces[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		workspaces[i].MemberIDs = members
+	}
+	return workspaces, nil
+}
+
+// GetWorkspace 根据 ID 获取工作区
+func (s *Service) GetWorkspace(id int64) (*Workspace, error) {
+	var ws Workspace
+	err := s.db.QueryRow(`
+		SELECT w.id, w.name, COALESCE(w.description, ''), w.createdAt, w.updatedAt,
+			(SELECT COUNT(*) FROM "Endpoint" e WHERE e.workspaceId = w.id)
+		FROM "Workspace" w WHERE w.id = ?
+	`, id).Scan(&ws.ID, &ws.Name, &ws.Description, &ws.CreatedAt, &ws.UpdatedAt, &ws.EndpointCount)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("工作区不存在")
+		}
+		return nil, err
+	}
+	members, err := s.members(id)
+	if err != nil {
+		return nil, err
+	}
+	ws.MemberIDs = members
+	return &ws, nil
+}
+
+// members 获取工作区成员的用户 ID 列表
+func (s *Service) members(workspaceID int64) ([]int64, error) {
+	rows, err := s.db.Query(`SELECT userId FROM "WorkspaceMember" WHERE workspaceId = ? ORDER BY userId`, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make([]int64, 0)
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// CreateWorkspace 创建工作区
+func (s *Service) CreateWorkspace(req CreateWorkspaceRequest) (*Workspace, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, errors.New("工作区名称不能为空")
+	}
+
+	var exists int
+	err := s.db.QueryRow(`SELECT 1 FROM "Workspace" WHERE name = ?`, name).Scan(&exists)
+	if err == nil {
+		return nil, errors.New("工作区名称已存在")
+	} else if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	result, err := s.db.Exec(`
+		INSERT INTO "Workspace" (name, description, createdAt, updatedAt)
+		VALUES (?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+	`, name, req.Description)
+	if err != nil {
+		return nil, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return s.GetWorkspace(id)
+}
+
+// UpdateWorkspace 更新工作区名称与描述
+func (s *Service) UpdateWorkspace(id int64, req UpdateWorkspaceRequest) (*Workspace, error) {
+	if _, err := s.GetWorkspace(id); err != nil {
+		return nil, err
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, errors.New("工作区名称不能为空")
+	}
+
+	var exists int
+	err := s.db.QueryRow(`SELECT 1 FROM "Workspace" WHERE name = ? AND id != ?`, name, id).Scan(&exists)
+	if err == nil {
+		return nil, errors.New("工作区名称已存在")
+	} else if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	if _, err := s.db.Exec(`
+		UPDATE "Workspace" SET name = ?, description = ?, updatedAt = CURRENT_TIMESTAMP WHERE id = ?
+	`, name, req.Description, id); err != nil {
+		return nil, err
+	}
+	return s.GetWorkspace(id)
+}
+
+// DeleteWorkspace 删除工作区，默认工作区和仍包含主控的工作区不可删除
+func (s *Service) DeleteWorkspace(id int64) error {
+	if id == DefaultWorkspaceID {
+		return errors.New("默认工作区不可删除")
+	}
+	ws, err := s.GetWorkspace(id)
+	if err != nil {
+		return err
+	}
+	if ws.EndpointCount > 0 {
+		return errors.New("工作区下仍有主控，请先迁移到其他工作区")
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM "WorkspaceMember" WHERE workspaceId = ?`, id); err != nil {
+		return err
+	}
+	// 标签随工作区回收到默认工作区
+	if _, err := tx.Exec(`UPDATE Tags SET workspace_id = ? WHERE workspace_id = ?`, DefaultWorkspaceID, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM "Workspace" WHERE id = ?`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SetMembers 以覆盖方式设置工作区成员
+func (s *Service) SetMembers(id int64, userIDs []int64) error {
+	if _, err := s.GetWorkspace(id); err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM "WorkspaceMember" WHERE workspaceId = ?`, id); err != nil {
+		return err
+	}
+	for _, userID := range userIDs {
+		var exists int
+		if err := tx.QueryRow(`SELECT 1 FROM "User" WHERE id = ?`, userID).Scan(&exists); err != nil {
+			if err == sql.ErrNoRows {
+				return errors.New("用户不存在")
+			}
+			return err
+		}
+		if _, err := tx.Exec(`
+			INSERT OR IGNORE INTO "WorkspaceMember" (workspaceId, userId, createdAt)
+			VALUES (?, ?, CURRENT_TIMESTAMP)
+		`, id, userID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// AssignEndpoints 将主控（连同其隧道）迁移到指定工作区
+func (s *Service) AssignEndpoints(id int64, endpointIDs []int64) error {
+	if _, err := s.GetWorkspace(id); err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, endpointID := range endpointIDs {
+		res, err := tx.Exec(`UPDATE "Endpoint" SET workspaceId = ?, updatedAt = CURRENT_TIMESTAMP WHERE id = ?`, id, endpointID)
+		if err != nil {
+			return err
+		}
+		if affected, _ := res.RowsAffected(); affected == 0 {
+			return errors.New("主控不存在")
+		}
+	}
+	return tx.Commit()
+}
+
+// EndpointWorkspaceID 获取主控所属的工作区 ID
+func (s *Service) EndpointWorkspaceID(endpointID int64) (int64, error) {
+	var id int64
+	err := s.db.QueryRow(`SELECT workspaceId FROM "Endpoint" WHERE id = ?`, endpointID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, errors.New("主控不存在")
+	}
+	return id, err
+}
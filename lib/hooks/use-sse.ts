@@ -5,6 +5,8 @@ interface SSEOptions {
   onMessage?: (event: any) => void;
   onError?: (error: any) => void;
   onConnected?: () => void;
+  // 断线期间错过的事件已过期，需重新拉取全量数据
+  onResync?: () => void;
 }
 
 // 全局事件订阅 - 用于监听所有系统事件（包括隧道更新、仪表盘更新等）
@@ -29,6 +31,14 @@ export function useGlobalSSE(options: SSEOptions = {}) {
           }
           return;
         }
+
+        // 服务端无法补发断线期间的事件
+        if (data.type === 'resync') {
+          if (options.onResync) {
+            options.onResync();
+          }
+          return;
+        }
         
         if (options.onMessage) {
           options.onMessage(data);
@@ -82,6 +92,14 @@ export function useTunnelSSE(instanceId: string, options: SSEOptions = {}) {
           }
           return;
         }
+
+        // 服务端无法补发断线期间的事件
+        if (data.type === 'resync') {
+          if (options.onResync) {
+            options.onResync();
+          }
+          return;
+        }
         
         if (options.onMessage) {
           options.onMessage(data);
@@ -26,6 +26,22 @@ export function buildApiUrl(path: string): string {
 
 }
 
+/**
+ * 构造 If-Match 请求头，修改隧道、主控配置时须携带资源的配置修订号
+ * @param revision 配置修订号（列表、详情接口返回的 revision 字段）
+ */
+export function ifMatchHeader(revision?: number): Record<string, string> {
+  return revision ? { 'If-Match': `"${revision}"` } : {};
+}
+
+/**
+ * 从响应的 ETag 中解析资源最新的配置修订号
+ */
+export function revisionFromResponse(response: Response): number | undefined {
+  const match = response.headers.get('ETag')?.match(/^(?:W\/)?"(\d+)"$/);
+  return match ? Number(match[1]) : undefined;
+}
+
 // 实例缓存
 const instanceCache = new Map<string, { data: Instance; timestamp: number }>();
 const CACHE_TTL = 60000; // 1分钟缓存时间